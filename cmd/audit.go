@@ -0,0 +1,228 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	securityhubtypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"github.com/spf13/cobra"
+)
+
+// A best practice the SCP chain of every account should follow.
+type bestPractice struct {
+	name     string
+	severity securityhubtypes.SeverityLabel
+	failure  string // what failing the check means
+	passes   func(chain []scp.Level) bool
+}
+
+// The best practices audited, in the order they are reported.
+var bestPractices = []bestPractice{
+	{
+		name:     "deny-leave-organization",
+		severity: securityhubtypes.SeverityLabelHigh,
+		failure:  "Nothing denies leaving the organization",
+		passes:   deniesActions("organizations:LeaveOrganization"),
+	},
+	{
+		name:     "deny-root-user",
+		severity: securityhubtypes.SeverityLabelHigh,
+		failure:  "Nothing denies the actions of the root user",
+		passes:   deniesRootUser,
+	},
+	{
+		name:     "region-restriction",
+		severity: securityhubtypes.SeverityLabelMedium,
+		failure:  "Nothing restricts the regions that can be used",
+		passes:   restrictsRegions,
+	},
+	{
+		name:     "not-allow-all-only",
+		severity: securityhubtypes.SeverityLabelHigh,
+		failure:  "Only allow-all policies apply, nothing limits what principals can do",
+		passes:   func(chain []scp.Level) bool { return !scp.Unrestricted(chain) },
+	},
+	{
+		name:     "cloudtrail-protection",
+		severity: securityhubtypes.SeverityLabelHigh,
+		failure:  "Nothing denies stopping the logging of the CloudTrail trails or deleting them",
+		passes:   deniesActions("cloudtrail:StopLogging", "cloudtrail:DeleteTrail"),
+	},
+}
+
+// newAuditCmd creates the aws audit command.
+func newAuditCmd(deps *dependencies) *cobra.Command {
+	var ouID string // OU whose accounts are audited, the whole org if empty
+	auditCmd := &cobra.Command{
+		Use:         "audit",
+		Short:       "Checks the SCPs of every account against common best practices and scores the org",
+		Annotations: map[string]string{findingsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditBestPractices(cmd.Context(), deps, ouID)
+		},
+	}
+
+	auditCmd.Flags().StringVar(&ouID, "ou-id", "", "OU ID whose accounts are audited (defaults to the org root)")
+
+	return auditCmd
+}
+
+// auditBestPractices runs every best-practice check on the SCP chain of every
+// account, reporting whether each account passes them all, how many accounts
+// pass each check and the share of passed checks as the overall score. The
+// management account is left out since SCPs never apply to it.
+func auditBestPractices(ctx context.Context, deps *dependencies, startOUID string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	startID, err := getStartingID(ctx, client, startOUID)
+	if err != nil {
+		return err
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	accountIDs, err := listAccountsInSubtree(ctx, client, startID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(deps.report, "Best-practice checks of the SCPs of every account (the management account is not affected by SCPs):")
+	checked, passedChecks := 0, 0
+	passedBy := map[string]int{} // accounts passing each check, by name
+	var findings []auditFinding
+	for _, id := range accountIDs {
+		if id == managementAccountID {
+			continue
+		}
+		checked++
+
+		chain, err := getPolicyChain(ctx, client, id, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return err
+		}
+		account := chain[len(chain)-1]
+
+		var failing []string
+		for _, practice := range bestPractices {
+			stop := deps.profile.time(checkPhase, practice.name)
+			passed := practice.passes(chain)
+			stop()
+			if passed {
+				passedBy[practice.name]++
+				passedChecks++
+				continue
+			}
+			failing = append(failing, practice.name)
+			findings = append(findings, auditFinding{
+				check:        "audit/" + practice.name,
+				severity:     practice.severity,
+				title:        fmt.Sprintf("Account %s fails the %s best practice", account.TargetName, practice.name),
+				description:  fmt.Sprintf("%s in account %s [%s].", practice.failure, account.TargetName, account.TargetID),
+				resourceType: accountResource,
+				resourceID:   accountResourceID(id),
+			})
+		}
+
+		if len(failing) == 0 {
+			fmt.Fprintf(deps.report, "|-- PASS Account: %s [%s]\n", account.TargetName, account.TargetID)
+		} else {
+			fmt.Fprintf(deps.report, "|-- FAIL Account: %s [%s] (failing: %s)\n", account.TargetName, account.TargetID, strings.Join(failing, ", "))
+		}
+	}
+
+	if checked == 0 {
+		fmt.Fprintln(deps.report, "No account to audit")
+		return publishFindings(ctx, deps, "aws audit", findings)
+	}
+
+	fmt.Fprintln(deps.report, "Accounts passing each check:")
+	for _, practice := range bestPractices {
+		fmt.Fprintf(deps.report, "|-- %s: %d of %d accounts\n", practice.name, passedBy[practice.name], checked)
+	}
+	total := checked * len(bestPractices)
+	score := int(math.Round(100 * float64(passedChecks) / float64(total)))
+	fmt.Fprintf(deps.report, "Overall score: %d/100 (%d of %d checks passed)\n", score, passedChecks, total)
+
+	return publishFindings(ctx, deps, "aws audit", findings)
+}
+
+// Passes when every action is denied somewhere in the chain, even if only under
+// some conditions (e.g. except for a break-glass role).
+func deniesActions(actions ...string) func(chain []scp.Level) bool {
+	return func(chain []scp.Level) bool {
+		for _, action := range actions {
+			explanation := scp.Explain(chain, action)
+			if explanation.DeniedBy == nil && len(explanation.ConditionalDenies) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Passes when a deny statement applies to the root user, i.e. its condition
+// matches a principal ARN like arn:aws:iam::*:root.
+func deniesRootUser(chain []scp.Level) bool {
+	return anyDeny(chain, func(statement scp.Statement) bool {
+		for _, keys := range statement.Condition {
+			for key, values := range keys {
+				if !strings.EqualFold(key, "aws:PrincipalArn") {
+					continue
+				}
+				for _, value := range values {
+					if strings.HasSuffix(value, ":root") {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	})
+}
+
+// Passes when a deny statement applies outside of a set of regions, i.e. its
+// condition is a negated match on aws:RequestedRegion.
+func restrictsRegions(chain []scp.Level) bool {
+	return anyDeny(chain, func(statement scp.Statement) bool {
+		for operator, keys := range statement.Condition {
+			if !strings.Contains(operator, "Not") {
+				continue
+			}
+			for key := range keys {
+				if strings.EqualFold(key, "aws:RequestedRegion") {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// Reports whether a deny statement of the chain satisfies match.
+func anyDeny(chain []scp.Level, match func(scp.Statement) bool) bool {
+	for _, level := range chain {
+		for _, policy := range level.Policies {
+			for _, statement := range policy.Document.Statement {
+				if statement.Effect == scp.Deny && match(statement) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
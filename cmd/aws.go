@@ -9,13 +9,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/organizations"
-	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // Default indentation increment to build a tree like output.
@@ -25,9 +24,12 @@ const indent string = "    "
 type outputFormat string
 
 const (
-	text outputFormat = "text" //nolint:unused
-	json outputFormat = "json" //nolint:unused
-	dot  outputFormat = "dot"  //nolint:unused
+	textFormat   outputFormat = "text"   //nolint:unused
+	jsonFormat   outputFormat = "json"   //nolint:unused
+	dotFormat    outputFormat = "dot"    //nolint:unused
+	csvFormat    outputFormat = "csv"    //nolint:unused
+	cypherFormat outputFormat = "cypher" //nolint:unused
+	yamlFormat   outputFormat = "yaml"   //nolint:unused
 )
 
 // String is used both by fmt.Print and by Cobra in help text.
@@ -38,11 +40,11 @@ func (e *outputFormat) String() string {
 // Set must have pointer receiver so it doesn't change the value of a copy.
 func (e *outputFormat) Set(v string) error {
 	switch v {
-	case "text", "json", "dot":
+	case "text", "json", "dot", "csv", "cypher", "yaml":
 		*e = outputFormat(v)
 		return nil
 	default:
-		return errors.New(`must be one of "text", "json", or "dot"`)
+		return errors.New(`must be one of "text", "json", "dot", "csv", "cypher", or "yaml"`)
 	}
 }
 
@@ -57,430 +59,359 @@ func outputFormatCompletion(cmd *cobra.Command, args []string, toComplete string
 		"text\tdisplays results as a text based tree in yout terminal",
 		"json\tdisplays results formatted in json",
 		"dot\tgenerates a dot file with the results",
+		"csv\tdisplays one row per account, formatted in csv",
+		"cypher\tgenerates the Cypher statements loading the org graph into Neo4j",
 	}, cobra.ShellCompDirectiveDefault
 }
 
-// awsCmd represents the aws command.
-var (
-	accountID string // AWS account ID that wil be verified
-	format    outputFormat
-	awsCmd    = &cobra.Command{
+// treeOptions are the flags of the aws tree and aws account commands, and of
+// the deprecated aws --account-id.
+type treeOptions struct {
+	renderOptions
+	accountID string // AWS account ID that will be verified, "all" for the whole tree
+	ouID      string // OU ID where the traversal starts, the org root is used if empty
+	resume    bool   // continue an interrupted scan from its checkpoint
+	checkFile string // where the checkpoint of an interrupted scan is written
+}
+
+// newAwsCmd creates the group of AWS commands.
+func newAwsCmd(deps *dependencies) *cobra.Command {
+	options := &treeOptions{renderOptions: renderOptions{format: textFormat}}
+	awsCmd := &cobra.Command{
 		Use:   "aws",
 		Short: "Entrypoint for all AWS interactions",
+		// "aws --account-id <id> -o <format>" predates the subcommands, it keeps
+		// working with its hidden flags
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return describeAccount(accountID)
+			if !cmd.Flags().Changed("account-id") {
+				return cmd.Help()
+			}
+			if !cmd.Flags().Changed("output-format") {
+				return errors.New(`required flag(s) "output-format" not set`)
+			}
+			fmt.Fprintln(deps.stderr, `"aws --account-id" is deprecated, use "aws tree" or "aws account <account-id>" instead`)
+			return describeAccount(cmd.Context(), deps, options)
 		},
 	}
-)
-
-func init() {
-	rootCmd.AddCommand(awsCmd)
 
-	// Not using shorthand value for account id for the sake of UX
-	awsCmd.Flags().StringVar(&accountID, "account-id", "", "aws account ID that will be analyzed")
-	awsCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+	awsCmd.Flags().StringVar(&options.accountID, "account-id", "", "aws account ID that will be analyzed")
+	addTreeFlags(awsCmd, &deps.options, options)
+	awsCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		awsCmd.Flags().MarkHidden(flag.Name) //nolint:gosec,errcheck
+	})
 
-	awsCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json", "dot"`)
-	awsCmd.MarkFlagRequired("output-format") //nolint:gosec,errcheck
+	// Available to every aws subcommand
+	run := &deps.options
+	awsCmd.PersistentFlags().StringVar(&run.roleARN, "role-arn", "", "ARN of an audit role to assume, used to analyze an external organization")
+	awsCmd.PersistentFlags().StringVar(&run.externalID, "external-id", "", "external ID required to assume the audit role")
+	awsCmd.PersistentFlags().StringArrayVar(&run.namingConventions, "naming-convention", nil,
+		"naming convention of the SCPs, e.g. 'scp-<category>-<nn>', used to group policies by category (repeatable)")
+	awsCmd.PersistentFlags().StringVar(&run.sortKey, "sort", orgtree.SortByName, `order of the OUs and accounts below every node: "name", "id" or "none" (API order)`)
+	awsCmd.PersistentFlags().StringVar(&run.treeStyleName, "tree-style", "flat", `how the branches of the text tree are drawn: "flat", "ascii", "unicode" or "compact"`)
+
+	awsCmd.AddCommand(newTreeCmd(deps))
+	awsCmd.AddCommand(newAccountCmd(deps))
+
+	awsCmd.AddCommand(newAuditCmd(deps))
+	awsCmd.AddCommand(newBackupPolicyCmd(deps))
+	awsCmd.AddCommand(newCheckCmd(deps))
+	awsCmd.AddCommand(newCompareCmd(deps))
+	awsCmd.AddCommand(newConformCmd(deps))
+	awsCmd.AddCommand(newConsolidateCmd(deps))
+	awsCmd.AddCommand(newDeclarativePolicyCmd(deps))
+	awsCmd.AddCommand(newDelegatedAdminsCmd(deps))
+	awsCmd.AddCommand(newDeniedServicesCmd(deps))
+	awsCmd.AddCommand(newDiffCmd(deps))
+	awsCmd.AddCommand(newDuplicatesCmd(deps))
+	awsCmd.AddCommand(newEffectiveCmd(deps))
+	awsCmd.AddCommand(newExplainCmd(deps))
+	awsCmd.AddCommand(newExportCmd(deps))
+	awsCmd.AddCommand(newHistoryCmd(deps))
+	awsCmd.AddCommand(newLintCmd(deps))
+	awsCmd.AddCommand(newMetricsCmd(deps))
+	awsCmd.AddCommand(newAwsOrgCmd(deps))
+	awsCmd.AddCommand(newOrgsCmd(deps))
+	awsCmd.AddCommand(newPoliciesCmd(deps))
+	awsCmd.AddCommand(newPolicyCmd(deps))
+	awsCmd.AddCommand(newReconcileCmd(deps))
+	awsCmd.AddCommand(newScoreCmd(deps))
+	awsCmd.AddCommand(newSimulateCmd(deps))
+	awsCmd.AddCommand(newSnapshotCmd(deps))
+	awsCmd.AddCommand(newStatsCmd(deps))
+	awsCmd.AddCommand(newTagPolicyCmd(deps))
+	awsCmd.AddCommand(newUnrestrictedCmd(deps))
+	awsCmd.AddCommand(newWhichCmd(deps))
+	awsCmd.AddCommand(newWhoCanCmd(deps))
+
+	return awsCmd
 }
 
-// describeAccount computes the information requested from the target AWS account.
-func describeAccount(targetAccountID string) error {
-	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return err
-	}
-
-	// Creating organizations client with local AWS config
-	client := organizations.NewFromConfig(cfg)
-
-	// Get the root ID of AWS the organization
-	rootID, err := getRootID(client)
-	if err != nil {
-		return fmt.Errorf("couldn't get organization's root ID: %v", err)
-	}
-
-	// Make sure the output is properly formatted
-	switch format {
-	case "dot":
-		return displayOrganizationTreeDot()
-	case "json":
-		return displayOrganizationTreeJSON()
-	default: // (text) Using default even though format is an enum to prevent an LSP error (missing return)
-		return displayOrganizationTreeText(client, targetAccountID, rootID, "", map[string]bool{})
+// newTreeCmd creates the aws tree command.
+func newTreeCmd(deps *dependencies) *cobra.Command {
+	options := &treeOptions{renderOptions: renderOptions{format: textFormat}}
+	treeCmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Displays the tree of the organization (or of an OU) with the policies applied to every account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return describeAccount(cmd.Context(), deps, options)
+		},
 	}
-}
-
-// TODO. JSON Output implementation.
-func displayOrganizationTreeJSON() error {
-	fmt.Println("JSON Output")
-	return nil
-}
 
-// TODO. Dot (graphviz) Output implementation.
-func displayOrganizationTreeDot() error {
-	fmt.Println("Dot Output")
-	return nil
-}
+	// Not using shorthand value for account id for the sake of UX
+	treeCmd.Flags().StringVar(&options.accountID, "account-id", "all", `aws account ID whose path is displayed, "all" for the whole tree`)
+	addTreeFlags(treeCmd, &deps.options, options)
 
-// Text based output.
-func displayOrganizationTreeText(client *organizations.Client, targetAccountID, rootID, prefix string, visited map[string]bool) error {
-	if strings.ToLower(targetAccountID) == "all" {
-		fmt.Printf("%s|-- Root: [%s]\n", prefix, rootID)
-		return printEntireOrg(client, rootID, prefix+indent, visited)
-	} else {
-		return printPathToAccount(client, rootID, targetAccountID)
-	}
+	return treeCmd
 }
 
-func printPathToAccount(client *organizations.Client, rootID string, targetAccountID string) error {
-	type node struct {
-		path []string
-		id   string
-	}
-
-	// Org processing will start from the root node (id: r-xxxxx).
-	toBeProcessed := []node{
-		{
-			path: []string{rootID},
-			id:   rootID,
+// newAccountCmd creates the aws account command.
+func newAccountCmd(deps *dependencies) *cobra.Command {
+	options := &treeOptions{renderOptions: renderOptions{format: textFormat}}
+	accountCmd := &cobra.Command{
+		Use:   "account <account-id>",
+		Short: "Displays the path from the root to an account with the policies applied to it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.EqualFold(args[0], "all") {
+				return errors.New(`use "aws tree" to display every account`)
+			}
+			options.accountID = args[0]
+			return describeAccount(cmd.Context(), deps, options)
 		},
 	}
 
-	// While we still have nodes to process
-	for len(toBeProcessed) > 0 {
-		// Pull the next node from the processing queue
-		currentNode := toBeProcessed[0]
-		toBeProcessed = toBeProcessed[1:]
+	addTreeFlags(accountCmd, &deps.options, options)
 
-		// List accounts
-		childAccounts, err := listChildren(client, currentNode.id, types.ChildTypeAccount)
-		if err != nil {
-			return fmt.Errorf("error listing accounts: %w", err)
-		}
-
-		// List organizational units
-		childOUs, err := listChildren(client, currentNode.id, types.ChildTypeOrganizationalUnit)
-		if err != nil {
-			return fmt.Errorf("error listing organizational units: %w", err)
-		}
-
-		// Check if the target account ID is among the children
-		for _, child := range childAccounts {
-			childID := *child.Id
-			// tracking path from root node
-			newPath := append(currentNode.path, childID) // nolint:gocritic
-
-			// If the current child matches the target ID, return the path
-			if childID == targetAccountID {
-				prefix := ""
-				for _, id := range newPath {
-					// to get account and OU names
-					name, err := getNameByID(client, id)
-					if err != nil {
-						return fmt.Errorf("error getting name for id [%s]: %v", id, err)
-					}
-					// displays tree like output
-					switch {
-					case strings.HasPrefix(id, "r-"):
-						fmt.Printf("%s|-- Root: [%s]\n", "", id)
-					case strings.HasPrefix(id, "ou-"):
-						fmt.Printf("%s|-- OU: %s [%s]\n", prefix, name, id)
-					default:
-						// Add an indicator to the account name in case it is the org management account
-						name, err = isManagementAccount(client, id, name)
-						if err != nil {
-							return fmt.Errorf("error determining if the target account %s is the management account: %v", id, err)
-						}
-
-						// list all SCPs applied to the account (inherited and directly applied)
-						scpNames, err := listSCPsforTargetID(client, id)
-						if err != nil {
-							return fmt.Errorf("error getting SCPs for account %s: %v", childID, err)
-						}
-
-						fmt.Printf("%s|-- Account: %s [%s] (SCPs: %s)\n", prefix, name, id, strings.Join(scpNames, ", "))
-					}
-					prefix += "    "
-				}
-				return nil
-			}
-		}
-
-		for _, child := range childOUs {
-			childID := *child.Id
-			// tracking path from root node.
-			newPath := append(currentNode.path, childID) // nolint:gocritic
-			// Enqueue the child node for further exploration.
-			toBeProcessed = append(toBeProcessed, node{path: newPath, id: childID})
-		}
-	}
-
-	// If the target account ID was not found, return an error.
-	fmt.Printf("Target account ID %s was not found in the organization", targetAccountID)
-	return nil
+	return accountCmd
 }
 
-// Traverses the org tree using BFS and prints it completely.
-func printEntireOrg(client *organizations.Client, rootID, prefix string, visited map[string]bool) error {
-	toBeProcessed := []string{rootID}
+// Adds the flags shared by the commands displaying the tree of the organization.
+// The scope and the details of the nodes apply to the whole run.
+func addTreeFlags(cmd *cobra.Command, run *runOptions, options *treeOptions) {
+	cmd.Flags().StringVar(&options.ouID, "ou-id", "", "OU ID used as the starting point of the analysis (defaults to the org root)")
 
-	for len(toBeProcessed) > 0 {
-		parentID := toBeProcessed[0]
-		toBeProcessed = toBeProcessed[1:]
+	cmd.Flags().VarP(&options.format, "output-format", "o", `valid output formats are: "text", "json", "dot", "csv", "cypher", "yaml"`)
 
-		// List accounts
-		childAccounts, err := listChildren(client, parentID, types.ChildTypeAccount)
-		if err != nil {
-			return fmt.Errorf("error listing accounts: %w", err)
-		}
+	cmd.Flags().StringArrayVar(&run.scope.excludeOUs, "exclude-ou", nil, "OU ID or glob pattern on OU names to omit, along with its subtree (repeatable)")
+	cmd.Flags().StringArrayVar(&run.scope.excludeAccounts, "exclude-account", nil, "account ID or glob pattern on account names to omit (repeatable)")
+	cmd.Flags().BoolVar(&run.scope.onlyActive, "only-active", false, "omit the SUSPENDED and PENDING_CLOSURE accounts")
+	cmd.Flags().BoolVar(&run.scope.onlySuspended, "only-suspended", false, "only include the SUSPENDED and PENDING_CLOSURE accounts")
+	cmd.MarkFlagsMutuallyExclusive("only-active", "only-suspended")
 
-		// List organizational units
-		childOUs, err := listChildren(client, parentID, types.ChildTypeOrganizationalUnit)
-		if err != nil {
-			return fmt.Errorf("error listing organizational units: %w", err)
-		}
+	cmd.Flags().BoolVar(&options.showPolicyIDs, "show-policy-ids", false, "display policy IDs and ARNs next to their names in the text output")
 
-		// Display accounts in a tree-like format.
-		for _, child := range childAccounts {
-			childID := *child.Id
-			// Don't process the same entities (accounts | OUs) more then once.
-			if visited[childID] {
-				continue
-			}
-
-			// The org management account will be highlighted in the resulting dataset.
-			accountName, err := getNameByID(client, childID)
-			if err != nil {
-				return fmt.Errorf("error getting name for id %s: %v", childID, err)
-			}
-
-			// Add an indicator to the account name in case it is the org management account
-			accountName, err = isManagementAccount(client, childID, accountName)
-			if err != nil {
-				return fmt.Errorf("error determining if the target account %s is the management account: %v", childID, err)
-			}
-
-			// list all SCPs applied to the account (inherited and directly applied)
-			scpNames, err := listSCPsforTargetID(client, childID)
-			if err != nil {
-				return fmt.Errorf("error getting SCPs for account %s: %v", childID, err)
-			}
+	cmd.Flags().BoolVar(&options.showDocuments, "show-documents", false, "display the full document of every SCP applied to the accounts")
+	cmd.Flags().IntVar(&run.maxDocumentBytes, "max-document-bytes", 4096, "documents larger than this are truncated, dropping whole statements (0 for no limit)")
+	cmd.Flags().BoolVar(&run.fullDocuments, "full-documents", false, "never truncate documents, regardless of --max-document-bytes")
 
-			fmt.Printf("%s|-- Account: %s [%s] (SCPs: %s)\n", prefix, accountName, childID, strings.Join(scpNames, ", "))
+	cmd.Flags().StringSliceVar(&run.policyTypeNames, "policy-type", nil, `other policy types displayed along with the SCPs: "tag", "backup", "aiservices-opt-out", "declarative-ec2" (repeatable)`)
+	cmd.Flags().BoolVar(&run.showEffectivePolicies, "show-effective-policies", false, "display the effective policy of every account for the types given with --policy-type")
 
-			// Mark the account as processed
-			visited[childID] = true
-		}
-
-		// Display OUs in a tree-like format
-		for _, child := range childOUs {
-			childID := *child.Id
-			if visited[childID] {
-				continue
-			}
+	cmd.Flags().StringArrayVar(&run.inheritTagKeys, "inherit-tag", nil, "tag key copied from the OUs down to their accounts in the json and csv outputs, along with its source (repeatable)")
+	cmd.Flags().BoolVar(&run.alternateContacts, "alternate-contacts", false, "include the security, billing and operations alternate contacts of every account (Account Management API)")
 
-			ouName, err := getNameByID(client, childID)
-			if err != nil {
-				return fmt.Errorf("error getting name for id %s: %v", childID, err)
-			}
-
-			fmt.Printf("%s|-- OU: %s [%s]\n", prefix, ouName, childID)
-
-			// Mark the OU as processed
-			visited[childID] = true
+	cmd.Flags().BoolVar(&options.resume, "resume", false, "continue an interrupted scan using its checkpoint")
+	cmd.Flags().StringVar(&options.checkFile, "checkpoint-file", defaultCheckpointFile, "file where the progress of an interrupted scan is saved")
+}
 
-			// Add child OU to the queue for further processing
-			// Only the OU nodes have children (another OUs or member accounts)
-			toBeProcessed = append(toBeProcessed, childID)
+// describeAccount computes the information requested from the target AWS account.
+// If the scan is interrupted (or fails half way) the API results gathered so far are
+// saved as a checkpoint, so it can be continued later with --resume.
+func describeAccount(ctx context.Context, deps *dependencies, options *treeOptions) error {
+	key, err := scanCheckpointKey(ctx, deps, options)
+	if err != nil {
+		return err
+	}
 
-			// // Make a recursive call with an updated prefix and processedEntities
-			if err := printEntireOrg(client, childID, prefix+"    ", visited); err != nil {
-				return err
-			}
+	checkFile := options.checkFile
+	if options.resume {
+		if err := deps.cache.loadCheckpoint(checkFile, key); err != nil {
+			return fmt.Errorf("couldn't resume from checkpoint %s: %w", checkFile, err)
 		}
 	}
-	return nil
-}
 
-// Lists all children of current node. childtype determines whether we return accounts or OUs.
-func listChildren(client *organizations.Client, parentID string, childType types.ChildType) ([]types.Child, error) {
-	input := &organizations.ListChildrenInput{
-		ParentId:  &parentID,
-		ChildType: childType,
+	err = scanAccount(ctx, deps, options)
+	var notFound accountNotFoundError
+	if errors.As(err, &notFound) {
+		// The scan is complete, the account is just not there
+		if removeErr := removeCheckpoint(checkFile); removeErr != nil {
+			return removeErr
+		}
+		return err
 	}
-
-	result, err := client.ListChildren(context.TODO(), input)
 	if err != nil {
-		return nil, err
+		if deps.cache.empty() {
+			return err
+		}
+		if saveErr := deps.cache.saveCheckpoint(checkFile, key); saveErr != nil {
+			return fmt.Errorf("%w (couldn't save checkpoint: %v)", err, saveErr)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("scan interrupted, progress saved to %s (rerun with --resume to continue)", checkFile)
+		}
+		return fmt.Errorf("%w (progress saved to %s, rerun with --resume to continue)", err, checkFile)
 	}
 
-	return result.Children, nil
+	// The scan is complete, an old checkpoint would only lead to stale results
+	return removeCheckpoint(checkFile)
 }
 
-// To obtain more account metadata.
-func getAccount(client *organizations.Client, accountID string) (*types.Account, error) {
-	input := &organizations.DescribeAccountInput{
-		AccountId: &accountID,
-	}
-
-	result, err := client.DescribeAccount(context.TODO(), input)
+// Describes the scan for its checkpoint: the organization, the role used to
+// reach it, the starting OU and the policy types displayed with the SCPs.
+func scanCheckpointKey(ctx context.Context, deps *dependencies, options *treeOptions) (checkpointKey, error) {
+	policyTypes, err := resolvePolicyTypes(deps.options.policyTypeNames)
 	if err != nil {
-		return nil, err
+		return checkpointKey{}, err
 	}
-
-	return result.Account, nil
-}
-
-// To obtain more OU metadata.
-func getOU(client *organizations.Client, ouID string) (*types.OrganizationalUnit, error) {
-	input := &organizations.DescribeOrganizationalUnitInput{
-		OrganizationalUnitId: &ouID,
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return checkpointKey{}, err
 	}
-
-	result, err := client.DescribeOrganizationalUnit(context.TODO(), input)
+	org, err := client.scout().Organization(ctx)
 	if err != nil {
-		return nil, err
+		return checkpointKey{}, err
 	}
 
-	return result.OrganizationalUnit, nil
+	key := checkpointKey{OrganizationID: *org.Id, RoleARN: deps.options.roleARN, OUID: options.ouID}
+	for _, pt := range policyTypes {
+		key.PolicyTypes = append(key.PolicyTypes, string(pt.policyType))
+	}
+	slices.Sort(key.PolicyTypes)
+	key.PolicyTypes = slices.Compact(key.PolicyTypes)
+	return key, nil
 }
 
-// Lists all the SCPs directly attached to targetID (OU or account).
-func listSCPsForTarget(client *organizations.Client, targetID string) ([]types.PolicySummary, error) {
-	input := &organizations.ListPoliciesForTargetInput{
-		TargetId: &targetID,
-		Filter:   types.PolicyTypeServiceControlPolicy,
+// scanAccount runs the analysis of the target account and displays the results.
+func scanAccount(ctx context.Context, deps *dependencies, options *treeOptions) error {
+	run := &deps.options
+	var err error
+	if run.namingPatterns, err = compileNamingConventions(run.namingConventions); err != nil {
+		return err
+	}
+	if run.selectedPolicyTypes, err = resolvePolicyTypes(run.policyTypeNames); err != nil {
+		return err
 	}
 
-	result, err := client.ListPoliciesForTarget(context.TODO(), input)
+	// Organizations client of the local AWS config (or of the external org audit role)
+	client, err := deps.orgClient(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return result.Policies, nil
-}
-
-// Decides whether accountID corresponds to the management acccount of the org.
-func isManagementAccount(client *organizations.Client, accountID, accountName string) (string, error) {
-	input := &organizations.DescribeOrganizationInput{}
-
-	result, err := client.DescribeOrganization(context.TODO(), input)
+	// Get the ID of the node where the traversal starts (org root unless scoped to an OU)
+	rootID, err := getStartingID(ctx, client, options.ouID)
 	if err != nil {
-		return "", fmt.Errorf("error describing organization: %v", err)
+		return err
 	}
 
-	if *result.Organization.MasterAccountId == accountID {
-		accountName += " (Management Account)"
+	// Results of an external org are labeled with its org ID (structured formats always include it)
+	if run.roleARN != "" && options.format == textFormat {
+		label, err := organizationLabel(ctx, client)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(deps.report, label)
 	}
-	return accountName, nil
-}
 
-// Get root ID deom your AWS.
-func getRootID(client *organizations.Client) (string, error) {
-	roots, err := client.ListRoots(context.TODO(), &organizations.ListRootsInput{})
+	// The tree is built once and written by the renderer of the output format
+	renderer, err := newTreeRenderer(ctx, run, client, options.renderOptions)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	if len(roots.Roots) == 0 {
-		return "", fmt.Errorf("no roots found in the organization")
+	tree, err := buildOrganizationTree(ctx, client, options.accountID, rootID)
+	if err != nil {
+		return err
 	}
-
-	return *roots.Roots[0].Id, nil
-}
-
-// Obtains resource name given its ID. Useful for returning info to the users.
-func getNameByID(client *organizations.Client, entityID string) (string, error) {
-	// Check if the entityID is a valid AWS account ID
-	if _, err := strconv.Atoi(entityID); err == nil && len(entityID) == 12 {
-		account, err := getAccount(client, entityID)
-		if err != nil {
-			return "", fmt.Errorf("error getting account: %w", err)
+	if options.showDocuments {
+		if err := addDocuments(ctx, client, tree.Root); err != nil {
+			return err
 		}
-		return *account.Name, nil
-	} else if strings.HasPrefix(entityID, "r-") {
-		return "Root", nil
-	} else {
-		// Assume it's an organizational unit
-		ou, err := getOU(client, entityID)
+	}
+	if run.alternateContacts {
+		accounts, err := deps.accountClient(ctx)
 		if err != nil {
-			return "", fmt.Errorf("error getting OU: %w", err)
+			return err
+		}
+		if err := addAlternateContacts(ctx, accounts, tree.Root); err != nil {
+			return err
 		}
-		return *ou.Name, nil
 	}
+	return renderer.Render(deps.report, tree)
 }
 
-// Recursive function to list all SCPs associated with a child and its parent OUs.
-func listAllSCPsForChild(client *organizations.Client, childID string) ([]types.PolicySummary, error) {
-	var allSCPs []types.PolicySummary
-
-	// List SCPs directly attached to the child
-	directSCPs, err := listSCPsForTarget(client, childID)
+// Gets the ID of the management account of the org.
+func getManagementAccountID(ctx context.Context, client orgAPI) (string, error) {
+	org, err := client.scout().Organization(ctx)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	allSCPs = append(allSCPs, directSCPs...)
 
-	// List parent OUs of the child
-	if !strings.HasPrefix(childID, "r-") {
-		parentOUs, err := listParentOUs(client, childID)
+	return *org.MasterAccountId, nil
+}
+
+// Decides where the org traversal starts. Scoping the analysis to an OU subtree
+// avoids walking (and needing permissions on) the rest of the organization.
+func getStartingID(ctx context.Context, client orgAPI, startOUID string) (string, error) {
+	if startOUID == "" {
+		rootID, err := client.scout().RootID(ctx)
 		if err != nil {
-			return nil, err
+			return "", fmt.Errorf("couldn't get organization's root ID: %w", err)
 		}
+		return rootID, nil
+	}
 
-		// Recursively list SCPs for each parent OU
-		for _, ou := range parentOUs {
-			ouSCPs, err := listAllSCPsForChild(client, *ou.Id)
-			if err != nil {
-				return nil, err
-			}
-			allSCPs = append(allSCPs, ouSCPs...)
-		}
+	if !strings.HasPrefix(startOUID, "ou-") {
+		return "", fmt.Errorf("invalid OU ID %q: it must start with \"ou-\"", startOUID)
 	}
 
-	return allSCPs, nil
-}
+	// Make sure the OU exists before starting the traversal
+	if _, err := client.scout().OU(ctx, startOUID); err != nil {
+		return "", fmt.Errorf("couldn't find OU: %w", err)
+	}
 
-// List parent OUs for a given entity ID.
-func listParentOUs(client *organizations.Client, entityID string) ([]types.OrganizationalUnit, error) {
-	var parentOUs []types.OrganizationalUnit
+	return startOUID, nil
+}
 
-	// List parent OUs
-	response, err := client.ListParents(context.TODO(), &organizations.ListParentsInput{
-		ChildId: &entityID,
-	})
-	if err != nil {
-		return nil, err
+// Names of the policies, in the same order.
+func policyNames(policies []orgtree.Policy) []string {
+	names := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		names = append(names, policy.Name)
 	}
+	return names
+}
 
-	// Extract parent OUs from the response
-	for _, ou := range response.Parents {
-		parentOUs = append(parentOUs, types.OrganizationalUnit{Id: ou.Id})
+// Formats the policies applied to an entity for the text output.
+// Names are not unique, so IDs and ARNs can be displayed as well for automation.
+// When naming conventions are given, policies are grouped by category.
+func (r textRenderer) formatPolicies(policies []orgtree.Policy) string {
+	if len(r.naming) == 0 {
+		return r.formatPolicyList(policies)
 	}
 
-	return parentOUs, nil
-}
-
-// List ALL(inherited and directly applied) SCPs for target ID.
-// Also dedups as needed.
-func listSCPsforTargetID(client *organizations.Client, entityID string) ([]string, error) {
-	allSCPs, err := listAllSCPsForChild(client, entityID)
-	if err != nil {
-		return nil, fmt.Errorf("error listing SCPs: %w", err)
+	categories, groups := r.naming.group(policies)
+	formatted := make([]string, 0, len(categories))
+	for _, category := range categories {
+		formatted = append(formatted, fmt.Sprintf("%s: %s", category, r.formatPolicyList(groups[category])))
 	}
+	return strings.Join(formatted, "; ")
+}
 
-	// using a map here to remove duplicated SCPs (common with inherited policies)
-	// in this case I don't really care about the values, just the keys in the map
-	unique := make(map[string]bool)
-	// just to make it easier to display via strings.Join instead of an additional loop
-	var scpNames []string
-	for _, scp := range allSCPs {
-		if _, ok := unique[*scp.Name]; !ok {
-			unique[*scp.Name] = true
-			scpNames = append(scpNames, *scp.Name)
+// Formats a list of policies, along with their IDs and ARNs if requested.
+func (r textRenderer) formatPolicyList(policies []orgtree.Policy) string {
+	formatted := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		if !r.showPolicyIDs {
+			formatted = append(formatted, r.colors.paint(policyColor, policy.Name))
+			continue
+		}
+		// GCP policies have no ARN, their ID is their resource name
+		if policy.ARN == "" {
+			formatted = append(formatted, fmt.Sprintf("%s [%s]", r.colors.paint(policyColor, policy.Name), policy.ID))
+			continue
 		}
+		formatted = append(formatted, fmt.Sprintf("%s [%s, %s]", r.colors.paint(policyColor, policy.Name), policy.ID, policy.ARN))
 	}
-	return scpNames, nil
+	return strings.Join(formatted, ", ")
 }
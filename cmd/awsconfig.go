@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Session name used when assuming the audit role, shows up in the external org's CloudTrail.
+const roleSessionName string = "policy-scout"
+
+// Loads the AWS config used by every command. Standalone accounts and denied
+// calls are detected, the progress is counted and calls are logged on every API
+// call, and calls are timed with --profile-scan.
+func (d *dependencies) loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := loadProviderConfig(ctx, &d.options)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.APIOptions = append(cfg.APIOptions, d.standaloneMiddleware, d.progress.middleware, loggingMiddleware(d.logger, d.now))
+	if d.options.profileScan {
+		cfg.APIOptions = append(cfg.APIOptions, d.profile.middleware)
+	}
+	return cfg, nil
+}
+
+// Loads the local AWS config. If an audit role was provided, the credentials of
+// that role are used instead of the local ones. In demo mode and when running
+// offline from a snapshot, no AWS config is needed at all.
+func loadProviderConfig(ctx context.Context, run *runOptions) (aws.Config, error) {
+	if run.demo || run.snapshotFile != "" {
+		return offlineAWSConfig(), nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if run.roleARN != "" {
+		assumeRole(&cfg, run.roleARN, run.externalID)
+	}
+	return cfg, nil
+}
+
+// Replaces the credentials of cfg with the ones of the role, assumed with them.
+func assumeRole(cfg *aws.Config, roleARN, externalID string) {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = roleSessionName
+		if externalID != "" {
+			o.ExternalID = aws.String(externalID)
+		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+}
+
+// Builds the label identifying the organization being analyzed. Results of an
+// external org must be clearly told apart from the ones of our own org.
+func organizationLabel(ctx context.Context, client orgAPI) (string, error) {
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	label := fmt.Sprintf("Organization: %s", *org.Id)
+	if roleARN := client.options().roleARN; roleARN != "" {
+		label += fmt.Sprintf(" (external, via %s)", roleARN)
+	}
+	return label, nil
+}
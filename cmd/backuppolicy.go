@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/backuppolicy"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newBackupPolicyCmd creates the aws backup-policy command.
+func newBackupPolicyCmd(deps *dependencies) *cobra.Command {
+	var (
+		accountID    string // account whose effective backup policy is displayed, or "all"
+		showDocument bool   // display the merged policy document too
+	)
+	backupPolicyCmd := &cobra.Command{
+		Use:   "backup-policy",
+		Short: "Displays the effective backup plans of accounts and flags the ones without coverage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayEffectiveBackupPolicies(cmd.Context(), deps, accountID, showDocument)
+		},
+	}
+
+	backupPolicyCmd.Flags().StringVar(&accountID, "account-id", "", `aws account ID that will be analyzed, "all" for every account`)
+	backupPolicyCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	backupPolicyCmd.Flags().BoolVar(&showDocument, "show-document", false, "display the merged document of the effective backup policy")
+
+	return backupPolicyCmd
+}
+
+// displayEffectiveBackupPolicies reports, for every account, the backup plans
+// resulting from merging all the backup policies it inherits. Accounts without
+// any effective backup plan are flagged.
+func displayEffectiveBackupPolicies(ctx context.Context, deps *dependencies, targetAccountID string, showDocument bool) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	accountIDs, err := resolveAccountIDs(ctx, client, targetAccountID)
+	if err != nil {
+		return err
+	}
+
+	uncovered := 0
+	for _, id := range accountIDs {
+		name, err := client.scout().Name(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting name for id %s: %w", id, err)
+		}
+
+		content, found, err := getEffectivePolicy(ctx, client, id, types.EffectivePolicyTypeBackupPolicy)
+		if err != nil {
+			return err
+		}
+
+		var effective *backuppolicy.Effective
+		if found {
+			if effective, err = backuppolicy.Parse(content); err != nil {
+				return fmt.Errorf("effective backup policy of %s: %w", id, err)
+			}
+		}
+		if effective == nil || len(effective.Plans) == 0 {
+			uncovered++
+			fmt.Fprintf(deps.report, "|-- Account: %s [%s]: NO BACKUP PLAN COVERAGE\n", name, id)
+			continue
+		}
+
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s]\n", name, id)
+		for _, plan := range effective.Plans {
+			fmt.Fprintf(deps.report, "%s|-- Plan: %s (regions: %s)\n", indent, plan.Name, strings.Join(plan.Regions, ", "))
+			for _, rule := range plan.Rules {
+				fmt.Fprintf(deps.report, "%s%s|-- Rule: %s\n", indent, indent, formatBackupRule(rule))
+			}
+			if len(plan.Selections) > 0 {
+				fmt.Fprintf(deps.report, "%s%s|-- Selections: %s\n", indent, indent, strings.Join(plan.Selections, ", "))
+			}
+		}
+
+		if showDocument {
+			document, err := prettyDocument(content, indent+indent)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(deps.report, "%s|-- Document:\n%s\n", indent, document)
+		}
+	}
+	fmt.Fprintf(deps.report, "%d of %d accounts have no backup plan coverage\n", uncovered, len(accountIDs))
+
+	return nil
+}
+
+// Describes a backup rule, e.g. "Daily: cron(0 5 ? * * *) to vault Main, kept 35 days, copied to arn:...".
+func formatBackupRule(rule backuppolicy.Rule) string {
+	formatted := fmt.Sprintf("%s: %s to vault %s", rule.Name, rule.Schedule, rule.TargetVault)
+	if rule.DeleteAfterDays != "" {
+		formatted += fmt.Sprintf(", kept %s days", rule.DeleteAfterDays)
+	}
+	if len(rule.CopyDestinations) > 0 {
+		formatted += ", copied to " + strings.Join(rule.CopyDestinations, ", ")
+	}
+	return formatted
+}
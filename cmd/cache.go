@@ -0,0 +1,224 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg"
+)
+
+// Default location of the checkpoint written when a scan is interrupted.
+const defaultCheckpointFile string = ".policy-scout-checkpoint.json"
+
+// scanCache keeps the results of the Organizations API calls made during a scan,
+// as JSON documents keyed by call and arguments (see awsorg.Cache). It is
+// persisted as a checkpoint when a scan is interrupted so it can be resumed
+// later without repeating the calls that already succeeded.
+type scanCache struct {
+	mu      sync.Mutex
+	Entries map[string]json.RawMessage
+
+	logger *slog.Logger // logs the hits with --debug
+
+	// Modification time of the warm cache last loaded, to reload it when it changes
+	warmMu       sync.Mutex
+	warmModified time.Time
+}
+
+func newScanCache() *scanCache {
+	return &scanCache{Entries: map[string]json.RawMessage{}}
+}
+
+// Get implements awsorg.Cache.
+func (c *scanCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.Entries[key]
+	kind, _, _ := strings.Cut(key, "/")
+	logCacheHit(c.logger, kind, key, ok)
+	return value, ok
+}
+
+// Set implements awsorg.Cache.
+func (c *scanCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[key] = value
+}
+
+// The documents of the policies and the tags of the resources are cached along
+// with the results of the Scout.
+func cachedDocument(c awsorg.Cache, policyID string) (string, bool) {
+	var document string
+	data, ok := c.Get("document/" + policyID)
+	if !ok || json.Unmarshal(data, &document) != nil {
+		return "", false
+	}
+	return document, true
+}
+
+func cacheDocument(c awsorg.Cache, policyID, document string) {
+	if data, err := json.Marshal(document); err == nil {
+		c.Set("document/"+policyID, data)
+	}
+}
+
+func cachedTags(c awsorg.Cache, resourceID string) (map[string]string, bool) {
+	var tags map[string]string
+	data, ok := c.Get("tags/" + resourceID)
+	if !ok || json.Unmarshal(data, &tags) != nil {
+		return nil, false
+	}
+	return tags, true
+}
+
+func cacheTags(c awsorg.Cache, resourceID string, tags map[string]string) {
+	if data, err := json.Marshal(tags); err == nil {
+		c.Set("tags/"+resourceID, data)
+	}
+}
+
+// Reports whether no API results have been cached yet.
+func (c *scanCache) empty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.Entries) == 0
+}
+
+// Forgets every cached result, so that a long-running server scanning again sees
+// the changes of the organization.
+func (c *scanCache) reset() {
+	fresh := newScanCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries = fresh.Entries
+}
+
+// The scan a checkpoint was written for. A scan only resumes from the
+// checkpoint of the same organization, role, starting OU and policy types,
+// otherwise the results of both scans would be mixed.
+type checkpointKey struct {
+	OrganizationID string   `json:"organizationId"`
+	RoleARN        string   `json:"roleArn,omitempty"`
+	OUID           string   `json:"ouId,omitempty"`
+	PolicyTypes    []string `json:"policyTypes,omitempty"` // sorted
+}
+
+func (k checkpointKey) equal(other checkpointKey) bool {
+	return k.OrganizationID == other.OrganizationID && k.RoleARN == other.RoleARN && k.OUID == other.OUID && slices.Equal(k.PolicyTypes, other.PolicyTypes)
+}
+
+func (k checkpointKey) String() string {
+	description := "organization " + k.OrganizationID
+	if k.RoleARN != "" {
+		description += " via " + k.RoleARN
+	}
+	if k.OUID != "" {
+		description += ", OU " + k.OUID
+	}
+	if len(k.PolicyTypes) > 0 {
+		description += ", policy types " + strings.Join(k.PolicyTypes, ", ")
+	}
+	return description
+}
+
+// What save and saveCheckpoint write.
+type cacheFile struct {
+	Key     *checkpointKey             `json:"key,omitempty"` // only set in checkpoints
+	Entries map[string]json.RawMessage `json:"entries"`
+}
+
+// Writes the cache to path, as a warm cache.
+func (c *scanCache) save(path string) error {
+	return c.write(path, nil)
+}
+
+// Writes the cache to path, as the checkpoint of the scan described by key.
+func (c *scanCache) saveCheckpoint(path string, key checkpointKey) error {
+	return c.write(path, &key)
+}
+
+// The file is written next to its final location first and then renamed, so a
+// second interruption never leaves a truncated checkpoint.
+func (c *scanCache) write(path string, key *checkpointKey) error {
+	c.mu.Lock()
+	data, err := json.Marshal(cacheFile{Key: key, Entries: c.Entries})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Loads a warm cache previously written by save.
+func (c *scanCache) load(path string) error {
+	loaded, err := readCacheFile(path)
+	if err != nil {
+		return err
+	}
+	c.set(loaded.Entries)
+	return nil
+}
+
+// Loads the checkpoint previously written by saveCheckpoint for the scan
+// described by key, refusing the ones of any other scan.
+func (c *scanCache) loadCheckpoint(path string, key checkpointKey) error {
+	loaded, err := readCacheFile(path)
+	if err != nil {
+		return err
+	}
+	if loaded.Key == nil {
+		return fmt.Errorf("it doesn't say which scan it was written for, not resuming %s from it", key)
+	}
+	if !loaded.Key.equal(key) {
+		return fmt.Errorf("it was written for %s, not for %s", loaded.Key, key)
+	}
+	c.set(loaded.Entries)
+	return nil
+}
+
+func readCacheFile(path string) (cacheFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cacheFile{}, err
+	}
+	var loaded cacheFile
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return cacheFile{}, fmt.Errorf("invalid checkpoint file: %w", err)
+	}
+	return loaded, nil
+}
+
+func (c *scanCache) set(entries map[string]json.RawMessage) {
+	if entries == nil {
+		entries = map[string]json.RawMessage{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries = entries
+}
+
+// Removes the checkpoint at path, if any. Called once a scan completes.
+func removeCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
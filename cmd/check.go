@@ -0,0 +1,269 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	securityhubtypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/spf13/cobra"
+)
+
+// checkOptions are the flags of the aws check command.
+type checkOptions struct {
+	regoDir   string // directory of the Rego rules evaluated against the org
+	rulesPath string // YAML file of the rules evaluated against the org
+}
+
+// Rule of the Rego rules collecting their violations, e.g.
+//
+//	package policyscout
+//
+//	violations contains {"rule": "prod-deny-root", "severity": "HIGH", "resource": ou.id, "msg": "..."} if { ... }
+const regoQuery = "data.policyscout.violations"
+
+// A rule broken by the organization, e.g. a production OU without the SCP
+// denying the root user.
+type ruleViolation struct {
+	Rule     string `json:"rule"`
+	Message  string `json:"msg"`
+	Severity string `json:"severity"` // CRITICAL, HIGH, MEDIUM (the default), LOW or INFORMATIONAL
+	Resource string `json:"resource"` // ID of the account, OU, root or policy, the organization if empty
+}
+
+// newCheckCmd creates the aws check command.
+func newCheckCmd(deps *dependencies) *cobra.Command {
+	options := &checkOptions{}
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Evaluates custom rules against a snapshot of the org and reports their violations",
+		Long: `Evaluates custom rules against a snapshot of the org and reports their violations.
+
+The rules of --rules are a YAML file declaring the SCPs (names or IDs, attached
+or inherited) required or forbidden and the tags required on the OUs and
+accounts whose path matches a glob pattern, "*" not matching "/" (e.g.
+/Root/Workloads/Production/* for the children of the Production OU), along
+with the maximum depth of the OUs:
+
+  maxDepth: 4
+  rules:
+    - name: production-guardrails
+      path: /Root/Workloads/Production*
+      severity: HIGH
+      requiredSCPs: [scp-regions-01]
+      forbiddenSCPs: [scp-legacy-01]
+      requiredTags: [CostCenter]
+
+The Rego rules of --rego-dir (Rego v1 syntax, as of OPA 1.0) are evaluated by
+the OPA library embedded in policy-scout, along with the JSON and YAML data
+files of the directory. Their input is the snapshot written by "aws snapshot" (ous, accounts
+and policies with their targets and documents), along with "paths", the path of
+every root, OU and account keyed by ID (e.g. /Root/Workloads/Production). The
+violations are the elements of data.policyscout.violations: objects with the
+"rule", "msg", "severity" and "resource" (an ID) of the violation, or plain
+messages.`,
+		Annotations: map[string]string{findingsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return checkRules(cmd.Context(), deps, options.rulesPath, options.regoDir)
+		},
+	}
+
+	checkCmd.Flags().StringVar(&options.rulesPath, "rules", "", "YAML file of the required and forbidden SCPs per OU path, the required tags and the maximum depth of the OUs")
+	checkCmd.Flags().StringVar(&options.regoDir, "rego-dir", "", "directory of the Rego rules (package policyscout) evaluated against the org")
+	checkCmd.MarkFlagsOneRequired("rules", "rego-dir")
+
+	return checkCmd
+}
+
+// checkRules evaluates the rules of the YAML file and of the Rego directory
+// (either can be empty) against a snapshot of the organization, without the
+// entities out of the scope, and reports their violations, the most severe
+// first.
+func checkRules(ctx context.Context, deps *dependencies, file, dir string) error {
+	var rules *rulesFile
+	var sources []string
+	if file != "" {
+		var err error
+		if rules, err = loadRulesFile(file); err != nil {
+			return err
+		}
+		sources = append(sources, file)
+	}
+	if dir != "" {
+		sources = append(sources, dir)
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, err := captureSnapshot(ctx, client)
+	if err != nil {
+		return err
+	}
+	if err := scopeSnapshot(ctx, client, snapshot); err != nil {
+		return err
+	}
+
+	var violations []ruleViolation
+	if rules != nil {
+		violations = rules.evaluate(snapshot)
+	}
+	if dir != "" {
+		regoViolations, err := evaluateRego(ctx, dir, snapshot)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, regoViolations...)
+	}
+
+	findings := make([]auditFinding, 0, len(violations))
+	for _, violation := range violations {
+		severity, err := parseSeverity(violation.Severity)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", violation.Rule, err)
+		}
+		subject := snapshot.ID
+		if violation.Resource != "" {
+			subject = fmt.Sprintf("%s [%s]", snapshot.name(violation.Resource), violation.Resource)
+		}
+		resourceType, resourceID := snapshot.findingResource(violation.Resource)
+		findings = append(findings, auditFinding{
+			check:        "check/" + violation.Rule,
+			severity:     severity,
+			title:        fmt.Sprintf("%s: %s: %s", violation.Rule, subject, violation.Message),
+			description:  violation.Message,
+			resourceType: resourceType,
+			resourceID:   resourceID,
+			detail:       violation.Message,
+		})
+	}
+
+	printRuleFindings(deps.report, findings, strings.Join(sources, " and "))
+	return publishFindings(ctx, deps, "aws check", findings)
+}
+
+// Prints the violations of the rules, the most severe first.
+func printRuleFindings(w io.Writer, findings []auditFinding, source string) {
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "No violation of the rules of %s\n", source)
+		return
+	}
+	fmt.Fprintf(w, "Violations of the rules of %s:\n", source)
+	for _, finding := range sortBySeverity(findings) {
+		fmt.Fprintf(w, "|-- %s %s\n", finding.severity, finding.title)
+	}
+	fmt.Fprintf(w, "%s violations (%s)\n", formatCount(len(findings)), formatSeverityCounts(findings))
+}
+
+// Evaluates the Rego rules of dir, the snapshot being their input.
+func evaluateRego(ctx context.Context, dir string, snapshot *orgSnapshot) ([]ruleViolation, error) {
+	input, err := regoInput(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	query := rego.New(
+		rego.Query(regoQuery),
+		rego.Load([]string{dir}, nil),
+		rego.SetRegoVersion(ast.RegoV1),
+		rego.Input(input),
+	)
+	// The errors of the rules come with their location
+	results, err := query.Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating the Rego rules: %w", err)
+	}
+	// No result when no rule defines the violations
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil, nil
+	}
+
+	values, ok := results[0].Expressions[0].Value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a set of violations", regoQuery)
+	}
+	var violations []ruleViolation
+	for _, value := range values {
+		violation := ruleViolation{Rule: "rego"}
+		switch value := value.(type) {
+		case string:
+			violation.Message = value
+		case map[string]any:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &violation); err != nil {
+				return nil, fmt.Errorf("invalid violation %s: expected a message or an object with rule, msg, severity and resource", data)
+			}
+		default:
+			return nil, fmt.Errorf("invalid violation %v: expected a message or an object with rule, msg, severity and resource", value)
+		}
+		violations = append(violations, violation)
+	}
+	return violations, nil
+}
+
+// The input of the Rego rules: the snapshot and the path of every entity.
+func regoInput(snapshot *orgSnapshot) (map[string]any, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var input map[string]any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, err
+	}
+
+	paths := map[string]string{snapshot.RootID: snapshot.path(snapshot.RootID)}
+	for _, ou := range snapshot.OUs {
+		paths[ou.ID] = snapshot.path(ou.ID)
+	}
+	for _, account := range snapshot.Accounts {
+		paths[account.ID] = snapshot.path(account.ID)
+	}
+	input["paths"] = paths
+	return input, nil
+}
+
+// Parses the severity of a finding given by a rule, MEDIUM if empty.
+func parseSeverity(severity string) (securityhubtypes.SeverityLabel, error) {
+	if severity == "" {
+		return securityhubtypes.SeverityLabelMedium, nil
+	}
+	label := securityhubtypes.SeverityLabel(strings.ToUpper(severity))
+	if !slices.Contains(severityLabels, label) {
+		return "", fmt.Errorf("invalid severity %q: valid severities are CRITICAL, HIGH, MEDIUM, LOW and INFORMATIONAL", severity)
+	}
+	return label, nil
+}
+
+// The resource of a finding about an entity of the snapshot: an account, or the
+// ARN of a policy, OU or root. The organization when the ID is empty or
+// unknown.
+func (o *orgSnapshot) findingResource(id string) (resourceType, resourceID string) {
+	if _, ok := o.account(id); ok {
+		return accountResource, accountResourceID(id)
+	}
+	if policy, ok := o.policy(id); ok {
+		return policyResource, *o.policySummary(policy).Arn
+	}
+	if id == o.RootID {
+		return rootResource, o.arn("root", id)
+	}
+	if _, ok := o.parent(id); ok {
+		return ouResource, o.arn("ou", id)
+	}
+	return policyResource, o.arn("organization", o.ID)
+}
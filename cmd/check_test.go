@@ -0,0 +1,44 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFindingResource(t *testing.T) {
+	data, err := os.ReadFile(snapshotOf(t, newTestOrg()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := parseSnapshot(data)
+	if err != nil {
+		t.Fatalf("parseSnapshot: %v", err)
+	}
+
+	tests := []struct {
+		id       string
+		wantType string
+		wantID   string
+	}{
+		{"222222222222", "AwsAccount", "AWS::::Account:222222222222"},
+		{"p-denyleave", "Other", "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave"},
+		{"ou-root-work", "AwsOrganizationsOrganizationalUnit", "arn:aws:organizations::111111111111:ou/o-example/ou-root-work"},
+		{"r-root", "Other", "arn:aws:organizations::111111111111:root/o-example/r-root"},
+		{"", "Other", "arn:aws:organizations::111111111111:organization/o-example"},
+		{"ou-root-gone", "Other", "arn:aws:organizations::111111111111:organization/o-example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			gotType, gotID := snapshot.findingResource(tt.id)
+			if gotType != tt.wantType || gotID != tt.wantID {
+				t.Errorf("findingResource(%q) = %s %s, want %s %s", tt.id, gotType, gotID, tt.wantType, tt.wantID)
+			}
+		})
+	}
+}
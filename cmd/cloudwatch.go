@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Namespace of the metrics published to CloudWatch when --cloudwatch-namespace
+// is not given.
+const defaultCloudWatchNamespace = "PolicyScout"
+
+// Metrics published by the commands besides aws metrics.
+const (
+	ungovernedAccountsMetric = "UngovernedAccounts" // aws metrics and aws unrestricted
+	driftMetric              = "DriftCount"         // aws snapshot diff
+)
+
+// Annotation of the commands computing metrics, which can be published to
+// CloudWatch.
+const metricsAnnotation = "metrics"
+
+// cloudWatchAPI is the part of the CloudWatch API used by the commands.
+type cloudWatchAPI interface {
+	PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// Creates the CloudWatch client of the local AWS config.
+func (d *dependencies) newCloudWatchClient(ctx context.Context) (cloudWatchAPI, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cloudwatch.NewFromConfig(cfg), nil
+}
+
+// A metric published to CloudWatch, e.g. the number of ungoverned accounts.
+type cloudWatchMetric struct {
+	name  string
+	unit  cloudwatchtypes.StandardUnit
+	value float64
+}
+
+// Publishes the metrics of a scan to CloudWatch with --publish cloudwatch, under
+// --cloudwatch-namespace with the OrganizationId dimension, so alarms can be set
+// on them.
+func publishMetrics(ctx context.Context, deps *dependencies, orgID string, metrics []cloudWatchMetric) error {
+	if !slices.Contains(deps.options.publishTargets, publishCloudWatch) || len(metrics) == 0 {
+		return nil
+	}
+
+	client, err := deps.cloudWatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := deps.now()
+	data := make([]cloudwatchtypes.MetricDatum, 0, len(metrics))
+	for _, metric := range metrics {
+		data = append(data, cloudwatchtypes.MetricDatum{
+			MetricName: aws.String(metric.name),
+			Unit:       metric.unit,
+			Value:      aws.Float64(metric.value),
+			Timestamp:  aws.Time(now),
+			Dimensions: []cloudwatchtypes.Dimension{{Name: aws.String("OrganizationId"), Value: aws.String(orgID)}},
+		})
+	}
+	if _, err := client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{Namespace: aws.String(deps.options.cloudWatchNamespace), MetricData: data}); err != nil {
+		return fmt.Errorf("error publishing metrics to CloudWatch: %w", err)
+	}
+	fmt.Fprintf(deps.stderr, "%s metrics published to CloudWatch (namespace %s)\n", formatCount(len(data)), deps.options.cloudWatchNamespace)
+	return nil
+}
@@ -0,0 +1,310 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// The AWS SDK version in use predates resource control policies.
+const resourceControlPolicy types.PolicyType = "RESOURCE_CONTROL_POLICY"
+
+//go:embed templates
+var templates embed.FS
+
+// compareOptions are the flags of the aws compare command.
+type compareOptions struct {
+	accountIDs []string // accounts to compare, the first one is the reference
+	outputFile string   // where the HTML report is written, --report-to if empty
+}
+
+// newCompareCmd creates the aws compare command.
+func newCompareCmd(deps *dependencies) *cobra.Command {
+	options := &compareOptions{}
+	compareCmd := &cobra.Command{
+		Use:   "compare",
+		Short: "Generates an HTML report comparing two or more accounts side by side",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return compareAccounts(cmd.Context(), deps, options.accountIDs, options.outputFile)
+		},
+	}
+
+	compareCmd.Flags().StringSliceVar(&options.accountIDs, "account-id", nil, "aws account IDs to compare, the first one is used as the reference (repeatable)")
+	compareCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	compareCmd.Flags().StringVar(&options.outputFile, "output-file", "", "where the HTML report is written, any --report-to destination (defaults to --report-to)")
+
+	return compareCmd
+}
+
+// An entry (root, OU or account) in the path from the org root to an account.
+type pathEntry struct {
+	ID   string
+	Name string
+}
+
+// Status of a policy in a comparison column, relative to the reference account.
+type policyStatus string
+
+const (
+	policyShared  policyStatus = "shared"  // also applied to the reference account
+	policyExtra   policyStatus = "extra"   // not applied to the reference account
+	policyMissing policyStatus = "missing" // applied to the reference account only
+)
+
+type comparedPolicy struct {
+	Name   string
+	Status policyStatus
+}
+
+// A cell of the comparison table: the policies of a given type, or the
+// Identity Center access, of a single account.
+type comparisonCell struct {
+	Unavailable string // why there is nothing to compare, e.g. the policy type is not enabled
+	Policies    []comparedPolicy
+}
+
+// The benchmark score of an account in the comparison table.
+type scoreCell struct {
+	Score  int
+	Delta  int      // difference with the score of the reference account
+	Failed []string // failed governance checks, see governanceChecks
+}
+
+// A row of the comparison table, one per policy type and one for the Identity
+// Center access.
+type comparisonSection struct {
+	Title string
+	Cells []comparisonCell
+}
+
+// Everything the comparison report displays about a single account.
+type accountReport struct {
+	ID         string
+	Name       string
+	Management bool
+	Path       []pathEntry
+	Policies   map[types.PolicyType][]string
+	Disabled   map[types.PolicyType]bool  // policy types not enabled in the org
+	Score      *scoredNode                // benchmark score, see aws score
+	Access     []identityCenterAssignment // who can access the account through Identity Center
+	NoAccess   string                     // why the Identity Center access couldn't be read
+}
+
+// Policy types displayed in the comparison report, in order.
+var comparedPolicyTypes = []struct {
+	policyType types.PolicyType
+	title      string
+}{
+	{types.PolicyTypeServiceControlPolicy, "SCPs"},
+	{resourceControlPolicy, "RCPs"},
+}
+
+// compareAccounts collects the data of every account and renders the HTML report.
+func compareAccounts(ctx context.Context, deps *dependencies, accountIDs []string, outputFile string) error {
+	if len(accountIDs) < 2 {
+		return errors.New("at least two account IDs are required for a comparison")
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	label, err := organizationLabel(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	identityCenter, err := deps.identityCenter(ctx)
+	if err != nil {
+		return err
+	}
+
+	reports := make([]*accountReport, 0, len(accountIDs))
+	for _, id := range accountIDs {
+		report, err := collectAccountReport(ctx, client, rootID, id)
+		if err != nil {
+			return err
+		}
+		report.Management = id == managementAccountID
+
+		report.Score, err = scoreAccount(ctx, deps, client, id, report.Management)
+		if err != nil {
+			return err
+		}
+
+		// Identity Center is optional, and so is the permission to read it
+		report.Access, err = listIdentityCenterAccess(ctx, identityCenter, id)
+		switch {
+		case errors.Is(err, errNoIdentityCenter):
+			report.NoAccess = "Identity Center not enabled"
+		case err != nil:
+			deps.logger.Warn("couldn't read the Identity Center access", "account", id, "error", err)
+			report.NoAccess = "couldn't be read"
+		}
+		reports = append(reports, report)
+	}
+
+	if outputFile == "" {
+		return renderComparison(deps.report, label, reports)
+	}
+
+	out, err := openSink(outputFile, deps)
+	if err != nil {
+		return err
+	}
+	if err := renderComparison(out, label, reports); err != nil {
+		return err
+	}
+	return out.Close(ctx)
+}
+
+// Gathers the OU path and the policies applied to an account.
+func collectAccountReport(ctx context.Context, client orgAPI, rootID, accountID string) (*accountReport, error) {
+	path, err := client.scout().FindAccountPath(ctx, rootID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if path == nil {
+		return nil, accountNotFoundError(accountID)
+	}
+
+	report := &accountReport{
+		ID:       accountID,
+		Policies: map[types.PolicyType][]string{},
+		Disabled: map[types.PolicyType]bool{},
+	}
+
+	for _, id := range path {
+		name, err := client.scout().Name(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting name for id [%s]: %w", id, err)
+		}
+		report.Path = append(report.Path, pathEntry{ID: id, Name: name})
+	}
+	report.Name = report.Path[len(report.Path)-1].Name
+	// The account itself is displayed in the column header
+	report.Path = report.Path[:len(report.Path)-1]
+
+	for _, pt := range comparedPolicyTypes {
+		policies, err := client.scout().EffectivePolicies(ctx, accountID, pt.policyType)
+		var notEnabled *types.PolicyTypeNotEnabledException
+		switch {
+		case errors.As(err, &notEnabled):
+			report.Disabled[pt.policyType] = true
+		case err != nil:
+			return nil, fmt.Errorf("error getting policies for account %s: %w", accountID, err)
+		}
+		report.Policies[pt.policyType] = policyNames(policies)
+	}
+
+	return report, nil
+}
+
+// Renders the comparison, the first report is used as the reference account.
+func renderComparison(w io.Writer, label string, reports []*accountReport) error {
+	tmpl, err := template.ParseFS(templates, "templates/compare.html")
+	if err != nil {
+		return err
+	}
+
+	var sections []comparisonSection
+	for _, pt := range comparedPolicyTypes {
+		section := comparisonSection{Title: pt.title}
+		for i, report := range reports {
+			if report.Disabled[pt.policyType] {
+				section.Cells = append(section.Cells, comparisonCell{Unavailable: "policy type not enabled"})
+				continue
+			}
+			section.Cells = append(section.Cells, compareNames(reports[0].Policies[pt.policyType], report.Policies[pt.policyType], i == 0))
+		}
+		sections = append(sections, section)
+	}
+
+	access := comparisonSection{Title: "Identity Center access"}
+	for i, report := range reports {
+		if report.NoAccess != "" {
+			access.Cells = append(access.Cells, comparisonCell{Unavailable: report.NoAccess})
+			continue
+		}
+		access.Cells = append(access.Cells, compareNames(accessNames(reports[0]), accessNames(report), i == 0))
+	}
+	sections = append(sections, access)
+
+	scores := make([]scoreCell, 0, len(reports))
+	for _, report := range reports {
+		scores = append(scores, scoreCell{
+			Score:  report.Score.Score,
+			Delta:  report.Score.Score - reports[0].Score.Score,
+			Failed: report.Score.Failed,
+		})
+	}
+
+	return tmpl.Execute(w, struct {
+		Organization string
+		Accounts     []*accountReport
+		Scores       []scoreCell
+		Sections     []comparisonSection
+	}{label, reports, scores, sections})
+}
+
+// Compares the names of a cell to the ones of the reference account,
+// highlighting the ones it lacks.
+func compareNames(reference, names []string, isReference bool) comparisonCell {
+	inReference := map[string]bool{}
+	for _, name := range reference {
+		inReference[name] = true
+	}
+
+	var cell comparisonCell
+	applied := map[string]bool{}
+	for _, name := range names {
+		applied[name] = true
+		status := policyShared
+		if !isReference && !inReference[name] {
+			status = policyExtra
+		}
+		cell.Policies = append(cell.Policies, comparedPolicy{Name: name, Status: status})
+	}
+	// Highlight the guardrails of the reference account this account lacks
+	if !isReference {
+		for _, name := range reference {
+			if !applied[name] {
+				cell.Policies = append(cell.Policies, comparedPolicy{Name: name, Status: policyMissing})
+			}
+		}
+	}
+	return cell
+}
+
+// Describes every Identity Center assignment of an account, e.g.
+// "AdministratorAccess: GROUP platform-admins".
+func accessNames(report *accountReport) []string {
+	names := make([]string, 0, len(report.Access))
+	for _, assignment := range report.Access {
+		names = append(names, fmt.Sprintf("%s: %s %s", assignment.PermissionSet, assignment.PrincipalType, assignment.Principal))
+	}
+	return names
+}
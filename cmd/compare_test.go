@@ -0,0 +1,103 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/identitystore"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	ssoadmintypes "github.com/aws/aws-sdk-go-v2/service/ssoadmin/types"
+)
+
+// An Identity Center instance whose groups are assigned permission sets,
+// keyed by account ID and then by permission set name.
+type fakeIdentityCenter map[string]map[string][]string
+
+func (f fakeIdentityCenter) ListInstances(context.Context, *ssoadmin.ListInstancesInput, ...func(*ssoadmin.Options)) (*ssoadmin.ListInstancesOutput, error) {
+	return &ssoadmin.ListInstancesOutput{Instances: []ssoadmintypes.InstanceMetadata{{
+		InstanceArn:     aws.String("arn:aws:sso:::instance/ssoins-example"),
+		IdentityStoreId: aws.String("d-example"),
+	}}}, nil
+}
+
+func (f fakeIdentityCenter) ListPermissionSetsProvisionedToAccount(_ context.Context, params *ssoadmin.ListPermissionSetsProvisionedToAccountInput, _ ...func(*ssoadmin.Options)) (*ssoadmin.ListPermissionSetsProvisionedToAccountOutput, error) {
+	output := &ssoadmin.ListPermissionSetsProvisionedToAccountOutput{}
+	for name := range f[aws.ToString(params.AccountId)] {
+		output.PermissionSets = append(output.PermissionSets, "arn:aws:sso:::permissionSet/ssoins-example/"+name)
+	}
+	return output, nil
+}
+
+func (f fakeIdentityCenter) ListAccountAssignments(_ context.Context, params *ssoadmin.ListAccountAssignmentsInput, _ ...func(*ssoadmin.Options)) (*ssoadmin.ListAccountAssignmentsOutput, error) {
+	name := filepath.Base(aws.ToString(params.PermissionSetArn))
+	output := &ssoadmin.ListAccountAssignmentsOutput{}
+	for _, group := range f[aws.ToString(params.AccountId)][name] {
+		output.AccountAssignments = append(output.AccountAssignments, ssoadmintypes.AccountAssignment{
+			AccountId:        params.AccountId,
+			PermissionSetArn: params.PermissionSetArn,
+			PrincipalId:      aws.String("id-" + group),
+			PrincipalType:    ssoadmintypes.PrincipalTypeGroup,
+		})
+	}
+	return output, nil
+}
+
+func (f fakeIdentityCenter) DescribePermissionSet(_ context.Context, params *ssoadmin.DescribePermissionSetInput, _ ...func(*ssoadmin.Options)) (*ssoadmin.DescribePermissionSetOutput, error) {
+	return &ssoadmin.DescribePermissionSetOutput{PermissionSet: &ssoadmintypes.PermissionSet{
+		Name:             aws.String(filepath.Base(aws.ToString(params.PermissionSetArn))),
+		PermissionSetArn: params.PermissionSetArn,
+	}}, nil
+}
+
+func (f fakeIdentityCenter) DescribeUser(context.Context, *identitystore.DescribeUserInput, ...func(*identitystore.Options)) (*identitystore.DescribeUserOutput, error) {
+	return &identitystore.DescribeUserOutput{}, nil
+}
+
+func (f fakeIdentityCenter) DescribeGroup(_ context.Context, params *identitystore.DescribeGroupInput, _ ...func(*identitystore.Options)) (*identitystore.DescribeGroupOutput, error) {
+	return &identitystore.DescribeGroupOutput{DisplayName: aws.String(strings.TrimPrefix(aws.ToString(params.GroupId), "id-"))}, nil
+}
+
+func TestCompare(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "comparison.html")
+	_, err := runCommandWith(t, func(deps *dependencies) {
+		org := newTestOrg()
+		deps.organizations = func(context.Context) (orgOperations, error) { return org, nil }
+		deps.identityCenter = func(context.Context) (identityCenterAPI, error) {
+			return fakeIdentityCenter{
+				"111111111111": {"AdministratorAccess": {"platform-admins"}, "ReadOnlyAccess": {"auditors"}},
+				"222222222222": {"ReadOnlyAccess": {"auditors", "payments-team"}},
+			}, nil
+		}
+	}, "aws", "compare", "--account-id", "111111111111", "--account-id", "222222222222", "--output-file", output)
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+
+	report, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Benchmark score",
+		"0/100",
+		`40/100 <span class="higher">(+40)</span>`,
+		"failing: aiOptOut, backup, tags",
+		"Identity Center access",
+		`<li>ReadOnlyAccess: GROUP auditors</li>`,
+		`<li class="extra">+ ReadOnlyAccess: GROUP payments-team</li>`,
+		`<li class="missing">AdministratorAccess: GROUP platform-admins</li>`,
+	} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("the comparison is missing %q:\n%s", want, report)
+		}
+	}
+}
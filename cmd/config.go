@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the config file looked up in the home directory when --config is not given.
+const defaultConfigFile = ".policy-scout.yaml"
+
+// runOptions are the settings shared by the commands of a run: the flags of the
+// root, aws and gcp commands, the flags of the tree commands read while the
+// tree is built, and what the config file adds to them. They live in the
+// dependencies, so every run (e.g. every Lambda invocation) starts afresh.
+type runOptions struct {
+	configFile   string // config file given in the command line, $HOME/.policy-scout.yaml if empty
+	demo         bool   // every command runs against the embedded fictional organization instead of AWS
+	snapshotFile string // snapshot written by "aws snapshot" read instead of the live organization
+
+	reportURI           string   // where the reports are sent, see openSink for the supported URIs
+	publishTargets      []string // where the results of the command are published, besides the report (repeatable)
+	publishKMSKey       string   // KMS key encrypting the objects published to S3, the default encryption of the bucket if empty
+	cloudWatchNamespace string   // namespace of the metrics published to CloudWatch
+	notifyTargets       []string // where the alerts of the command are sent (repeatable)
+	webhookURL          string   // Slack incoming webhook of --notify slack
+	historyTable        string   // DynamoDB table keeping the snapshots and the findings, for trend analysis
+
+	verbose     bool   // log retries and failed API calls
+	debug       bool   // also log every API call and cache hit
+	logFormat   string // "text" or "json"
+	quiet       bool   // suppress the progress indicator
+	noColor     bool   // disable the colors of the text output, as does NO_COLOR
+	colorOutput bool   // whether the text tree is colored, resolved once the flags are parsed
+	profileScan bool   // report where the time of the command went, see scanProfile
+
+	cacheFile   string        // where the warm cache is written and read from
+	cacheMaxAge time.Duration // older warm caches are ignored
+	noCache     bool          // ignore the warm cache
+
+	// Cross-org settings, used to scout another organization (e.g. during M&A
+	// due diligence) by assuming a read-only audit role that organization trusts
+	roleARN    string // audit role assumed in the external org
+	externalID string // external ID required by the trust policy of that role
+
+	namingConventions []string     // naming conventions of the policies as given in the command line, e.g. "scp-<category>-<nn>"
+	namingPatterns    policyNaming // compiled by compileNamingConventions
+	sortKey           string       // order of the children of every node, see --sort
+	treeStyleName     string       // drawing style of the text tree, see treeStyles
+
+	scope scopeOptions // entities left out of the reports, see isExcluded
+
+	// Details added to the nodes of the tree
+	maxDocumentBytes      int               // larger documents are truncated
+	fullDocuments         bool              // never truncate documents
+	policyTypeNames       []string          // policy types displayed along with the SCPs, as given in the command line
+	showEffectivePolicies bool              // display the effective policy of every account
+	selectedPolicyTypes   []extraPolicyType // resolved by resolvePolicyTypes
+	inheritTagKeys        []string          // tags set at OU level copied down to the accounts in the structured outputs
+	alternateContacts     bool              // fetch the alternate contacts of every account
+
+	gcp gcpOptions // flags of the gcp commands
+
+	organizations []orgSource    // organizations of the config file, scanned by "aws orgs"
+	scoreWeights  map[string]int // weight of every governance check, see defaultScoreWeights
+}
+
+// Creates the options of a run, before the flags are parsed.
+func newRunOptions() runOptions {
+	return runOptions{scoreWeights: maps.Clone(defaultScoreWeights)}
+}
+
+// The configuration shared by all the commands.
+type scoutConfig struct {
+	Scope         scopeConfig `yaml:"scope"`
+	Score         scoreConfig `yaml:"score"`
+	Organizations []orgSource `yaml:"organizations"`
+}
+
+// An organization scanned by "aws orgs", reached with a profile of the local AWS
+// config, an audit role, or offline with a snapshot.
+type orgSource struct {
+	Name       string `yaml:"name"`
+	Profile    string `yaml:"profile"`
+	RoleARN    string `yaml:"roleArn"`
+	ExternalID string `yaml:"externalId"`
+	Snapshot   string `yaml:"snapshot"` // written by "aws snapshot"
+}
+
+// How the governance score is computed.
+type scoreConfig struct {
+	// Weight of every governance check, keyed by check name (see governanceChecks)
+	Weights map[string]int `yaml:"weights"`
+}
+
+// Entities left out of every command, e.g. noisy sandbox accounts that would
+// otherwise pollute compliance numbers.
+type scopeConfig struct {
+	Exclude struct {
+		// OU IDs, glob patterns on OU names or OU paths starting with "/" (e.g. "/Root/Sandbox")
+		OUs []string `yaml:"ous"`
+		// Account IDs or glob patterns on account names
+		Accounts []string `yaml:"accounts"`
+		// Accounts carrying any of these tags, as key=value
+		AccountTags []string `yaml:"accountTags"`
+	} `yaml:"exclude"`
+}
+
+// Loads the config file and applies it on top of the command line flags. A missing
+// default config file is fine, a missing file given with --config is not.
+func (o *runOptions) loadConfig() error {
+	path := o.configFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, defaultConfigFile)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if o.configFile == "" && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("couldn't read config file: %w", err)
+	}
+
+	var loaded scoutConfig
+	if err := yaml.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	o.scope.excludeOUs = append(o.scope.excludeOUs, loaded.Scope.Exclude.OUs...)
+	o.scope.excludeAccounts = append(o.scope.excludeAccounts, loaded.Scope.Exclude.Accounts...)
+	o.scope.excludeAccountTags = append(o.scope.excludeAccountTags, loaded.Scope.Exclude.AccountTags...)
+
+	for i, org := range loaded.Organizations {
+		if org.Name == "" {
+			return fmt.Errorf("invalid config file %s: organization #%d has no name", path, i+1)
+		}
+		if org.Snapshot != "" && (org.Profile != "" || org.RoleARN != "") {
+			return fmt.Errorf("invalid config file %s: organization %s can't be read from a snapshot and from AWS", path, org.Name)
+		}
+	}
+	o.organizations = loaded.Organizations
+
+	for name, weight := range loaded.Score.Weights {
+		if _, ok := o.scoreWeights[name]; !ok {
+			return fmt.Errorf("invalid config file %s: unknown governance check %q", path, name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("invalid config file %s: the weight of %s can't be negative", path, name)
+		}
+		o.scoreWeights[name] = weight
+	}
+	return nil
+}
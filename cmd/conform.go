@@ -0,0 +1,287 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	securityhubtypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"github.com/spf13/cobra"
+)
+
+// conformOptions are the flags of the aws conform command.
+type conformOptions struct {
+	goldenAccountID string   // account used as the guardrail baseline
+	baselineFile    string   // template file describing the desired guardrails
+	accountIDs      []string // accounts checked against the baseline, all of them if empty
+	planFile        string   // where the attach plan of the deviating accounts is written, none if empty
+}
+
+// newConformCmd creates the aws conform command.
+func newConformCmd(deps *dependencies) *cobra.Command {
+	options := &conformOptions{}
+	conformCmd := &cobra.Command{
+		Use:         "conform",
+		Short:       "Reports how accounts deviate from a golden account or a guardrail template",
+		Annotations: map[string]string{findingsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return checkConformance(cmd.Context(), deps, options.goldenAccountID, options.baselineFile, options.accountIDs, options.planFile)
+		},
+	}
+
+	conformCmd.Flags().StringVar(&options.goldenAccountID, "against", "", "ID of the golden account used as the baseline")
+	conformCmd.Flags().StringVar(&options.baselineFile, "template", "", "JSON file with the desired policies per policy type, used as the baseline")
+	conformCmd.MarkFlagsOneRequired("against", "template")
+	conformCmd.MarkFlagsMutuallyExclusive("against", "template")
+
+	conformCmd.Flags().StringSliceVar(&options.accountIDs, "account-id", nil, "aws account IDs to check (repeatable, defaults to every account in the org)")
+	conformCmd.Flags().StringVar(&options.planFile, "plan-file", "", "where the JSON plan of the AttachPolicy operations fixing the deviations is written: a file path, file://, s3://bucket/key or https:// (POST)")
+
+	return conformCmd
+}
+
+// The desired set of guardrails. When loaded from a template file it looks like:
+//
+//	{"policies": {"SERVICE_CONTROL_POLICY": ["FullAWSAccess", "DenyLeaveOrg"]}}
+type guardrailBaseline struct {
+	Description string                        `json:"-"`
+	Policies    map[types.PolicyType][]string `json:"policies"`
+}
+
+// Loads the baseline from a template file.
+func loadBaseline(path string) (*guardrailBaseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := &guardrailBaseline{}
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, fmt.Errorf("invalid template file %s: %w", path, err)
+	}
+	baseline.Description = "template " + path
+	return baseline, nil
+}
+
+// checkConformance compares the guardrails of every target account with the baseline,
+// optionally writing the plan of the policy attachments fixing the deviations.
+func checkConformance(ctx context.Context, deps *dependencies, goldenID, templatePath string, accountIDs []string, planFile string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+
+	var baseline *guardrailBaseline
+	if templatePath != "" {
+		if baseline, err = loadBaseline(templatePath); err != nil {
+			return err
+		}
+	} else {
+		golden, err := collectAccountReport(ctx, client, rootID, goldenID)
+		if err != nil {
+			return err
+		}
+		baseline = &guardrailBaseline{
+			Description: fmt.Sprintf("account %s [%s]", golden.Name, golden.ID),
+			Policies:    golden.Policies,
+		}
+	}
+
+	if len(accountIDs) == 0 {
+		if accountIDs, err = listAccountsInSubtree(ctx, client, rootID); err != nil {
+			return err
+		}
+	}
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if deps.options.roleARN != "" {
+		label, err := organizationLabel(ctx, client)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(deps.report, label)
+	}
+
+	fmt.Fprintf(deps.report, "Baseline: %s\n", baseline.Description)
+	plan, index := newAttachPlan(baseline.Description), policyIndex{}
+	checked, deviating := 0, 0
+	var published []auditFinding
+	for _, id := range accountIDs {
+		// The golden account trivially conforms to itself
+		if id == goldenID {
+			continue
+		}
+
+		report, err := collectAccountReport(ctx, client, rootID, id)
+		if err != nil {
+			return err
+		}
+		// SCPs and RCPs never apply to the management account, its deviations are not gaps
+		if id == managementAccountID {
+			fmt.Fprintf(deps.report, "|-- Account: %s [%s]: exempt (SCPs and RCPs don't apply to the management account)\n", report.Name, report.ID)
+			continue
+		}
+		checked++
+
+		deviations := compareWithBaseline(baseline, report)
+		if len(deviations) == 0 {
+			fmt.Fprintf(deps.report, "|-- Account: %s [%s]: conforms\n", report.Name, report.ID)
+			continue
+		}
+
+		deviating++
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s]: deviates\n", report.Name, report.ID)
+		for _, d := range deviations {
+			fmt.Fprintf(deps.report, "%s|-- %s\n", indent, d)
+		}
+		published = append(published, missingGuardrailFindings(baseline, report)...)
+
+		if planFile == "" {
+			continue
+		}
+		for _, pt := range comparedPolicyTypes {
+			missing, _ := diffPolicyNames(baseline.Policies[pt.policyType], report.Policies[pt.policyType])
+			for _, name := range missing {
+				if err := plan.attach(ctx, client, index, pt.policyType, name, report); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	fmt.Fprintf(deps.report, "%d of %d accounts deviate from the baseline\n", deviating, checked)
+
+	if planFile != "" {
+		if err := plan.write(ctx, deps, planFile); err != nil {
+			return fmt.Errorf("couldn't write plan: %w", err)
+		}
+		fmt.Fprintf(deps.report, "Plan with %s AttachPolicy operations (%s unresolved) written to %s\n", formatCount(len(plan.Operations)), formatCount(len(plan.Unresolved)), planFile)
+	}
+	return publishFindings(ctx, deps, "aws conform", published)
+}
+
+// The findings of the guardrails of the baseline an account is missing, one per
+// policy. Extra policies are reported, but not published: they are not a gap.
+func missingGuardrailFindings(baseline *guardrailBaseline, report *accountReport) []auditFinding {
+	var findings []auditFinding
+	for _, pt := range comparedPolicyTypes {
+		missing, _ := diffPolicyNames(baseline.Policies[pt.policyType], report.Policies[pt.policyType])
+		for _, name := range missing {
+			findings = append(findings, auditFinding{
+				check:        "missing-guardrail",
+				severity:     securityhubtypes.SeverityLabelMedium,
+				title:        fmt.Sprintf("Account %s is missing the guardrail %s", report.Name, name),
+				description:  fmt.Sprintf("%s is one of the %s of the baseline (%s), but it doesn't apply to account %s [%s].", name, pt.title, baseline.Description, report.Name, report.ID),
+				resourceType: accountResource,
+				resourceID:   accountResourceID(report.ID),
+				detail:       name,
+			})
+		}
+	}
+	return findings
+}
+
+// Lists the differences between the guardrails of an account and the baseline.
+func compareWithBaseline(baseline *guardrailBaseline, report *accountReport) []string {
+	var deviations []string
+	for _, pt := range comparedPolicyTypes {
+		missing, extra := diffPolicyNames(baseline.Policies[pt.policyType], report.Policies[pt.policyType])
+		if len(missing) > 0 {
+			deviations = append(deviations, fmt.Sprintf("%s missing: %s", pt.title, strings.Join(missing, ", ")))
+		}
+		if len(extra) > 0 {
+			deviations = append(deviations, fmt.Sprintf("%s extra: %s", pt.title, strings.Join(extra, ", ")))
+		}
+	}
+	return deviations
+}
+
+// Returns the names in want that are not in got (missing) and the other way around (extra).
+func diffPolicyNames(want, got []string) (missing, extra []string) {
+	wanted := map[string]bool{}
+	for _, name := range want {
+		wanted[name] = true
+	}
+	present := map[string]bool{}
+	for _, name := range got {
+		present[name] = true
+		if !wanted[name] {
+			extra = append(extra, name)
+		}
+	}
+	for _, name := range want {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, extra
+}
+
+// Lists the IDs of every account below parentID, failing if there are none.
+func listAccountsInSubtree(ctx context.Context, client orgAPI, parentID string) ([]string, error) {
+	accountIDs, err := collectAccountsInSubtree(ctx, client, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(accountIDs) == 0 {
+		return nil, errors.New("no accounts found in the organization")
+	}
+	return accountIDs, nil
+}
+
+// Collects the IDs of every account below parentID using BFS.
+func collectAccountsInSubtree(ctx context.Context, client orgAPI, parentID string) ([]string, error) {
+	var accountIDs []string
+	toBeProcessed := []string{parentID}
+
+	for len(toBeProcessed) > 0 {
+		currentID := toBeProcessed[0]
+		toBeProcessed = toBeProcessed[1:]
+
+		childAccounts, err := client.scout().Children(ctx, currentID, types.ChildTypeAccount)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range childAccounts {
+			excluded, err := isExcluded(ctx, client, childID)
+			if err != nil {
+				return nil, err
+			}
+			if !excluded {
+				accountIDs = append(accountIDs, childID)
+			}
+		}
+
+		childOUs, err := client.scout().Children(ctx, currentID, types.ChildTypeOrganizationalUnit)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range childOUs {
+			excluded, err := isExcluded(ctx, client, childID)
+			if err != nil {
+				return nil, err
+			}
+			if !excluded {
+				toBeProcessed = append(toBeProcessed, childID)
+			}
+		}
+	}
+
+	return accountIDs, nil
+}
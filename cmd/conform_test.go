@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+func TestConform(t *testing.T) {
+	// The management account misses deny-leave, but that is no gap
+	template := writeTestFile(t, "baseline.json", `{"policies": {"`+string(types.PolicyTypeServiceControlPolicy)+`": ["FullAWSAccess", "deny-leave"]}}`)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "management account exempt",
+			args: []string{"--against", "222222222222"},
+			want: "Baseline: account payments [222222222222]\n" +
+				"|-- Account: management [111111111111]: exempt (SCPs and RCPs don't apply to the management account)\n" +
+				"|-- Account: legacy [333333333333]: conforms\n" +
+				"0 of 1 accounts deviate from the baseline\n",
+		},
+		{
+			name: "management account requested",
+			args: []string{"--against", "222222222222", "--account-id", "111111111111"},
+			want: "Baseline: account payments [222222222222]\n" +
+				"|-- Account: management [111111111111]: exempt (SCPs and RCPs don't apply to the management account)\n" +
+				"0 of 0 accounts deviate from the baseline\n",
+		},
+		{
+			name: "template",
+			args: []string{"--template", template, "--account-id", "111111111111,222222222222"},
+			want: "Baseline: template " + template + "\n" +
+				"|-- Account: management [111111111111]: exempt (SCPs and RCPs don't apply to the management account)\n" +
+				"|-- Account: payments [222222222222]: conforms\n" +
+				"0 of 1 accounts deviate from the baseline\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, newTestOrg(), append([]string{"aws", "conform"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("conform: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("conform wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// Organizations quotas relevant to SCP consolidation.
+const (
+	maxSCPsPerTarget = 5    // SCPs that can be directly attached to a root, OU or account
+	maxSCPSize       = 5120 // characters of an SCP document
+)
+
+// newConsolidateCmd creates the aws consolidate command.
+func newConsolidateCmd(deps *dependencies) *cobra.Command {
+	consolidateCmd := &cobra.Command{
+		Use:   "consolidate",
+		Short: "Proposes SCP consolidation plans to reduce attachments and quota usage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return planConsolidation(cmd.Context(), deps)
+		},
+	}
+
+	return consolidateCmd
+}
+
+// A policy of the attachment graph.
+type graphPolicy struct {
+	id         string
+	name       string
+	awsManaged bool
+	content    string
+	document   *scp.Document
+}
+
+// The SCP attachments of the whole org, along with its structure.
+type attachmentGraph struct {
+	rootID      string
+	parents     map[string]string   // child ID -> parent ID
+	children    map[string][]string // parent ID -> child IDs (OUs and accounts)
+	accounts    []string
+	names       map[string]string   // entity ID -> name
+	attachments map[string][]string // target ID -> IDs of the SCPs directly attached
+	policies    map[string]*graphPolicy
+}
+
+// Loads the structure of the org and the SCPs directly attached to every node.
+func loadAttachmentGraph(ctx context.Context, client orgAPI) (*attachmentGraph, error) {
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+
+	graph := &attachmentGraph{
+		rootID:      rootID,
+		parents:     map[string]string{},
+		children:    map[string][]string{},
+		names:       map[string]string{},
+		attachments: map[string][]string{},
+		policies:    map[string]*graphPolicy{},
+	}
+
+	toBeProcessed := []string{rootID}
+	for len(toBeProcessed) > 0 {
+		currentID := toBeProcessed[0]
+		toBeProcessed = toBeProcessed[1:]
+
+		if err := graph.loadNode(ctx, client, currentID); err != nil {
+			return nil, err
+		}
+
+		childAccounts, err := client.scout().Children(ctx, currentID, types.ChildTypeAccount)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range childAccounts {
+			graph.parents[childID] = currentID
+			graph.children[currentID] = append(graph.children[currentID], childID)
+			graph.accounts = append(graph.accounts, childID)
+			if err := graph.loadNode(ctx, client, childID); err != nil {
+				return nil, err
+			}
+		}
+
+		childOUs, err := client.scout().Children(ctx, currentID, types.ChildTypeOrganizationalUnit)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range childOUs {
+			graph.parents[childID] = currentID
+			graph.children[currentID] = append(graph.children[currentID], childID)
+			toBeProcessed = append(toBeProcessed, childID)
+		}
+	}
+
+	return graph, nil
+}
+
+// Loads the name of a node and the SCPs directly attached to it.
+func (g *attachmentGraph) loadNode(ctx context.Context, client orgAPI, id string) error {
+	name, err := client.scout().Name(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error getting name for id %s: %w", id, err)
+	}
+	g.names[id] = name
+
+	attached, err := client.scout().DirectPolicies(ctx, id, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range attached {
+		g.attachments[id] = append(g.attachments[id], policy.ID)
+		if _, ok := g.policies[policy.ID]; ok {
+			continue
+		}
+
+		content, err := getPolicyDocument(ctx, client, policy.ID)
+		if err != nil {
+			return err
+		}
+		document, err := scp.Parse(content)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", policy.ID, err)
+		}
+		g.policies[policy.ID] = &graphPolicy{
+			id:         policy.ID,
+			name:       policy.Name,
+			awsManaged: isAWSManagedARN(policy.ARN),
+			content:    content,
+			document:   document,
+		}
+	}
+	return nil
+}
+
+// Reports whether a policy is managed by AWS (e.g. FullAWSAccess) rather than by
+// the organization, their ARNs belong to the "aws" account.
+func isAWSManagedARN(arn string) bool {
+	return strings.Contains(arn, ":organizations::aws:")
+}
+
+// Returns a copy of the graph whose attachments can be modified.
+func (g *attachmentGraph) withAttachments() *attachmentGraph {
+	clone := *g
+	clone.attachments = make(map[string][]string, len(g.attachments))
+	clone.policies = make(map[string]*graphPolicy, len(g.policies))
+	for target, ids := range g.attachments {
+		clone.attachments[target] = append([]string{}, ids...)
+	}
+	for id, policy := range g.policies {
+		clone.policies[id] = policy
+	}
+	return &clone
+}
+
+// Detaches a policy from a target.
+func (g *attachmentGraph) detach(target, policyID string) {
+	var kept []string
+	for _, id := range g.attachments[target] {
+		if id != policyID {
+			kept = append(kept, id)
+		}
+	}
+	g.attachments[target] = kept
+}
+
+// Computes the effective SCPs of an account according to the graph.
+func (g *attachmentGraph) effective(accountID string) scp.Effective {
+	ids := []string{accountID}
+	for current := accountID; current != g.rootID; {
+		current = g.parents[current]
+		ids = append([]string{current}, ids...)
+	}
+
+	chain := make([]scp.Level, 0, len(ids))
+	for _, id := range ids {
+		level := scp.Level{TargetID: id, TargetName: g.names[id]}
+		for _, policyID := range g.attachments[id] {
+			policy := g.policies[policyID]
+			level.Policies = append(level.Policies, scp.Policy{ID: policy.id, Name: policy.name, Document: policy.document})
+		}
+		chain = append(chain, level)
+	}
+	return scp.Analyze(chain)
+}
+
+// Counts the SCP attachments of the graph and the targets at the quota limit.
+func (g *attachmentGraph) usage() (attachments, atLimit int) {
+	for _, ids := range g.attachments {
+		attachments += len(ids)
+		if len(ids) >= maxSCPsPerTarget {
+			atLimit++
+		}
+	}
+	return attachments, atLimit
+}
+
+// A consolidation proposal, along with the graph resulting from applying it.
+type consolidationProposal struct {
+	description string
+	details     []string
+	after       *attachmentGraph
+}
+
+// Reports whether applying a proposal keeps the effective SCPs of every account.
+// The verification relies on scp.Analyze, hence it is an estimation: conditions are
+// compared as written and not evaluated.
+func verifyEquivalence(before, after *attachmentGraph) (bool, []string) {
+	var changed []string
+	for _, accountID := range before.accounts {
+		a, b := before.effective(accountID), after.effective(accountID)
+		if !reflect.DeepEqual(a.Allowed, b.Allowed) || !reflect.DeepEqual(denyKeys(a.Denies), denyKeys(b.Denies)) {
+			changed = append(changed, fmt.Sprintf("%s [%s]", before.names[accountID], accountID))
+		}
+	}
+	return len(changed) == 0, changed
+}
+
+// Unique, sorted representation of deny statements, regardless of where they are attached.
+func denyKeys(rules []scp.Rule) []string {
+	unique := map[string]bool{}
+	for _, rule := range rules {
+		key, _ := json.Marshal(rule.Statement) //nolint:errchkjson
+		unique[string(key)] = true
+	}
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Proposes merging customer managed policies attached to the exact same targets.
+// Policies attached at the same level are combined as a union, so merging their
+// statements into a single document keeps the same semantics.
+func proposeMerges(g *attachmentGraph) []consolidationProposal {
+	groups := map[string][]string{} // sorted targets -> policy IDs
+	targetsOf := map[string][]string{}
+	for target, ids := range g.attachments {
+		for _, id := range ids {
+			targetsOf[id] = append(targetsOf[id], target)
+		}
+	}
+	for id, targets := range targetsOf {
+		if g.policies[id].awsManaged {
+			continue
+		}
+		sort.Strings(targets)
+		key := strings.Join(targets, ",")
+		groups[key] = append(groups[key], id)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var proposals []consolidationProposal
+	for _, key := range keys {
+		ids := groups[key]
+		sort.Strings(ids)
+
+		// Merge greedily, as long as the merged document fits the size quota
+		for len(ids) > 1 {
+			merged, content := []string{ids[0]}, mergeDocuments(g, []string{ids[0]})
+			for _, id := range ids[1:] {
+				candidate := mergeDocuments(g, append(append([]string{}, merged...), id))
+				if len(candidate) > maxSCPSize {
+					break
+				}
+				merged, content = append(merged, id), candidate
+			}
+			ids = ids[len(merged):]
+			if len(merged) < 2 {
+				continue
+			}
+			proposals = append(proposals, mergeProposal(g, strings.Split(key, ","), merged, content))
+		}
+	}
+	return proposals
+}
+
+// Builds the merged document of a set of policies.
+func mergeDocuments(g *attachmentGraph, ids []string) string {
+	merged := struct {
+		Version   string
+		Statement []scp.Statement
+	}{Version: "2012-10-17"}
+	for _, id := range ids {
+		merged.Statement = append(merged.Statement, g.policies[id].document.Statement...)
+	}
+	content, _ := json.Marshal(merged) //nolint:errchkjson
+	return string(content)
+}
+
+func mergeProposal(g *attachmentGraph, targets, ids []string, content string) consolidationProposal {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, g.policies[id].name)
+	}
+
+	after := g.withAttachments()
+	document, _ := scp.Parse(content)
+	mergedID := "merged:" + strings.Join(ids, "+")
+	after.policies[mergedID] = &graphPolicy{id: mergedID, name: "merged", content: content, document: document}
+
+	var details []string
+	for _, target := range targets {
+		before := len(after.attachments[target])
+		for _, id := range ids {
+			after.detach(target, id)
+		}
+		after.attachments[target] = append(after.attachments[target], mergedID)
+		details = append(details, fmt.Sprintf("%s [%s]: %d -> %d SCPs", g.names[target], target, before, len(after.attachments[target])))
+	}
+
+	return consolidationProposal{
+		description: fmt.Sprintf("merge %s (attached to the same %d targets) into a single policy of %s/%s characters", strings.Join(names, ", "), len(targets), formatCount(len(content)), formatCount(maxSCPSize)),
+		details:     details,
+		after:       after,
+	}
+}
+
+// Proposes attaching deny-only policies to a parent instead of to every one of its
+// children. Allow statements are never moved: SCPs require an allow at every level.
+func proposeReattachments(g *attachmentGraph) []consolidationProposal {
+	parents := make([]string, 0, len(g.children))
+	for parent := range g.children {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+
+	var proposals []consolidationProposal
+	for _, parent := range parents {
+		children := g.children[parent]
+		if len(children) < 2 {
+			continue
+		}
+
+		// Policies attached to every child of the parent
+		common := map[string]int{}
+		for _, child := range children {
+			for _, id := range g.attachments[child] {
+				common[id]++
+			}
+		}
+
+		ids := make([]string, 0, len(common))
+		for id, count := range common {
+			if count == len(children) && denyOnly(g.policies[id].document) && !contains(g.attachments[parent], id) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			if len(g.attachments[parent]) >= maxSCPsPerTarget {
+				break
+			}
+
+			after := g.withAttachments()
+			for _, child := range children {
+				after.detach(child, id)
+			}
+			after.attachments[parent] = append(after.attachments[parent], id)
+
+			proposals = append(proposals, consolidationProposal{
+				description: fmt.Sprintf("attach %s to %s [%s] instead of to its %d children", g.policies[id].name, g.names[parent], parent, len(children)),
+				details:     []string{fmt.Sprintf("%s [%s]: %d -> %d SCPs", g.names[parent], parent, len(g.attachments[parent]), len(after.attachments[parent]))},
+				after:       after,
+			})
+		}
+	}
+	return proposals
+}
+
+// Reports whether a document only contains deny statements.
+func denyOnly(document *scp.Document) bool {
+	for _, statement := range document.Statement {
+		if statement.Effect != scp.Deny {
+			return false
+		}
+	}
+	return len(document.Statement) > 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// planConsolidation loads the attachment graph and prints every proposal along with
+// its impact on the quotas and the result of its equivalence verification.
+func planConsolidation(ctx context.Context, deps *dependencies) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	graph, err := loadAttachmentGraph(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	attachments, atLimit := graph.usage()
+	fmt.Fprintf(deps.report, "Current usage: %s SCP attachments, %d targets at the %d SCPs per target quota\n", formatCount(attachments), atLimit, maxSCPsPerTarget)
+
+	proposals := append(proposeMerges(graph), proposeReattachments(graph)...)
+	if len(proposals) == 0 {
+		fmt.Fprintln(deps.report, "No consolidation opportunities found")
+		return nil
+	}
+
+	for i, proposal := range proposals {
+		fmt.Fprintf(deps.report, "Proposal %d: %s\n", i+1, proposal.description)
+		for _, detail := range proposal.details {
+			fmt.Fprintf(deps.report, "%s|-- %s\n", indent, detail)
+		}
+
+		afterAttachments, afterAtLimit := proposal.after.usage()
+		fmt.Fprintf(deps.report, "%s|-- Resulting usage: %s SCP attachments, %d targets at the quota\n", indent, formatCount(afterAttachments), afterAtLimit)
+
+		if equivalent, changed := verifyEquivalence(graph, proposal.after); equivalent {
+			fmt.Fprintf(deps.report, "%s|-- Effective permissions: unchanged for all %d accounts\n", indent, len(graph.accounts))
+		} else {
+			fmt.Fprintf(deps.report, "%s|-- Effective permissions: CHANGED for %s\n", indent, strings.Join(changed, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+const (
+	denyRegionsDocument  = `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","NotAction":"iam:*","Resource":"*","Condition":{"StringNotEquals":{"aws:RequestedRegion":"eu-west-1"}}}]}`
+	denyPublicS3Document = `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:PutBucketPublicAccessBlock","Resource":"*"}]}`
+)
+
+// The test org with a second deny policy on the Workloads OU, and another one
+// attached to every account of that OU.
+func newConsolidationOrg() *awsorgtest.Org {
+	return newTestOrg().
+		AddAccount("ou-root-work", "444444444444", "ledger", types.AccountStatusActive).
+		AddPolicy("p-regions", "deny-regions", types.PolicyTypeServiceControlPolicy, denyRegionsDocument).
+		AddPolicy("p-s3", "deny-public-s3", types.PolicyTypeServiceControlPolicy, denyPublicS3Document).
+		AttachPolicy("ou-root-work", "p-regions").
+		AttachPolicy("222222222222", "p-s3").
+		AttachPolicy("333333333333", "p-s3").
+		AttachPolicy("444444444444", "p-s3")
+}
+
+func TestConsolidate(t *testing.T) {
+	// Five SCPs on the management account, the most an account can have
+	atQuota := newTestOrg()
+	for _, id := range []string{"p-a", "p-b", "p-c", "p-d"} {
+		atQuota.AddPolicy(id, "deny-"+id, types.PolicyTypeServiceControlPolicy, denyLeaveDocument).AttachPolicy("111111111111", id)
+	}
+	atQuota.AttachPolicy("111111111111", "p-FullAWSAccess")
+
+	tests := []struct {
+		name string
+		org  *awsorgtest.Org
+		want string
+	}{
+		{
+			name: "merge and re-attach",
+			org:  newConsolidationOrg(),
+			want: "Current usage: 6 SCP attachments, 0 targets at the 5 SCPs per target quota\n" +
+				"Proposal 1: merge deny-leave, deny-regions (attached to the same 1 targets) into a single policy of 245/5,120 characters\n" +
+				indent + "|-- Workloads [ou-root-work]: 2 -> 1 SCPs\n" +
+				indent + "|-- Resulting usage: 5 SCP attachments, 0 targets at the quota\n" +
+				indent + "|-- Effective permissions: unchanged for all 4 accounts\n" +
+				"Proposal 2: attach deny-public-s3 to Workloads [ou-root-work] instead of to its 3 children\n" +
+				indent + "|-- Workloads [ou-root-work]: 2 -> 3 SCPs\n" +
+				indent + "|-- Resulting usage: 4 SCP attachments, 0 targets at the quota\n" +
+				indent + "|-- Effective permissions: unchanged for all 4 accounts\n",
+		},
+		{
+			name: "merge at the quota",
+			org:  atQuota,
+			want: "Current usage: 7 SCP attachments, 1 targets at the 5 SCPs per target quota\n" +
+				"Proposal 1: merge deny-p-a, deny-p-b, deny-p-c, deny-p-d (attached to the same 1 targets) into a single policy of 358/5,120 characters\n" +
+				indent + "|-- management [111111111111]: 5 -> 2 SCPs\n" +
+				indent + "|-- Resulting usage: 4 SCP attachments, 0 targets at the quota\n" +
+				indent + "|-- Effective permissions: unchanged for all 3 accounts\n",
+		},
+		{
+			name: "nothing to consolidate",
+			org:  newTestOrg(),
+			want: "Current usage: 2 SCP attachments, 0 targets at the 5 SCPs per target quota\nNo consolidation opportunities found\n",
+		},
+		{
+			name: "empty organization",
+			org:  awsorgtest.New("o-example", "r-root", "111111111111"),
+			want: "Current usage: 0 SCP attachments, 0 targets at the 5 SCPs per target quota\nNo consolidation opportunities found\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, tt.org, "aws", "consolidate")
+			if err != nil {
+				t.Fatalf("consolidate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("consolidate wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyEquivalence(t *testing.T) {
+	// SCPs need an allow at every level
+	org := newConsolidationOrg()
+	for _, id := range []string{"ou-root-work", "111111111111", "222222222222", "333333333333", "444444444444"} {
+		org.AttachPolicy(id, "p-FullAWSAccess")
+	}
+	deps := newDependencies(nil, nil)
+	deps.organizations = func(context.Context) (orgOperations, error) { return org, nil }
+	client, err := deps.orgClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := loadAttachmentGraph(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(g *attachmentGraph)
+		want   []string
+	}{
+		{"nothing changed", func(*attachmentGraph) {}, nil},
+		{
+			name: "deny moved to the parent",
+			change: func(g *attachmentGraph) {
+				g.detach("222222222222", "p-s3")
+				g.attachments["ou-root-work"] = append(g.attachments["ou-root-work"], "p-s3")
+			},
+			want: nil,
+		},
+		{
+			name:   "deny detached",
+			change: func(g *attachmentGraph) { g.detach("222222222222", "p-s3") },
+			want:   []string{"payments [222222222222]"},
+		},
+		{
+			name:   "allow detached",
+			change: func(g *attachmentGraph) { g.detach("r-root", "p-FullAWSAccess") },
+			want:   []string{"management [111111111111]", "legacy [333333333333]", "payments [222222222222]", "ledger [444444444444]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := graph.withAttachments()
+			tt.change(after)
+			equivalent, changed := verifyEquivalence(graph, after)
+			if equivalent != (len(tt.want) == 0) || !reflect.DeepEqual(changed, tt.want) {
+				t.Errorf("verifyEquivalence() = %t, %q, want the accounts %q changed", equivalent, changed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/account"
+	accounttypes "github.com/aws/aws-sdk-go-v2/service/account/types"
+)
+
+// Alternate contacts of an account, in the order they are displayed.
+var alternateContactTypes = []accounttypes.AlternateContactType{
+	accounttypes.AlternateContactTypeSecurity,
+	accounttypes.AlternateContactTypeBilling,
+	accounttypes.AlternateContactTypeOperations,
+}
+
+// accountAPI is the part of the Account Management API used by the commands.
+type accountAPI interface {
+	GetAlternateContact(ctx context.Context, params *account.GetAlternateContactInput, optFns ...func(*account.Options)) (*account.GetAlternateContactOutput, error)
+}
+
+// Creates the Account Management client of the org being analyzed. Reading the
+// contacts of the member accounts requires trusted access for
+// account.amazonaws.com.
+func (d *dependencies) newAccountClient(ctx context.Context) (accountAPI, error) {
+	snapshot, err := offlineSnapshot(&d.options)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		return snapshot, nil
+	}
+
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return account.NewFromConfig(cfg), nil
+}
+
+// Adds the alternate contacts to every active account of the tree. Suspended and
+// closing accounts are skipped, their contacts can't be read anymore.
+func addAlternateContacts(ctx context.Context, client accountAPI, tree *orgtree.Node) error {
+	return tree.Walk(func(node *orgtree.Node, depth int) error {
+		if node.Type != orgtree.AccountNode || !node.Active() {
+			return nil
+		}
+
+		for _, contactType := range alternateContactTypes {
+			contact, found, err := getAlternateContact(ctx, client, node, contactType)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			if node.AlternateContacts == nil {
+				node.AlternateContacts = map[string]orgtree.Contact{}
+			}
+			node.AlternateContacts[string(contactType)] = contact
+		}
+		return nil
+	})
+}
+
+// Gets an alternate contact of an account. found is false when the contact is
+// not set.
+func getAlternateContact(ctx context.Context, client accountAPI, node *orgtree.Node, contactType accounttypes.AlternateContactType) (contact orgtree.Contact, found bool, err error) {
+	input := &account.GetAlternateContactInput{AlternateContactType: contactType}
+	// The management account can't name itself, its contacts are the ones of the caller
+	if !node.ManagementAccount {
+		input.AccountId = aws.String(node.ID)
+	}
+
+	result, err := client.GetAlternateContact(ctx, input)
+	var notFound *accounttypes.ResourceNotFoundException
+	switch {
+	case errors.As(err, &notFound):
+		return orgtree.Contact{}, false, nil
+	case err != nil:
+		return orgtree.Contact{}, false, fmt.Errorf("error getting the %s contact of %s: %w", strings.ToLower(string(contactType)), node.ID, err)
+	}
+
+	return orgtree.Contact{
+		Name:  aws.ToString(result.AlternateContact.Name),
+		Title: aws.ToString(result.AlternateContact.Title),
+		Email: aws.ToString(result.AlternateContact.EmailAddress),
+		Phone: aws.ToString(result.AlternateContact.PhoneNumber),
+	}, true, nil
+}
+
+// Describes the alternate contacts of an account, including the ones not set.
+func alternateContactItems(node *orgtree.Node) []textItem {
+	var items []textItem
+	for _, contactType := range alternateContactTypes {
+		label := strings.ToUpper(string(contactType)[:1]) + strings.ToLower(string(contactType)[1:])
+		contact, found := node.AlternateContacts[string(contactType)]
+		if !found {
+			items = append(items, textItem{text: fmt.Sprintf("%s contact: not set", label)})
+			continue
+		}
+		items = append(items, textItem{text: fmt.Sprintf("%s contact: %s", label, formatContact(contact))})
+	}
+	return items
+}
+
+// Formats a contact as "Name (Title) <email>, phone".
+func formatContact(contact orgtree.Contact) string {
+	text := contact.Name
+	if contact.Title != "" {
+		text += fmt.Sprintf(" (%s)", contact.Title)
+	}
+	text += fmt.Sprintf(" <%s>", contact.Email)
+	if contact.Phone != "" {
+		text += ", " + contact.Phone
+	}
+	return text
+}
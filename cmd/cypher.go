@@ -0,0 +1,152 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// cypherRenderer writes the tree as Cypher statements loading it into Neo4j: a
+// node per root, OU, account and policy (organization, folder, project and
+// policy on GCP), a CHILD_OF relationship from every node to its parent, and
+// an ATTACHED_TO relationship from every policy to the targets it is directly
+// attached to. The statements MERGE the nodes on their IDs, so loading a
+// newer scan updates the graph.
+//
+// The AWS nodes of the tree list the inherited policies too, the direct
+// attachments are read from the API (or the cache). The GCP nodes only list
+// the policies set on them, so client is nil for GCP trees.
+type cypherRenderer struct {
+	ctx    context.Context
+	client orgAPI
+}
+
+// A policy of the tree, with its type.
+type cypherPolicy struct {
+	orgtree.Policy
+	policyType string
+}
+
+// Render implements orgtree.Renderer.
+func (r cypherRenderer) Render(w io.Writer, tree *orgtree.Tree) error {
+	var b strings.Builder
+	var policies []cypherPolicy
+	seen := map[string]bool{}
+	// Written once every node is, so the MATCH of both ends finds them
+	var children, attachments []string
+
+	err := tree.Root.Walk(func(node *orgtree.Node, _ int) error {
+		properties := []string{"n.name = " + cypherString(node.Name)}
+		switch node.Type {
+		case orgtree.RootNode:
+			properties = append(properties, "n.organizationId = "+cypherString(tree.OrganizationID))
+		case orgtree.AccountNode:
+			properties = append(properties, "n.status = "+cypherString(node.Status), fmt.Sprintf("n.managementAccount = %t", node.ManagementAccount))
+		case orgtree.OrganizationNode:
+			properties = append(properties, "n.organizationId = "+cypherString(tree.OrganizationID))
+		case orgtree.ProjectNode:
+			properties = append(properties, "n.status = "+cypherString(node.Status))
+		}
+		fmt.Fprintf(&b, "MERGE (n:%s {id: %s}) SET %s;\n", cypherLabel(node), cypherString(node.ID), strings.Join(properties, ", "))
+		for _, child := range node.Children {
+			children = append(children, fmt.Sprintf("MATCH (child:%s {id: %s}), (parent:%s {id: %s}) MERGE (child)-[:CHILD_OF]->(parent);\n",
+				cypherLabel(child), cypherString(child.ID), cypherLabel(node), cypherString(node.ID)))
+		}
+
+		byType := map[string][]orgtree.Policy{}
+		if r.client != nil {
+			byType[string(types.PolicyTypeServiceControlPolicy)] = node.SCPs
+		}
+		for policyType, applied := range node.Policies {
+			byType[policyType] = applied
+		}
+		for _, policyType := range sortedKeys(byType) {
+			for _, policy := range byType[policyType] {
+				if !seen[policy.ID] {
+					seen[policy.ID] = true
+					policies = append(policies, cypherPolicy{policy, policyType})
+				}
+			}
+			direct, err := r.attachedPolicyIDs(node, policyType, byType[policyType])
+			if err != nil {
+				return err
+			}
+			for _, id := range direct {
+				attachments = append(attachments, fmt.Sprintf("MATCH (p:Policy {id: %s}), (t:%s {id: %s}) MERGE (p)-[:ATTACHED_TO]->(t);\n",
+					cypherString(id), cypherLabel(node), cypherString(node.ID)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		// GCP policies have no ARN, their ID is their resource name
+		if policy.ARN == "" {
+			fmt.Fprintf(&b, "MERGE (p:Policy {id: %s}) SET p.name = %s, p.type = %s;\n",
+				cypherString(policy.ID), cypherString(policy.Name), cypherString(policy.policyType))
+			continue
+		}
+		fmt.Fprintf(&b, "MERGE (p:Policy {id: %s}) SET p.name = %s, p.arn = %s, p.type = %s;\n",
+			cypherString(policy.ID), cypherString(policy.Name), cypherString(policy.ARN), cypherString(policy.policyType))
+	}
+	b.WriteString(strings.Join(children, ""))
+	b.WriteString(strings.Join(attachments, ""))
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Lists the IDs of the policies of policyType directly attached to a node.
+func (r cypherRenderer) attachedPolicyIDs(node *orgtree.Node, policyType string, applied []orgtree.Policy) ([]string, error) {
+	if r.client == nil {
+		ids := make([]string, 0, len(applied))
+		for _, policy := range applied {
+			ids = append(ids, policy.ID)
+		}
+		return ids, nil
+	}
+
+	direct, err := r.client.scout().DirectPolicies(r.ctx, node.ID, types.PolicyType(policyType))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(direct))
+	for _, policy := range direct {
+		ids = append(ids, policy.ID)
+	}
+	return ids, nil
+}
+
+func cypherLabel(node *orgtree.Node) string {
+	switch node.Type {
+	case orgtree.RootNode:
+		return "Root"
+	case orgtree.OUNode:
+		return "OrganizationalUnit"
+	case orgtree.OrganizationNode:
+		return "Organization"
+	case orgtree.FolderNode:
+		return "Folder"
+	case orgtree.ProjectNode:
+		return "Project"
+	default:
+		return "Account"
+	}
+}
+
+// Quotes a string literal, escaping the characters Cypher reserves in them.
+func cypherString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(value) + "'"
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ariguillegp/policy-scout/internal/declarativepolicy"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// The AWS SDK version in use predates declarative policies.
+const (
+	declarativePolicyEC2          types.PolicyType          = "DECLARATIVE_POLICY_EC2"
+	effectiveDeclarativePolicyEC2 types.EffectivePolicyType = "DECLARATIVE_POLICY_EC2"
+)
+
+// newDeclarativePolicyCmd creates the aws declarative-policy command.
+func newDeclarativePolicyCmd(deps *dependencies) *cobra.Command {
+	var (
+		accountID    string // account whose effective declarative policy is displayed, or "all"
+		showDocument bool   // display the merged policy document too
+	)
+	declarativePolicyCmd := &cobra.Command{
+		Use:   "declarative-policy",
+		Short: "Displays the EC2 attributes enforced by declarative policies on accounts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayEffectiveDeclarativePolicies(cmd.Context(), deps, accountID, showDocument)
+		},
+	}
+
+	declarativePolicyCmd.Flags().StringVar(&accountID, "account-id", "", `aws account ID that will be analyzed, "all" for every account`)
+	declarativePolicyCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	declarativePolicyCmd.Flags().BoolVar(&showDocument, "show-document", false, "display the merged document of the effective declarative policy")
+
+	return declarativePolicyCmd
+}
+
+// displayEffectiveDeclarativePolicies reports, for every account, the EC2 account
+// attributes (serial console access, image block public access, ...) enforced by
+// the declarative policies it inherits.
+func displayEffectiveDeclarativePolicies(ctx context.Context, deps *dependencies, targetAccountID string, showDocument bool) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	accountIDs, err := resolveAccountIDs(ctx, client, targetAccountID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range accountIDs {
+		name, err := client.scout().Name(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting name for id %s: %w", id, err)
+		}
+
+		content, found, err := getEffectivePolicy(ctx, client, id, effectiveDeclarativePolicyEC2)
+		if err != nil {
+			return err
+		}
+		if !found {
+			fmt.Fprintf(deps.report, "|-- Account: %s [%s]: no EC2 attribute enforced\n", name, id)
+			continue
+		}
+
+		effective, err := declarativepolicy.Parse(content)
+		if err != nil {
+			return fmt.Errorf("effective declarative policy of %s: %w", id, err)
+		}
+
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s]\n", name, id)
+		for _, attribute := range effective.Attributes {
+			fmt.Fprintf(deps.report, "%s|-- %s\n", indent, attribute.Name)
+			for _, setting := range attribute.Settings {
+				fmt.Fprintf(deps.report, "%s%s|-- %s: %s\n", indent, indent, setting.Path, setting.Value)
+			}
+		}
+
+		if showDocument {
+			document, err := prettyDocument(content, indent+indent)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(deps.report, "%s|-- Document:\n%s\n", indent, document)
+		}
+	}
+
+	return nil
+}
+
+// Describes the EC2 attribute settings of an effective declarative policy.
+func describeEffectiveDeclarativePolicy(content string) ([]string, error) {
+	effective, err := declarativepolicy.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, attribute := range effective.Attributes {
+		for _, setting := range attribute.Settings {
+			lines = append(lines, fmt.Sprintf("%s.%s: %s", attribute.Name, setting.Path, setting.Value))
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newDelegatedAdminsCmd creates the aws delegated-admins command.
+func newDelegatedAdminsCmd(deps *dependencies) *cobra.Command {
+	delegatedAdminsCmd := &cobra.Command{
+		Use:   "delegated-admins",
+		Short: "Lists the delegated administrator accounts and the services they administer",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayDelegatedAdministrators(cmd.Context(), deps)
+		},
+	}
+
+	return delegatedAdminsCmd
+}
+
+// displayDelegatedAdministrators lists the accounts AWS services delegated the
+// administration of the org to. They are highly privileged, like the management
+// account, which is displayed along with them.
+func displayDelegatedAdministrators(ctx context.Context, deps *dependencies) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return err
+	}
+	managementName, err := client.scout().Name(ctx, *org.MasterAccountId)
+	if err != nil {
+		return fmt.Errorf("error getting name for id %s: %w", *org.MasterAccountId, err)
+	}
+
+	admins, err := listDelegatedAdministrators(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(deps.report, "Management account: %s [%s]\n", managementName, *org.MasterAccountId)
+	fmt.Fprintln(deps.report, "Delegated administrators:")
+	if len(admins) == 0 {
+		fmt.Fprintf(deps.report, "%s(none)\n", indent)
+	}
+	for _, admin := range admins {
+		excluded, err := isExcluded(ctx, client, *admin.Id)
+		if err != nil {
+			return err
+		}
+		if excluded {
+			continue
+		}
+
+		services, err := listDelegatedServices(ctx, client, *admin.Id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s]\n", *admin.Name, *admin.Id)
+		for _, service := range services {
+			fmt.Fprintf(deps.report, "%s|-- %s\n", indent, service)
+		}
+	}
+
+	return nil
+}
+
+// Lists the delegated administrator accounts of the org, sorted by name.
+func listDelegatedAdministrators(ctx context.Context, client orgAPI) ([]types.DelegatedAdministrator, error) {
+	var admins []types.DelegatedAdministrator
+	paginator := organizations.NewListDelegatedAdministratorsPaginator(client, &organizations.ListDelegatedAdministratorsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing delegated administrators: %w", err)
+		}
+		admins = append(admins, page.DelegatedAdministrators...)
+	}
+
+	sort.Slice(admins, func(i, j int) bool { return *admins[i].Name < *admins[j].Name })
+	return admins, nil
+}
+
+// Lists the service principals a delegated administrator account administers, sorted.
+func listDelegatedServices(ctx context.Context, client orgAPI, accountID string) ([]string, error) {
+	var services []string
+	paginator := organizations.NewListDelegatedServicesForAccountPaginator(client, &organizations.ListDelegatedServicesForAccountInput{AccountId: &accountID})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing delegated services of %s: %w", accountID, err)
+		}
+		for _, service := range page.DelegatedServices {
+			services = append(services, *service.ServicePrincipal)
+		}
+	}
+
+	sort.Strings(services)
+	return services, nil
+}
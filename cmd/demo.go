@@ -0,0 +1,20 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	_ "embed"
+)
+
+// The fictional organization used by --demo, in the snapshot format.
+//
+//go:embed demo/org.json
+var demoSnapshot []byte
+
+// The fictional GCP organization used by --demo, in the GCP snapshot format.
+//
+//go:embed demo/gcp.json
+var demoGCPSnapshot []byte
@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newDeniedServicesCmd creates the aws denied-services command.
+func newDeniedServicesCmd(deps *dependencies) *cobra.Command {
+	var accountID string // account whose denied services are listed
+	deniedServicesCmd := &cobra.Command{
+		Use:   "denied-services",
+		Short: "Lists the AWS services an account can't use, fully or partially, because of its SCPs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listDeniedServices(cmd.Context(), deps, accountID)
+		},
+	}
+
+	deniedServicesCmd.Flags().StringVar(&accountID, "account-id", "", "aws account ID whose denied services are listed")
+	deniedServicesCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	return deniedServicesCmd
+}
+
+// listDeniedServices groups the deny statements inherited by an account by
+// service, and reports the services not allowed at every level of its chain,
+// so application teams know what they can't use.
+func listDeniedServices(ctx context.Context, deps *dependencies, accountID string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	chain, err := getPolicyChain(ctx, client, accountID, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+	account := chain[len(chain)-1]
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+	if accountID == managementAccountID {
+		fmt.Fprintf(deps.report, "%s [%s] is the management account, SCPs don't apply to it: no service is denied\n", account.TargetName, account.TargetID)
+		return nil
+	}
+
+	effective := scp.Analyze(chain)
+	services, broad := scp.DeniedServices(effective.Denies)
+
+	fmt.Fprintf(deps.report, "Services denied to %s [%s]:\n", account.TargetName, account.TargetID)
+	if len(services) == 0 && len(broad) == 0 && coversAllActions(effective.Allowed) {
+		fmt.Fprintf(deps.report, "%s(none)\n", indent)
+	}
+
+	for _, rule := range broad {
+		fmt.Fprintf(deps.report, "|-- Every service: %s\n", formatRule(rule))
+	}
+
+	for _, service := range services {
+		if service.Full {
+			fmt.Fprintf(deps.report, "|-- %s: fully denied\n", service.Service)
+		} else {
+			fmt.Fprintf(deps.report, "|-- %s: partially denied (%s)\n", service.Service, strings.Join(service.Actions, ", "))
+		}
+		for _, rule := range service.Rules {
+			fmt.Fprintf(deps.report, "%s|-- %s\n", indent, formatRule(rule))
+		}
+	}
+
+	// Without an allow-all policy at every level, whatever isn't allowed is denied
+	if !coversAllActions(effective.Allowed) {
+		allowed := "nothing"
+		if len(effective.Allowed) > 0 {
+			allowed = strings.Join(effective.Allowed, ", ")
+		}
+		fmt.Fprintf(deps.report, "|-- Every other service: implicitly denied, the SCPs of every level only allow %s\n", allowed)
+	}
+
+	return nil
+}
+
+// Reports whether the allowed action patterns include every action.
+func coversAllActions(allowed []string) bool {
+	for _, pattern := range allowed {
+		if scp.Covers(pattern, "*:*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+)
+
+// dependencies are the resources of the outside world used by the commands,
+// along with the state of the run they share. Execute builds the commands with
+// the real ones, end-to-end tests can build them with a fake organization (see
+// awsorgtest) and capture their output.
+type dependencies struct {
+	organizations  func(ctx context.Context) (orgOperations, error)                        // client of the analyzed organization, see orgClient
+	orgSource      func(ctx context.Context, org orgSource) (orgOperations, error)         // client of one of the organizations of the config file
+	orgCaller      func(ctx context.Context, org orgSource) (callerIdentity, error)        // who the credentials of one of those organizations are
+	caller         func(ctx context.Context) (callerIdentity, error)                       // who the credentials of the analyzed organization are
+	accountClient  func(ctx context.Context) (accountAPI, error)                           // client of the Account Management API of that organization
+	iamClient      func(ctx context.Context, accountID, accessRole string) (iamAPI, error) // client of the IAM of a member account
+	identityCenter func(ctx context.Context) (identityCenterAPI, error)                    // client of the Identity Center of that organization
+	stsClient      func(cfg aws.Config) stsAPI                                             // who the credentials of cfg are
+	accountAliases func(cfg aws.Config) accountAliasAPI                                    // alias of the account of the credentials of cfg
+	accessAnalyzer func(ctx context.Context) (accessAnalyzerAPI, error)                    // validates the policies with --access-analyzer
+	s3Client       func(ctx context.Context) (s3API, error)                                // where reports are sent and published to
+	securityHub    func(ctx context.Context) (*securityHub, error)                         // where the findings are published
+	history        func(ctx context.Context) (historyAPI, error)                           // client of the DynamoDB table keeping the history of the scans
+	snsClient      func(ctx context.Context, region string) (snsAPI, error)                // client of the SNS topics notified
+	cloudWatch     func(ctx context.Context) (cloudWatchAPI, error)                        // where the metrics are published
+	sqsClient      func(ctx context.Context, region string) (sqsAPI, error)                // client of the queue receiving the events of the organization
+	gcpClient      func(ctx context.Context) (gcpAPI, error)                               // client of the analyzed GCP organization
+	stdout         io.Writer                                                               // reports sent to "-" and progress messages
+	stderr         io.Writer                                                               // warnings and diagnostics
+	httpClient     *http.Client                                                            // reports sent to https://, Slack and the Pushgateway
+	now            func() time.Time                                                        // clock, e.g. to age the warm cache
+
+	options     runOptions    // flags shared by the commands and settings of the config file
+	scanMu      sync.Mutex    // guards scan
+	scan        *scanClient   // client of the analyzed organization, created once per run by orgClient
+	standalone  atomic.Bool   // set when the Organizations API reports a standalone account, see standaloneMiddleware
+	cache       *scanCache    // API results of the run, along with the warm cache and the checkpoint
+	progress    *scanProgress // progress of the scan, counting even when nothing is displayed
+	profile     *scanProfile  // where the time of the run went, see --profile-scan
+	logger      *slog.Logger  // logger selected by --verbose, --debug and --log-format
+	report      io.Writer     // what commands write their reports to, see openReportSink
+	sink        sink          // destination of --report-to
+	publication bytes.Buffer  // copy of what is archived with --publish s3://
+}
+
+// The dependencies used when running policy-scout.
+func defaultDependencies() *dependencies {
+	d := newDependencies(os.Stdout, os.Stderr)
+	d.organizations = d.newOrgClient
+	d.orgSource = d.newOrgSourceClient
+	d.orgCaller = d.orgSourceCaller
+	d.caller = d.analyzedOrgCaller
+	d.accountClient = d.newAccountClient
+	d.iamClient = d.newIAMClient
+	d.identityCenter = d.newIdentityCenterClient
+	d.stsClient = newSTSClient
+	d.accountAliases = newAccountAliasClient
+	d.accessAnalyzer = d.newAccessAnalyzerClient
+	d.s3Client = d.newS3Client
+	d.securityHub = d.newSecurityHub
+	d.history = d.newHistoryClient
+	d.snsClient = d.newSNSClient
+	d.cloudWatch = d.newCloudWatchClient
+	d.sqsClient = d.newSQSClient
+	d.gcpClient = d.newGCPClient
+	return d
+}
+
+// Creates dependencies writing to stdout and stderr, with a fresh state and no
+// clients.
+func newDependencies(stdout, stderr io.Writer) *dependencies {
+	return &dependencies{
+		stdout:     stdout,
+		stderr:     stderr,
+		httpClient: http.DefaultClient,
+		now:        time.Now,
+		options:    newRunOptions(),
+		cache:      newScanCache(),
+		progress:   &scanProgress{},
+		profile:    newScanProfile(),
+		// Until the flags are parsed, only warnings are logged
+		logger: slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+		report: stdout,
+	}
+}
+
+// Creates the Organizations client of the org being analyzed: the one of the
+// local AWS config, of the audit role, of the demo or of the snapshot.
+func (d *dependencies) newOrgClient(ctx context.Context) (orgOperations, error) {
+	snapshot, err := offlineSnapshot(&d.options)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		return snapshot, nil
+	}
+
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return organizations.NewFromConfig(cfg), nil
+}
+
+// Creates the Organizations client of one of the organizations of the config
+// file, see loadOrgSourceConfig.
+func (d *dependencies) newOrgSourceClient(ctx context.Context, org orgSource) (orgOperations, error) {
+	if org.Snapshot != "" {
+		return readSnapshot(org.Snapshot)
+	}
+
+	cfg, err := d.loadOrgSourceConfig(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return organizations.NewFromConfig(cfg), nil
+}
+
+// Gets the caller identity of the credentials of one of the organizations of
+// the config file.
+func (d *dependencies) orgSourceCaller(ctx context.Context, org orgSource) (callerIdentity, error) {
+	cfg, err := d.loadOrgSourceConfig(ctx, org)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	return d.getCallerIdentity(ctx, cfg)
+}
+
+// Gets the caller identity of the credentials of the analyzed organization,
+// the ones of the local AWS config or of the audit role, along with the alias
+// of their account.
+func (d *dependencies) analyzedOrgCaller(ctx context.Context) (callerIdentity, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	caller, err := d.getCallerIdentity(ctx, cfg)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	// The alias is optional, and so is the permission to read it
+	if aliases, err := d.accountAliases(cfg).ListAccountAliases(ctx, &iam.ListAccountAliasesInput{}); err == nil && len(aliases.AccountAliases) > 0 {
+		caller.Alias = aliases.AccountAliases[0]
+	}
+	return caller, nil
+}
+
+// orgClient returns the client of the analyzed organization, along with the
+// Scout reading it. The same client is returned for the whole run, so the
+// organization and its root are only described once.
+func (d *dependencies) orgClient(ctx context.Context) (orgAPI, error) {
+	d.scanMu.Lock()
+	defer d.scanMu.Unlock()
+	if d.scan != nil {
+		return d.scan, nil
+	}
+
+	client, err := d.organizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.scan = d.newScanClient(client)
+	return d.scan, nil
+}
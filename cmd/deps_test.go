@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	analyzertypes "github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// An HTTP transport keeping the requests sent, answered with status.
+type fakeTransport struct {
+	status   int
+	requests []string // method, URL and body of every request
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.requests = append(f.requests, req.Method+" "+req.URL.String()+"\n"+string(body))
+	return &http.Response{StatusCode: f.status, Status: http.StatusText(f.status), Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+// An S3 client keeping the objects put.
+type fakeS3 struct {
+	objects map[string]string // body by bucket/key
+}
+
+func (f *fakeS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = string(body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestReportDestinations(t *testing.T) {
+	const tree = "|-- Account: payments [222222222222]"
+
+	t.Run("https", func(t *testing.T) {
+		transport := &fakeTransport{status: http.StatusOK}
+		got, err := runCommandWith(t, func(deps *dependencies) {
+			deps.organizations = func(context.Context) (orgOperations, error) { return newTestOrg(), nil }
+			deps.httpClient = &http.Client{Transport: transport}
+		}, "--report-to", "https://reports.example.com/scans", "aws", "tree")
+		if err != nil {
+			t.Fatalf("tree: %v", err)
+		}
+		if got != "" {
+			t.Errorf("tree wrote %q to stdout, want it sent", got)
+		}
+		if len(transport.requests) != 1 || !strings.HasPrefix(transport.requests[0], "POST https://reports.example.com/scans\n") || !strings.Contains(transport.requests[0], tree) {
+			t.Errorf("requests = %q, want the report posted", transport.requests)
+		}
+	})
+
+	t.Run("https error", func(t *testing.T) {
+		_, err := runCommandWith(t, func(deps *dependencies) {
+			deps.organizations = func(context.Context) (orgOperations, error) { return newTestOrg(), nil }
+			deps.httpClient = &http.Client{Transport: &fakeTransport{status: http.StatusForbidden}}
+		}, "--report-to", "https://reports.example.com/scans", "aws", "tree")
+		if err == nil || !strings.Contains(err.Error(), "unexpected status Forbidden") {
+			t.Errorf("error = %v, want the status of the response", err)
+		}
+	})
+
+	t.Run("s3", func(t *testing.T) {
+		bucket := &fakeS3{objects: map[string]string{}}
+		_, err := runCommandWith(t, func(deps *dependencies) {
+			deps.organizations = func(context.Context) (orgOperations, error) { return newTestOrg(), nil }
+			deps.s3Client = func(context.Context) (s3API, error) { return bucket, nil }
+		}, "--report-to", "s3://reports/scans/tree.txt", "aws", "tree")
+		if err != nil {
+			t.Fatalf("tree: %v", err)
+		}
+		if !strings.Contains(bucket.objects["reports/scans/tree.txt"], tree) {
+			t.Errorf("objects = %q, want the report in reports/scans/tree.txt", bucket.objects)
+		}
+	})
+}
+
+func TestMetricsPushgateway(t *testing.T) {
+	transport := &fakeTransport{status: http.StatusOK}
+	_, err := runCommandWith(t, func(deps *dependencies) {
+		deps.organizations = func(context.Context) (orgOperations, error) { return newTestOrg(), nil }
+		deps.httpClient = &http.Client{Transport: transport}
+		deps.now = func() time.Time { return time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC) }
+	}, "aws", "metrics", "--pushgateway", "http://pushgateway:9091/")
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	if len(transport.requests) != 1 || !strings.HasPrefix(transport.requests[0], "PUT http://pushgateway:9091/metrics/job/policy-scout/organization_id/o-example\n") {
+		t.Fatalf("requests = %q, want the metrics pushed to the group of the organization", transport.requests)
+	}
+	for _, want := range []string{
+		`policy_scout_account_count{organization_id="o-example"} 3`,
+		`policy_scout_scan_duration_seconds{organization_id="o-example"} 0`,
+		`policy_scout_scan_timestamp_seconds{organization_id="o-example"} 1714521600`,
+	} {
+		if !strings.Contains(transport.requests[0], want+"\n") {
+			t.Errorf("metrics pushed:\n%s\nwant them to contain %s", transport.requests[0], want)
+		}
+	}
+}
+
+// An Access Analyzer client with the same findings for every policy.
+type fakeAccessAnalyzer struct {
+	findings []analyzertypes.ValidatePolicyFinding
+}
+
+func (f fakeAccessAnalyzer) ValidatePolicy(context.Context, *accessanalyzer.ValidatePolicyInput, ...func(*accessanalyzer.Options)) (*accessanalyzer.ValidatePolicyOutput, error) {
+	return &accessanalyzer.ValidatePolicyOutput{Findings: f.findings}, nil
+}
+
+func TestLintAccessAnalyzer(t *testing.T) {
+	analyzer := fakeAccessAnalyzer{findings: []analyzertypes.ValidatePolicyFinding{{
+		FindingType:    analyzertypes.ValidatePolicyFindingTypeSuggestion,
+		IssueCode:      aws.String("EMPTY_ARRAY_CONDITION"),
+		FindingDetails: aws.String("Add a value to the empty array."),
+		Locations: []analyzertypes.Location{{Path: []analyzertypes.PathElement{
+			&analyzertypes.PathElementMemberValue{Value: "Statement"},
+			&analyzertypes.PathElementMemberIndex{Value: 0},
+		}}},
+	}}}
+
+	got, err := runCommandWith(t, func(deps *dependencies) {
+		deps.organizations = func(context.Context) (orgOperations, error) { return newTestOrg(), nil }
+		deps.accessAnalyzer = func(context.Context) (accessAnalyzerAPI, error) { return analyzer, nil }
+	}, "aws", "lint", "--access-analyzer")
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	want := "|-- deny-leave [p-denyleave]\n" + indent + "|-- suggestion access-analyzer/EMPTY_ARRAY_CONDITION: Statement[0]: Add a value to the empty array.\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("lint wrote:\n%s\nwant it to contain:\n%s", got, want)
+	}
+}
+
+type fakeSTS struct{ account, arn string }
+
+func (f fakeSTS) GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: &f.account, Arn: &f.arn}, nil
+}
+
+type fakeAccountAliases []string
+
+func (f fakeAccountAliases) ListAccountAliases(context.Context, *iam.ListAccountAliasesInput, ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error) {
+	return &iam.ListAccountAliasesOutput{AccountAliases: f}, nil
+}
+
+func TestAnalyzedOrgCaller(t *testing.T) {
+	const arn = "arn:aws:sts::111111111111:assumed-role/auditor/alice"
+
+	tests := []struct {
+		name    string
+		aliases fakeAccountAliases
+		want    callerIdentity
+	}{
+		{"alias", fakeAccountAliases{"example-management"}, callerIdentity{AccountID: "111111111111", ARN: arn, Alias: "example-management"}},
+		{"no alias", nil, callerIdentity{AccountID: "111111111111", ARN: arn}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := newDependencies(io.Discard, io.Discard)
+			// No AWS config is loaded in demo mode
+			deps.options.demo = true
+			deps.stsClient = func(aws.Config) stsAPI { return fakeSTS{"111111111111", arn} }
+			deps.accountAliases = func(aws.Config) accountAliasAPI { return tt.aliases }
+
+			got, err := deps.analyzedOrgCaller(context.Background())
+			if err != nil {
+				t.Fatalf("analyzedOrgCaller: %v", err)
+			}
+			got.Region = ""
+			if got != tt.want {
+				t.Errorf("analyzedOrgCaller() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A fake organization counting the times it is described.
+type describeCountingOrg struct {
+	*awsorgtest.Org
+	describes int
+}
+
+func (o *describeCountingOrg) DescribeOrganization(ctx context.Context, params *organizations.DescribeOrganizationInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error) {
+	o.describes++
+	return o.Org.DescribeOrganization(ctx, params, optFns...)
+}
+
+func TestOrganizationDescribedOnce(t *testing.T) {
+	org := &describeCountingOrg{Org: newTestOrg()}
+	clients := 0
+	_, err := runCommandWith(t, func(deps *dependencies) {
+		deps.organizations = func(context.Context) (orgOperations, error) {
+			clients++
+			return org, nil
+		}
+	}, "aws", "tree", "--checkpoint-file", filepath.Join(t.TempDir(), "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("tree: %v", err)
+	}
+	// Both the checkpoint and every account of the tree need the organization
+	if clients != 1 || org.describes != 1 {
+		t.Errorf("%d clients created and the organization described %d times, want both once", clients, org.describes)
+	}
+}
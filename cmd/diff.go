@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// diffOptions are the flags of the aws diff command.
+type diffOptions struct {
+	accountIDs    []string // the two accounts compared
+	showDocuments bool     // display the merged SCP document of each account
+}
+
+// newDiffCmd creates the aws diff command.
+func newDiffCmd(deps *dependencies) *cobra.Command {
+	options := &diffOptions{}
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compares the effective SCPs of two accounts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return diffAccounts(cmd.Context(), deps, options.accountIDs, options.showDocuments)
+		},
+	}
+
+	diffCmd.Flags().StringSliceVar(&options.accountIDs, "account-id", nil, "the two aws account IDs to compare (repeatable)")
+	diffCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	diffCmd.Flags().BoolVar(&options.showDocuments, "show-documents", false, "display the merged SCP document (every statement of the chain) of each account")
+
+	return diffCmd
+}
+
+// diffAccounts computes the effective permissions of both accounts and reports
+// what each one is allowed or denied that the other one isn't.
+func diffAccounts(ctx context.Context, deps *dependencies, accountIDs []string, showDocuments bool) error {
+	if len(accountIDs) != 2 {
+		return errors.New("exactly two account IDs are required for a diff")
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var chains [2][]scp.Level
+	var effective [2]scp.Effective
+	var labels [2]string
+	for i, id := range accountIDs {
+		if chains[i], err = getPolicyChain(ctx, client, id, types.PolicyTypeServiceControlPolicy); err != nil {
+			return err
+		}
+		effective[i] = analyzeChain(chains[i], managementAccountID)
+		account := chains[i][len(chains[i])-1]
+		labels[i] = fmt.Sprintf("%s [%s]", account.TargetName, account.TargetID)
+		if id == managementAccountID {
+			labels[i] = fmt.Sprintf("%s (Management Account) [%s]", account.TargetName, account.TargetID)
+		}
+	}
+
+	for i, j := range []int{1, 0} {
+		fmt.Fprintf(deps.report, "Only %s is allowed:\n", labels[i])
+		printPatterns(deps.report, onlyAllowedIn(effective[i].Allowed, effective[j].Allowed))
+	}
+
+	for i, j := range []int{1, 0} {
+		fmt.Fprintf(deps.report, "Only %s is denied:\n", labels[i])
+		denies := onlyDeniedIn(effective[i].Denies, effective[j].Denies)
+		if len(denies) == 0 {
+			fmt.Fprintf(deps.report, "%s(none)\n", indent)
+		}
+		for _, deny := range denies {
+			fmt.Fprintf(deps.report, "%s%s\n", indent, formatRule(deny))
+		}
+	}
+
+	if showDocuments {
+		for i := range chains {
+			document, err := mergedDocument(chains[i])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(deps.report, "Merged SCP document of %s:\n%s\n", labels[i], document)
+		}
+	}
+
+	return nil
+}
+
+func printPatterns(w io.Writer, patterns []string) {
+	if len(patterns) == 0 {
+		fmt.Fprintf(w, "%s(none)\n", indent)
+	}
+	for _, pattern := range patterns {
+		fmt.Fprintf(w, "%s%s\n", indent, pattern)
+	}
+}
+
+// Returns the patterns allowed in a that b doesn't fully allow.
+func onlyAllowedIn(a, b []string) []string {
+	var result []string
+	for _, p := range a {
+		covered := false
+		for _, q := range b {
+			if scp.Covers(q, p) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Returns the deny statements of a that b doesn't have. Statements are compared by
+// content, regardless of their Sid and of where they are attached.
+func onlyDeniedIn(a, b []scp.Rule) []scp.Rule {
+	keys := map[string]bool{}
+	for _, rule := range b {
+		keys[rule.Statement.Key()] = true
+	}
+
+	var result []scp.Rule
+	for _, rule := range a {
+		if !keys[rule.Statement.Key()] {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// Merges every statement of the chain into a single document, from the root down.
+func mergedDocument(chain []scp.Level) (string, error) {
+	merged := struct {
+		Version   string          `json:"Version"`
+		Statement []scp.Statement `json:"Statement"`
+	}{Version: "2012-10-17"}
+
+	for _, level := range chain {
+		for _, policy := range level.Policies {
+			merged.Statement = append(merged.Statement, policy.Document.Statement...)
+		}
+	}
+
+	document, err := json.MarshalIndent(merged, indent, "  ")
+	if err != nil {
+		return "", err
+	}
+	return indent + string(document), nil
+}
@@ -0,0 +1,285 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// snapshotDiffOptions are the flags of the aws snapshot diff command.
+type snapshotDiffOptions struct {
+	oldSnapshot string // snapshot taken first, e.g. during the last audit
+	from        string // date of the snapshot of the history used instead of --old
+	newSnapshot string // snapshot compared with it, the live organization if empty
+}
+
+// newSnapshotDiffCmd creates the aws snapshot diff command.
+func newSnapshotDiffCmd(deps *dependencies) *cobra.Command {
+	options := &snapshotDiffOptions{}
+	snapshotDiffCmd := &cobra.Command{
+		Use:         "diff",
+		Short:       "Reports the drift between two snapshots, or between a snapshot and the live organization",
+		Annotations: map[string]string{driftAnnotation: "true", metricsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return diffSnapshots(cmd.Context(), deps, options.oldSnapshot, options.from, options.newSnapshot)
+		},
+	}
+
+	snapshotDiffCmd.Flags().StringVar(&options.oldSnapshot, "old", "", "snapshot used as the reference, e.g. the one of the last audit")
+	snapshotDiffCmd.Flags().StringVar(&options.from, "from", "", "use the last snapshot of the --history-table taken on or before this date (2006-01-02 or RFC 3339) as the reference")
+	snapshotDiffCmd.MarkFlagsOneRequired("old", "from")
+	snapshotDiffCmd.MarkFlagsMutuallyExclusive("old", "from")
+	snapshotDiffCmd.Flags().StringVar(&options.newSnapshot, "new", "", "snapshot compared with the reference (defaults to the live organization)")
+
+	return snapshotDiffCmd
+}
+
+// diffSnapshots reports the accounts added, removed and moved, the OUs added and
+// removed, and the SCPs whose attachments or documents changed. The reference is
+// the snapshot at oldPath, or the one of the history at the date from.
+func diffSnapshots(ctx context.Context, deps *dependencies, oldPath, from, newPath string) error {
+	before := ""
+	if from != "" {
+		if deps.options.historyTable == "" {
+			return errors.New("--from reads the snapshots kept in a DynamoDB table, set it with --history-table")
+		}
+		_, end, err := parseHistoryDate(from)
+		if err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+		before = end.Format(time.RFC3339)
+	}
+
+	var current *orgSnapshot
+	var err error
+	newLabel := newPath
+	if newPath != "" {
+		if current, err = readSnapshot(newPath); err != nil {
+			return err
+		}
+	} else {
+		client, err := deps.orgClient(ctx)
+		if err != nil {
+			return err
+		}
+		if current, err = captureSnapshot(ctx, client); err != nil {
+			return err
+		}
+		newLabel = "the live organization"
+	}
+
+	var old *orgSnapshot
+	oldLabel := oldPath
+	if from != "" {
+		client, err := deps.history(ctx)
+		if err != nil {
+			return err
+		}
+		var entry historyEntry
+		if old, entry, err = latestSnapshot(ctx, client, deps.options.historyTable, current.ID, before); err != nil {
+			return err
+		}
+		oldLabel = fmt.Sprintf("the snapshot of %s", entry.ScannedAt)
+	} else if old, err = readSnapshot(oldPath); err != nil {
+		return err
+	}
+
+	if old.ID != current.ID {
+		fmt.Fprintf(deps.stderr, "Warning: comparing different organizations (%s and %s)\n", old.ID, current.ID)
+	}
+
+	report := compareSnapshots(old, current, oldLabel, newLabel)
+	printDrift(deps.report, report)
+	if err := publishMetrics(ctx, deps, report.organizationID, []cloudWatchMetric{{name: driftMetric, unit: cloudwatchtypes.StandardUnitCount, value: float64(report.total())}}); err != nil {
+		return err
+	}
+	return notifyDrift(ctx, deps, report)
+}
+
+// Computes the drift from old to current, labels name both states in the report.
+func compareSnapshots(old, current *orgSnapshot, oldLabel, newLabel string) driftReport {
+	return driftReport{
+		organizationID: current.ID,
+		from:           oldLabel,
+		to:             newLabel,
+		sections: []driftSection{
+			{"Accounts added", addedAccounts(old, current)},
+			{"Accounts removed", addedAccounts(current, old)},
+			{"Accounts moved", movedAccounts(old, current)},
+			{"OUs added", addedOUs(old, current)},
+			{"OUs removed", addedOUs(current, old)},
+			{"SCP changes", changedSCPs(old, current)},
+		},
+	}
+}
+
+func printDrift(w io.Writer, report driftReport) {
+	fmt.Fprintf(w, "Drift from %s to %s:\n", report.from, report.to)
+	for _, section := range report.sections {
+		if len(section.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "|-- %s:\n", section.title)
+		for _, change := range section.changes {
+			fmt.Fprintf(w, "%s|-- %s\n", indent, change)
+		}
+	}
+	if report.total() == 0 {
+		fmt.Fprintln(w, "No drift")
+	} else {
+		fmt.Fprintf(w, "%d changes\n", report.total())
+	}
+}
+
+func readSnapshot(path string) (*orgSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read snapshot: %w", err)
+	}
+	snapshot, err := parseSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// Lists the accounts of b that are not in a.
+func addedAccounts(a, b *orgSnapshot) []string {
+	var changes []string
+	for _, account := range b.Accounts {
+		if _, ok := a.account(account.ID); !ok {
+			changes = append(changes, fmt.Sprintf("%s [%s] in %s", account.Name, account.ID, b.path(account.ParentID)))
+		}
+	}
+	return changes
+}
+
+// Lists the accounts whose location changed. OUs are compared by path, so
+// recreating an OU with the same name isn't reported as moving its accounts.
+func movedAccounts(old, current *orgSnapshot) []string {
+	var changes []string
+	for _, account := range current.Accounts {
+		before, ok := old.account(account.ID)
+		if !ok {
+			continue
+		}
+		if from, to := old.path(before.ParentID), current.path(account.ParentID); from != to {
+			changes = append(changes, fmt.Sprintf("%s [%s]: %s -> %s", account.Name, account.ID, from, to))
+		}
+	}
+	return changes
+}
+
+// Lists the OUs of b that are not in a.
+func addedOUs(a, b *orgSnapshot) []string {
+	var changes []string
+	for _, ou := range b.OUs {
+		if _, ok := a.parent(ou.ID); !ok {
+			changes = append(changes, fmt.Sprintf("%s [%s]", b.path(ou.ID), ou.ID))
+		}
+	}
+	return changes
+}
+
+// Lists the SCPs created, deleted, attached, detached or whose document changed.
+func changedSCPs(old, current *orgSnapshot) []string {
+	var changes []string
+	for _, policy := range current.Policies {
+		if policy.Type != string(types.PolicyTypeServiceControlPolicy) {
+			continue
+		}
+		before, ok := old.policy(policy.ID)
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s [%s]: created, attached to %s", policy.Name, policy.ID, current.targetNames(policy.Targets)))
+			continue
+		}
+
+		if attached := missingIDs(before.Targets, policy.Targets); len(attached) > 0 {
+			changes = append(changes, fmt.Sprintf("%s [%s]: attached to %s", policy.Name, policy.ID, current.targetNames(attached)))
+		}
+		if detached := missingIDs(policy.Targets, before.Targets); len(detached) > 0 {
+			changes = append(changes, fmt.Sprintf("%s [%s]: detached from %s", policy.Name, policy.ID, old.targetNames(detached)))
+		}
+		if compactJSON(before.Content) != compactJSON(policy.Content) {
+			changes = append(changes, fmt.Sprintf("%s [%s]: document changed", policy.Name, policy.ID))
+		}
+		if before.Name != policy.Name {
+			changes = append(changes, fmt.Sprintf("%s [%s]: renamed from %s", policy.Name, policy.ID, before.Name))
+		}
+	}
+
+	for _, policy := range old.Policies {
+		if policy.Type != string(types.PolicyTypeServiceControlPolicy) {
+			continue
+		}
+		if _, ok := current.policy(policy.ID); !ok {
+			changes = append(changes, fmt.Sprintf("%s [%s]: deleted, was attached to %s", policy.Name, policy.ID, old.targetNames(policy.Targets)))
+		}
+	}
+	return changes
+}
+
+// Returns the IDs of b that are not in a, sorted.
+func missingIDs(a, b []string) []string {
+	present := map[string]bool{}
+	for _, id := range a {
+		present[id] = true
+	}
+	var missing []string
+	for _, id := range b {
+		if !present[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Builds the path of an entity from the root, e.g. /Root/Workloads/Production.
+func (o *orgSnapshot) path(id string) string {
+	var names []string
+	for current, ok := id, true; ok && current != ""; current, ok = o.parent(current) {
+		names = append([]string{o.name(current)}, names...)
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+func (o *orgSnapshot) name(id string) string {
+	if id == o.RootID {
+		return "Root"
+	}
+	if account, ok := o.account(id); ok {
+		return account.Name
+	}
+	for _, ou := range o.OUs {
+		if ou.ID == id {
+			return ou.Name
+		}
+	}
+	return id
+}
+
+func (o *orgSnapshot) targetNames(ids []string) string {
+	if len(ids) == 0 {
+		return "nothing"
+	}
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, fmt.Sprintf("%s [%s]", o.name(id), id))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// Takes a snapshot of org with aws snapshot, returning its path.
+func snapshotOf(t *testing.T, org *awsorgtest.Org) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if _, err := runCommand(t, org, "aws", "snapshot", "--out", path); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	return path
+}
+
+// The test org some time later: legacy was closed, payments moved to a new
+// Production OU, ledger was created, and the SCPs changed.
+func newDriftedOrg() *awsorgtest.Org {
+	return awsorgtest.New("o-example", "r-root", "111111111111").
+		AddAccount("r-root", "111111111111", "management", types.AccountStatusActive).
+		AddOU("r-root", "ou-root-work", "Workloads").
+		AddOU("ou-root-work", "ou-work-prod", "Production").
+		AddAccount("ou-work-prod", "222222222222", "payments", types.AccountStatusActive).
+		AddAccount("ou-root-work", "444444444444", "ledger", types.AccountStatusActive).
+		AddPolicy("p-FullAWSAccess", "FullAWSAccess", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`).
+		AddPolicy("p-denyleave", "deny-leaving", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":["organizations:LeaveOrganization"],"Resource":"*"}]}`).
+		AddPolicy("p-regions", "deny-regions", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","NotAction":"iam:*","Resource":"*","Condition":{"StringNotEquals":{"aws:RequestedRegion":"eu-west-1"}}}]}`).
+		AttachPolicy("r-root", "p-FullAWSAccess").
+		AttachPolicy("r-root", "p-denyleave").
+		AttachPolicy("ou-work-prod", "p-regions")
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	drift := "|-- Accounts added:\n" + indent + "|-- ledger [444444444444] in /Root/Workloads\n" +
+		"|-- Accounts removed:\n" + indent + "|-- legacy [333333333333] in /Root/Workloads\n" +
+		"|-- Accounts moved:\n" + indent + "|-- payments [222222222222]: /Root/Workloads -> /Root/Workloads/Production\n" +
+		"|-- OUs added:\n" + indent + "|-- /Root/Workloads/Production [ou-work-prod]\n" +
+		"|-- SCP changes:\n" +
+		indent + "|-- deny-leaving [p-denyleave]: attached to Root [r-root]\n" +
+		indent + "|-- deny-leaving [p-denyleave]: detached from Workloads [ou-root-work]\n" +
+		indent + "|-- deny-leaving [p-denyleave]: document changed\n" +
+		indent + "|-- deny-leaving [p-denyleave]: renamed from deny-leave\n" +
+		indent + "|-- deny-regions [p-regions]: created, attached to Production [ou-work-prod]\n" +
+		"9 changes\n"
+	reverted := "|-- Accounts added:\n" + indent + "|-- legacy [333333333333] in /Root/Workloads\n" +
+		"|-- Accounts removed:\n" + indent + "|-- ledger [444444444444] in /Root/Workloads\n" +
+		"|-- Accounts moved:\n" + indent + "|-- payments [222222222222]: /Root/Workloads/Production -> /Root/Workloads\n" +
+		"|-- OUs removed:\n" + indent + "|-- /Root/Workloads/Production [ou-work-prod]\n" +
+		"|-- SCP changes:\n" +
+		indent + "|-- deny-leave [p-denyleave]: attached to Workloads [ou-root-work]\n" +
+		indent + "|-- deny-leave [p-denyleave]: detached from Root [r-root]\n" +
+		indent + "|-- deny-leave [p-denyleave]: document changed\n" +
+		indent + "|-- deny-leave [p-denyleave]: renamed from deny-leaving\n" +
+		indent + "|-- deny-regions [p-regions]: deleted, was attached to Production [ou-work-prod]\n" +
+		"9 changes\n"
+	empty := func() *awsorgtest.Org { return awsorgtest.New("o-example", "r-root", "111111111111") }
+
+	tests := []struct {
+		name     string
+		old      *awsorgtest.Org
+		current  *awsorgtest.Org
+		snapshot bool // whether the current org is compared through a snapshot instead of live
+		want     string
+	}{
+		{"no drift", newTestOrg(), newTestOrg(), false, "No drift\n"},
+		{"drift from the live organization", newTestOrg(), newDriftedOrg(), false, drift},
+		{"drift between snapshots", newTestOrg(), newDriftedOrg(), true, drift},
+		{"reverted drift", newDriftedOrg(), newTestOrg(), true, reverted},
+		{"empty organization", empty(), empty(), false, "No drift\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := snapshotOf(t, tt.old)
+			args := []string{"aws", "snapshot", "diff", "--old", old}
+			to := "the live organization"
+			if tt.snapshot {
+				to = snapshotOf(t, tt.current)
+				args = append(args, "--new", to)
+			}
+
+			got, err := runCommand(t, tt.current, args...)
+			if err != nil {
+				t.Fatalf("snapshot diff: %v", err)
+			}
+			if want := "Drift from " + old + " to " + to + ":\n" + tt.want; got != want {
+				t.Errorf("snapshot diff wrote:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSnapshotDiffErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no reference", nil, "at least one of the flags in the group [old from] is required"},
+		{"history without a table", []string{"--from", "2024-05-01"}, "--from reads the snapshots kept in a DynamoDB table"},
+		{"missing snapshot", []string{"--old", "missing.json"}, "couldn't read snapshot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runCommand(t, newTestOrg(), append([]string{"aws", "snapshot", "diff"}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
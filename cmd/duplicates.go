@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newDuplicatesCmd creates the aws duplicates command.
+func newDuplicatesCmd(deps *dependencies) *cobra.Command {
+	var ignorePlusAddressing bool // aws+prod@example.com and aws+dev@example.com collide
+	duplicatesCmd := &cobra.Command{
+		Use:   "duplicates",
+		Short: "Flags accounts sharing a name or an email address",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return findDuplicateAccounts(cmd.Context(), deps, ignorePlusAddressing)
+		},
+	}
+
+	duplicatesCmd.Flags().BoolVar(&ignorePlusAddressing, "ignore-plus-addressing", false, "also flag the emails of the same mailbox once the plus-addressing tag is removed (aws+prod@example.com and aws+dev@example.com)")
+
+	return duplicatesCmd
+}
+
+// Normalizes an account name so names differing only in case or spacing collide.
+func normalizeAccountName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// Normalizes an email address, ignoring its case. With ignorePlusAddressing,
+// its plus-addressing tag is dropped too, so aws+prod@example.com and
+// aws+dev@example.com are considered the same mailbox.
+func normalizeAccountEmail(email string, ignorePlusAddressing bool) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || !ignorePlusAddressing {
+		return email
+	}
+	if tag := strings.Index(local, "+"); tag >= 0 {
+		local = local[:tag]
+	}
+	return local + "@" + domain
+}
+
+// Groups the accounts by a normalized key, keeping only the groups with collisions.
+func groupCollisions(accounts []types.Account, key func(types.Account) string) map[string][]types.Account {
+	groups := map[string][]types.Account{}
+	for _, account := range accounts {
+		groups[key(account)] = append(groups[key(account)], account)
+	}
+	for k, group := range groups {
+		if len(group) < 2 {
+			delete(groups, k)
+		}
+	}
+	return groups
+}
+
+// Prints the groups of colliding accounts, sorted by key.
+func printCollisions(w io.Writer, title string, groups map[string][]types.Account) {
+	fmt.Fprintln(w, title)
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "|-- %s\n", key)
+		for _, account := range groups[key] {
+			fmt.Fprintf(w, "%s|-- Account: %s [%s] <%s>\n", indent, *account.Name, *account.Id, *account.Email)
+		}
+	}
+}
+
+// findDuplicateAccounts reports the accounts sharing a name (ignoring case and
+// spacing) and the ones sharing an email, which are easily mixed up during
+// incidents. Plus-addressing is a common way of giving every account its own
+// email, so emails only sharing their mailbox are reported with
+// ignorePlusAddressing.
+func findDuplicateAccounts(ctx context.Context, deps *dependencies, ignorePlusAddressing bool) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	all, err := client.scout().Accounts(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing accounts: %w", err)
+	}
+
+	var accounts []types.Account
+	for _, account := range all {
+		excluded, err := isAccountOutOfScope(ctx, client, *account.Id)
+		if err != nil {
+			return err
+		}
+		if !excluded {
+			accounts = append(accounts, account)
+		}
+	}
+
+	names := groupCollisions(accounts, func(account types.Account) string { return normalizeAccountName(*account.Name) })
+	emails := groupCollisions(accounts, func(account types.Account) string {
+		return normalizeAccountEmail(*account.Email, ignorePlusAddressing)
+	})
+
+	printCollisions(deps.report, "Accounts sharing a name:", names)
+	if ignorePlusAddressing {
+		printCollisions(deps.report, "Accounts sharing an email mailbox (ignoring plus-addressing):", emails)
+	} else {
+		printCollisions(deps.report, "Accounts sharing an email:", emails)
+	}
+	fmt.Fprintf(deps.report, "%d name collisions and %d email collisions in %d accounts\n", len(names), len(emails), len(accounts))
+
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+func TestDuplicates(t *testing.T) {
+	// The test org gives every account its own plus-addressed email
+	// (aws+<id>@example.com), this one reuses the email of payments
+	newDuplicatesOrg := func() *awsorgtest.Org {
+		return newTestOrg().
+			AddAccount("r-root", "444444444444", "PAYMENTS", types.AccountStatusActive).
+			SetEmail("444444444444", "AWS+222222222222@example.com")
+	}
+
+	tests := []struct {
+		name string
+		org  *awsorgtest.Org
+		args []string
+		want string
+	}{
+		{
+			name: "same name and email",
+			org:  newDuplicatesOrg(),
+			want: "Accounts sharing a name:\n" +
+				"|-- payments\n" +
+				indent + "|-- Account: payments [222222222222] <aws+222222222222@example.com>\n" +
+				indent + "|-- Account: PAYMENTS [444444444444] <AWS+222222222222@example.com>\n" +
+				"Accounts sharing an email:\n" +
+				"|-- aws+222222222222@example.com\n" +
+				indent + "|-- Account: payments [222222222222] <aws+222222222222@example.com>\n" +
+				indent + "|-- Account: PAYMENTS [444444444444] <AWS+222222222222@example.com>\n" +
+				"1 name collisions and 1 email collisions in 4 accounts\n",
+		},
+		{
+			name: "plus-addressing is not a collision",
+			org:  newTestOrg(),
+			want: "Accounts sharing a name:\nAccounts sharing an email:\n0 name collisions and 0 email collisions in 3 accounts\n",
+		},
+		{
+			name: "ignoring plus-addressing",
+			org:  newTestOrg(),
+			args: []string{"--ignore-plus-addressing"},
+			want: "Accounts sharing a name:\n" +
+				"Accounts sharing an email mailbox (ignoring plus-addressing):\n" +
+				"|-- aws@example.com\n" +
+				indent + "|-- Account: management [111111111111] <aws+111111111111@example.com>\n" +
+				indent + "|-- Account: legacy [333333333333] <aws+333333333333@example.com>\n" +
+				indent + "|-- Account: payments [222222222222] <aws+222222222222@example.com>\n" +
+				"0 name collisions and 1 email collisions in 3 accounts\n",
+		},
+		{
+			name: "empty organization",
+			org:  awsorgtest.New("o-example", "r-root", "111111111111"),
+			want: "Accounts sharing a name:\nAccounts sharing an email:\n0 name collisions and 0 email collisions in 0 accounts\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, tt.org, append([]string{"aws", "duplicates"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("duplicates: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("duplicates wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAccountEmail(t *testing.T) {
+	tests := []struct {
+		email                string
+		ignorePlusAddressing bool
+		want                 string
+	}{
+		{" AWS+Prod@Example.com", false, "aws+prod@example.com"},
+		{"aws+prod@example.com", true, "aws@example.com"},
+		{"aws+prod+eu@example.com", true, "aws@example.com"},
+		{"aws@example.com", true, "aws@example.com"},
+		{"not-an-email+x", true, "not-an-email+x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := normalizeAccountEmail(tt.email, tt.ignorePlusAddressing); got != tt.want {
+				t.Errorf("normalizeAccountEmail(%q, %t) = %q, want %q", tt.email, tt.ignorePlusAddressing, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,537 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+const denyLeaveDocument = `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"organizations:LeaveOrganization","Resource":"*"}]}`
+
+// An organization with a management account, a workload OU with a suspended
+// account and a deny policy on that OU.
+func newTestOrg() *awsorgtest.Org {
+	return awsorgtest.New("o-example", "r-root", "111111111111").
+		AddAccount("r-root", "111111111111", "management", types.AccountStatusActive).
+		AddOU("r-root", "ou-root-work", "Workloads").
+		AddAccount("ou-root-work", "333333333333", "legacy", types.AccountStatusSuspended).
+		AddAccount("ou-root-work", "222222222222", "payments", types.AccountStatusActive).
+		AddPolicy("p-FullAWSAccess", "FullAWSAccess", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`).
+		AddPolicy("p-denyleave", "deny-leave", types.PolicyTypeServiceControlPolicy, denyLeaveDocument).
+		AttachPolicy("r-root", "p-FullAWSAccess").
+		AttachPolicy("ou-root-work", "p-denyleave")
+}
+
+// Runs the command line args against org, as Execute does, and returns what it
+// wrote to stdout.
+func runCommand(t *testing.T, org *awsorgtest.Org, args ...string) (string, error) {
+	t.Helper()
+	return runCommandWith(t, func(deps *dependencies) {
+		deps.organizations = func(context.Context) (orgOperations, error) { return org, nil }
+	}, args...)
+}
+
+// Runs the command line args with the dependencies changed by setup, in a
+// home directory of its own.
+func runCommandWith(t *testing.T, setup func(deps *dependencies), args ...string) (string, error) {
+	t.Helper()
+	// Neither the config file nor the warm cache of the user are read
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NO_COLOR", "1")
+
+	var stdout, stderr bytes.Buffer
+	deps := newDependencies(&stdout, &stderr)
+	setup(deps)
+
+	rootCmd := newRootCmd(deps)
+	rootCmd.SetArgs(append([]string{"--no-cache"}, args...))
+	err := rootCmd.ExecuteContext(context.Background())
+	return stdout.String(), err
+}
+
+func TestTreeCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "whole tree",
+			args: []string{"aws", "tree"},
+			want: `|-- Root: [r-root]
+    |-- Account: management (Management Account) [111111111111] (SCPs: FullAWSAccess)
+    |-- OU: Workloads [ou-root-work]
+        |-- Account: legacy (SUSPENDED) [333333333333] (SCPs: deny-leave, FullAWSAccess)
+        |-- Account: payments [222222222222] (SCPs: deny-leave, FullAWSAccess)
+`,
+		},
+		{
+			name: "path to an account",
+			args: []string{"aws", "account", "222222222222"},
+			want: `|-- Root: [r-root]
+    |-- OU: Workloads [ou-root-work]
+        |-- Account: payments [222222222222] (SCPs: deny-leave, FullAWSAccess)
+`,
+		},
+		{
+			name: "policy IDs",
+			args: []string{"aws", "account", "222222222222", "--show-policy-ids"},
+			want: `|-- Root: [r-root]
+    |-- OU: Workloads [ou-root-work]
+        |-- Account: payments [222222222222] (SCPs: deny-leave [p-denyleave, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave], FullAWSAccess [p-FullAWSAccess, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess])
+`,
+		},
+		{
+			name: "OU subtree without suspended accounts",
+			args: []string{"aws", "tree", "--ou-id", "ou-root-work", "--only-active"},
+			want: `|-- OU: Workloads [ou-root-work]
+    |-- Account: payments [222222222222] (SCPs: deny-leave, FullAWSAccess)
+`,
+		},
+		{
+			name: "csv",
+			args: []string{"aws", "tree", "-o", "csv", "--exclude-account", "legacy"},
+			want: `account_id,account_name,ou_path,management_account,status,scps
+111111111111,management,/Root,true,ACTIVE,FullAWSAccess
+222222222222,payments,/Root/Workloads,false,ACTIVE,deny-leave;FullAWSAccess
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, newTestOrg(), tt.args...)
+			if err != nil {
+				t.Fatalf("policy-scout %s: %v", strings.Join(tt.args, " "), err)
+			}
+			if got != tt.want {
+				t.Errorf("policy-scout %s wrote:\n%s\nwant:\n%s", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTreeCommandJSON(t *testing.T) {
+	got, err := runCommand(t, newTestOrg(), "aws", "account", "222222222222", "-o", "json", "--show-documents")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		OrganizationID string `json:"organizationId"`
+		Tree           struct {
+			Children []struct {
+				Children []struct {
+					ID   string `json:"id"`
+					SCPs []struct {
+						Name     string          `json:"name"`
+						Document json.RawMessage `json:"document"`
+					} `json:"scps"`
+				} `json:"children"`
+			} `json:"children"`
+		} `json:"tree"`
+	}
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, got)
+	}
+	if report.OrganizationID != "o-example" {
+		t.Errorf("organizationId = %q, want o-example", report.OrganizationID)
+	}
+	account := report.Tree.Children[0].Children[0]
+	if account.ID != "222222222222" {
+		t.Fatalf("account = %q, want 222222222222", account.ID)
+	}
+	if len(account.SCPs) != 2 || account.SCPs[0].Name != "deny-leave" {
+		t.Fatalf("SCPs = %+v, want deny-leave and FullAWSAccess", account.SCPs)
+	}
+	var document bytes.Buffer
+	if err := json.Compact(&document, account.SCPs[0].Document); err != nil || document.String() != denyLeaveDocument {
+		t.Errorf("document of deny-leave = %s, want %s", account.SCPs[0].Document, denyLeaveDocument)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	tests := []struct {
+		name      string
+		accountID string
+		want      string
+	}{
+		{
+			name:      "member account",
+			accountID: "222222222222",
+			want:      "organizations:LeaveOrganization for account payments [222222222222]: DENIED\n",
+		},
+		{
+			name:      "management account",
+			accountID: "111111111111",
+			want:      "organizations:LeaveOrganization for account management [111111111111]: ALLOWED (SCPs don't apply to the management account)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, newTestOrg(), "aws", "simulate", "--account-id", tt.accountID, "--action", "organizations:LeaveOrganization")
+			if err != nil {
+				t.Fatalf("policy-scout aws simulate: %v", err)
+			}
+			if first, _, _ := strings.Cut(got, "\n"); first+"\n" != tt.want {
+				t.Errorf("policy-scout aws simulate wrote:\n%s\nwant it to start with:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagementAccountPermissions(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "effective",
+			args: []string{"aws", "effective", "--account-id", "111111111111"},
+			want: []string{
+				"SCPs don't apply to the management account",
+				"Allowed actions (allowed at every level of the chain):\n    *\nDenied actions:\n    (none)\n",
+			},
+		},
+		{
+			name: "diff",
+			args: []string{"aws", "diff", "--account-id", "111111111111", "--account-id", "222222222222"},
+			want: []string{
+				"Only management (Management Account) [111111111111] is allowed:\n    *\n",
+				"Only payments [222222222222] is denied:\n    organizations:LeaveOrganization",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, newTestOrg(), tt.args...)
+			if err != nil {
+				t.Fatalf("policy-scout %s: %v", strings.Join(tt.args, " "), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("policy-scout %s wrote:\n%s\nwant it to contain:\n%s", strings.Join(tt.args, " "), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAccountNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"account", []string{"aws", "account", "999999999999"}},
+		{"effective", []string{"aws", "effective", "--account-id", "999999999999"}},
+		{"simulate", []string{"aws", "simulate", "--account-id", "999999999999", "--action", "s3:GetObject"}},
+		{"diff", []string{"aws", "diff", "--account-id", "222222222222", "--account-id", "999999999999"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runCommand(t, newTestOrg(), tt.args...)
+			var notFound accountNotFoundError
+			if !errors.As(err, &notFound) {
+				t.Fatalf("policy-scout %s: error = %v, want accountNotFoundError", strings.Join(tt.args, " "), err)
+			}
+			if code := exitCode(err); code != exitAccountNotFound {
+				t.Errorf("policy-scout %s: exit code = %d, want %d", strings.Join(tt.args, " "), code, exitAccountNotFound)
+			}
+		})
+	}
+}
+
+func TestDemoPoliciesList(t *testing.T) {
+	got, err := runCommandWith(t, func(deps *dependencies) {
+		deps.organizations = deps.newOrgClient
+	}, "--demo", "aws", "policies", "list")
+	if err != nil {
+		t.Fatalf("policy-scout --demo aws policies list: %v", err)
+	}
+	// Policy types that aren't enabled in the demo organization, like RCPs, are left out
+	want := "|-- SERVICE_CONTROL_POLICY\n    |-- FullAWSAccess [p-FullAWSAccess] (AWS managed, 15 attachments): Allows access to every operation\n"
+	if !strings.HasPrefix(got, want) || strings.Contains(got, "RESOURCE_CONTROL_POLICY") {
+		t.Errorf("policy-scout --demo aws policies list wrote:\n%s\nwant it to start with:\n%s", got, want)
+	}
+}
+
+func TestPoliciesListAttachments(t *testing.T) {
+	got, err := runCommand(t, newTestOrg(), "aws", "policies", "list")
+	if err != nil {
+		t.Fatalf("policies list: %v", err)
+	}
+	want := "(customer managed, 1 attachment)"
+	if !strings.Contains(got, want) || strings.Contains(got, "1 attachments") {
+		t.Errorf("policies list wrote:\n%s\nwant it to contain %q", got, want)
+	}
+}
+
+func TestResumeCheckpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     checkpointKey
+		args    []string
+		wantErr string
+	}{
+		{
+			name: "same scan",
+			key:  checkpointKey{OrganizationID: "o-example", OUID: "ou-root-work"},
+			args: []string{"--ou-id", "ou-root-work"},
+		},
+		{
+			name:    "another organization",
+			key:     checkpointKey{OrganizationID: "o-other"},
+			wantErr: "it was written for organization o-other, not for organization o-example",
+		},
+		{
+			name:    "another OU",
+			key:     checkpointKey{OrganizationID: "o-example", OUID: "ou-root-work"},
+			wantErr: "it was written for organization o-example, OU ou-root-work, not for organization o-example",
+		},
+		{
+			name:    "other policy types",
+			key:     checkpointKey{OrganizationID: "o-example"},
+			args:    []string{"--policy-type", "tag"},
+			wantErr: "it was written for organization o-example, not for organization o-example, policy types TAG_POLICY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFile := filepath.Join(t.TempDir(), "checkpoint.json")
+			if err := newScanCache().saveCheckpoint(checkFile, tt.key); err != nil {
+				t.Fatal(err)
+			}
+
+			args := append([]string{"aws", "tree", "--resume", "--checkpoint-file", checkFile}, tt.args...)
+			_, err := runCommand(t, newTestOrg(), args...)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("policy-scout %s: %v", strings.Join(args, " "), err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("policy-scout %s: error = %v, want %q", strings.Join(args, " "), err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The credentials of an account that isn't a member of any organization.
+type standaloneOrg struct{ *awsorgtest.Org }
+
+func (standaloneOrg) DescribeOrganization(context.Context, *organizations.DescribeOrganizationInput, ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error) {
+	return nil, &types.AWSOrganizationsNotInUseException{Message: aws.String("not in use")}
+}
+
+func TestStandaloneProfileInOrgs(t *testing.T) {
+	got, err := runCommandWith(t, func(deps *dependencies) {
+		config := "organizations:\n  - name: payer\n    profile: payer\n  - name: sandbox\n    profile: sandbox\n"
+		if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), defaultConfigFile), []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		deps.orgSource = func(_ context.Context, source orgSource) (orgOperations, error) {
+			if source.Name == "sandbox" {
+				return standaloneOrg{newTestOrg()}, nil
+			}
+			return newTestOrg(), nil
+		}
+		deps.orgCaller = func(context.Context, orgSource) (callerIdentity, error) {
+			return callerIdentity{AccountID: "444444444444", ARN: "arn:aws:iam::444444444444:user/scout"}, nil
+		}
+	}, "aws", "orgs", "-o", "json")
+	if err != nil {
+		t.Fatalf("orgs: %v", err)
+	}
+
+	var report multiOrgReport
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, got)
+	}
+	if org := report.Organizations["o-example"]; org == nil || org.Tree == nil || org.Standalone {
+		t.Errorf("o-example = %+v, want the tree of payer", org)
+	}
+	sandbox := report.Organizations["444444444444"]
+	if sandbox == nil || !sandbox.Standalone || sandbox.Name != "sandbox" || sandbox.Tree != nil {
+		t.Fatalf("444444444444 = %+v, want the standalone account of sandbox", sandbox)
+	}
+	if sandbox.Caller != "arn:aws:iam::444444444444:user/scout" {
+		t.Errorf("caller = %q, want the ARN of the credentials", sandbox.Caller)
+	}
+}
+
+// The test organization with a sandbox OU, left out of the scope of the
+// config file written by writeSandboxScope.
+func newSandboxOrg() *awsorgtest.Org {
+	return newTestOrg().
+		AddOU("r-root", "ou-root-sandbox", "Sandbox").
+		AddAccount("ou-root-sandbox", "444444444444", "experiments", types.AccountStatusActive)
+}
+
+// Writes the config file excluding the sandbox OU by its path.
+func writeSandboxScope(t *testing.T) {
+	t.Helper()
+	config := "scope:\n  exclude:\n    ous: [\"/Root/Sandbox\"]\n"
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), defaultConfigFile), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Writes Rego rules to a directory of their own.
+func writeRegoDir(t *testing.T, rules string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rules.rego"), []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCheckExcludedOU(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rules, []byte("rules:\n  - name: deny-leave\n    path: /Root/*/*\n    requiredSCPs: [deny-leave]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A violation for every account and OU of the input
+	regoDir := writeRegoDir(t, `package policyscout
+
+violations contains {"rule": "input", "severity": "LOW", "resource": account.id, "msg": "in the input"} if {
+	some account in input.accounts
+}
+
+violations contains {"rule": "input", "severity": "LOW", "resource": ou.id, "msg": "in the input"} if {
+	some ou in input.ous
+}
+`)
+
+	got, err := runCommandWith(t, func(deps *dependencies) {
+		writeSandboxScope(t)
+		org := newSandboxOrg()
+		deps.organizations = func(context.Context) (orgOperations, error) { return org, nil }
+	}, "aws", "check", "--rules", rules, "--rego-dir", regoDir)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	if strings.Contains(got, "deny-leave:") {
+		t.Errorf("check wrote:\n%s\nwant no violation of deny-leave, the account of the sandbox being out of the scope", got)
+	}
+	for _, id := range []string{"ou-root-sandbox", "444444444444"} {
+		if strings.Contains(got, id) {
+			t.Errorf("the input of the Rego rules contains %s, which is out of the scope:\n%s", id, got)
+		}
+	}
+	if !strings.Contains(got, "[222222222222]") {
+		t.Errorf("the input of the Rego rules is missing 222222222222:\n%s", got)
+	}
+}
+
+func TestCheckRego(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "message",
+			rules: `package policyscout
+
+violations contains sprintf("%s is not the root", [input.paths["ou-root-work"]]) if {
+	input.paths["ou-root-work"] != "/Root"
+}
+`,
+			want: "|-- MEDIUM rego: o-example: /Root/Workloads is not the root\n",
+		},
+		{
+			name: "violation object",
+			rules: `package policyscout
+
+violations contains {"rule": "no-suspended", "severity": "high", "resource": account.id, "msg": "suspended account"} if {
+	some account in input.accounts
+	account.status == "SUSPENDED"
+}
+`,
+			want: "|-- HIGH no-suspended: legacy [333333333333]: suspended account\n",
+		},
+		{
+			name:  "no violations",
+			rules: "package policyscout\n\nallow := true\n",
+			want:  "No violation of the rules",
+		},
+		{
+			name:    "syntax error",
+			rules:   "package policyscout\n\nviolations contains x if {\n",
+			wantErr: "rules.rego:",
+		},
+		{
+			name:    "invalid severity",
+			rules:   "package policyscout\n\nviolations contains {\"rule\": \"r\", \"severity\": \"urgent\", \"msg\": \"m\"}\n",
+			wantErr: `invalid severity "urgent"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, newTestOrg(), "aws", "check", "--rego-dir", writeRegoDir(t, tt.rules))
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("check: %v", err)
+			case !strings.Contains(got, tt.want):
+				t.Errorf("check wrote:\n%s\nwant it to contain:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportExcludedOU(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "tables")
+	_, err := runCommandWith(t, func(deps *dependencies) {
+		writeSandboxScope(t)
+		org := newSandboxOrg()
+		deps.organizations = func(context.Context) (orgOperations, error) { return org, nil }
+	}, "aws", "export", "--out", "file://"+out)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	for _, table := range []string{"accounts", "ous", "attachments"} {
+		data, err := os.ReadFile(filepath.Join(out, table, table+".csv"))
+		if err != nil {
+			t.Fatalf("table %s: %v", table, err)
+		}
+		for _, id := range []string{"ou-root-sandbox", "444444444444"} {
+			if bytes.Contains(data, []byte(id)) {
+				t.Errorf("table %s contains %s, which is out of the scope:\n%s", table, id, data)
+			}
+		}
+	}
+	accounts, err := os.ReadFile(filepath.Join(out, "accounts", "accounts.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(accounts, []byte("222222222222,payments")) {
+		t.Errorf("accounts.csv is missing payments:\n%s", accounts)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newEffectiveCmd creates the aws effective command.
+func newEffectiveCmd(deps *dependencies) *cobra.Command {
+	var accountID string // account whose effective permissions are computed
+	effectiveCmd := &cobra.Command{
+		Use:   "effective",
+		Short: "Computes the actions an account is allowed to perform according to its SCPs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayEffectivePermissions(cmd.Context(), deps, accountID)
+		},
+	}
+
+	effectiveCmd.Flags().StringVar(&accountID, "account-id", "", "aws account ID that will be analyzed")
+	effectiveCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	return effectiveCmd
+}
+
+// displayEffectivePermissions downloads every SCP in the inheritance chain of the
+// account and reports the net set of allowed actions along with the explicit denies.
+func displayEffectivePermissions(ctx context.Context, deps *dependencies, targetAccountID string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	chain, err := getPolicyChain(ctx, client, targetAccountID, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(deps.report, "Inheritance chain:")
+	prefix := ""
+	for _, level := range chain {
+		names := make([]string, 0, len(level.Policies))
+		for _, policy := range level.Policies {
+			names = append(names, policy.Name)
+		}
+		fmt.Fprintf(deps.report, "%s|-- %s [%s] (SCPs: %s)\n", prefix, level.TargetName, level.TargetID, strings.Join(names, ", "))
+		prefix += indent
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+	if targetAccountID == managementAccountID {
+		fmt.Fprintln(deps.report, "SCPs don't apply to the management account, the attached ones are ignored.")
+	}
+	effective := analyzeChain(chain, managementAccountID)
+
+	fmt.Fprintln(deps.report, "Allowed actions (allowed at every level of the chain):")
+	if len(effective.Allowed) == 0 {
+		fmt.Fprintf(deps.report, "%s(none)\n", indent)
+	}
+	for _, pattern := range effective.Allowed {
+		fmt.Fprintf(deps.report, "%s%s\n", indent, pattern)
+	}
+
+	fmt.Fprintln(deps.report, "Denied actions:")
+	if len(effective.Denies) == 0 {
+		fmt.Fprintf(deps.report, "%s(none)\n", indent)
+	}
+	for _, deny := range effective.Denies {
+		fmt.Fprintf(deps.report, "%s%s\n", indent, formatRule(deny))
+	}
+
+	return nil
+}
+
+// Computes the effective permissions of the account at the end of the chain.
+// SCPs don't apply to the management account, which is allowed every action.
+func analyzeChain(chain []scp.Level, managementAccountID string) scp.Effective {
+	if chain[len(chain)-1].TargetID == managementAccountID {
+		return scp.Effective{Allowed: []string{"*"}}
+	}
+	return scp.Analyze(chain)
+}
+
+// Describes a statement of the chain: the actions it covers, its conditions and where it comes from.
+func formatRule(rule scp.Rule) string {
+	actions := strings.Join(rule.Statement.Action, ", ")
+	if len(rule.Statement.NotAction) > 0 {
+		actions = "everything except " + strings.Join(rule.Statement.NotAction, ", ")
+	}
+
+	formatted := actions
+	if rule.Statement.Conditional() {
+		formatted += " when " + rule.Statement.Condition.String()
+	}
+
+	source := rule.PolicyName
+	if rule.Statement.Sid != "" {
+		source += ", statement " + rule.Statement.Sid
+	}
+	return fmt.Sprintf("%s (%s, attached to %s [%s])", formatted, source, rule.TargetName, rule.TargetID)
+}
+
+// Builds the inheritance chain of an account, from the root down to the account,
+// with the (parsed) policies of policyType directly attached at every level.
+func getPolicyChain(ctx context.Context, client orgAPI, accountID string, policyType types.PolicyType) ([]scp.Level, error) {
+	// Walk up the tree until the root is reached
+	ids := []string{accountID}
+	for current := accountID; !strings.HasPrefix(current, "r-"); {
+		parentID, err := client.scout().ParentID(ctx, current)
+		if err != nil {
+			if current == accountID && isAccountNotFound(err) {
+				return nil, accountNotFoundError(accountID)
+			}
+			return nil, err
+		}
+		current = parentID
+		ids = append([]string{current}, ids...)
+	}
+
+	chain := make([]scp.Level, 0, len(ids))
+	for _, id := range ids {
+		name, err := client.scout().Name(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting name for id %s: %w", id, err)
+		}
+
+		attached, err := client.scout().DirectPolicies(ctx, id, policyType)
+		if err != nil {
+			return nil, err
+		}
+
+		level := scp.Level{TargetID: id, TargetName: name}
+		for _, policy := range attached {
+			document, err := getPolicyDocument(ctx, client, policy.ID)
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := scp.Parse(document)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", policy.ID, err)
+			}
+			level.Policies = append(level.Policies, scp.Policy{ID: policy.ID, Name: policy.Name, Document: parsed})
+		}
+		chain = append(chain, level)
+	}
+
+	return chain, nil
+}
+
+// Whether the Organizations API reports that an account isn't part of the
+// organization, e.g. when listing its parents.
+func isAccountNotFound(err error) bool {
+	var childNotFound *types.ChildNotFoundException
+	var accountNotFound *types.AccountNotFoundException
+	return errors.As(err, &childNotFound) || errors.As(err, &accountNotFound)
+}
@@ -0,0 +1,52 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// Gets the effective policy of policyType for an account, i.e. the result of
+// merging every policy of that type it inherits, as computed by Organizations.
+// found is false when no policy of that type applies to the account (or the type
+// is not enabled in the organization).
+func getEffectivePolicy(ctx context.Context, client orgAPI, accountID string, policyType types.EffectivePolicyType) (content string, found bool, err error) {
+	result, err := client.DescribeEffectivePolicy(ctx, &organizations.DescribeEffectivePolicyInput{
+		PolicyType: policyType,
+		TargetId:   &accountID,
+	})
+
+	var notFound *types.EffectivePolicyNotFoundException
+	var notEnabled *types.PolicyTypeNotEnabledException
+	switch {
+	case errors.As(err, &notFound), errors.As(err, &notEnabled):
+		return "", false, nil
+	case err != nil:
+		return "", false, fmt.Errorf("error describing the effective %s of %s: %w", policyType, accountID, err)
+	}
+
+	return *result.EffectivePolicy.PolicyContent, true, nil
+}
+
+// Resolves the accounts to analyze: a single account or, with "all" (case
+// insensitive), every account in the organization.
+func resolveAccountIDs(ctx context.Context, client orgAPI, targetAccountID string) ([]string, error) {
+	if strings.ToLower(targetAccountID) != "all" {
+		return []string{targetAccountID}, nil
+	}
+
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+	return listAccountsInSubtree(ctx, client, rootID)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// Exit codes of policy-scout, part of its interface: scripts rely on them.
+const (
+	exitSuccess         = 0 // the command succeeded
+	exitFailure         = 1 // any other error, e.g. invalid flags
+	exitAccountNotFound = 2 // the target account is not part of the organization (or of the analyzed OU)
+	exitAccessDenied    = 3 // the credentials are not allowed to read the organization
+	exitPartialResults  = 4 // a report was written, but some of its data couldn't be read because of API errors
+)
+
+// Whether the error chain holds an API call denied either by the
+// Organizations API or when assuming the audit role.
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "AccessDeniedException", "AccessDenied":
+		return true
+	}
+	return false
+}
+
+// Returned when a report was written without the data of some of its parts,
+// e.g. the organizations of "aws orgs" that couldn't be read.
+type partialResultsError []error
+
+func (e partialResultsError) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("partial results, %s", strings.Join(messages, "; "))
+}
+
+func (e partialResultsError) Unwrap() []error {
+	return e
+}
+
+// Maps the error of a command to the exit code of the process.
+func exitCode(err error) int {
+	var partial partialResultsError
+	var notFound accountNotFoundError
+	switch {
+	case err == nil:
+		return exitSuccess
+	case errors.As(err, &partial):
+		return exitPartialResults
+	case errors.As(err, &notFound):
+		return exitAccountNotFound
+	case isAccessDenied(err):
+		return exitAccessDenied
+	default:
+		return exitFailure
+	}
+}
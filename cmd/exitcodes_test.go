@@ -0,0 +1,70 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestExitCode(t *testing.T) {
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not allowed"}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitSuccess},
+		{"denied call", fmt.Errorf("couldn't get organization's root ID: %w", denied), exitAccessDenied},
+		{"denied role", fmt.Errorf("error assuming role: %w", &smithy.GenericAPIError{Code: "AccessDenied"}), exitAccessDenied},
+		{"other API error", fmt.Errorf("error listing: %w", &smithy.GenericAPIError{Code: "TooManyRequestsException"}), exitFailure},
+		{"unwrapped denied call", errors.New("couldn't get organization's root ID: " + denied.Error()), exitFailure},
+		{"account not found", fmt.Errorf("scan: %w", accountNotFoundError("999999999999")), exitAccountNotFound},
+		{"partial results", partialResultsError{fmt.Errorf("organization b: %w", denied)}, exitPartialResults},
+		{"other error", errors.New("invalid flags"), exitFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialResultsAreReported(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "orgs.json")
+	_, err := runCommandWith(t, func(deps *dependencies) {
+		config := "organizations:\n  - name: good\n    profile: good\n  - name: denied\n    profile: denied\n"
+		if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), defaultConfigFile), []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		deps.orgSource = func(_ context.Context, source orgSource) (orgOperations, error) {
+			if source.Name == "denied" {
+				return nil, fmt.Errorf("error assuming role: %w", &smithy.GenericAPIError{Code: "AccessDenied"})
+			}
+			return newTestOrg(), nil
+		}
+	}, "aws", "orgs", "-o", "json", "--report-to", output)
+	if code := exitCode(err); code != exitPartialResults {
+		t.Fatalf("exit code = %d (%v), want %d", code, err, exitPartialResults)
+	}
+	report, readErr := os.ReadFile(output)
+	if readErr != nil {
+		t.Fatalf("the partial report wasn't written: %v", readErr)
+	}
+	if !strings.Contains(string(report), `"o-example"`) {
+		t.Errorf("partial report doesn't hold the organization that was read:\n%s", report)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// explainOptions are the flags of the aws explain command.
+type explainOptions struct {
+	accountID string // account whose chain is walked
+	action    string // action being explained, e.g. iam:CreateUser
+}
+
+// newExplainCmd creates the aws explain command.
+func newExplainCmd(deps *dependencies) *cobra.Command {
+	options := &explainOptions{}
+	explainCmd := &cobra.Command{
+		Use:   "explain",
+		Short: "Explains which SCP statements deny (or allow) an action, level by level",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return explainDecision(cmd.Context(), deps, options.accountID, options.action)
+		},
+	}
+
+	explainCmd.Flags().StringVar(&options.accountID, "account-id", "", "aws account ID whose SCP inheritance chain is walked")
+	explainCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+	explainCmd.Flags().StringVar(&options.action, "action", "", "action to explain, e.g. iam:CreateUser")
+	explainCmd.MarkFlagRequired("action") //nolint:gosec,errcheck
+
+	return explainCmd
+}
+
+// explainDecision walks the SCP inheritance chain of the account, from the root
+// down to the account, printing the statements matching the action at every
+// level, and the exact statement (and condition) causing a deny. Unlike
+// simulate, no request context is needed: conditions are shown, not evaluated.
+func explainDecision(ctx context.Context, deps *dependencies, accountID, action string) error {
+	if !strings.Contains(action, ":") {
+		return fmt.Errorf("invalid action %q: it must look like service:Action", action)
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	chain, err := getPolicyChain(ctx, client, accountID, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+	account := chain[len(chain)-1]
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+	if accountID == managementAccountID {
+		fmt.Fprintf(deps.report, "%s for account %s [%s]: ALLOWED (SCPs don't apply to the management account)\n", action, account.TargetName, account.TargetID)
+		return nil
+	}
+
+	explanation := scp.Explain(chain, action)
+
+	verdict := "DENIED"
+	switch {
+	case explanation.Allowed() && len(explanation.ConditionalDenies) > 0:
+		verdict = "ALLOWED, unless a conditional deny matches"
+	case explanation.Allowed():
+		verdict = "ALLOWED"
+	}
+	fmt.Fprintf(deps.report, "%s for account %s [%s]: %s\n", action, account.TargetName, account.TargetID, verdict)
+
+	for _, level := range explanation.Levels {
+		fmt.Fprintf(deps.report, "|-- %s\n", levelLabel(*level.Level))
+		for _, rule := range level.Allows {
+			fmt.Fprintf(deps.report, "%s|-- Allowed by %s\n", indent, ruleSource(rule))
+		}
+		if len(level.Allows) == 0 {
+			fmt.Fprintf(deps.report, "%s|-- Not allowed by any SCP attached here\n", indent)
+		}
+		for _, rule := range level.Denies {
+			fmt.Fprintf(deps.report, "%s|-- Denied by %s, %s\n", indent, ruleSource(rule), denyScope(rule.Statement))
+		}
+	}
+
+	switch {
+	case explanation.DeniedBy != nil:
+		fmt.Fprintf(deps.report, "Reason: explicit deny by %s\n", formatRule(*explanation.DeniedBy))
+	case explanation.NotAllowedAt != nil:
+		fmt.Fprintf(deps.report, "Reason: implicit deny, no SCP attached to %s [%s] allows it\n", explanation.NotAllowedAt.TargetName, explanation.NotAllowedAt.TargetID)
+	}
+	return nil
+}
+
+// Labels a level of the chain like the org tree does.
+func levelLabel(level scp.Level) string {
+	switch {
+	case strings.HasPrefix(level.TargetID, "r-"):
+		return fmt.Sprintf("Root: [%s]", level.TargetID)
+	case strings.HasPrefix(level.TargetID, "ou-"):
+		return fmt.Sprintf("OU: %s [%s]", level.TargetName, level.TargetID)
+	default:
+		return fmt.Sprintf("Account: %s [%s]", level.TargetName, level.TargetID)
+	}
+}
+
+// The policy and statement SID of a rule.
+func ruleSource(rule scp.Rule) string {
+	source := rule.PolicyName
+	if rule.Statement.Sid != "" {
+		source += ", statement " + rule.Statement.Sid
+	}
+	return source
+}
+
+// Describes when a deny statement applies.
+func denyScope(statement scp.Statement) string {
+	var scope []string
+	switch {
+	case len(statement.NotResource) > 0:
+		scope = append(scope, "on every resource except "+strings.Join(statement.NotResource, ", "))
+	case !statement.OnEveryResource():
+		scope = append(scope, "on "+strings.Join(statement.Resource, ", "))
+	}
+	if statement.Conditional() {
+		scope = append(scope, "when "+statement.Condition.String())
+		if unsupported := statement.Condition.UnsupportedOperators(); len(unsupported) > 0 {
+			scope = append(scope, fmt.Sprintf("(unsupported %s, can't be evaluated by aws simulate)", strings.Join(unsupported, ", ")))
+		}
+	}
+	if len(scope) == 0 {
+		return "unconditionally"
+	}
+	return strings.Join(scope, " ")
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// A table of the export, written as <out>/<name>/<name>.csv so every table has
+// its own prefix, as Athena expects.
+type exportTable struct {
+	name   string
+	header []string
+	rows   [][]string
+}
+
+// newExportCmd creates the aws export command.
+func newExportCmd(deps *dependencies) *cobra.Command {
+	var out string // directory (or s3://bucket/prefix/) receiving the tables
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports the org as flat CSV tables (accounts, ous, policies, attachments, statements) for SQL analysis",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportTables(cmd.Context(), deps, out)
+		},
+	}
+
+	exportCmd.Flags().StringVar(&out, "out", "", "directory (or s3://bucket/prefix/) receiving a folder per table, e.g. ./tables")
+	exportCmd.MarkFlagRequired("out") //nolint:gosec,errcheck
+
+	exportCmd.AddCommand(newExportTerraformCmd(deps))
+
+	return exportCmd
+}
+
+// exportTables captures the organization and writes it as normalized tables,
+// joined by their IDs: ous (the root included), accounts, policies, the
+// attachments of the policies to their targets and the statements of the SCPs.
+// The entities out of the scope are left out of every table.
+func exportTables(ctx context.Context, deps *dependencies, out string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, err := captureSnapshot(ctx, client)
+	if err != nil {
+		return err
+	}
+	if err := scopeSnapshot(ctx, client, snapshot); err != nil {
+		return err
+	}
+
+	tables, err := snapshotTables(snapshot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(deps.report, "Tables of %s exported to %s:\n", snapshot.ID, out)
+	// file:// destinations are local directories too
+	out = strings.TrimPrefix(out, "file://")
+	local := !strings.Contains(out, "://")
+	for _, table := range tables {
+		location := strings.TrimSuffix(out, "/") + "/" + table.name
+		if local {
+			if err := os.MkdirAll(location, 0o755); err != nil { //nolint:gosec
+				return fmt.Errorf("couldn't create %s: %w", location, err)
+			}
+		}
+		destination, err := openSink(location+"/"+table.name+".csv", deps)
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(destination)
+		writer.Write(table.header)  //nolint:errcheck
+		writer.WriteAll(table.rows) //nolint:errcheck
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		if err := destination.Close(ctx); err != nil {
+			return fmt.Errorf("couldn't write table %s: %w", table.name, err)
+		}
+		fmt.Fprintf(deps.report, "|-- %s: %s rows\n", table.name, formatCount(len(table.rows)))
+	}
+	return nil
+}
+
+// Flattens a snapshot into the tables of the export. Lists (e.g. the actions of
+// a statement) are joined with ";", like the CSV output of aws tree, and
+// conditions are kept as JSON.
+func snapshotTables(snapshot *orgSnapshot) ([]exportTable, error) {
+	ous := exportTable{name: "ous", header: []string{"ou_id", "name", "parent_id", "path"}}
+	ous.rows = append(ous.rows, []string{snapshot.RootID, "Root", "", snapshot.path(snapshot.RootID)})
+	for _, ou := range snapshot.OUs {
+		ous.rows = append(ous.rows, []string{ou.ID, ou.Name, ou.ParentID, snapshot.path(ou.ID)})
+	}
+
+	accounts := exportTable{name: "accounts", header: []string{"account_id", "name", "email", "status", "parent_id", "ou_path", "joined", "management_account"}}
+	for _, account := range snapshot.Accounts {
+		joined := ""
+		if account.Joined != 0 {
+			joined = time.Unix(account.Joined, 0).UTC().Format(time.RFC3339)
+		}
+		accounts.rows = append(accounts.rows, []string{
+			account.ID, account.Name, account.Email, account.Status, account.ParentID, snapshot.path(account.ParentID),
+			joined, strconv.FormatBool(account.ID == snapshot.ManagementAccountID),
+		})
+	}
+
+	policies := exportTable{name: "policies", header: []string{"policy_id", "name", "type", "description", "aws_managed", "size", "content"}}
+	attachments := exportTable{name: "attachments", header: []string{"policy_id", "policy_name", "target_id", "target_type", "target_name"}}
+	statements := exportTable{name: "statements", header: []string{"policy_id", "statement_index", "sid", "effect", "actions", "not_actions", "resources", "not_resources", "conditions"}}
+	for _, policy := range snapshot.Policies {
+		content := compactJSON(policy.Content)
+		policies.rows = append(policies.rows, []string{
+			policy.ID, policy.Name, policy.Type, policy.Description, strconv.FormatBool(policy.AWSManaged), strconv.Itoa(len(content)), content,
+		})
+		for _, target := range policy.Targets {
+			attachments.rows = append(attachments.rows, []string{policy.ID, policy.Name, target, targetType(target), snapshot.name(target)})
+		}
+
+		// Only SCPs are IAM policy documents, the other types have their own syntax
+		if policy.Type != string(types.PolicyTypeServiceControlPolicy) {
+			continue
+		}
+		document, err := scp.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", policy.ID, err)
+		}
+		for i, statement := range document.Statement {
+			conditions := ""
+			if len(statement.Condition) > 0 {
+				encoded, err := json.Marshal(statement.Condition)
+				if err != nil {
+					return nil, err
+				}
+				conditions = string(encoded)
+			}
+			statements.rows = append(statements.rows, []string{
+				policy.ID, strconv.Itoa(i), statement.Sid, statement.Effect,
+				strings.Join(statement.Action, ";"), strings.Join(statement.NotAction, ";"),
+				strings.Join(statement.Resource, ";"), strings.Join(statement.NotResource, ";"), conditions,
+			})
+		}
+	}
+
+	return []exportTable{ous, accounts, policies, attachments, statements}, nil
+}
+
+// Type of a policy target, from the prefix of its ID.
+func targetType(id string) string {
+	switch {
+	case strings.HasPrefix(id, "r-"):
+		return string(types.TargetTypeRoot)
+	case strings.HasPrefix(id, "ou-"):
+		return string(types.TargetTypeOrganizationalUnit)
+	default:
+		return string(types.TargetTypeAccount)
+	}
+}
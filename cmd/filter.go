@@ -0,0 +1,257 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// scopeOptions are the exclude filters, given with flags and in the scope of
+// the config file. Each value can be an ID or a glob pattern matched against
+// names. OU filters starting with "/" are matched against the path of the OU
+// instead (e.g. "/Root/Sandbox").
+type scopeOptions struct {
+	excludeOUs         []string // OUs omitted from the reports, along with their subtrees
+	excludeAccounts    []string // accounts omitted from the reports
+	excludeAccountTags []string // accounts carrying any of these tags (key=value) are omitted
+	onlyActive         bool     // accounts that are not ACTIVE (projects pending deletion for GCP) are omitted
+	onlySuspended      bool     // ACTIVE accounts are omitted
+}
+
+// Makes sure every exclude filter is valid before the scan starts.
+func (s *scopeOptions) validate() error {
+	for _, pattern := range append(append([]string{}, s.excludeOUs...), s.excludeAccounts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	for _, tag := range s.excludeAccountTags {
+		if key, _, ok := strings.Cut(tag, "="); !ok || key == "" {
+			return fmt.Errorf("invalid exclude tag %q: it must look like key=value", tag)
+		}
+	}
+	return nil
+}
+
+// Reports whether id or name match any of the patterns.
+func matchesAny(patterns []string, id, name string) bool {
+	for _, pattern := range patterns {
+		// Patterns were validated up front, so errors can be safely ignored here
+		if idMatch, _ := path.Match(pattern, id); idMatch {
+			return true
+		}
+		if nameMatch, _ := path.Match(pattern, name); nameMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// Decides whether an OU or an account must be left out of the reports.
+// Names are only looked up when there are filters for that kind of entity.
+func isExcluded(ctx context.Context, client orgAPI, entityID string) (bool, error) {
+	if strings.HasPrefix(entityID, "ou-") {
+		return isOUExcluded(ctx, client, entityID)
+	}
+
+	scope := client.options().scope
+	if len(scope.excludeAccounts) > 0 {
+		name, err := client.scout().Name(ctx, entityID)
+		if err != nil {
+			return false, fmt.Errorf("error getting name for id %s: %w", entityID, err)
+		}
+		if matchesAny(scope.excludeAccounts, entityID, name) {
+			return true, nil
+		}
+	}
+
+	if scope.onlyActive || scope.onlySuspended {
+		account, err := client.scout().Account(ctx, entityID)
+		if err != nil {
+			return false, err
+		}
+		if active := account.Status == types.AccountStatusActive; active != scope.onlyActive {
+			return true, nil
+		}
+	}
+
+	if len(scope.excludeAccountTags) > 0 {
+		tags, err := getResourceTags(ctx, client, entityID)
+		if err != nil {
+			return false, fmt.Errorf("error getting tags of account %s: %w", entityID, err)
+		}
+		for _, tag := range scope.excludeAccountTags {
+			key, value, _ := strings.Cut(tag, "=")
+			if current, ok := tags[key]; ok && current == value {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Decides whether an account is left out of the reports, either by itself or
+// because it lives below an excluded OU. Used by the commands listing accounts
+// without walking the org tree.
+func isAccountOutOfScope(ctx context.Context, client orgAPI, accountID string) (bool, error) {
+	excluded, err := isExcluded(ctx, client, accountID)
+	if err != nil || excluded || len(client.options().scope.excludeOUs) == 0 {
+		return excluded, err
+	}
+
+	for current := accountID; !strings.HasPrefix(current, "r-"); {
+		parentID, err := client.scout().ParentID(ctx, current)
+		if err != nil {
+			return false, err
+		}
+		current = parentID
+
+		if strings.HasPrefix(current, "ou-") {
+			if excluded, err := isOUExcluded(ctx, client, current); err != nil || excluded {
+				return excluded, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// Leaves the OUs and accounts out of the scope out of a snapshot captured for
+// an analysis (the snapshots written by "aws snapshot" are complete), along
+// with the policy targets pointing to them. The OUs of the snapshot are listed
+// parents first, so the subtree of an excluded OU goes with it.
+func scopeSnapshot(ctx context.Context, client orgAPI, snapshot *orgSnapshot) error {
+	removed := map[string]bool{}
+	ous := snapshot.OUs[:0]
+	for _, ou := range snapshot.OUs {
+		excluded := removed[ou.ParentID]
+		if !excluded {
+			var err error
+			if excluded, err = isOUExcluded(ctx, client, ou.ID); err != nil {
+				return err
+			}
+		}
+		if excluded {
+			removed[ou.ID] = true
+			continue
+		}
+		ous = append(ous, ou)
+	}
+	snapshot.OUs = ous
+
+	accounts := snapshot.Accounts[:0]
+	for _, account := range snapshot.Accounts {
+		excluded := removed[account.ParentID]
+		if !excluded {
+			var err error
+			if excluded, err = isExcluded(ctx, client, account.ID); err != nil {
+				return err
+			}
+		}
+		if excluded {
+			removed[account.ID] = true
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	snapshot.Accounts = accounts
+
+	for i, policy := range snapshot.Policies {
+		snapshot.Policies[i].Targets = slices.DeleteFunc(policy.Targets, func(id string) bool { return removed[id] })
+	}
+	return nil
+}
+
+// Decides whether an OU must be left out of the reports. The path of the OU is
+// only computed when some filter is a path.
+func isOUExcluded(ctx context.Context, client orgAPI, ouID string) (bool, error) {
+	excludeOUs := client.options().scope.excludeOUs
+	if len(excludeOUs) == 0 {
+		return false, nil
+	}
+
+	name, err := client.scout().Name(ctx, ouID)
+	if err != nil {
+		return false, fmt.Errorf("error getting name for id %s: %w", ouID, err)
+	}
+
+	var patterns, pathPatterns []string
+	for _, pattern := range excludeOUs {
+		if strings.HasPrefix(pattern, "/") {
+			pathPatterns = append(pathPatterns, pattern)
+		} else {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if matchesAny(patterns, ouID, name) {
+		return true, nil
+	}
+	if len(pathPatterns) == 0 {
+		return false, nil
+	}
+
+	ouPath, err := getOUPath(ctx, client, ouID)
+	if err != nil {
+		return false, err
+	}
+	for _, pattern := range pathPatterns {
+		if match, _ := path.Match(pattern, ouPath); match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Builds the path of names from the root to an OU, e.g. "/Root/Prod/Finance".
+func getOUPath(ctx context.Context, client orgAPI, ouID string) (string, error) {
+	var names []string
+	for current := ouID; ; {
+		name, err := client.scout().Name(ctx, current)
+		if err != nil {
+			return "", fmt.Errorf("error getting name for id %s: %w", current, err)
+		}
+		names = append([]string{name}, names...)
+		if strings.HasPrefix(current, "r-") {
+			break
+		}
+
+		parentID, err := client.scout().ParentID(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		current = parentID
+	}
+	return "/" + strings.Join(names, "/"), nil
+}
+
+// Gets the tags of an account or OU. Tags are cached like the rest of the API results.
+func getResourceTags(ctx context.Context, client orgAPI, resourceID string) (map[string]string, error) {
+	if tags, ok := cachedTags(client.scout().Cache, resourceID); ok {
+		return tags, nil
+	}
+
+	tags := map[string]string{}
+	paginator := organizations.NewListTagsForResourcePaginator(client, &organizations.ListTagsForResourceInput{ResourceId: &resourceID})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range page.Tags {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+
+	cacheTags(client.scout().Cache, resourceID, tags)
+	return tags, nil
+}
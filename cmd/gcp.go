@@ -6,30 +6,346 @@ Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
 	"github.com/spf13/cobra"
 )
 
-// gcpCmd represents the gcp command.
-var gcpCmd = &cobra.Command{
-	Use:   "gcp",
-	Short: "Entrypoint for all GCP interactions",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("gcp called")
-	},
+// gcpOptions are the flags of the gcp commands, shared by all of them.
+type gcpOptions struct {
+	organizationIDs  []string // IDs of the analyzed organizations, e.g. 123456789012
+	allOrganizations bool     // every organization the credentials can see is analyzed
+	serviceAccount   string   // service account impersonated to call the APIs, e.g. auditor@project.iam.gserviceaccount.com
+	credentials      string   // credentials file used instead of the Application Default Credentials
+	quotaProject     string   // project billed for the quota of the API calls
+	filterTags       []string // only the projects carrying every one of these tags (key=value) are kept
+	filterLabels     []string // only the projects carrying every one of these labels (key=value) are kept
+	onlyActive       bool     // the projects pending deletion are left out
+	showLiens        bool     // the liens of every project are added to the tree
+	assetInventory   bool     // the hierarchy and the org policies are read from the Cloud Asset Inventory
+	assetExport      string   // Cloud Asset Inventory export analyzed instead of the live organization
+	folderID         string   // folder where the traversals start, the organization if empty
+	sortKey          string   // order of the children of every node, see --sort
 }
 
-func init() {
-	rootCmd.AddCommand(gcpCmd)
+// newGcpCmd creates the group of GCP commands.
+func newGcpCmd(deps *dependencies) *cobra.Command {
+	gcpCmd := &cobra.Command{
+		Use:   "gcp",
+		Short: "Entrypoint for all GCP interactions",
+	}
 
-	// Here you will define your flags and configuration settings.
+	// Available to every gcp subcommand
+	options := &deps.options.gcp
+	gcpCmd.PersistentFlags().StringSliceVar(&options.organizationIDs, "organization", nil, "ID of the analyzed GCP organization, e.g. 123456789012 (repeatable or comma separated, gcp tree and gcp policies combining the reports of several organizations)")
+	gcpCmd.PersistentFlags().BoolVar(&options.allOrganizations, "all-organizations", false, "analyze every organization the credentials can see (organizations.search) instead of the ones of --organization")
+	gcpCmd.MarkFlagsMutuallyExclusive("organization", "all-organizations")
+	gcpCmd.PersistentFlags().StringVar(&options.serviceAccount, "impersonate-service-account", "", "email of a read-only audit service account impersonated to call the APIs (IAM Credentials API), instead of using your own credentials")
+	gcpCmd.PersistentFlags().StringVar(&options.credentials, "credentials-file", "", "JSON credentials file (service account key, workload identity federation config) used instead of the Application Default Credentials")
+	gcpCmd.PersistentFlags().StringVar(&options.quotaProject, "quota-project", "", "project the quota and billing of the API calls are charged to, instead of the quota project of the credentials")
+	gcpCmd.PersistentFlags().BoolVar(&options.assetInventory, "asset-inventory", false, "read the folders, projects and org policies from the Cloud Asset Inventory of the organization in a few batched calls instead of calls per folder and project (Cloud Asset API)")
+	gcpCmd.PersistentFlags().StringVar(&options.assetExport, "asset-export", "", "analyze the folders, projects and org policies of a Cloud Asset Inventory export (gcloud asset export or gcloud asset list --format=json) offline instead of the live organization")
+	gcpCmd.MarkFlagsMutuallyExclusive("asset-inventory", "asset-export")
+	gcpCmd.PersistentFlags().StringVar(&options.sortKey, "sort", orgtree.SortByName, `order of the folders and projects below every node: "name", "id" or "none" (API order)`)
+	gcpCmd.PersistentFlags().StringVar(&deps.options.treeStyleName, "tree-style", "flat", `how the branches of the text tree are drawn: "flat", "ascii", "unicode" or "compact"`)
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// gcpCmd.PersistentFlags().String("foo", "", "A help for foo")
+	gcpCmd.AddCommand(newGcpEffectiveCmd(deps))
+	gcpCmd.AddCommand(newGcpPoliciesCmd(deps))
+	gcpCmd.AddCommand(newGcpSimulateCmd(deps))
+	gcpCmd.AddCommand(newGcpSnapshotCmd(deps))
+	gcpCmd.AddCommand(newGcpTreeCmd(deps))
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// gcpCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	return gcpCmd
+}
+
+// newGcpTreeCmd creates the gcp tree command.
+func newGcpTreeCmd(deps *dependencies) *cobra.Command {
+	options := &renderOptions{format: textFormat}
+	treeCmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Displays the resource hierarchy of the organization (folders and projects) with the org and deny policies of every node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := describeGCPHierarchy(cmd.Context(), deps, *options)
+			return finishPartialResults(cmd, deps, err)
+		},
+	}
+
+	treeCmd.Flags().VarP(&options.format, "output-format", "o", `valid output formats are: "text", "json", "dot", "csv", "cypher", "yaml"`)
+	gcp := &deps.options.gcp
+	treeCmd.Flags().StringVar(&gcp.folderID, "folder-id", "", "ID of the folder used as the starting point of the analysis, e.g. 123456789012 (defaults to the organization)")
+	treeCmd.Flags().BoolVar(&options.showPolicyIDs, "show-policy-ids", false, "display the resource names of the org policies next to their constraints in the text output")
+	treeCmd.Flags().StringArrayVar(&gcp.filterTags, "filter-tag", nil, "only keep the projects carrying this tag (key=value, bound or inherited), and the folders leading to them (repeatable)")
+	treeCmd.Flags().StringArrayVar(&gcp.filterLabels, "filter-label", nil, "only keep the projects carrying this label (key=value), and the folders leading to them (repeatable)")
+	treeCmd.Flags().BoolVar(&gcp.showLiens, "show-liens", false, "include the liens placed on every project, which prevent its deletion (Resource Manager API)")
+	treeCmd.Flags().BoolVar(&gcp.onlyActive, "only-active", false, "omit the projects pending deletion (DELETE_REQUESTED)")
+
+	return treeCmd
+}
+
+// describeGCPHierarchy walks the organizations (or the folder of --folder-id)
+// down to their projects and writes the trees in the output format.
+func describeGCPHierarchy(ctx context.Context, deps *dependencies, options renderOptions) error {
+	gcp := &deps.options.gcp
+	renderer, err := newTreeRenderer(ctx, &deps.options, nil, options)
+	if err != nil {
+		return err
+	}
+
+	if err := validateGCPFilters(gcp); err != nil {
+		return err
+	}
+
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	starts, ancestors, err := getGCPStartingResources(ctx, gcp, client)
+	if err != nil {
+		return err
+	}
+	if len(starts) > 1 {
+		return describeGCPOrganizations(ctx, deps.report, gcp, client, starts, options.format, renderer)
+	}
+
+	tree, err := buildGCPTree(ctx, gcp, client, starts[0], ancestors)
+	if err != nil {
+		return err
+	}
+	return renderer.Render(deps.report, tree)
+}
+
+// describeGCPOrganizations builds the tree of every organization and merges
+// them in a single report keyed by organization ID, like "aws orgs" does. An
+// organization that can't be read doesn't prevent reporting the others, the
+// command then ends with partial results.
+func describeGCPOrganizations(ctx context.Context, w io.Writer, gcp *gcpOptions, client gcpAPI, organizations []*gcpResource, format outputFormat, renderer orgtree.Renderer) error {
+	if format != textFormat && format != jsonFormat && format != yamlFormat {
+		return fmt.Errorf(`the %q output format is not available for several organizations, use "text", "json" or "yaml"`, format)
+	}
+
+	report := multiOrgReport{Organizations: map[string]*multiOrgEntry{}}
+	var failed partialResultsError
+	for _, organization := range organizations {
+		tree, err := buildGCPTree(ctx, gcp, client, organization, nil)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("organization %s: %w", organization.Name, err))
+			continue
+		}
+		// The text trees are written right away
+		if format == textFormat {
+			if err := renderer.Render(w, tree); err != nil {
+				return err
+			}
+		}
+		report.Organizations[tree.OrganizationID] = &multiOrgEntry{Name: organization.DisplayName, Tree: tree.Root}
+	}
+	if len(failed) == len(organizations) {
+		return failed[0]
+	}
+
+	switch format {
+	case jsonFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	case yamlFormat:
+		if err := orgtree.EncodeYAML(w, report); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Gets the organizations of --organization, every one the credentials can see
+// with --all-organizations, or the one of the demo (or export) being used when
+// neither is given.
+func gcpOrganizations(ctx context.Context, gcp *gcpOptions, client gcpAPI) ([]*gcpResource, error) {
+	if gcp.allOrganizations {
+		organizations, err := client.SearchOrganizations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(organizations) == 0 {
+			return nil, errors.New("no organization can be seen with these credentials")
+		}
+		return organizations, nil
+	}
+
+	if len(gcp.organizationIDs) == 0 {
+		demo, ok := client.(*gcpSnapshot)
+		if !ok {
+			return nil, errors.New("at least one of the flags in the group [organization all-organizations] is required")
+		}
+		return []*gcpResource{&demo.Organization}, nil
+	}
+
+	var organizations []*gcpResource
+	for _, name := range gcpOrganizationNames(gcp) {
+		organization, err := client.GetResource(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, organization)
+	}
+	return organizations, nil
+}
+
+// Resource names of the organizations of --organization, each once.
+func gcpOrganizationNames(gcp *gcpOptions) []string {
+	var names []string
+	for _, id := range gcp.organizationIDs {
+		name := gcpOrganizationPrefix + strings.TrimPrefix(id, gcpOrganizationPrefix)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Gets the resources where the traversals start: the folder of --folder-id,
+// the organizations otherwise. The ancestors of the folder, from its
+// organization down to its parent, are returned along with it; its
+// organization is checked to be one of --organization, and found from the
+// folder when not given.
+func getGCPStartingResources(ctx context.Context, gcp *gcpOptions, client gcpAPI) ([]*gcpResource, []*gcpResource, error) {
+	if gcp.folderID == "" {
+		organizations, err := gcpOrganizations(ctx, gcp, client)
+		return organizations, nil, err
+	}
+
+	name := gcpFolderPrefix + strings.TrimPrefix(gcp.folderID, gcpFolderPrefix)
+	folder, err := client.GetResource(ctx, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't find folder %s: %w", name, err)
+	}
+	var ancestors []*gcpResource
+	for parent := folder.Parent; parent != ""; {
+		resource, err := client.GetResource(ctx, parent)
+		if err != nil {
+			return nil, nil, err
+		}
+		ancestors = append([]*gcpResource{resource}, ancestors...)
+		parent = resource.Parent
+	}
+
+	if organizations := gcpOrganizationNames(gcp); len(organizations) > 0 && (len(ancestors) == 0 || !slices.Contains(organizations, ancestors[0].Name)) {
+		return nil, nil, fmt.Errorf("folder %s is not in the organization %s", name, strings.Join(organizations, ", "))
+	}
+	return []*gcpResource{folder}, ancestors, nil
+}
+
+// Builds the tree below the starting resource, its children sorted according
+// to --sort. ancestors are the ones of a starting folder, from its
+// organization down to its parent, whose tags it inherits.
+func buildGCPTree(ctx context.Context, gcp *gcpOptions, client gcpAPI, start *gcpResource, ancestors []*gcpResource) (*orgtree.Tree, error) {
+	sortKey := gcp.sortKey
+	switch sortKey {
+	case "", orgtree.SortByName, orgtree.SortByID, sortNone:
+	default:
+		return nil, fmt.Errorf(`invalid sort key %q: valid sort keys are "name", "id", "none"`, sortKey)
+	}
+
+	organization := start
+	var inherited map[string]orgtree.Tag
+	for _, ancestor := range ancestors {
+		node := newGCPNode(ancestor)
+		if err := addGCPTags(ctx, client, node, ancestor.Name, inherited); err != nil {
+			return nil, err
+		}
+		inherited = node.Tags
+	}
+	if len(ancestors) > 0 {
+		organization = ancestors[0]
+	}
+
+	root, err := buildGCPSubtree(ctx, gcp, client, start, inherited)
+	if err != nil {
+		return nil, err
+	}
+	if len(gcp.filterTags)+len(gcp.filterLabels) > 0 {
+		filterGCPProjects(gcp, root)
+	}
+	// The custom constraints are defined in the organization, below its node
+	if organization == start {
+		if err := addGCPCustomConstraints(ctx, client, root, organization.Name); err != nil {
+			return nil, err
+		}
+	}
+	if sortKey != sortNone {
+		root.Sort(sortKey)
+	}
+	return &orgtree.Tree{OrganizationID: strings.TrimPrefix(organization.Name, gcpOrganizationPrefix), Root: root}, nil
+}
+
+// Recursively builds the subtree of an organization or folder: its projects
+// and the subtrees of its folders. inherited are the tags of its parent.
+func buildGCPSubtree(ctx context.Context, gcp *gcpOptions, client gcpAPI, resource *gcpResource, inherited map[string]orgtree.Tag) (*orgtree.Node, error) {
+	node := newGCPNode(resource)
+	if err := addGCPPolicies(ctx, client, node, resource.Name); err != nil {
+		return nil, err
+	}
+	if err := addGCPTags(ctx, client, node, resource.Name, inherited); err != nil {
+		return nil, err
+	}
+
+	projects, err := client.ListProjects(ctx, resource.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if !isGCPProjectInScope(gcp, project) {
+			continue
+		}
+		child := newGCPNode(project)
+		if err := addGCPPolicies(ctx, client, child, project.Name); err != nil {
+			return nil, err
+		}
+		if err := addGCPTags(ctx, client, child, project.Name, node.Tags); err != nil {
+			return nil, err
+		}
+		if gcp.showLiens {
+			if err := addGCPLiens(ctx, client, child, project.Name); err != nil {
+				return nil, err
+			}
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	folders, err := client.ListFolders(ctx, resource.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		child, err := buildGCPSubtree(ctx, gcp, client, folder, node.Tags)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// Creates the node of a resource, without its children. Organizations and
+// folders are identified by their number, projects by their project ID.
+func newGCPNode(resource *gcpResource) *orgtree.Node {
+	switch {
+	case strings.HasPrefix(resource.Name, gcpOrganizationPrefix):
+		return &orgtree.Node{Type: orgtree.OrganizationNode, ID: strings.TrimPrefix(resource.Name, gcpOrganizationPrefix), Name: resource.DisplayName}
+	case strings.HasPrefix(resource.Name, gcpFolderPrefix):
+		return &orgtree.Node{Type: orgtree.FolderNode, ID: strings.TrimPrefix(resource.Name, gcpFolderPrefix), Name: resource.DisplayName}
+	default:
+		return &orgtree.Node{Type: orgtree.ProjectNode, ID: resource.ProjectID, Name: resource.DisplayName, Status: resource.State}
+	}
 }
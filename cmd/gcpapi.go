@@ -0,0 +1,366 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"google.golang.org/api/cloudasset/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/iam/v2"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+	"google.golang.org/api/orgpolicy/v2"
+	"google.golang.org/api/policytroubleshooter/v1"
+)
+
+// gcpAPI is the part of the Google Cloud APIs used by the gcp commands. The
+// client libraries are made of call builders, which can't be faked, so the
+// traversals take this interface instead: it is implemented by gcpClient for
+// the live organization, by gcpAssetClient when its hierarchy comes from the
+// Cloud Asset Inventory, and by gcpSnapshot for the demo and the exports.
+type gcpAPI interface {
+	// Lists the organizations the credentials can see
+	SearchOrganizations(ctx context.Context) ([]*gcpResource, error)
+	// Gets an organization, folder or project by resource name, e.g. folders/123
+	GetResource(ctx context.Context, name string) (*gcpResource, error)
+	// Lists the folders right below an organization or folder
+	ListFolders(ctx context.Context, parent string) ([]*gcpResource, error)
+	// Lists the projects right below an organization or folder, the ones pending
+	// deletion included
+	ListProjects(ctx context.Context, parent string) ([]*gcpResource, error)
+	// Lists the org policies set on an organization, folder or project
+	ListPolicies(ctx context.Context, parent string) ([]*orgpolicy.GoogleCloudOrgpolicyV2Policy, error)
+	// Lists the custom constraints defined in an organization
+	ListCustomConstraints(ctx context.Context, organization string) ([]*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint, error)
+	// Lists the IAM deny policies attached to an organization, folder or project,
+	// with their rules
+	ListDenyPolicies(ctx context.Context, resource string) ([]*iam.GoogleIamV2Policy, error)
+	// Lists the tags of an organization, folder or project, the ones inherited
+	// from its ancestors included
+	ListEffectiveTags(ctx context.Context, resource string) ([]*cloudresourcemanager.EffectiveTag, error)
+	// Lists the liens placed on a project, e.g. projects/123
+	ListLiens(ctx context.Context, project string) ([]*cloudresourcemanager.Lien, error)
+	// Asks the Policy Troubleshooter whether the IAM allow policies grant a
+	// permission to a principal (an email) on a resource, e.g. GRANTED, empty
+	// when it can't be asked
+	TroubleshootIAM(ctx context.Context, principal, resource, permission string) (string, error)
+}
+
+// An organization, folder or project of the GCP resource hierarchy.
+type gcpResource struct {
+	Name        string            `json:"name"` // organizations/<id>, folders/<id> or projects/<number>
+	DisplayName string            `json:"displayName"`
+	ProjectID   string            `json:"projectId,omitempty"` // projects only
+	Parent      string            `json:"parent,omitempty"`    // resource name, none for organizations
+	State       string            `json:"state,omitempty"`     // ACTIVE or DELETE_REQUESTED
+	Labels      map[string]string `json:"labels,omitempty"`    // projects only
+}
+
+// Prefixes of the resource names of the hierarchy.
+const (
+	gcpOrganizationPrefix = "organizations/"
+	gcpFolderPrefix       = "folders/"
+	gcpProjectPrefix      = "projects/"
+)
+
+// Parent of the IAM deny policies attached to a resource of the hierarchy, its
+// full resource name URL-encoded as the attachment point, e.g.
+// policies/cloudresourcemanager.googleapis.com%2Ffolders%2F123/denypolicies.
+func gcpDenyPoliciesParent(resource string) string {
+	return "policies/" + url.PathEscape("cloudresourcemanager.googleapis.com/"+resource) + "/denypolicies"
+}
+
+// gcpClient is the gcpAPI of the live organization, reached with the
+// Application Default Credentials (or --credentials-file), possibly as the
+// service account of --impersonate-service-account.
+type gcpClient struct {
+	resourceManager *cloudresourcemanager.Service
+	orgPolicy       *orgpolicy.Service
+	iam             *iam.Service
+	troubleshooter  *policytroubleshooter.Service
+}
+
+// Creates the client of the GCP organization being analyzed: the live one, the
+// demo, or the Cloud Asset Inventory export of --asset-export.
+func (d *dependencies) newGCPClient(ctx context.Context) (gcpAPI, error) {
+	if d.options.demo {
+		return parseGCPSnapshot(demoGCPSnapshot)
+	}
+	gcp := &d.options.gcp
+	if gcp.assetExport != "" {
+		return loadGCPAssetExport(gcp.assetExport)
+	}
+
+	options, err := gcpClientOptions(ctx, gcp)
+	if err != nil {
+		return nil, err
+	}
+	resourceManager, err := cloudresourcemanager.NewService(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the Resource Manager client: %w", err)
+	}
+	orgPolicy, err := orgpolicy.NewService(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the Org Policy client: %w", err)
+	}
+	iamService, err := iam.NewService(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the IAM client: %w", err)
+	}
+	troubleshooter, err := policytroubleshooter.NewService(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the Policy Troubleshooter client: %w", err)
+	}
+	client := &gcpClient{resourceManager: resourceManager, orgPolicy: orgPolicy, iam: iamService, troubleshooter: troubleshooter}
+	if !gcp.assetInventory {
+		return client, nil
+	}
+
+	assetService, err := cloudasset.NewService(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the Cloud Asset client: %w", err)
+	}
+	organizations, err := gcpOrganizations(ctx, gcp, client)
+	if err != nil {
+		return nil, err
+	}
+	assetClient := &gcpAssetClient{gcpClient: client}
+	for _, organization := range organizations {
+		assets, err := listGCPAssets(ctx, assetService, organization.Name)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, err := gcpSnapshotFromAssets(assets)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Cloud Asset Inventory of %s: %w", organization.Name, err)
+		}
+		assetClient.assets = append(assetClient.assets, snapshot)
+	}
+	return assetClient, nil
+}
+
+// Options of the clients of the APIs: the credentials of --credentials-file
+// rather than the Application Default Credentials, and the quota project of
+// --quota-project. With --impersonate-service-account, the IAM Credentials API
+// exchanges these credentials for short-lived tokens of the service account,
+// so only the service account needs to be granted the viewer roles on the
+// organization.
+func gcpClientOptions(ctx context.Context, gcp *gcpOptions) ([]option.ClientOption, error) {
+	var options []option.ClientOption
+	if gcp.credentials != "" {
+		options = append(options, option.WithCredentialsFile(gcp.credentials))
+	}
+	if gcp.quotaProject != "" {
+		options = append(options, option.WithQuotaProject(gcp.quotaProject))
+	}
+	if gcp.serviceAccount == "" {
+		return options, nil
+	}
+
+	tokens, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: gcp.serviceAccount,
+		Scopes:          []string{cloudresourcemanager.CloudPlatformScope},
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error impersonating the service account %s: %w", gcp.serviceAccount, err)
+	}
+	options = []option.ClientOption{option.WithTokenSource(tokens)}
+	if gcp.quotaProject != "" {
+		options = append(options, option.WithQuotaProject(gcp.quotaProject))
+	}
+	return options, nil
+}
+
+// SearchOrganizations implements gcpAPI.
+func (c *gcpClient) SearchOrganizations(ctx context.Context) ([]*gcpResource, error) {
+	var organizations []*gcpResource
+	err := c.resourceManager.Organizations.Search().Pages(ctx, func(page *cloudresourcemanager.SearchOrganizationsResponse) error {
+		for _, organization := range page.Organizations {
+			organizations = append(organizations, &gcpResource{Name: organization.Name, DisplayName: organization.DisplayName, State: organization.State})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching the organizations: %w", err)
+	}
+	return organizations, nil
+}
+
+// GetResource implements gcpAPI.
+func (c *gcpClient) GetResource(ctx context.Context, name string) (*gcpResource, error) {
+	switch {
+	case strings.HasPrefix(name, gcpOrganizationPrefix):
+		organization, err := c.resourceManager.Organizations.Get(name).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %w", name, err)
+		}
+		return &gcpResource{Name: organization.Name, DisplayName: organization.DisplayName, State: organization.State}, nil
+	case strings.HasPrefix(name, gcpFolderPrefix):
+		folder, err := c.resourceManager.Folders.Get(name).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %w", name, err)
+		}
+		return gcpFolderResource(folder), nil
+	default:
+		project, err := c.resourceManager.Projects.Get(name).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %w", name, err)
+		}
+		return gcpProjectResource(project), nil
+	}
+}
+
+// ListFolders implements gcpAPI.
+func (c *gcpClient) ListFolders(ctx context.Context, parent string) ([]*gcpResource, error) {
+	var folders []*gcpResource
+	err := c.resourceManager.Folders.List().Parent(parent).Pages(ctx, func(page *cloudresourcemanager.ListFoldersResponse) error {
+		for _, folder := range page.Folders {
+			folders = append(folders, gcpFolderResource(folder))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the folders of %s: %w", parent, err)
+	}
+	return folders, nil
+}
+
+// ListProjects implements gcpAPI.
+func (c *gcpClient) ListProjects(ctx context.Context, parent string) ([]*gcpResource, error) {
+	var projects []*gcpResource
+	err := c.resourceManager.Projects.List().Parent(parent).ShowDeleted(true).Pages(ctx, func(page *cloudresourcemanager.ListProjectsResponse) error {
+		for _, project := range page.Projects {
+			projects = append(projects, gcpProjectResource(project))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the projects of %s: %w", parent, err)
+	}
+	return projects, nil
+}
+
+// ListPolicies implements gcpAPI.
+func (c *gcpClient) ListPolicies(ctx context.Context, parent string) ([]*orgpolicy.GoogleCloudOrgpolicyV2Policy, error) {
+	var policies []*orgpolicy.GoogleCloudOrgpolicyV2Policy
+	collect := func(page *orgpolicy.GoogleCloudOrgpolicyV2ListPoliciesResponse) error {
+		policies = append(policies, page.Policies...)
+		return nil
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(parent, gcpOrganizationPrefix):
+		err = c.orgPolicy.Organizations.Policies.List(parent).Pages(ctx, collect)
+	case strings.HasPrefix(parent, gcpFolderPrefix):
+		err = c.orgPolicy.Folders.Policies.List(parent).Pages(ctx, collect)
+	default:
+		err = c.orgPolicy.Projects.Policies.List(parent).Pages(ctx, collect)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing the org policies of %s: %w", parent, err)
+	}
+	return policies, nil
+}
+
+// ListCustomConstraints implements gcpAPI.
+func (c *gcpClient) ListCustomConstraints(ctx context.Context, organization string) ([]*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint, error) {
+	var constraints []*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint
+	err := c.orgPolicy.Organizations.CustomConstraints.List(organization).Pages(ctx, func(page *orgpolicy.GoogleCloudOrgpolicyV2ListCustomConstraintsResponse) error {
+		constraints = append(constraints, page.CustomConstraints...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the custom constraints of %s: %w", organization, err)
+	}
+	return constraints, nil
+}
+
+// ListDenyPolicies implements gcpAPI. Listing only returns the metadata of the
+// policies, so every one is then read for its rules.
+func (c *gcpClient) ListDenyPolicies(ctx context.Context, resource string) ([]*iam.GoogleIamV2Policy, error) {
+	var names []string
+	err := c.iam.Policies.ListPolicies(gcpDenyPoliciesParent(resource)).Pages(ctx, func(page *iam.GoogleIamV2ListPoliciesResponse) error {
+		for _, policy := range page.Policies {
+			names = append(names, policy.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the deny policies of %s: %w", resource, err)
+	}
+
+	policies := make([]*iam.GoogleIamV2Policy, 0, len(names))
+	for _, name := range names {
+		policy, err := c.iam.Policies.Get(name).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("error getting the deny policy %s: %w", name, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// ListEffectiveTags implements gcpAPI.
+func (c *gcpClient) ListEffectiveTags(ctx context.Context, resource string) ([]*cloudresourcemanager.EffectiveTag, error) {
+	var tags []*cloudresourcemanager.EffectiveTag
+	err := c.resourceManager.EffectiveTags.List().Parent("//cloudresourcemanager.googleapis.com/"+resource).Pages(ctx, func(page *cloudresourcemanager.ListEffectiveTagsResponse) error {
+		tags = append(tags, page.EffectiveTags...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the tags of %s: %w", resource, err)
+	}
+	return tags, nil
+}
+
+// ListLiens implements gcpAPI.
+func (c *gcpClient) ListLiens(ctx context.Context, project string) ([]*cloudresourcemanager.Lien, error) {
+	var liens []*cloudresourcemanager.Lien
+	err := c.resourceManager.Liens.List().Parent(project).Pages(ctx, func(page *cloudresourcemanager.ListLiensResponse) error {
+		liens = append(liens, page.Liens...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the liens of %s: %w", project, err)
+	}
+	return liens, nil
+}
+
+// TroubleshootIAM implements gcpAPI.
+func (c *gcpClient) TroubleshootIAM(ctx context.Context, principal, resource, permission string) (string, error) {
+	request := &policytroubleshooter.GoogleCloudPolicytroubleshooterV1TroubleshootIamPolicyRequest{
+		AccessTuple: &policytroubleshooter.GoogleCloudPolicytroubleshooterV1AccessTuple{
+			Principal:        principal,
+			FullResourceName: "//cloudresourcemanager.googleapis.com/" + resource,
+			Permission:       permission,
+		},
+	}
+	response, err := c.troubleshooter.Iam.Troubleshoot(request).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("error troubleshooting %s for %s on %s: %w", permission, principal, resource, err)
+	}
+	return response.Access, nil
+}
+
+func gcpFolderResource(folder *cloudresourcemanager.Folder) *gcpResource {
+	return &gcpResource{Name: folder.Name, DisplayName: folder.DisplayName, Parent: folder.Parent, State: folder.State}
+}
+
+func gcpProjectResource(project *cloudresourcemanager.Project) *gcpResource {
+	return &gcpResource{
+		Name:        project.Name,
+		DisplayName: project.DisplayName,
+		ProjectID:   project.ProjectId,
+		Parent:      project.Parent,
+		State:       project.State,
+		Labels:      project.Labels,
+	}
+}
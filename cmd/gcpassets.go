@@ -0,0 +1,283 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"google.golang.org/api/cloudasset/v1"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Asset types of the resource hierarchy in the Cloud Asset Inventory.
+const (
+	gcpOrganizationAssetType = "cloudresourcemanager.googleapis.com/Organization"
+	gcpFolderAssetType       = "cloudresourcemanager.googleapis.com/Folder"
+	gcpProjectAssetType      = "cloudresourcemanager.googleapis.com/Project"
+)
+
+// Prefix of the full resource names of the hierarchy, e.g.
+// //cloudresourcemanager.googleapis.com/folders/123.
+const gcpFullNamePrefix = "//cloudresourcemanager.googleapis.com/"
+
+// gcpAssetClient is the gcpAPI of --asset-inventory: the hierarchy and the org
+// policies are read from the Cloud Asset Inventory of every organization in a
+// couple of paginated calls, instead of a call per folder and project, the rest
+// coming from the live APIs.
+type gcpAssetClient struct {
+	*gcpClient
+	assets []*gcpSnapshot // one per organization
+}
+
+// SearchOrganizations implements gcpAPI.
+func (c *gcpAssetClient) SearchOrganizations(_ context.Context) ([]*gcpResource, error) {
+	organizations := make([]*gcpResource, 0, len(c.assets))
+	for _, assets := range c.assets {
+		organizations = append(organizations, &assets.Organization)
+	}
+	return organizations, nil
+}
+
+// GetResource implements gcpAPI.
+func (c *gcpAssetClient) GetResource(ctx context.Context, name string) (*gcpResource, error) {
+	for _, assets := range c.assets {
+		if resource, err := assets.GetResource(ctx, name); err == nil {
+			return resource, nil
+		}
+	}
+	return nil, fmt.Errorf("error getting %s: not found in the Cloud Asset Inventory", name)
+}
+
+// ListFolders implements gcpAPI.
+func (c *gcpAssetClient) ListFolders(ctx context.Context, parent string) ([]*gcpResource, error) {
+	var folders []*gcpResource
+	for _, assets := range c.assets {
+		found, _ := assets.ListFolders(ctx, parent)
+		folders = append(folders, found...)
+	}
+	return folders, nil
+}
+
+// ListProjects implements gcpAPI.
+func (c *gcpAssetClient) ListProjects(ctx context.Context, parent string) ([]*gcpResource, error) {
+	var projects []*gcpResource
+	for _, assets := range c.assets {
+		found, _ := assets.ListProjects(ctx, parent)
+		projects = append(projects, found...)
+	}
+	return projects, nil
+}
+
+// ListPolicies implements gcpAPI.
+func (c *gcpAssetClient) ListPolicies(ctx context.Context, parent string) ([]*orgpolicy.GoogleCloudOrgpolicyV2Policy, error) {
+	var policies []*orgpolicy.GoogleCloudOrgpolicyV2Policy
+	for _, assets := range c.assets {
+		found, _ := assets.ListPolicies(ctx, parent)
+		policies = append(policies, found...)
+	}
+	return policies, nil
+}
+
+// Lists the organization, folders and projects of an organization (RESOURCE
+// content) and their org policies (ORG_POLICY content) from the Cloud Asset
+// API.
+func listGCPAssets(ctx context.Context, service *cloudasset.Service, organization string) ([]*cloudasset.Asset, error) {
+	var assets []*cloudasset.Asset
+	collect := func(page *cloudasset.ListAssetsResponse) error {
+		assets = append(assets, page.Assets...)
+		return nil
+	}
+	err := service.Assets.List(organization).
+		AssetTypes(gcpOrganizationAssetType, gcpFolderAssetType, gcpProjectAssetType).
+		ContentType("RESOURCE").PageSize(1000).Pages(ctx, collect)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the resources of %s from the Cloud Asset Inventory: %w", organization, err)
+	}
+	err = service.Assets.List(organization).
+		AssetTypes(gcpOrganizationAssetType, gcpFolderAssetType, gcpProjectAssetType).
+		ContentType("ORG_POLICY").PageSize(1000).Pages(ctx, collect)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the org policies of %s from the Cloud Asset Inventory: %w", organization, err)
+	}
+	return assets, nil
+}
+
+// Loads the Cloud Asset Inventory export of --asset-export: the newline
+// delimited JSON of gcloud asset export (RESOURCE and ORG_POLICY contents,
+// possibly concatenated in the same file) or the JSON array of gcloud asset
+// list --format=json.
+func loadGCPAssetExport(file string) (*gcpSnapshot, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read Cloud Asset Inventory export: %w", err)
+	}
+
+	var assets []*cloudasset.Asset
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid Cloud Asset Inventory export %s: %w", file, err)
+		}
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, value := range values {
+			// The exports use the field names of the protos (asset_type), the API
+			// and gcloud asset list the JSON ones (assetType)
+			normalized, err := json.Marshal(camelCaseKeys(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Cloud Asset Inventory export %s: %w", file, err)
+			}
+			asset := &cloudasset.Asset{}
+			if err := json.Unmarshal(normalized, asset); err != nil {
+				return nil, fmt.Errorf("invalid Cloud Asset Inventory export %s: %w", file, err)
+			}
+			assets = append(assets, asset)
+		}
+	}
+
+	snapshot, err := gcpSnapshotFromAssets(assets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Cloud Asset Inventory export %s: %w", file, err)
+	}
+	return snapshot, nil
+}
+
+// Renames the snake_case keys of the JSON objects in camelCase, except the ones
+// of the resource data, already in the format of the API (e.g. the labels).
+func camelCaseKeys(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		renamed := make(map[string]any, len(value))
+		for key, child := range value {
+			if key != "data" {
+				child = camelCaseKeys(child)
+			}
+			renamed[camelCase(key)] = child
+		}
+		return renamed
+	case []any:
+		for i, child := range value {
+			value[i] = camelCaseKeys(child)
+		}
+	}
+	return value
+}
+
+func camelCase(key string) string {
+	words := strings.Split(key, "_")
+	for i := 1; i < len(words); i++ {
+		if words[i] != "" {
+			runes := []rune(words[i])
+			runes[0] = unicode.ToUpper(runes[0])
+			words[i] = string(runes)
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// Resource data of the organization, folder and project assets, in the
+// format of the v1 Resource Manager API (lifecycleState, the display name of
+// projects in name) or the v3 one (state, displayName).
+type gcpAssetData struct {
+	Name           string            `json:"name"`
+	DisplayName    string            `json:"displayName"`
+	ProjectID      string            `json:"projectId"`
+	LifecycleState string            `json:"lifecycleState"`
+	State          string            `json:"state"`
+	Labels         map[string]string `json:"labels"`
+}
+
+// Builds the snapshot of the organization of the assets: the organization,
+// folders and projects of the RESOURCE assets, and the org policies of the
+// ORG_POLICY ones converted to the v2 format of the Org Policy API.
+func gcpSnapshotFromAssets(assets []*cloudasset.Asset) (*gcpSnapshot, error) {
+	snapshot := &gcpSnapshot{Version: gcpSnapshotVersion}
+	for _, asset := range assets {
+		name := strings.TrimPrefix(asset.Name, gcpFullNamePrefix)
+		for _, policy := range asset.OrgPolicy {
+			snapshot.Policies = append(snapshot.Policies, gcpV2Policy(name, policy))
+		}
+		if asset.Resource == nil || len(asset.Resource.Data) == 0 {
+			continue
+		}
+
+		data := &gcpAssetData{}
+		if err := json.Unmarshal(asset.Resource.Data, data); err != nil {
+			return nil, fmt.Errorf("invalid resource data of %s: %w", asset.Name, err)
+		}
+		resource := gcpResource{
+			Name:        name,
+			DisplayName: data.DisplayName,
+			Parent:      strings.TrimPrefix(asset.Resource.Parent, gcpFullNamePrefix),
+			State:       data.State,
+		}
+		if resource.State == "" {
+			resource.State = data.LifecycleState
+		}
+
+		switch asset.AssetType {
+		case gcpOrganizationAssetType:
+			resource.Parent = ""
+			snapshot.Organization = resource
+		case gcpFolderAssetType:
+			snapshot.Folders = append(snapshot.Folders, resource)
+		case gcpProjectAssetType:
+			resource.ProjectID = data.ProjectID
+			resource.Labels = data.Labels
+			if resource.DisplayName == "" {
+				resource.DisplayName = data.Name
+			}
+			snapshot.Projects = append(snapshot.Projects, resource)
+		}
+	}
+
+	if snapshot.Organization.Name == "" {
+		return nil, errors.New("no organization asset found")
+	}
+	return snapshot, nil
+}
+
+// Converts an org policy of the Cloud Asset Inventory, in the v1 format of the
+// Resource Manager API, to the v2 format of the Org Policy API set on resource.
+func gcpV2Policy(resource string, policy *cloudasset.GoogleCloudOrgpolicyV1Policy) *orgpolicy.GoogleCloudOrgpolicyV2Policy {
+	spec := &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{UpdateTime: policy.UpdateTime}
+	switch {
+	case policy.RestoreDefault != nil:
+		spec.Reset = true
+	case policy.BooleanPolicy != nil:
+		spec.Rules = []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{Enforce: policy.BooleanPolicy.Enforced}}
+	case policy.ListPolicy != nil:
+		list := policy.ListPolicy
+		spec.InheritFromParent = list.InheritFromParent
+		switch {
+		case list.AllValues == "ALLOW":
+			spec.Rules = []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{AllowAll: true}}
+		case list.AllValues == "DENY":
+			spec.Rules = []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{DenyAll: true}}
+		case len(list.AllowedValues)+len(list.DeniedValues) > 0:
+			spec.Rules = []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{
+				Values: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRuleStringValues{
+					AllowedValues: list.AllowedValues,
+					DeniedValues:  list.DeniedValues,
+				},
+			}}
+		}
+	}
+	return &orgpolicy.GoogleCloudOrgpolicyV2Policy{
+		Name: resource + "/policies/" + strings.TrimPrefix(policy.Constraint, "constraints/"),
+		Spec: spec,
+	}
+}
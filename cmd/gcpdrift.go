@@ -0,0 +1,254 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/gcppolicy"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// gcpSnapshotDiffOptions are the flags of the gcp snapshot diff command.
+type gcpSnapshotDiffOptions struct {
+	oldSnapshot string // snapshot taken first, e.g. during the last audit
+	newSnapshot string // snapshot compared with it, the live organization if empty
+}
+
+// newGcpSnapshotDiffCmd creates the gcp snapshot diff command.
+func newGcpSnapshotDiffCmd(deps *dependencies) *cobra.Command {
+	options := &gcpSnapshotDiffOptions{}
+	snapshotDiffCmd := &cobra.Command{
+		Use:         "diff",
+		Short:       "Reports the drift between two GCP snapshots, or between a snapshot and the live organization",
+		Annotations: map[string]string{driftAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return diffGCPSnapshots(cmd.Context(), deps, options.oldSnapshot, options.newSnapshot)
+		},
+	}
+
+	snapshotDiffCmd.Flags().StringVar(&options.oldSnapshot, "old", "", "snapshot used as the reference, e.g. the one of the last audit")
+	snapshotDiffCmd.MarkFlagRequired("old") //nolint:gosec,errcheck
+	snapshotDiffCmd.Flags().StringVar(&options.newSnapshot, "new", "", "snapshot compared with the reference (defaults to the live organization)")
+
+	return snapshotDiffCmd
+}
+
+// diffGCPSnapshots reports the projects and folders added, removed and moved,
+// and the constraints set, removed or changed on any resource between the
+// snapshot at oldPath and the one at newPath (or the live organization).
+func diffGCPSnapshots(ctx context.Context, deps *dependencies, oldPath, newPath string) error {
+	old, err := readGCPSnapshot(oldPath)
+	if err != nil {
+		return err
+	}
+
+	var current *gcpSnapshot
+	newLabel := newPath
+	if newPath != "" {
+		if current, err = readGCPSnapshot(newPath); err != nil {
+			return err
+		}
+	} else {
+		client, err := deps.gcpClient(ctx)
+		if err != nil {
+			return err
+		}
+		// The organization of the reference, unless told otherwise
+		organization := &old.Organization
+		if gcp := &deps.options.gcp; gcp.allOrganizations || len(gcp.organizationIDs) > 0 {
+			organizations, err := gcpOrganizations(ctx, gcp, client)
+			if err != nil {
+				return err
+			}
+			if len(organizations) > 1 {
+				return errors.New("a GCP snapshot holds a single organization, pass one --organization")
+			}
+			organization = organizations[0]
+		} else if organization, err = client.GetResource(ctx, old.Organization.Name); err != nil {
+			return err
+		}
+		if current, err = captureGCPSnapshot(ctx, client, organization); err != nil {
+			return err
+		}
+		newLabel = "the live organization"
+	}
+
+	if old.Organization.Name != current.Organization.Name {
+		fmt.Fprintf(deps.stderr, "Warning: comparing different organizations (%s and %s)\n", old.Organization.Name, current.Organization.Name)
+	}
+
+	report := compareGCPSnapshots(old, current, oldPath, newLabel)
+	printDrift(deps.report, report)
+	return notifyDrift(ctx, deps, report)
+}
+
+// Computes the drift from old to current, labels name both states in the report.
+func compareGCPSnapshots(old, current *gcpSnapshot, oldLabel, newLabel string) driftReport {
+	set, removed, changed := changedGCPConstraints(old, current)
+	return driftReport{
+		organizationID: strings.TrimPrefix(current.Organization.Name, gcpOrganizationPrefix),
+		from:           oldLabel,
+		to:             newLabel,
+		sections: []driftSection{
+			{"Projects added", addedGCPResources(old, current, current.Projects)},
+			{"Projects removed", addedGCPResources(current, old, old.Projects)},
+			{"Projects moved", movedGCPResources(old, current, current.Projects)},
+			{"Folders added", addedGCPResources(old, current, current.Folders)},
+			{"Folders removed", addedGCPResources(current, old, old.Folders)},
+			{"Folders moved", movedGCPResources(old, current, current.Folders)},
+			{"Constraints set", set},
+			{"Constraints removed", removed},
+			{"Constraints changed", changed},
+		},
+	}
+}
+
+func readGCPSnapshot(path string) (*gcpSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read GCP snapshot: %w", err)
+	}
+	snapshot, err := parseGCPSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// Lists the resources of b (its folders or projects) that are not in a.
+func addedGCPResources(a, b *gcpSnapshot, resources []gcpResource) []string {
+	var changes []string
+	for i := range resources {
+		if _, ok := a.resource(resources[i].Name); !ok {
+			changes = append(changes, fmt.Sprintf("%s in %s", b.label(&resources[i]), b.path(resources[i].Parent)))
+		}
+	}
+	return changes
+}
+
+// Lists the resources of current (its folders or projects) whose parent
+// changed. Parents are compared by resource name, so moving a folder is
+// reported once, not for every project below it.
+func movedGCPResources(old, current *gcpSnapshot, resources []gcpResource) []string {
+	var changes []string
+	for i := range resources {
+		before, ok := old.resource(resources[i].Name)
+		if !ok || before.Parent == resources[i].Parent {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", current.label(&resources[i]), old.path(before.Parent), current.path(resources[i].Parent)))
+	}
+	return changes
+}
+
+// Lists the org policies set on a resource since old, the ones removed and the
+// ones whose live or dry-run spec changed. The etags and update times of the
+// specs are not compared, only their rules.
+func changedGCPConstraints(old, current *gcpSnapshot) (set, removed, changed []string) {
+	before := map[string]*orgpolicy.GoogleCloudOrgpolicyV2Policy{}
+	for _, policy := range old.Policies {
+		before[policy.Name] = policy
+	}
+
+	after := map[string]bool{}
+	for _, policy := range current.Policies {
+		after[policy.Name] = true
+		previous, ok := before[policy.Name]
+		if !ok {
+			set = append(set, fmt.Sprintf("%s: %s", current.policyLabel(policy.Name), describeGCPPolicySpec(policy.Spec)+gcpDryRunLabel(policy)))
+			continue
+		}
+		if change := describeGCPSpecChange(previous.Spec, policy.Spec, "no live spec"); change != "" {
+			changed = append(changed, fmt.Sprintf("%s: %s", current.policyLabel(policy.Name), change))
+		}
+		if change := describeGCPSpecChange(previous.DryRunSpec, policy.DryRunSpec, "no dry-run spec"); change != "" {
+			changed = append(changed, fmt.Sprintf("%s: dry run: %s", current.policyLabel(policy.Name), change))
+		}
+	}
+
+	for _, policy := range old.Policies {
+		if !after[policy.Name] {
+			removed = append(removed, fmt.Sprintf("%s: was %s", old.policyLabel(policy.Name), describeGCPPolicySpec(policy.Spec)+gcpDryRunLabel(policy)))
+		}
+	}
+	return set, removed, changed
+}
+
+// Describes how a spec changed, e.g. "deny all -> allowed values:
+// in:us-locations", nothing when its rules are the same. A missing spec is
+// described as none.
+func describeGCPSpecChange(old, current *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec, none string) string {
+	if gcpSpecRules(old) == gcpSpecRules(current) {
+		return ""
+	}
+	describe := func(spec *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec) string {
+		if spec == nil {
+			return none
+		}
+		return describeGCPPolicySpec(spec)
+	}
+	from, to := describe(old), describe(current)
+	if from == to {
+		// e.g. the expression of a condition
+		return "rules changed (" + to + ")"
+	}
+	return from + " -> " + to
+}
+
+// The rules of a spec as JSON, without its etag and update time.
+func gcpSpecRules(spec *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec) string {
+	if spec == nil {
+		return ""
+	}
+	rules := *spec
+	rules.Etag, rules.UpdateTime = "", ""
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Finds an organization, folder or project of the snapshot by resource name.
+func (s *gcpSnapshot) resource(name string) (*gcpResource, bool) {
+	resource, err := s.GetResource(context.Background(), name)
+	return resource, err == nil
+}
+
+// Describes a resource like the tree does, e.g. Sandbox [200000000005].
+func (s *gcpSnapshot) label(resource *gcpResource) string {
+	return fmt.Sprintf("%s [%s]", resource.DisplayName, newGCPNode(resource).ID)
+}
+
+// Describes an org policy by constraint and resource, e.g.
+// gcp.resourceLocations on /example.com/Sandbox.
+func (s *gcpSnapshot) policyLabel(name string) string {
+	resource, _, _ := strings.Cut(name, "/policies/")
+	return fmt.Sprintf("%s on %s", gcppolicy.ConstraintName(name), s.path(resource))
+}
+
+// Builds the path of a resource from the organization with display names, e.g.
+// /example.com/Workloads/Production.
+func (s *gcpSnapshot) path(name string) string {
+	var names []string
+	for name != "" {
+		resource, ok := s.resource(name)
+		if !ok {
+			names = append([]string{name}, names...)
+			break
+		}
+		names = append([]string{resource.DisplayName}, names...)
+		name = resource.Parent
+	}
+	return "/" + strings.Join(names, "/")
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// A GCP organization with a Workloads and a Sandbox folder, and a project in
+// the first one, changed by edit.
+func newTestGCPSnapshot(edit func(s *gcpSnapshot)) *gcpSnapshot {
+	snapshot := &gcpSnapshot{
+		Version:      gcpSnapshotVersion,
+		Organization: gcpResource{Name: "organizations/1", DisplayName: "example.com"},
+		Folders: []gcpResource{
+			{Name: "folders/2", DisplayName: "Workloads", Parent: "organizations/1"},
+			{Name: "folders/5", DisplayName: "Sandbox", Parent: "organizations/1"},
+		},
+		Projects: []gcpResource{
+			{Name: "projects/3", DisplayName: "payments", ProjectID: "payments-prod", Parent: "folders/2"},
+		},
+		Policies: []*orgpolicy.GoogleCloudOrgpolicyV2Policy{
+			{Name: "organizations/1/policies/compute.requireOsLogin", Spec: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{
+				Etag:  "a",
+				Rules: []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{Enforce: true}},
+			}},
+		},
+	}
+	if edit != nil {
+		edit(snapshot)
+	}
+	return snapshot
+}
+
+func TestCompareGCPSnapshots(t *testing.T) {
+	locations := &orgpolicy.GoogleCloudOrgpolicyV2Policy{Name: "folders/2/policies/gcp.resourceLocations", Spec: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{
+		Rules: []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{Values: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRuleStringValues{AllowedValues: []string{"in:eu-locations"}}}},
+	}}
+
+	tests := []struct {
+		name string
+		old  *gcpSnapshot
+		new  *gcpSnapshot
+		want map[string][]string // changes by section
+	}{
+		{
+			name: "no drift",
+			old:  newTestGCPSnapshot(nil),
+			new:  newTestGCPSnapshot(nil),
+			want: map[string][]string{},
+		},
+		{
+			name: "empty organization",
+			old:  &gcpSnapshot{Version: gcpSnapshotVersion, Organization: gcpResource{Name: "organizations/1", DisplayName: "example.com"}},
+			new:  &gcpSnapshot{Version: gcpSnapshotVersion, Organization: gcpResource{Name: "organizations/1", DisplayName: "example.com"}},
+			want: map[string][]string{},
+		},
+		{
+			name: "projects and folders",
+			old:  newTestGCPSnapshot(nil),
+			new: newTestGCPSnapshot(func(s *gcpSnapshot) {
+				s.Folders = append(s.Folders[:1], gcpResource{Name: "folders/6", DisplayName: "Archive", Parent: "folders/2"})
+				s.Projects[0].Parent = "folders/6"
+				s.Projects = append(s.Projects, gcpResource{Name: "projects/4", DisplayName: "ledger", ProjectID: "ledger-prod", Parent: "folders/2"})
+			}),
+			want: map[string][]string{
+				"Projects added":  {"ledger [ledger-prod] in /example.com/Workloads"},
+				"Projects moved":  {"payments [payments-prod]: /example.com/Workloads -> /example.com/Workloads/Archive"},
+				"Folders added":   {"Archive [6] in /example.com/Workloads"},
+				"Folders removed": {"Sandbox [5] in /example.com"},
+			},
+		},
+		{
+			name: "constraints",
+			old:  newTestGCPSnapshot(nil),
+			new: newTestGCPSnapshot(func(s *gcpSnapshot) {
+				s.Policies = []*orgpolicy.GoogleCloudOrgpolicyV2Policy{locations}
+			}),
+			want: map[string][]string{
+				"Constraints set":     {"gcp.resourceLocations on /example.com/Workloads: allowed values: in:eu-locations"},
+				"Constraints removed": {"compute.requireOsLogin on /example.com: was enforced"},
+			},
+		},
+		{
+			name: "spec changed",
+			old:  newTestGCPSnapshot(nil),
+			new: newTestGCPSnapshot(func(s *gcpSnapshot) {
+				s.Policies[0].Spec = &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{Etag: "b", Rules: []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{{Enforce: false}}}
+			}),
+			want: map[string][]string{
+				"Constraints changed": {"compute.requireOsLogin on /example.com: enforced -> not enforced"},
+			},
+		},
+		{
+			name: "only the etag changed",
+			old:  newTestGCPSnapshot(nil),
+			new: newTestGCPSnapshot(func(s *gcpSnapshot) {
+				s.Policies[0].Spec.Etag, s.Policies[0].Spec.UpdateTime = "b", "2024-05-01T00:00:00Z"
+			}),
+			want: map[string][]string{},
+		},
+		{
+			name: "dry run changed",
+			old:  newTestGCPSnapshot(nil),
+			new: newTestGCPSnapshot(func(s *gcpSnapshot) {
+				s.Policies[0].DryRunSpec = &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{Reset: true}
+			}),
+			want: map[string][]string{
+				"Constraints changed": {"compute.requireOsLogin on /example.com: dry run: no dry-run spec -> reset to the constraint default"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := compareGCPSnapshots(tt.old, tt.new, "old.json", "new.json")
+			got := map[string][]string{}
+			for _, section := range report.sections {
+				if len(section.changes) > 0 {
+					got[section.title] = section.changes
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("drift = %q, want %q", got, tt.want)
+			}
+			if report.organizationID != "1" {
+				t.Errorf("organizationID = %q, want 1", report.organizationID)
+			}
+		})
+	}
+}
+
+func TestGCPSnapshotDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, snapshot *gcpSnapshot) string {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	old := write("old.json", newTestGCPSnapshot(nil))
+	current := write("new.json", newTestGCPSnapshot(func(s *gcpSnapshot) { s.Projects = nil }))
+
+	got, err := runCommandWith(t, func(*dependencies) {}, "gcp", "snapshot", "diff", "--old", old, "--new", current)
+	if err != nil {
+		t.Fatalf("gcp snapshot diff: %v", err)
+	}
+	want := "Drift from " + old + " to " + current + ":\n|-- Projects removed:\n    |-- payments [payments-prod] in /example.com/Workloads\n1 changes\n"
+	if got != want {
+		t.Errorf("gcp snapshot diff wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
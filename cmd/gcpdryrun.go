@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/spf13/cobra"
+)
+
+// newGcpPoliciesDryRunCmd creates the gcp policies dry-run command.
+func newGcpPoliciesDryRunCmd(deps *dependencies) *cobra.Command {
+	format := textFormat // output format of the report
+	policiesDryRunCmd := &cobra.Command{
+		Use:   "dry-run",
+		Short: "Reports the org policies having a dry-run spec: the constraints only in dry run and the pending changes to live policies",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reportGCPDryRuns(cmd.Context(), deps, format)
+		},
+	}
+
+	policiesDryRunCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json", "csv", "yaml"`)
+
+	return policiesDryRunCmd
+}
+
+// reportGCPDryRuns lists the org policies of the organization having a
+// dry-run spec, which is evaluated and logged without being enforced: the
+// constraints only in dry run, not enforced at all yet, then the live policies
+// whose dry-run spec is the change being rolled out.
+func reportGCPDryRuns(ctx context.Context, deps *dependencies, outputFormat outputFormat) error {
+	if outputFormat == cypherFormat || outputFormat == dotFormat {
+		return fmt.Errorf(`the %q output format is not available for the dry-run report, valid output formats are: "text", "json", "csv", "yaml"`, outputFormat)
+	}
+
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	starts, _, err := getGCPStartingResources(ctx, &deps.options.gcp, client)
+	if err != nil {
+		return err
+	}
+
+	policies, err := collectGCPPolicies(ctx, client, starts)
+	if err != nil {
+		return err
+	}
+	var dryRunOnly, pending []listedGCPPolicy
+	for _, policy := range policies {
+		switch {
+		case policy.DryRunSpec == nil:
+		case !policy.live:
+			dryRunOnly = append(dryRunOnly, policy)
+		default:
+			pending = append(pending, policy)
+		}
+	}
+	dryRuns := append(append([]listedGCPPolicy{}, dryRunOnly...), pending...)
+
+	switch outputFormat {
+	case jsonFormat:
+		encoder := json.NewEncoder(deps.report)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(dryRuns)
+	case yamlFormat:
+		return orgtree.EncodeYAML(deps.report, dryRuns)
+	case csvFormat:
+		return writeGCPPoliciesCSV(deps.report, dryRuns)
+	}
+
+	if len(dryRuns) == 0 {
+		fmt.Fprintln(deps.report, "No org policy is in dry run in the organization")
+		return nil
+	}
+	fmt.Fprintln(deps.report, "Only in dry run (not enforced yet):")
+	printGCPDryRuns(deps.report, dryRunOnly, func(policy listedGCPPolicy) string { return policy.DryRun })
+	fmt.Fprintln(deps.report, "Dry-run changes to live policies:")
+	printGCPDryRuns(deps.report, pending, func(policy listedGCPPolicy) string {
+		return fmt.Sprintf("%s (live: %s)", policy.DryRun, policy.Enforcement)
+	})
+	fmt.Fprintf(deps.report, "%s only in dry run, %s with a dry-run change\n",
+		formatQuantity(len(dryRunOnly), "constraint", "constraints"), formatQuantity(len(pending), "live policy", "live policies"))
+	return nil
+}
+
+// Prints a line per policy, what is in dry run described by describe.
+func printGCPDryRuns(w io.Writer, policies []listedGCPPolicy, describe func(policy listedGCPPolicy) string) {
+	if len(policies) == 0 {
+		fmt.Fprintf(w, "%s(none)\n", indent)
+	}
+	for _, policy := range policies {
+		fmt.Fprintf(w, "%s|-- %s on %s [%s]: %s\n", indent, policy.Constraint, policy.ResourceName, policy.Resource, describe(policy))
+	}
+}
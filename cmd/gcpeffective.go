@@ -0,0 +1,159 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/gcppolicy"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// newGcpEffectiveCmd creates the gcp effective command.
+func newGcpEffectiveCmd(deps *dependencies) *cobra.Command {
+	var project string // project whose effective org policies are computed
+	effectiveCmd := &cobra.Command{
+		Use:   "effective",
+		Short: "Computes the org policies in force on a project, resolving the policies set along its ancestry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayGCPEffectivePolicies(cmd.Context(), deps, project)
+		},
+	}
+
+	effectiveCmd.Flags().StringVar(&project, "project", "", "ID or number of the GCP project that will be analyzed")
+	effectiveCmd.MarkFlagRequired("project") //nolint:gosec,errcheck
+
+	return effectiveCmd
+}
+
+// displayGCPEffectivePolicies reports the org policies set on the organization,
+// folders and project of the ancestry of a project, what each constraint
+// resolves to on the project once inheritFromParent and reset are applied, and
+// the permissions denied by the IAM deny policies of the ancestry.
+func displayGCPEffectivePolicies(ctx context.Context, deps *dependencies, project string) error {
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	chain, err := getGCPPolicyChain(ctx, client, gcpProjectPrefix+strings.TrimPrefix(project, gcpProjectPrefix))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(deps.report, "Inheritance chain:")
+	prefix := ""
+	for _, level := range chain {
+		constraints := make([]string, 0, len(level.Policies))
+		for _, policy := range level.Policies {
+			constraints = append(constraints, gcppolicy.ConstraintName(policy.Name)+gcpDryRunLabel(policy))
+		}
+		line := fmt.Sprintf("%s|-- %s [%s] (Org policies: %s)", prefix, level.DisplayName, level.ResourceName, strings.Join(constraints, ", "))
+		if len(level.DenyPolicies) > 0 {
+			names := make([]string, 0, len(level.DenyPolicies))
+			for _, policy := range level.DenyPolicies {
+				names = append(names, gcppolicy.DenyPolicyName(policy))
+			}
+			line += fmt.Sprintf(" (Deny policies: %s)", strings.Join(names, ", "))
+		}
+		fmt.Fprintln(deps.report, line)
+		prefix += indent
+	}
+
+	// What the custom constraints check is defined in the organization
+	customConstraints, err := client.ListCustomConstraints(ctx, chain[0].ResourceName)
+	if err != nil {
+		return err
+	}
+	definitions := map[string]*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint{}
+	for _, constraint := range customConstraints {
+		definitions[gcppolicy.CustomConstraintName(constraint.Name)] = constraint
+	}
+
+	fmt.Fprintln(deps.report, "Effective org policies:")
+	effective := gcppolicy.Resolve(chain)
+	if len(effective) == 0 {
+		fmt.Fprintf(deps.report, "%s(none, every constraint has its default behavior)\n", indent)
+	}
+	for _, policy := range effective {
+		fmt.Fprintf(deps.report, "%s%s: %s (%s)\n", indent, policy.Constraint, describeEffectiveRules(policy), formatGCPPolicySources(policy))
+		if !gcppolicy.IsCustom(policy.Constraint) {
+			continue
+		}
+		if definition, found := definitions[policy.Constraint]; found {
+			fmt.Fprintf(deps.report, "%s%sCustom constraint: %s\n", indent, indent, gcppolicy.DescribeCustomConstraint(definition))
+		} else {
+			fmt.Fprintf(deps.report, "%s%sCustom constraint: not defined in %s\n", indent, indent, chain[0].ResourceName)
+		}
+	}
+
+	// Every deny policy of the chain applies, whatever the IAM allow policies grant
+	fmt.Fprintln(deps.report, "Denied permissions (IAM deny policies):")
+	denies := gcppolicy.Denies(chain)
+	if len(denies) == 0 {
+		fmt.Fprintf(deps.report, "%s(none)\n", indent)
+	}
+	for _, deny := range denies {
+		fmt.Fprintf(deps.report, "%s%s (%s on %s)\n", indent, gcppolicy.DescribeDenyRule(deny.Rule), deny.Policy, deny.Resource)
+	}
+	return nil
+}
+
+// Builds the chain of a resource, from its organization down to the resource,
+// with the org policies set on every level sorted by constraint and the deny
+// policies attached to it sorted by name.
+func getGCPPolicyChain(ctx context.Context, client gcpAPI, name string) ([]gcppolicy.Level, error) {
+	var chain []gcppolicy.Level
+	for name != "" {
+		resource, err := client.GetResource(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		policies, err := client.ListPolicies(ctx, resource.Name)
+		if err != nil {
+			return nil, err
+		}
+		sortGCPPolicies(policies)
+		denyPolicies, err := client.ListDenyPolicies(ctx, resource.Name)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(denyPolicies, func(i, j int) bool {
+			return gcppolicy.DenyPolicyName(denyPolicies[i]) < gcppolicy.DenyPolicyName(denyPolicies[j])
+		})
+		chain = append([]gcppolicy.Level{{ResourceName: resource.Name, DisplayName: resource.DisplayName, Policies: policies, DenyPolicies: denyPolicies}}, chain...)
+		name = resource.Parent
+	}
+	return chain, nil
+}
+
+func describeEffectiveRules(policy gcppolicy.Effective) string {
+	if policy.Reset {
+		return "constraint default"
+	}
+	return gcppolicy.Describe(policy.Rules)
+}
+
+// Formats where the effective policy of a constraint comes from, e.g. "set on
+// folders/123" or "merged from organizations/1, folders/123".
+func formatGCPPolicySources(policy gcppolicy.Effective) string {
+	parents := make([]string, 0, len(policy.Sources))
+	for _, source := range policy.Sources {
+		parents = append(parents, gcppolicy.Parent(source))
+	}
+	switch {
+	case policy.Reset:
+		return "reset on " + parents[0]
+	case len(parents) == 1:
+		return "set on " + parents[0]
+	default:
+		return "merged from " + strings.Join(parents, ", ")
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+)
+
+// State of the projects that are not pending deletion.
+const gcpActiveState = "ACTIVE"
+
+// Makes sure every tag of --filter-tag and every label of --filter-label is
+// valid before the scan starts.
+func validateGCPFilters(gcp *gcpOptions) error {
+	for _, tag := range gcp.filterTags {
+		if key, _, ok := strings.Cut(tag, "="); !ok || key == "" {
+			return fmt.Errorf("invalid filter tag %q: it must look like key=value", tag)
+		}
+	}
+	for _, label := range gcp.filterLabels {
+		if key, _, ok := strings.Cut(label, "="); !ok || key == "" {
+			return fmt.Errorf("invalid filter label %q: it must look like key=value", label)
+		}
+	}
+	return nil
+}
+
+// Decides whether a project is kept according to --only-active and
+// --filter-label, which only need what listing the projects returns, so the
+// other projects are left out before their policies and tags are read.
+func isGCPProjectInScope(gcp *gcpOptions, project *gcpResource) bool {
+	if gcp.onlyActive && project.State != gcpActiveState {
+		return false
+	}
+	for _, filter := range gcp.filterLabels {
+		key, value, _ := strings.Cut(filter, "=")
+		if current, ok := project.Labels[key]; !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether a node carries every tag of --filter-tag. Keys can be given
+// namespaced (123456789012/env=prod) or by short name (env=prod).
+func matchesGCPFilterTags(gcp *gcpOptions, node *orgtree.Node) bool {
+	for _, filter := range gcp.filterTags {
+		key, value, _ := strings.Cut(filter, "=")
+		found := false
+		for namespacedKey, tag := range node.Tags {
+			if (namespacedKey == key || strings.HasSuffix(namespacedKey, "/"+key)) && tag.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Drops the projects not matching --filter-tag from the subtree of a node,
+// along with the folders left without any project. Reports whether something
+// is left below the node.
+func filterGCPProjects(gcp *gcpOptions, node *orgtree.Node) bool {
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if child.Type == orgtree.ProjectNode && matchesGCPFilterTags(gcp, child) ||
+			child.Type != orgtree.ProjectNode && filterGCPProjects(gcp, child) {
+			kept = append(kept, child)
+		}
+	}
+	node.Children = kept
+	return len(kept) > 0
+}
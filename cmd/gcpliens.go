@@ -0,0 +1,56 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+)
+
+// Sets the liens placed on a project on its node, sorted by reason. Liens
+// prevent the deletion of the project (or the other operations of their
+// restrictions) until they are removed, e.g. the one of a Shared VPC host
+// project.
+func addGCPLiens(ctx context.Context, client gcpAPI, node *orgtree.Node, project string) error {
+	liens, err := client.ListLiens(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	for _, lien := range liens {
+		node.Liens = append(node.Liens, orgtree.Lien{
+			Reason:       lien.Reason,
+			Origin:       lien.Origin,
+			Restrictions: lien.Restrictions,
+			CreateTime:   lien.CreateTime,
+		})
+	}
+	sort.Slice(node.Liens, func(i, j int) bool { return node.Liens[i].Reason < node.Liens[j].Reason })
+	return nil
+}
+
+// Describes the liens of a project, one item each, for the text output.
+func lienItems(node *orgtree.Node) []textItem {
+	items := make([]textItem, 0, len(node.Liens))
+	for _, lien := range node.Liens {
+		items = append(items, textItem{text: fmt.Sprintf("Lien: %s (placed by %s, restricts %s)", lien.Reason, lien.Origin, strings.Join(lien.Restrictions, ", "))})
+	}
+	return items
+}
+
+// Formats the liens of a project for the csv output, their reasons separated
+// by semicolons.
+func formatGCPLiens(node *orgtree.Node) string {
+	reasons := make([]string, 0, len(node.Liens))
+	for _, lien := range node.Liens {
+		reasons = append(reasons, lien.Reason)
+	}
+	return strings.Join(reasons, ";")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ariguillegp/policy-scout/internal/gcppolicy"
+	"github.com/spf13/cobra"
+)
+
+// newGcpPoliciesLintCmd creates the gcp policies lint command.
+func newGcpPoliciesLintCmd(deps *dependencies) *cobra.Command {
+	policiesLintCmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Tells the boolean constraints from the list ones in every org policy and flags the list rules with empty or all-encompassing values",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lintGCPPolicies(cmd.Context(), deps)
+		},
+	}
+
+	return policiesLintCmd
+}
+
+// lintGCPPolicies walks the organizations (or the folder of --folder-id) down
+// to their projects and runs every lint check on the org policies set on every
+// resource, reporting the kind of each constraint along with its findings.
+func lintGCPPolicies(ctx context.Context, deps *dependencies) error {
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	starts, _, err := getGCPStartingResources(ctx, &deps.options.gcp, client)
+	if err != nil {
+		return err
+	}
+
+	total, flagged, policies := 0, 0, 0
+	kinds := map[string]int{}
+	lint := func(resource *gcpResource) error {
+		set, err := client.ListPolicies(ctx, resource.Name)
+		if err != nil {
+			return err
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		sortGCPPolicies(set)
+
+		fmt.Fprintf(deps.report, "|-- %s [%s]\n", resource.DisplayName, resource.Name)
+		for _, policy := range set {
+			policies++
+			kind := gcppolicy.Kind(policy)
+			kinds[kind]++
+			if kind != "" {
+				kind = " (" + kind + ")"
+			}
+			fmt.Fprintf(deps.report, "%s|-- %s%s%s: %s\n", indent, gcppolicy.ConstraintName(policy.Name), gcpDryRunLabel(policy), kind, describeGCPPolicySpec(policy.Spec))
+
+			var findings []gcppolicy.Finding
+			for _, check := range gcppolicy.Checks {
+				stop := deps.profile.time(checkPhase, "gcp/"+check.Name)
+				findings = append(findings, check.Run(policy)...)
+				stop()
+			}
+			if len(findings) > 0 {
+				flagged++
+				total += len(findings)
+			}
+			for _, finding := range findings {
+				fmt.Fprintf(deps.report, "%s%s|-- %s %s: %s\n", indent, indent, finding.Severity, finding.Check, finding.Message)
+			}
+		}
+		return nil
+	}
+	for _, start := range starts {
+		if err := walkGCPHierarchy(ctx, client, start, lint); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(deps.report, "%s findings in %s of %s org policies (%s boolean, %s list constraints)\n",
+		formatCount(total), formatCount(flagged), formatCount(policies), formatCount(kinds[gcppolicy.BooleanConstraint]), formatCount(kinds[gcppolicy.ListConstraint]))
+	return nil
+}
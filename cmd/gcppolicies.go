@@ -0,0 +1,296 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/gcppolicy"
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// newGcpPoliciesCmd creates the group of commands that work on every org
+// policy of the organization.
+func newGcpPoliciesCmd(deps *dependencies) *cobra.Command {
+	policiesCmd := &cobra.Command{
+		Use:   "policies",
+		Short: "Inspect every org policy of the organization at once",
+	}
+
+	policiesCmd.PersistentFlags().StringVar(&deps.options.gcp.folderID, "folder-id", "", "ID of the folder used as the starting point of the analysis, e.g. 123456789012 (defaults to the organization)")
+
+	policiesCmd.AddCommand(newGcpPoliciesDryRunCmd(deps))
+	policiesCmd.AddCommand(newGcpPoliciesLintCmd(deps))
+	policiesCmd.AddCommand(newGcpPoliciesListCmd(deps))
+
+	return policiesCmd
+}
+
+// newGcpPoliciesListCmd creates the gcp policies list command.
+func newGcpPoliciesListCmd(deps *dependencies) *cobra.Command {
+	format := textFormat // output format of the list
+	policiesListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists every constraint configured anywhere in the hierarchy, with the resources it is set on and their rules",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listAllGCPPolicies(cmd.Context(), deps, format)
+		},
+	}
+
+	policiesListCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json", "dot", "csv", "yaml"`)
+
+	return policiesListCmd
+}
+
+// An org policy of the organization, folder or project it is set on.
+type listedGCPPolicy struct {
+	Constraint   string                                                  `json:"constraint"`
+	Name         string                                                  `json:"name"`         // resource name of the policy
+	Resource     string                                                  `json:"resource"`     // e.g. folders/123
+	ResourceName string                                                  `json:"resourceName"` // display name of the resource
+	ResourceType string                                                  `json:"resourceType"` // organization, folder or project
+	Custom       bool                                                    `json:"custom,omitempty"`
+	Enforcement  string                                                  `json:"enforcement"` // summary of the rules
+	Inherit      bool                                                    `json:"inheritFromParent,omitempty"`
+	Reset        bool                                                    `json:"reset,omitempty"`
+	Rules        []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule `json:"rules,omitempty"`
+	DryRun       string                                                  `json:"dryRun,omitempty"` // summary of the dry-run spec, logged without being enforced
+	DryRunSpec   *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec             `json:"dryRunSpec,omitempty"`
+	live         bool                                                    // whether the policy has a live spec
+}
+
+// listAllGCPPolicies walks the organizations (or the folder of --folder-id)
+// down to their projects and lists the org policies set on every resource,
+// grouped by constraint.
+func listAllGCPPolicies(ctx context.Context, deps *dependencies, outputFormat outputFormat) error {
+	if outputFormat == cypherFormat {
+		return errors.New(`the "cypher" output format is only available for trees, use "gcp tree -o cypher" to load the org policies into Neo4j`)
+	}
+
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	starts, _, err := getGCPStartingResources(ctx, &deps.options.gcp, client)
+	if err != nil {
+		return err
+	}
+
+	policies, err := collectGCPPolicies(ctx, client, starts)
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case jsonFormat:
+		encoder := json.NewEncoder(deps.report)
+		encoder.SetIndent("", "  ")
+		if policies == nil {
+			policies = []listedGCPPolicy{}
+		}
+		return encoder.Encode(policies)
+	case yamlFormat:
+		if policies == nil {
+			policies = []listedGCPPolicy{}
+		}
+		return orgtree.EncodeYAML(deps.report, policies)
+	case dotFormat:
+		return writeGCPPoliciesDot(deps.report, policies)
+	case csvFormat:
+		return writeGCPPoliciesCSV(deps.report, policies)
+	default:
+		printGCPPolicyList(deps.report, policies)
+		return nil
+	}
+}
+
+// Lists the org policies set on organizations (or a folder) and every folder
+// and project below them, grouped by constraint, in the order of the hierarchy.
+func collectGCPPolicies(ctx context.Context, client gcpAPI, starts []*gcpResource) ([]listedGCPPolicy, error) {
+	var policies []listedGCPPolicy
+	collect := func(resource *gcpResource) error {
+		set, err := client.ListPolicies(ctx, resource.Name)
+		if err != nil {
+			return err
+		}
+		for _, policy := range set {
+			listed := listedGCPPolicy{
+				Constraint:   gcppolicy.ConstraintName(policy.Name),
+				Name:         policy.Name,
+				Resource:     resource.Name,
+				ResourceName: resource.DisplayName,
+				ResourceType: gcpResourceType(resource.Name),
+				Enforcement:  describeGCPPolicySpec(policy.Spec),
+			}
+			listed.Custom = gcppolicy.IsCustom(listed.Constraint)
+			if policy.DryRunSpec != nil {
+				listed.DryRun, listed.DryRunSpec = describeGCPPolicySpec(policy.DryRunSpec), policy.DryRunSpec
+			}
+			if policy.Spec != nil {
+				listed.live = true
+				listed.Inherit, listed.Reset, listed.Rules = policy.Spec.InheritFromParent, policy.Spec.Reset, policy.Spec.Rules
+			}
+			policies = append(policies, listed)
+		}
+		return nil
+	}
+	for _, start := range starts {
+		if err := walkGCPHierarchy(ctx, client, start, collect); err != nil {
+			return nil, err
+		}
+	}
+	// Grouped by constraint, in the order of the hierarchy
+	sort.SliceStable(policies, func(i, j int) bool { return policies[i].Constraint < policies[j].Constraint })
+
+	return policies, nil
+}
+
+// Calls fn for a resource and every folder and project below it, parents
+// before their children.
+func walkGCPHierarchy(ctx context.Context, client gcpAPI, resource *gcpResource, fn func(resource *gcpResource) error) error {
+	if err := fn(resource); err != nil {
+		return err
+	}
+
+	projects, err := client.ListProjects(ctx, resource.Name)
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if err := fn(project); err != nil {
+			return err
+		}
+	}
+
+	folders, err := client.ListFolders(ctx, resource.Name)
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		if err := walkGCPHierarchy(ctx, client, folder, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The kind of node of a resource, e.g. folder for folders/123.
+func gcpResourceType(name string) string {
+	switch {
+	case strings.HasPrefix(name, gcpOrganizationPrefix):
+		return orgtree.OrganizationNode
+	case strings.HasPrefix(name, gcpFolderPrefix):
+		return orgtree.FolderNode
+	default:
+		return orgtree.ProjectNode
+	}
+}
+
+// Summarizes what a policy spec enforces, e.g. "deny all" or "reset to the
+// constraint default".
+func describeGCPPolicySpec(spec *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec) string {
+	switch {
+	case spec == nil:
+		return "no live spec"
+	case spec.Reset:
+		return "reset to the constraint default"
+	case spec.InheritFromParent:
+		return gcppolicy.Describe(spec.Rules) + ", merged with the policy of the parent"
+	default:
+		return gcppolicy.Describe(spec.Rules)
+	}
+}
+
+// Prints the policies grouped by constraint.
+func printGCPPolicyList(w io.Writer, policies []listedGCPPolicy) {
+	if len(policies) == 0 {
+		fmt.Fprintln(w, "No org policy is set in the organization")
+		return
+	}
+
+	var currentConstraint string
+	for _, policy := range policies {
+		if policy.Constraint != currentConstraint {
+			currentConstraint = policy.Constraint
+			custom := ""
+			if policy.Custom {
+				custom = " (custom)"
+			}
+			fmt.Fprintf(w, "|-- %s%s\n", currentConstraint, custom)
+		}
+		label := strings.ToUpper(policy.ResourceType[:1]) + policy.ResourceType[1:]
+		dryRun := ""
+		if policy.DryRun != "" {
+			dryRun = fmt.Sprintf(" (dry run: %s)", policy.DryRun)
+		}
+		fmt.Fprintf(w, "%s|-- %s: %s [%s]: %s%s\n", indent, label, policy.ResourceName, policy.Resource, policy.Enforcement, dryRun)
+	}
+}
+
+// Writes a row per policy, the rules summarized like in the text output.
+func writeGCPPoliciesCSV(w io.Writer, policies []listedGCPPolicy) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"constraint", "resource", "resource_name", "resource_type", "custom", "inherit_from_parent", "reset", "enforcement", "dry_run"}); err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		row := []string{
+			policy.Constraint,
+			policy.Resource,
+			policy.ResourceName,
+			policy.ResourceType,
+			strconv.FormatBool(policy.Custom),
+			strconv.FormatBool(policy.Inherit),
+			strconv.FormatBool(policy.Reset),
+			policy.Enforcement,
+			policy.DryRun,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes a graphviz graph linking every constraint with the resources it is
+// set on, the edges labeled with the rules.
+func writeGCPPoliciesDot(w io.Writer, policies []listedGCPPolicy) error {
+	var b strings.Builder
+	b.WriteString("digraph policies {\n  rankdir=LR;\n")
+
+	resources := map[string]listedGCPPolicy{}
+	var currentConstraint string
+	for _, policy := range policies {
+		if policy.Constraint != currentConstraint {
+			currentConstraint = policy.Constraint
+			fmt.Fprintf(&b, "  %q [shape=note, label=%q];\n", policy.Constraint, policy.Constraint)
+		}
+		resources[policy.Resource] = policy
+		label := policy.Enforcement
+		if policy.DryRun != "" {
+			label += "\ndry run: " + policy.DryRun
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", policy.Constraint, policy.Resource, label)
+	}
+	for _, name := range sortedKeys(resources) {
+		fmt.Fprintf(&b, "  %q [shape=box, label=%q];\n", name, fmt.Sprintf("%s\n%s", resources[name].ResourceName, name))
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
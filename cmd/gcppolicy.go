@@ -0,0 +1,175 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ariguillegp/policy-scout/internal/gcppolicy"
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Keys of the org policies of GCP, of the custom constraints of the
+// organization and of the IAM deny policies in the policies of the nodes of
+// the tree.
+const (
+	gcpOrgPolicyType        = "ORG_POLICY"
+	gcpCustomConstraintType = "CUSTOM_CONSTRAINT"
+	gcpDenyPolicyType       = "IAM_DENY_POLICY"
+)
+
+// Adds the org policies set on a resource and the deny policies attached to it
+// to its node.
+func addGCPPolicies(ctx context.Context, client gcpAPI, node *orgtree.Node, resourceName string) error {
+	if err := addGCPOrgPolicies(ctx, client, node, resourceName); err != nil {
+		return err
+	}
+	return addGCPDenyPolicies(ctx, client, node, resourceName)
+}
+
+// Lists the org policies set on a resource as policies of its node, sorted by
+// constraint: their constraint as name (e.g. compute.vmExternalIpAccess) and
+// the policy as document.
+func addGCPOrgPolicies(ctx context.Context, client gcpAPI, node *orgtree.Node, resourceName string) error {
+	policies, err := client.ListPolicies(ctx, resourceName)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	applied := make([]orgtree.Policy, 0, len(policies))
+	for _, policy := range policies {
+		document, err := json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", policy.Name, err)
+		}
+		applied = append(applied, orgtree.Policy{ID: policy.Name, Name: gcppolicy.ConstraintName(policy.Name), Document: document})
+	}
+	// Listed in a stable order, whatever the order of the API
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Name < applied[j].Name })
+	if node.Policies == nil {
+		node.Policies = map[string][]orgtree.Policy{}
+	}
+	node.Policies[gcpOrgPolicyType] = applied
+	return nil
+}
+
+// Lists the IAM deny policies attached to a resource as policies of its node,
+// sorted by name: their display name (their ID if they have none) as name and
+// the policy as document.
+func addGCPDenyPolicies(ctx context.Context, client gcpAPI, node *orgtree.Node, resourceName string) error {
+	policies, err := client.ListDenyPolicies(ctx, resourceName)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	attached := make([]orgtree.Policy, 0, len(policies))
+	for _, policy := range policies {
+		document, err := json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("deny policy %s: %w", policy.Name, err)
+		}
+		attached = append(attached, orgtree.Policy{ID: policy.Name, Name: gcppolicy.DenyPolicyName(policy), Document: document})
+	}
+	sort.Slice(attached, func(i, j int) bool { return attached[i].Name < attached[j].Name })
+	if node.Policies == nil {
+		node.Policies = map[string][]orgtree.Policy{}
+	}
+	node.Policies[gcpDenyPolicyType] = attached
+	return nil
+}
+
+// Lists the custom constraints defined in an organization as policies of its
+// node, sorted by name: their name (e.g. custom.denyPublicBuckets) as name and
+// the constraint as document.
+func addGCPCustomConstraints(ctx context.Context, client gcpAPI, node *orgtree.Node, organization string) error {
+	constraints, err := client.ListCustomConstraints(ctx, organization)
+	if err != nil {
+		return err
+	}
+	if len(constraints) == 0 {
+		return nil
+	}
+
+	defined := make([]orgtree.Policy, 0, len(constraints))
+	for _, constraint := range constraints {
+		document, err := json.Marshal(constraint)
+		if err != nil {
+			return fmt.Errorf("custom constraint %s: %w", constraint.Name, err)
+		}
+		defined = append(defined, orgtree.Policy{ID: constraint.Name, Name: gcppolicy.CustomConstraintName(constraint.Name), Document: document})
+	}
+	sort.Slice(defined, func(i, j int) bool { return defined[i].Name < defined[j].Name })
+	if node.Policies == nil {
+		node.Policies = map[string][]orgtree.Policy{}
+	}
+	node.Policies[gcpCustomConstraintType] = defined
+	return nil
+}
+
+// Describes the custom constraints defined in an organization, one item each,
+// for the text output.
+func customConstraintItems(node *orgtree.Node) ([]textItem, error) {
+	var items []textItem
+	for _, policy := range node.Policies[gcpCustomConstraintType] {
+		constraint := &orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint{}
+		if err := json.Unmarshal(policy.Document, constraint); err != nil {
+			return nil, fmt.Errorf("custom constraint %s: %w", policy.ID, err)
+		}
+		items = append(items, textItem{text: fmt.Sprintf("Custom constraint: %s (%s): %s", policy.Name, constraint.DisplayName, gcppolicy.DescribeCustomConstraint(constraint))})
+	}
+	return items, nil
+}
+
+// Formats the org policies set on a node and the deny policies attached to it
+// for the text output, nothing when there are none.
+func (r textRenderer) formatGCPPolicies(node *orgtree.Node) string {
+	text := ""
+	if policies := node.Policies[gcpOrgPolicyType]; len(policies) > 0 {
+		labeled := make([]orgtree.Policy, 0, len(policies))
+		for _, policy := range policies {
+			document := &orgpolicy.GoogleCloudOrgpolicyV2Policy{}
+			if err := json.Unmarshal(policy.Document, document); err == nil {
+				policy.Name += gcpDryRunLabel(document)
+			}
+			labeled = append(labeled, policy)
+		}
+		text += fmt.Sprintf(" (Org policies: %s)", r.formatPolicyList(labeled))
+	}
+	if policies := node.Policies[gcpDenyPolicyType]; len(policies) > 0 {
+		text += fmt.Sprintf(" (Deny policies: %s)", r.formatPolicyList(policies))
+	}
+	return text
+}
+
+// Flags the org policies having a dry-run spec for the text outputs: " (dry run)"
+// when they have nothing else, " (+dry run)" next to their live spec.
+func gcpDryRunLabel(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) string {
+	switch {
+	case policy.DryRunSpec == nil:
+		return ""
+	case policy.Spec == nil:
+		return " (dry run)"
+	default:
+		return " (+dry run)"
+	}
+}
+
+// Sorts policies by constraint, for a stable order whatever the order of the API.
+func sortGCPPolicies(policies []*orgpolicy.GoogleCloudOrgpolicyV2Policy) {
+	sort.Slice(policies, func(i, j int) bool {
+		return gcppolicy.ConstraintName(policies[i].Name) < gcppolicy.ConstraintName(policies[j].Name)
+	})
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/gcppolicy"
+	"github.com/spf13/cobra"
+)
+
+// gcpSimulateOptions are the flags of the gcp simulate command.
+type gcpSimulateOptions struct {
+	project    string // project where the change or action is simulated
+	constraint string // constraint the change is checked against, e.g. gcp.resourceLocations
+	value      string // value the change uses, for list constraints
+	permission string // permission of the simulated action, e.g. storage.buckets.delete
+	principal  string // email of the principal performing the action
+}
+
+// newGcpSimulateCmd creates the gcp simulate command.
+func newGcpSimulateCmd(deps *dependencies) *cobra.Command {
+	options := &gcpSimulateOptions{}
+	simulateCmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Decides whether the org policies or the deny policies of a project would block a change or an action",
+		Long: `Decides whether the org policies or the deny policies of a project would block a change or an action.
+
+With --constraint, the change is checked against the effective org policy of
+the constraint on the project, e.g. whether a resource can be created in
+us-west1 under gcp.resourceLocations (--value us-west1), or whether a boolean
+constraint like iam.disableServiceAccountKeyCreation is enforced.
+
+With --permission and --principal, the action is checked against the IAM deny
+policies of the ancestry of the project and, out of the demo, the Policy
+Troubleshooter reports whether the IAM allow policies grant it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.constraint != "" {
+				return simulateGCPConstraint(cmd.Context(), deps, options.project, options.constraint, options.value)
+			}
+			return simulateGCPPermission(cmd.Context(), deps, options.project, options.permission, options.principal)
+		},
+	}
+
+	simulateCmd.Flags().StringVar(&options.project, "project", "", "ID or number of the GCP project where the change or action is simulated")
+	simulateCmd.MarkFlagRequired("project") //nolint:gosec,errcheck
+
+	simulateCmd.Flags().StringVar(&options.constraint, "constraint", "", "constraint the change is checked against, e.g. gcp.resourceLocations")
+	simulateCmd.Flags().StringVar(&options.value, "value", "", "value used by the change for list constraints, e.g. us-west1 for gcp.resourceLocations")
+	simulateCmd.Flags().StringVar(&options.permission, "permission", "", "permission of the simulated action, e.g. storage.buckets.delete")
+	simulateCmd.Flags().StringVar(&options.principal, "principal", "", "email of the user or service account performing the action")
+	simulateCmd.MarkFlagsOneRequired("constraint", "permission")
+	simulateCmd.MarkFlagsMutuallyExclusive("constraint", "permission")
+	simulateCmd.MarkFlagsRequiredTogether("permission", "principal")
+
+	return simulateCmd
+}
+
+// Evaluates a change against the effective org policy of a constraint on the
+// project and explains the decision.
+func simulateGCPConstraint(ctx context.Context, deps *dependencies, project, constraint, value string) error {
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	chain, err := getGCPPolicyChain(ctx, client, gcpProjectPrefix+strings.TrimPrefix(project, gcpProjectPrefix))
+	if err != nil {
+		return err
+	}
+
+	var policy *gcppolicy.Effective
+	for _, effective := range gcppolicy.Resolve(chain) {
+		if effective.Constraint == constraint {
+			policy = &effective
+			break
+		}
+	}
+	decision := gcppolicy.EvaluateConstraint(policy, value)
+
+	subject := constraint
+	if value != "" {
+		subject += " = " + value
+	}
+	target := chain[len(chain)-1]
+	fmt.Fprintf(deps.report, "%s on project %s [%s]: %s\n", subject, target.DisplayName, target.ResourceName, decision.Verdict)
+	if policy != nil {
+		fmt.Fprintf(deps.report, "%s|-- Effective policy: %s (%s)\n", indent, describeEffectiveRules(*policy), formatGCPPolicySources(*policy))
+	}
+	for _, reason := range decision.Reasons {
+		fmt.Fprintf(deps.report, "%s|-- %s\n", indent, reason)
+	}
+	return nil
+}
+
+// Evaluates an action against the deny policies of the ancestry of the
+// project, and the allow policies with the Policy Troubleshooter, and explains
+// the decision.
+func simulateGCPPermission(ctx context.Context, deps *dependencies, project, permission, principal string) error {
+	if strings.Count(permission, ".") < 2 {
+		return fmt.Errorf("invalid permission %q: it must look like service.resource.verb", permission)
+	}
+
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	chain, err := getGCPPolicyChain(ctx, client, gcpProjectPrefix+strings.TrimPrefix(project, gcpProjectPrefix))
+	if err != nil {
+		return err
+	}
+	target := chain[len(chain)-1]
+
+	decision := gcppolicy.EvaluateDenies(gcppolicy.Denies(chain), permission, principal)
+	access, err := client.TroubleshootIAM(ctx, principal, target.ResourceName, permission)
+	if err != nil {
+		return err
+	}
+	// Whatever the deny policies say, nothing is allowed unless granted
+	verdict := decision.Verdict
+	if access == "NOT_GRANTED" && verdict != gcppolicy.Denied {
+		verdict = gcppolicy.Denied
+	}
+
+	fmt.Fprintf(deps.report, "%s for %s on project %s [%s]: %s\n", permission, principal, target.DisplayName, target.ResourceName, verdict)
+	for _, reason := range decision.Reasons {
+		fmt.Fprintf(deps.report, "%s|-- Deny policies: %s\n", indent, reason)
+	}
+	if access == "" {
+		fmt.Fprintf(deps.report, "%s|-- Allow policies: not checked, the Policy Troubleshooter is not available offline\n", indent)
+	} else {
+		fmt.Fprintf(deps.report, "%s|-- Allow policies: %s (Policy Troubleshooter)\n", indent, access)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/iam/v2"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Version of the format of the GCP snapshots.
+const gcpSnapshotVersion = 1
+
+// gcpSnapshot is a GCP organization held in memory, answering the calls of the
+// gcp commands like the live APIs do.
+type gcpSnapshot struct {
+	Version      int           `json:"version"`
+	Organization gcpResource   `json:"organization"`
+	Folders      []gcpResource `json:"folders"`
+	Projects     []gcpResource `json:"projects"`
+	// Org policies of every resource, e.g. folders/123/policies/gcp.resourceLocations
+	Policies []*orgpolicy.GoogleCloudOrgpolicyV2Policy `json:"policies,omitempty"`
+	// Custom constraints defined in the organization
+	CustomConstraints []*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint `json:"customConstraints,omitempty"`
+	// IAM deny policies of every resource, named after their attachment point
+	DenyPolicies []*iam.GoogleIamV2Policy `json:"denyPolicies,omitempty"`
+	// Tags bound to every resource, by resource name, the inherited ones being
+	// resolved from them
+	Tags map[string][]*cloudresourcemanager.EffectiveTag `json:"tags,omitempty"`
+	// Liens placed on the projects
+	Liens []*cloudresourcemanager.Lien `json:"liens,omitempty"`
+}
+
+// newGcpSnapshotCmd creates the gcp snapshot command.
+func newGcpSnapshotCmd(deps *dependencies) *cobra.Command {
+	var out string // where the snapshot is written
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Captures the folders, projects and policies of the organization, to be compared later with gcp snapshot diff",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return writeGCPSnapshot(cmd.Context(), deps, out)
+		},
+	}
+
+	snapshotCmd.Flags().StringVar(&out, "out", "", "where the snapshot is written, any --report-to destination")
+	snapshotCmd.MarkFlagRequired("out") //nolint:gosec,errcheck
+
+	snapshotCmd.AddCommand(newGcpSnapshotDiffCmd(deps))
+
+	return snapshotCmd
+}
+
+// writeGCPSnapshot captures the organization and writes it to out.
+func writeGCPSnapshot(ctx context.Context, deps *dependencies, out string) error {
+	client, err := deps.gcpClient(ctx)
+	if err != nil {
+		return err
+	}
+	organizations, err := gcpOrganizations(ctx, &deps.options.gcp, client)
+	if err != nil {
+		return err
+	}
+	if len(organizations) > 1 {
+		return errors.New("a GCP snapshot holds a single organization, pass one --organization")
+	}
+
+	snapshot, err := captureGCPSnapshot(ctx, client, organizations[0])
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	destination, err := openSink(out, deps)
+	if err != nil {
+		return err
+	}
+	if _, err := destination.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := destination.Close(ctx); err != nil {
+		return fmt.Errorf("couldn't write GCP snapshot to %s: %w", out, err)
+	}
+
+	fmt.Fprintf(deps.stderr, "Snapshot of %s saved to %s: %s folders, %s projects, %s org policies\n", snapshot.Organization.Name, out, formatCount(len(snapshot.Folders)), formatCount(len(snapshot.Projects)), formatCount(len(snapshot.Policies)))
+	return nil
+}
+
+// Captures an organization with every folder and project below it, the org
+// policies, deny policies and tags bound to each of them, the liens of the
+// projects and the custom constraints of the organization. Filters don't apply,
+// a snapshot holds the whole organization.
+func captureGCPSnapshot(ctx context.Context, client gcpAPI, organization *gcpResource) (*gcpSnapshot, error) {
+	snapshot := &gcpSnapshot{Version: gcpSnapshotVersion, Organization: *organization}
+	capture := func(resource *gcpResource) error {
+		switch gcpResourceType(resource.Name) {
+		case orgtree.FolderNode:
+			snapshot.Folders = append(snapshot.Folders, *resource)
+		case orgtree.ProjectNode:
+			snapshot.Projects = append(snapshot.Projects, *resource)
+			liens, err := client.ListLiens(ctx, resource.Name)
+			if err != nil {
+				return err
+			}
+			snapshot.Liens = append(snapshot.Liens, liens...)
+		}
+
+		policies, err := client.ListPolicies(ctx, resource.Name)
+		if err != nil {
+			return err
+		}
+		snapshot.Policies = append(snapshot.Policies, policies...)
+		denyPolicies, err := client.ListDenyPolicies(ctx, resource.Name)
+		if err != nil {
+			return err
+		}
+		snapshot.DenyPolicies = append(snapshot.DenyPolicies, denyPolicies...)
+
+		// Only the tags bound to the resource, the inherited ones are resolved
+		// from its ancestors when the snapshot is read
+		tags, err := client.ListEffectiveTags(ctx, resource.Name)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			if tag.Inherited {
+				continue
+			}
+			if snapshot.Tags == nil {
+				snapshot.Tags = map[string][]*cloudresourcemanager.EffectiveTag{}
+			}
+			snapshot.Tags[resource.Name] = append(snapshot.Tags[resource.Name], tag)
+		}
+		return nil
+	}
+	if err := walkGCPHierarchy(ctx, client, organization, capture); err != nil {
+		return nil, err
+	}
+
+	constraints, err := client.ListCustomConstraints(ctx, organization.Name)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.CustomConstraints = constraints
+	return snapshot, nil
+}
+
+// Parses a GCP snapshot, checking it is in a format this version understands.
+func parseGCPSnapshot(data []byte) (*gcpSnapshot, error) {
+	snapshot := &gcpSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("invalid GCP snapshot: %w", err)
+	}
+	if snapshot.Version != gcpSnapshotVersion {
+		return nil, fmt.Errorf("unsupported GCP snapshot version %d (expected %d)", snapshot.Version, gcpSnapshotVersion)
+	}
+	return snapshot, nil
+}
+
+// SearchOrganizations implements gcpAPI.
+func (s *gcpSnapshot) SearchOrganizations(_ context.Context) ([]*gcpResource, error) {
+	return []*gcpResource{&s.Organization}, nil
+}
+
+// GetResource implements gcpAPI.
+func (s *gcpSnapshot) GetResource(_ context.Context, name string) (*gcpResource, error) {
+	if name == s.Organization.Name {
+		return &s.Organization, nil
+	}
+	for _, resources := range [][]gcpResource{s.Folders, s.Projects} {
+		for i := range resources {
+			if resources[i].Name == name || (resources[i].ProjectID != "" && gcpProjectPrefix+resources[i].ProjectID == name) {
+				return &resources[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("error getting %s: not found in the organization %s", name, s.Organization.Name)
+}
+
+// ListFolders implements gcpAPI.
+func (s *gcpSnapshot) ListFolders(_ context.Context, parent string) ([]*gcpResource, error) {
+	return gcpChildren(s.Folders, parent), nil
+}
+
+// ListProjects implements gcpAPI.
+func (s *gcpSnapshot) ListProjects(_ context.Context, parent string) ([]*gcpResource, error) {
+	return gcpChildren(s.Projects, parent), nil
+}
+
+// ListPolicies implements gcpAPI.
+func (s *gcpSnapshot) ListPolicies(_ context.Context, parent string) ([]*orgpolicy.GoogleCloudOrgpolicyV2Policy, error) {
+	var policies []*orgpolicy.GoogleCloudOrgpolicyV2Policy
+	for _, policy := range s.Policies {
+		if strings.HasPrefix(policy.Name, parent+"/policies/") {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+// ListCustomConstraints implements gcpAPI.
+func (s *gcpSnapshot) ListCustomConstraints(_ context.Context, organization string) ([]*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint, error) {
+	var constraints []*orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint
+	for _, constraint := range s.CustomConstraints {
+		if strings.HasPrefix(constraint.Name, organization+"/customConstraints/") {
+			constraints = append(constraints, constraint)
+		}
+	}
+	return constraints, nil
+}
+
+// ListDenyPolicies implements gcpAPI.
+func (s *gcpSnapshot) ListDenyPolicies(_ context.Context, resource string) ([]*iam.GoogleIamV2Policy, error) {
+	var policies []*iam.GoogleIamV2Policy
+	for _, policy := range s.DenyPolicies {
+		if strings.HasPrefix(policy.Name, gcpDenyPoliciesParent(resource)+"/") {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+// ListEffectiveTags implements gcpAPI. The tags bound to a resource take
+// precedence over the values of the same keys bound to its ancestors.
+func (s *gcpSnapshot) ListEffectiveTags(ctx context.Context, resource string) ([]*cloudresourcemanager.EffectiveTag, error) {
+	var tags []*cloudresourcemanager.EffectiveTag
+	seen := map[string]bool{}
+	for name, inherited := resource, false; name != ""; inherited = true {
+		for _, tag := range s.Tags[name] {
+			if seen[tag.NamespacedTagKey] {
+				continue
+			}
+			seen[tag.NamespacedTagKey] = true
+			effective := *tag
+			effective.Inherited = inherited
+			tags = append(tags, &effective)
+		}
+
+		current, err := s.GetResource(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		name = current.Parent
+	}
+	return tags, nil
+}
+
+// ListLiens implements gcpAPI.
+func (s *gcpSnapshot) ListLiens(_ context.Context, project string) ([]*cloudresourcemanager.Lien, error) {
+	var liens []*cloudresourcemanager.Lien
+	for _, lien := range s.Liens {
+		if lien.Parent == project {
+			liens = append(liens, lien)
+		}
+	}
+	return liens, nil
+}
+
+// TroubleshootIAM implements gcpAPI. Snapshots don't hold the IAM allow
+// policies, so the Policy Troubleshooter can't be asked.
+func (s *gcpSnapshot) TroubleshootIAM(_ context.Context, _, _, _ string) (string, error) {
+	return "", nil
+}
+
+func gcpChildren(resources []gcpResource, parent string) []*gcpResource {
+	var children []*gcpResource
+	for i := range resources {
+		if resources[i].Parent == parent {
+			children = append(children, &resources[i])
+		}
+	}
+	return children
+}
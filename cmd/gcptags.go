@@ -0,0 +1,104 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+)
+
+// Source of the tags bound to the project itself.
+const projectTagSource = "project"
+
+// Sets the tags of a resource on its node: the Resource Manager tags bound to
+// it and the ones inherited from its ancestors, keyed by namespaced key (e.g.
+// 123456789012/env) with their short value. Tags bound to a project have
+// "project" as source, the other ones the ID of the folder (or organization)
+// they are bound to, like the tags inherited from OUs on AWS.
+func addGCPTags(ctx context.Context, client gcpAPI, node *orgtree.Node, resourceName string, inherited map[string]orgtree.Tag) error {
+	tags, err := client.ListEffectiveTags(ctx, resourceName)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	source := node.ID
+	if node.Type == orgtree.ProjectNode {
+		source = projectTagSource
+	}
+	node.Tags = make(map[string]orgtree.Tag, len(tags))
+	for _, tag := range tags {
+		value := tag.NamespacedTagValue[strings.LastIndex(tag.NamespacedTagValue, "/")+1:]
+		resolved := orgtree.Tag{Value: value, Source: source}
+		// Inherited values come with the ID of the resource they are bound to,
+		// known from the parents
+		if parent, ok := inherited[tag.NamespacedTagKey]; ok && tag.Inherited && parent.Value == value {
+			resolved.Source = parent.Source
+		}
+		node.Tags[tag.NamespacedTagKey] = resolved
+	}
+	return nil
+}
+
+// Writes the rows of the projects below node, whose path of names is
+// parentPath: the constraints of their org policies, the names of their deny
+// policies, their tags as key=value and the reasons of their liens with
+// --show-liens, each list separated by semicolons.
+func (r csvRenderer) writeProjectRows(writer *csv.Writer, node *orgtree.Node, parentPath string) error {
+	if node.Type == orgtree.ProjectNode {
+		row := []string{
+			node.ID,
+			node.Name,
+			parentPath,
+			node.Status,
+			strings.Join(policyNames(node.Policies[gcpOrgPolicyType]), ";"),
+			strings.Join(policyNames(node.Policies[gcpDenyPolicyType]), ";"),
+			strings.Join(gcpTagPairs(node), ";"),
+		}
+		if r.showLiens {
+			row = append(row, formatGCPLiens(node))
+		}
+		return writer.Write(row)
+	}
+
+	path := parentPath + "/" + node.Name
+	for _, child := range node.Children {
+		if err := r.writeProjectRows(writer, child, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Formats the tags of a node for the text output, sorted by key, nothing when
+// there are none.
+func formatGCPTags(node *orgtree.Node) string {
+	if len(node.Tags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (Tags: %s)", strings.Join(gcpTagPairs(node), ", "))
+}
+
+// Lists the tags of a node as key=value, sorted by key.
+func gcpTagPairs(node *orgtree.Node) []string {
+	keys := make([]string, 0, len(node.Tags))
+	for key := range node.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, key+"="+node.Tags[key].Value)
+	}
+	return tags
+}
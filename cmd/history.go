@@ -0,0 +1,386 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/spf13/cobra"
+)
+
+// Attributes of the items of the history table. Its partition key is
+// organizationId and its sort key scanId, both strings.
+const (
+	historyOrgKey  = "organizationId"
+	historyScanKey = "scanId" // time of the scan and command, e.g. 2024-05-01T02:00:00Z#aws lint
+)
+
+// Command recording the snapshots in the history.
+const snapshotCommand = "aws snapshot"
+
+// DynamoDB items are limited to 400 KB, attribute names included.
+const maxHistoryData = 390 << 10
+
+// historyAPI is the part of the DynamoDB API used by the commands.
+type historyAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// Creates the DynamoDB client of the local AWS config, where the history table is.
+func (d *dependencies) newHistoryClient(ctx context.Context) (historyAPI, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dynamodb.NewFromConfig(cfg), nil
+}
+
+// Checks --history-table can be used. The history only keeps the scans of live
+// organizations.
+func validateHistoryTable(run *runOptions) error {
+	if run.historyTable != "" && (run.demo || run.snapshotFile != "") {
+		return errors.New("--history-table keeps the scans of live organizations, it can't be used with --demo or --from-snapshot")
+	}
+	return nil
+}
+
+// A scan kept in the history.
+type historyEntry struct {
+	OrganizationID string `json:"organizationId"`
+	ScannedAt      string `json:"scannedAt"` // RFC 3339, UTC
+	Command        string `json:"command"`
+	Summary        string `json:"summary"`
+	Findings       *int   `json:"findings,omitempty"` // not set for the snapshots
+	data           []byte // gzipped snapshot or findings, only read when needed
+}
+
+// A finding, as kept in the history.
+type historyFinding struct {
+	Check        string `json:"check"`
+	Severity     string `json:"severity"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+// newHistoryCmd creates the aws history command.
+func newHistoryCmd(deps *dependencies) *cobra.Command {
+	var since string // only the scans from this date on
+	format := textFormat
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Lists the snapshots and findings of the org kept in the --history-table, with the trend of the findings",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayHistory(cmd.Context(), deps, since, format)
+		},
+	}
+
+	historyCmd.Flags().StringVar(&since, "since", "", "only the scans from this date on, as 2006-01-02 or RFC 3339")
+	historyCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json"`)
+
+	return historyCmd
+}
+
+// displayHistory lists the scans of the organization in chronological order.
+// Every finding count is compared with the one of the previous run of the same
+// command.
+func displayHistory(ctx context.Context, deps *dependencies, since string, format outputFormat) error {
+	if format != textFormat && format != jsonFormat {
+		return fmt.Errorf(`the %q output format is not available for "aws history", use "text" or "json"`, format)
+	}
+	if deps.options.historyTable == "" {
+		return errors.New(`"aws history" reads the scans kept in a DynamoDB table, set it with --history-table`)
+	}
+
+	from := ""
+	if since != "" {
+		start, _, err := parseHistoryDate(since)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		from = start.Format(time.RFC3339)
+	}
+
+	orgID, err := currentOrganizationID(ctx, deps)
+	if err != nil {
+		return err
+	}
+	client, err := deps.history(ctx)
+	if err != nil {
+		return err
+	}
+	entries, err := listHistory(ctx, client, deps.options.historyTable, orgID, from)
+	if err != nil {
+		return err
+	}
+
+	if format == jsonFormat {
+		if entries == nil {
+			entries = []historyEntry{}
+		}
+		encoder := json.NewEncoder(deps.report)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	fmt.Fprintf(deps.report, "History of %s (%s):\n", orgID, deps.options.historyTable)
+	previous := map[string]int{}
+	for _, entry := range entries {
+		line := fmt.Sprintf("|-- %s %s: %s", entry.ScannedAt, entry.Command, entry.Summary)
+		if entry.Findings != nil {
+			if last, ok := previous[entry.Command]; ok {
+				line += fmt.Sprintf(" [%s]", formatTrend(*entry.Findings-last))
+			}
+			previous[entry.Command] = *entry.Findings
+		}
+		fmt.Fprintln(deps.report, line)
+	}
+	fmt.Fprintf(deps.report, "%s scans\n", formatCount(len(entries)))
+	return nil
+}
+
+// Formats the change of a finding count, e.g. "+2", "-1" or "=".
+func formatTrend(delta int) string {
+	switch {
+	case delta > 0:
+		return "+" + formatCount(delta)
+	case delta < 0:
+		return formatCount(delta)
+	default:
+		return "="
+	}
+}
+
+// Keeps the snapshot of the organization in the history with --history-table.
+func recordSnapshot(ctx context.Context, deps *dependencies, snapshot *orgSnapshot, data []byte) error {
+	if deps.options.historyTable == "" {
+		return nil
+	}
+	summary := fmt.Sprintf("%s OUs, %s accounts, %s policies", formatCount(len(snapshot.OUs)), formatCount(len(snapshot.Accounts)), formatCount(len(snapshot.Policies)))
+	return recordScan(ctx, deps, historyEntry{OrganizationID: snapshot.ID, Command: snapshotCommand, Summary: summary}, data)
+}
+
+// Keeps the findings of a command in the history with --history-table, even when
+// there are none: that's how fixes show up in the trend.
+func recordFindings(ctx context.Context, deps *dependencies, command string, findings []auditFinding) error {
+	if deps.options.historyTable == "" {
+		return nil
+	}
+
+	orgID, err := currentOrganizationID(ctx, deps)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]historyFinding, 0, len(findings))
+	for _, finding := range findings {
+		kept = append(kept, historyFinding{
+			Check:        finding.check,
+			Severity:     string(finding.severity),
+			Title:        finding.title,
+			Description:  finding.description,
+			ResourceType: finding.resourceType,
+			ResourceID:   finding.resourceID,
+			Detail:       finding.detail,
+		})
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("%s findings", formatCount(len(findings)))
+	if len(findings) > 0 {
+		summary += fmt.Sprintf(" (%s)", formatSeverityCounts(findings))
+	}
+
+	total := len(findings)
+	return recordScan(ctx, deps, historyEntry{OrganizationID: orgID, Command: command, Summary: summary, Findings: &total}, data)
+}
+
+// Writes a scan to the history table, its data gzipped.
+func recordScan(ctx context.Context, deps *dependencies, entry historyEntry, data []byte) error {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(data) //nolint:errcheck
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if compressed.Len() > maxHistoryData {
+		return fmt.Errorf("the results of %q are too large to be kept in the history: %s KB gzipped, DynamoDB items are limited to 400 KB", entry.Command, formatCount(compressed.Len()>>10))
+	}
+
+	entry.ScannedAt = deps.now().UTC().Format(time.RFC3339)
+	item := map[string]dynamodbtypes.AttributeValue{
+		historyOrgKey:  &dynamodbtypes.AttributeValueMemberS{Value: entry.OrganizationID},
+		historyScanKey: &dynamodbtypes.AttributeValueMemberS{Value: entry.ScannedAt + "#" + entry.Command},
+		"scannedAt":    &dynamodbtypes.AttributeValueMemberS{Value: entry.ScannedAt},
+		"command":      &dynamodbtypes.AttributeValueMemberS{Value: entry.Command},
+		"summary":      &dynamodbtypes.AttributeValueMemberS{Value: entry.Summary},
+		"data":         &dynamodbtypes.AttributeValueMemberB{Value: compressed.Bytes()},
+	}
+	if entry.Findings != nil {
+		item["findings"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.Itoa(*entry.Findings)}
+	}
+
+	client, err := deps.history(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(deps.options.historyTable), Item: item}); err != nil {
+		return fmt.Errorf("error writing to the history table %s: %w", deps.options.historyTable, err)
+	}
+	fmt.Fprintf(deps.stderr, "Results of %s kept in the history table %s\n", entry.Command, deps.options.historyTable)
+	return nil
+}
+
+// Lists the scans of an organization from the given RFC 3339 time on, oldest
+// first, without their data.
+func listHistory(ctx context.Context, client historyAPI, table, orgID, from string) ([]historyEntry, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#org = :org"),
+		ProjectionExpression:   aws.String("#scannedAt, #command, #summary, #findings"),
+		ExpressionAttributeNames: map[string]string{
+			"#org":       historyOrgKey,
+			"#scannedAt": "scannedAt",
+			"#command":   "command",
+			"#summary":   "summary",
+			"#findings":  "findings",
+		},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":org": &dynamodbtypes.AttributeValueMemberS{Value: orgID},
+		},
+	}
+	if from != "" {
+		input.KeyConditionExpression = aws.String("#org = :org AND #scan >= :from")
+		input.ExpressionAttributeNames["#scan"] = historyScanKey
+		input.ExpressionAttributeValues[":from"] = &dynamodbtypes.AttributeValueMemberS{Value: from}
+	}
+
+	var entries []historyEntry
+	paginator := dynamodb.NewQueryPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the history table %s: %w", table, err)
+		}
+		for _, item := range page.Items {
+			entries = append(entries, historyItem(orgID, item))
+		}
+	}
+	return entries, nil
+}
+
+// Gets the last snapshot of an organization taken before the given RFC 3339 time.
+func latestSnapshot(ctx context.Context, client historyAPI, table, orgID, before string) (*orgSnapshot, historyEntry, error) {
+	paginator := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#org = :org AND #scan < :before"),
+		FilterExpression:       aws.String("#command = :command"),
+		ExpressionAttributeNames: map[string]string{
+			"#org":     historyOrgKey,
+			"#scan":    historyScanKey,
+			"#command": "command",
+		},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":org":     &dynamodbtypes.AttributeValueMemberS{Value: orgID},
+			":before":  &dynamodbtypes.AttributeValueMemberS{Value: before},
+			":command": &dynamodbtypes.AttributeValueMemberS{Value: snapshotCommand},
+		},
+		// Newest first, the filter applies after reading each page
+		ScanIndexForward: aws.Bool(false),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, historyEntry{}, fmt.Errorf("error reading the history table %s: %w", table, err)
+		}
+		if len(page.Items) == 0 {
+			continue
+		}
+
+		entry := historyItem(orgID, page.Items[0])
+		reader, err := gzip.NewReader(bytes.NewReader(entry.data))
+		if err != nil {
+			return nil, historyEntry{}, fmt.Errorf("invalid snapshot of %s in the history: %w", entry.ScannedAt, err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, historyEntry{}, fmt.Errorf("invalid snapshot of %s in the history: %w", entry.ScannedAt, err)
+		}
+		snapshot, err := parseSnapshot(data)
+		if err != nil {
+			return nil, historyEntry{}, fmt.Errorf("snapshot of %s in the history: %w", entry.ScannedAt, err)
+		}
+		return snapshot, entry, nil
+	}
+	return nil, historyEntry{}, fmt.Errorf("no snapshot of %s taken before %s in the history table %s", orgID, before, table)
+}
+
+// Reads an item of the history table.
+func historyItem(orgID string, item map[string]dynamodbtypes.AttributeValue) historyEntry {
+	entry := historyEntry{OrganizationID: orgID}
+	if value, ok := item["scannedAt"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		entry.ScannedAt = value.Value
+	}
+	if value, ok := item["command"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		entry.Command = value.Value
+	}
+	if value, ok := item["summary"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		entry.Summary = value.Value
+	}
+	if value, ok := item["findings"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if findings, err := strconv.Atoi(value.Value); err == nil {
+			entry.Findings = &findings
+		}
+	}
+	if value, ok := item["data"].(*dynamodbtypes.AttributeValueMemberB); ok {
+		entry.data = value.Value
+	}
+	return entry
+}
+
+// Parses a date of the history, as 2006-01-02 or RFC 3339. end is the first
+// instant after it: the next day for a date, the next second otherwise.
+func parseHistoryDate(value string) (start, end time.Time, err error) {
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+	instant, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%q is neither a date (2006-01-02) nor an RFC 3339 time", value)
+	}
+	instant = instant.UTC().Truncate(time.Second)
+	return instant, instant.Add(time.Second), nil
+}
+
+// Gets the ID of the organization being analyzed.
+func currentOrganizationID(ctx context.Context, deps *dependencies) (string, error) {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(org.Id), nil
+}
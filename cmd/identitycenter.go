@@ -0,0 +1,149 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/identitystore"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	ssoadmintypes "github.com/aws/aws-sdk-go-v2/service/ssoadmin/types"
+)
+
+// identityCenterAPI is the part of the IAM Identity Center (SSO Admin and
+// identity store) APIs used by the commands.
+type identityCenterAPI interface {
+	ListInstances(ctx context.Context, params *ssoadmin.ListInstancesInput, optFns ...func(*ssoadmin.Options)) (*ssoadmin.ListInstancesOutput, error)
+	ListPermissionSetsProvisionedToAccount(ctx context.Context, params *ssoadmin.ListPermissionSetsProvisionedToAccountInput, optFns ...func(*ssoadmin.Options)) (*ssoadmin.ListPermissionSetsProvisionedToAccountOutput, error)
+	ListAccountAssignments(ctx context.Context, params *ssoadmin.ListAccountAssignmentsInput, optFns ...func(*ssoadmin.Options)) (*ssoadmin.ListAccountAssignmentsOutput, error)
+	DescribePermissionSet(ctx context.Context, params *ssoadmin.DescribePermissionSetInput, optFns ...func(*ssoadmin.Options)) (*ssoadmin.DescribePermissionSetOutput, error)
+	DescribeUser(ctx context.Context, params *identitystore.DescribeUserInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeUserOutput, error)
+	DescribeGroup(ctx context.Context, params *identitystore.DescribeGroupInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeGroupOutput, error)
+}
+
+// The SSO Admin client along with the identity store one, resolving the names
+// of the users and groups assigned.
+type identityCenterClient struct {
+	*ssoadmin.Client
+	store *identitystore.Client
+}
+
+func (c identityCenterClient) DescribeUser(ctx context.Context, params *identitystore.DescribeUserInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeUserOutput, error) {
+	return c.store.DescribeUser(ctx, params, optFns...)
+}
+
+func (c identityCenterClient) DescribeGroup(ctx context.Context, params *identitystore.DescribeGroupInput, optFns ...func(*identitystore.Options)) (*identitystore.DescribeGroupOutput, error) {
+	return c.store.DescribeGroup(ctx, params, optFns...)
+}
+
+// Creates the Identity Center client of the org being analyzed. Identity
+// Center is administered from the management account or from its delegated
+// administrator, in the region of the local AWS config.
+func (d *dependencies) newIdentityCenterClient(ctx context.Context) (identityCenterAPI, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return identityCenterClient{Client: ssoadmin.NewFromConfig(cfg), store: identitystore.NewFromConfig(cfg)}, nil
+}
+
+// Returned when the organization has no Identity Center instance.
+var errNoIdentityCenter = errors.New("identity center is not enabled")
+
+// A permission set assigned to a user or a group on an account.
+type identityCenterAssignment struct {
+	PermissionSet string
+	PrincipalType string // USER or GROUP
+	Principal     string // user name or group display name, the ID if it couldn't be read
+}
+
+// Lists who can access an account through Identity Center, sorted by
+// permission set and principal.
+func listIdentityCenterAccess(ctx context.Context, client identityCenterAPI, accountID string) ([]identityCenterAssignment, error) {
+	instances, err := client.ListInstances(ctx, &ssoadmin.ListInstancesInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Identity Center instances: %w", err)
+	}
+	if len(instances.Instances) == 0 {
+		return nil, errNoIdentityCenter
+	}
+	instance := instances.Instances[0]
+
+	var permissionSets []string
+	paginator := ssoadmin.NewListPermissionSetsProvisionedToAccountPaginator(client, &ssoadmin.ListPermissionSetsProvisionedToAccountInput{
+		InstanceArn: instance.InstanceArn,
+		AccountId:   &accountID,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing permission sets of %s: %w", accountID, err)
+		}
+		permissionSets = append(permissionSets, page.PermissionSets...)
+	}
+
+	var assignments []identityCenterAssignment
+	for _, permissionSetARN := range permissionSets {
+		permissionSet, err := client.DescribePermissionSet(ctx, &ssoadmin.DescribePermissionSetInput{
+			InstanceArn:      instance.InstanceArn,
+			PermissionSetArn: aws.String(permissionSetARN),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing permission set %s: %w", permissionSetARN, err)
+		}
+		name := aws.ToString(permissionSet.PermissionSet.Name)
+
+		paginator := ssoadmin.NewListAccountAssignmentsPaginator(client, &ssoadmin.ListAccountAssignmentsInput{
+			InstanceArn:      instance.InstanceArn,
+			AccountId:        &accountID,
+			PermissionSetArn: aws.String(permissionSetARN),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error listing assignments of %s on %s: %w", name, accountID, err)
+			}
+			for _, assignment := range page.AccountAssignments {
+				assignments = append(assignments, identityCenterAssignment{
+					PermissionSet: name,
+					PrincipalType: string(assignment.PrincipalType),
+					Principal:     principalName(ctx, client, aws.ToString(instance.IdentityStoreId), assignment),
+				})
+			}
+		}
+	}
+
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].PermissionSet != assignments[j].PermissionSet {
+			return assignments[i].PermissionSet < assignments[j].PermissionSet
+		}
+		return assignments[i].Principal < assignments[j].Principal
+	})
+	return assignments, nil
+}
+
+// Reads the name of the user or group of an assignment. Reading the identity
+// store needs permissions of its own, without them the ID is displayed.
+func principalName(ctx context.Context, client identityCenterAPI, identityStoreID string, assignment ssoadmintypes.AccountAssignment) string {
+	id := aws.ToString(assignment.PrincipalId)
+	switch assignment.PrincipalType {
+	case ssoadmintypes.PrincipalTypeUser:
+		user, err := client.DescribeUser(ctx, &identitystore.DescribeUserInput{IdentityStoreId: &identityStoreID, UserId: &id})
+		if err == nil && aws.ToString(user.UserName) != "" {
+			return *user.UserName
+		}
+	case ssoadmintypes.PrincipalTypeGroup:
+		group, err := client.DescribeGroup(ctx, &identitystore.DescribeGroupInput{IdentityStoreId: &identityStoreID, GroupId: &id})
+		if err == nil && aws.ToString(group.DisplayName) != "" {
+			return *group.DisplayName
+		}
+	}
+	return id
+}
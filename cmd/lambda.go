@@ -0,0 +1,41 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LambdaEvent is the input of the Lambda function, set as the constant input of
+// the EventBridge rule scheduling the scan, e.g.
+// {"args": ["aws", "lint", "--publish", "security-hub"]}.
+type LambdaEvent struct {
+	Args []string `json:"args"` // command line, without the name of the tool
+}
+
+// HandleLambda runs the command of the event, as Execute does for the command
+// line. This is called by the handler of the lambda package. The report goes
+// to the logs of the function unless --report-to sends it somewhere else; a
+// failed command fails the invocation, so it can be retried or alarmed on.
+func HandleLambda(ctx context.Context, event LambdaEvent) error {
+	if len(event.Args) == 0 {
+		return errors.New(`no command to run: set the input of the rule to the command line, e.g. {"args": ["aws", "lint"]}`)
+	}
+
+	// A warm execution environment keeps the package state of the previous
+	// invocation, every invocation starts with fresh dependencies (and options)
+	deps := defaultDependencies()
+	rootCmd := newRootCmd(deps)
+	rootCmd.SetArgs(event.Args)
+	if _, err := rootCmd.ExecuteContextC(ctx); err != nil {
+		deps.progress.finish()
+		return fmt.Errorf("policy-scout %s failed (exit code %d): %w", strings.Join(event.Args, " "), exitCode(err), err)
+	}
+	return nil
+}
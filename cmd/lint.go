@@ -0,0 +1,241 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	analyzertypes "github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// lintOptions are the flags of the aws lint command.
+type lintOptions struct {
+	startOUID      string // OU whose accounts are checked for duplicate statements, the root if empty
+	accessAnalyzer bool   // also validate the policies with IAM Access Analyzer
+}
+
+// newLintCmd creates the aws lint command.
+func newLintCmd(deps *dependencies) *cobra.Command {
+	options := &lintOptions{}
+	lintCmd := &cobra.Command{
+		Use:         "lint",
+		Short:       "Analyzes the SCP documents of the org for common problems",
+		Annotations: map[string]string{findingsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lintPolicies(cmd.Context(), deps, options.startOUID, options.accessAnalyzer)
+		},
+	}
+
+	lintCmd.Flags().StringVar(&options.startOUID, "ou-id", "", "OU whose accounts are checked for duplicate inherited statements (defaults to the org root)")
+	lintCmd.Flags().BoolVar(&options.accessAnalyzer, "access-analyzer", false, "also report the findings (errors, warnings, suggestions) of IAM Access Analyzer policy validation")
+
+	return lintCmd
+}
+
+// lintPolicies runs every lint check on the customer managed SCPs of the org and
+// looks for statements repeated in the inheritance chain of every account.
+// Optionally, the policies are validated by IAM Access Analyzer too.
+func lintPolicies(ctx context.Context, deps *dependencies, startOUID string, accessAnalyzer bool) error {
+	if accessAnalyzer && (deps.options.demo || deps.options.snapshotFile != "") {
+		return errors.New("--access-analyzer calls the IAM Access Analyzer API, it can't be used with --demo or --from-snapshot")
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var analyzer accessAnalyzerAPI
+	if accessAnalyzer {
+		if analyzer, err = deps.accessAnalyzer(ctx); err != nil {
+			return err
+		}
+	}
+
+	startID, err := getStartingID(ctx, client, startOUID)
+	if err != nil {
+		return err
+	}
+
+	summaries, err := listOrganizationPolicies(ctx, client, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	// Findings are grouped by policy, in the order policies are listed
+	var policies []scp.Policy
+	findings := map[string][]scp.Finding{}
+	arns := map[string]string{}
+	for _, summary := range summaries {
+		// AWS managed policies (FullAWSAccess) can't be changed anyway
+		if summary.AwsManaged {
+			continue
+		}
+
+		document, err := getPolicyDocument(ctx, client, *summary.Id)
+		if err != nil {
+			return err
+		}
+		parsed, err := scp.Parse(document)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", *summary.Id, err)
+		}
+		policy := scp.Policy{ID: *summary.Id, Name: *summary.Name, Document: parsed}
+		policies = append(policies, policy)
+		arns[policy.ID] = aws.ToString(summary.Arn)
+
+		for _, check := range scp.Checks {
+			stop := deps.profile.time(checkPhase, check.Name)
+			findings[policy.ID] = append(findings[policy.ID], check.Run(policy)...)
+			stop()
+		}
+
+		if accessAnalyzer {
+			stop := deps.profile.time(checkPhase, "access-analyzer")
+			validated, err := validatePolicy(ctx, analyzer, policy, document)
+			stop()
+			if err != nil {
+				return err
+			}
+			findings[policy.ID] = append(findings[policy.ID], validated...)
+		}
+	}
+
+	accountIDs, err := collectAccountsInSubtree(ctx, client, startID)
+	if err != nil {
+		return err
+	}
+	reported := map[scp.Finding]bool{}
+	for _, id := range accountIDs {
+		chain, err := getPolicyChain(ctx, client, id, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return err
+		}
+
+		stop := deps.profile.time(checkPhase, "duplicate-statement")
+		duplicates := scp.LintChain(chain)
+		stop()
+
+		// Accounts below the same OU find the same duplicates
+		for _, finding := range duplicates {
+			if !reported[finding] {
+				reported[finding] = true
+				findings[finding.PolicyID] = append(findings[finding.PolicyID], finding)
+			}
+		}
+	}
+
+	total, flagged := 0, 0
+	var published []auditFinding
+	for _, policy := range policies {
+		if len(findings[policy.ID]) == 0 {
+			continue
+		}
+		flagged++
+		total += len(findings[policy.ID])
+		fmt.Fprintf(deps.report, "|-- %s [%s]\n", policy.Name, policy.ID)
+		for _, finding := range findings[policy.ID] {
+			fmt.Fprintf(deps.report, "%s|-- %s %s: %s: %s\n", indent, finding.Severity, finding.Check, finding.Sid, finding.Message)
+			published = append(published, auditFinding{
+				check:        "lint/" + finding.Check,
+				severity:     lintSeverity(finding.Severity),
+				title:        fmt.Sprintf("SCP %s: %s", policy.Name, finding.Check),
+				description:  fmt.Sprintf("%s: %s", finding.Sid, finding.Message),
+				resourceType: policyResource,
+				resourceID:   arns[policy.ID],
+				detail:       finding.Sid,
+			})
+		}
+	}
+	fmt.Fprintf(deps.report, "%s findings in %s of %s customer managed SCPs\n", formatCount(total), formatCount(flagged), formatCount(len(policies)))
+
+	return publishFindings(ctx, deps, "aws lint", published)
+}
+
+// accessAnalyzerAPI is the part of the IAM Access Analyzer API used by the commands.
+type accessAnalyzerAPI interface {
+	ValidatePolicy(ctx context.Context, params *accessanalyzer.ValidatePolicyInput, optFns ...func(*accessanalyzer.Options)) (*accessanalyzer.ValidatePolicyOutput, error)
+}
+
+// Creates the IAM Access Analyzer client of the local AWS config, the only one
+// it is reached with.
+func (d *dependencies) newAccessAnalyzerClient(ctx context.Context) (accessAnalyzerAPI, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return accessanalyzer.NewFromConfig(cfg), nil
+}
+
+// Validates an SCP with IAM Access Analyzer, converting its findings.
+func validatePolicy(ctx context.Context, client accessAnalyzerAPI, policy scp.Policy, document string) ([]scp.Finding, error) {
+	var findings []scp.Finding
+	paginator := accessanalyzer.NewValidatePolicyPaginator(client, &accessanalyzer.ValidatePolicyInput{
+		PolicyDocument: &document,
+		PolicyType:     analyzertypes.PolicyTypeServiceControlPolicy,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error validating policy %s with Access Analyzer: %w", policy.ID, err)
+		}
+
+		for _, finding := range page.Findings {
+			message := aws.ToString(finding.FindingDetails)
+			if finding.LearnMoreLink != nil {
+				message += " (" + *finding.LearnMoreLink + ")"
+			}
+			location := "document"
+			if len(finding.Locations) > 0 {
+				location = formatFindingPath(finding.Locations[0].Path)
+			}
+			findings = append(findings, scp.Finding{
+				Check:      "access-analyzer/" + aws.ToString(finding.IssueCode),
+				Severity:   strings.ReplaceAll(strings.ToLower(string(finding.FindingType)), "_", " "),
+				PolicyID:   policy.ID,
+				PolicyName: policy.Name,
+				Sid:        location,
+				Message:    message,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// Formats the location of a finding in the document, e.g. Statement[0].Action[1].
+func formatFindingPath(path []analyzertypes.PathElement) string {
+	var b strings.Builder
+	for _, element := range path {
+		switch e := element.(type) {
+		case *analyzertypes.PathElementMemberIndex:
+			fmt.Fprintf(&b, "[%d]", e.Value)
+		case *analyzertypes.PathElementMemberKey:
+			writePathName(&b, e.Value)
+		case *analyzertypes.PathElementMemberValue:
+			// Access Analyzer uses values for the element names too (Statement, Action)
+			writePathName(&b, e.Value)
+		}
+	}
+	if b.Len() == 0 {
+		return "document"
+	}
+	return b.String()
+}
+
+func writePathName(b *strings.Builder, name string) {
+	if b.Len() > 0 {
+		b.WriteString(".")
+	}
+	b.WriteString(name)
+}
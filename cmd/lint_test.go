@@ -0,0 +1,98 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// The test org with an SCP for every lint check: an unconditional deny, a
+// statement repeated below the Workloads OU, a large statement and a copy of
+// FullAWSAccess on the management account.
+func newLintOrg() *awsorgtest.Org {
+	large := `{"Version":"2012-10-17","Statement":[{"Sid":"Large","Effect":"Deny","Action":["` + strings.Repeat(`ec2:RunInstances","`, 60) +
+		`ec2:StartInstances"],"Resource":"*","Condition":{"Bool":{"aws:ViaAWSService":"false"}}}]}`
+	return newTestOrg().
+		AddPolicy("p-s3", "deny-s3", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Sid":"NoS3","Effect":"Deny","Action":"s3:*","Resource":"*"}]}`).
+		AddPolicy("p-leave", "deny-leave-again", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Sid":"Leave","Effect":"Deny","Action":"organizations:LeaveOrganization","Resource":"*"}]}`).
+		AddPolicy("p-large", "large", types.PolicyTypeServiceControlPolicy, large).
+		AddPolicy("p-allow", "allow-all", types.PolicyTypeServiceControlPolicy, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`).
+		AttachPolicy("222222222222", "p-leave").
+		AttachPolicy("222222222222", "p-s3").
+		AttachPolicy("222222222222", "p-large").
+		AttachPolicy("111111111111", "p-allow")
+}
+
+func TestLint(t *testing.T) {
+	allowAll := "|-- FullAWSAccess [p-FullAWSAccess]\n" +
+		indent + "|-- warning broad-allow: statement #1: allows every action (Action: *), prefer listing the allowed services\n" +
+		"|-- allow-all [p-allow]\n" +
+		indent + "|-- warning broad-allow: statement #1: allows every action (Action: *), prefer listing the allowed services\n"
+	findings := "|-- large [p-large]\n" +
+		indent + "|-- info statement-size: Large: statement of 1273 characters, over the recommended 1024: consider splitting it\n" +
+		"|-- deny-leave-again [p-leave]\n" +
+		indent + "|-- warning duplicate-statement: Leave: same statement as statement #1 of deny-leave, attached to Workloads\n" +
+		"|-- deny-s3 [p-s3]\n" +
+		indent + "|-- warning unconditional-deny: NoS3: denies s3:* without a condition, even to break-glass roles (e.g. exempt them with aws:PrincipalArn)\n"
+
+	tests := []struct {
+		name    string
+		org     *awsorgtest.Org
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "every check",
+			org:  newLintOrg(),
+			want: allowAll +
+				indent + "|-- warning duplicate-statement: statement #1: same statement as statement #1 of FullAWSAccess, attached to Root\n" +
+				findings + "6 findings in 5 of 6 customer managed SCPs\n",
+		},
+		{
+			name: "duplicates below an OU",
+			org:  newLintOrg(),
+			args: []string{"--ou-id", "ou-root-work"},
+			want: allowAll + findings + "5 findings in 5 of 6 customer managed SCPs\n",
+		},
+		{
+			name: "no findings",
+			org:  awsorgtest.New("o-example", "r-root", "111111111111").AddPolicy("p-denyleave", "deny-leave", types.PolicyTypeServiceControlPolicy, denyLeaveDocument),
+			want: "0 findings in 0 of 1 customer managed SCPs\n",
+		},
+		{
+			name: "empty organization",
+			org:  awsorgtest.New("o-example", "r-root", "111111111111"),
+			want: "0 findings in 0 of 0 customer managed SCPs\n",
+		},
+		{
+			name:    "access analyzer offline",
+			org:     newLintOrg(),
+			args:    []string{"--demo", "--access-analyzer"},
+			wantErr: "--access-analyzer calls the IAM Access Analyzer API, it can't be used with --demo or --from-snapshot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, tt.org, append([]string{"aws", "lint"}, tt.args...)...)
+			switch {
+			case tt.wantErr != "":
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("lint: %v", err)
+			case got != tt.want:
+				t.Errorf("lint wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
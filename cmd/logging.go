@@ -0,0 +1,98 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Creates the logger selected by --verbose, --debug and --log-format, writing to w.
+func newLogger(w io.Writer, run *runOptions) (*slog.Logger, error) {
+	level := slog.LevelWarn
+	switch {
+	case run.debug:
+		level = slog.LevelDebug
+	case run.verbose:
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch run.logFormat {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: valid log formats are \"text\", \"json\"", run.logFormat)
+	}
+}
+
+// Key of the number of attempts of an API call in the middleware stack values.
+type attemptsKey struct{}
+
+// Middleware logging every API call with its duration and number of attempts,
+// and every retry, added to the AWS config of every command. Failed calls are
+// logged at info level, as some failures are expected (e.g. policy types that
+// are not enabled) and are handled by the commands. Calls are timed with now.
+func loggingMiddleware(logger *slog.Logger, now func() time.Time) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return addLoggingMiddleware(stack, logger, now)
+	}
+}
+
+func addLoggingMiddleware(stack *middleware.Stack, logger *slog.Logger, now func() time.Time) error {
+	err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LogAPICall", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		attempts := new(int)
+		ctx = middleware.WithStackValue(ctx, attemptsKey{}, attempts)
+
+		start := now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		attrs := []any{
+			slog.String("service", awsmiddleware.GetServiceID(ctx)),
+			slog.String("operation", awsmiddleware.GetOperationName(ctx)),
+			slog.Int("attempts", *attempts),
+			slog.Duration("duration", now().Sub(start)),
+		}
+		if err != nil {
+			logger.InfoContext(ctx, "API call failed", append(attrs, slog.String("error", err.Error()))...)
+		} else {
+			logger.DebugContext(ctx, "API call", attrs...)
+		}
+		return out, metadata, err
+	}), middleware.After)
+	if err != nil {
+		return err
+	}
+
+	// Runs once per attempt, right after the retry middleware
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("LogAPIAttempt", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if attempts, ok := middleware.GetStackValue(ctx, attemptsKey{}).(*int); ok {
+			*attempts++
+			if *attempts > 1 {
+				logger.InfoContext(ctx, "retrying API call",
+					slog.String("service", awsmiddleware.GetServiceID(ctx)),
+					slog.String("operation", awsmiddleware.GetOperationName(ctx)),
+					slog.Int("attempt", *attempts))
+			}
+		}
+		return next.HandleFinalize(ctx, in)
+	}), "Retry", middleware.After)
+}
+
+// Logs a hit of the scan cache (which holds the warm cache and the checkpoint
+// being resumed), e.g. logCacheHit(logger, "ou", "ou/ou-ex12-5ec0a1b2", ok).
+func logCacheHit(logger *slog.Logger, kind, key string, hit bool) {
+	if hit && logger != nil {
+		logger.Debug("cache hit", slog.String("kind", kind), slog.String("key", key))
+	}
+}
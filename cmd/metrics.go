@@ -0,0 +1,280 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// Prefix of the names of the metrics.
+const metricsNamespace = "policy_scout"
+
+// Job of the metrics pushed to the Pushgateway.
+const metricsJob = "policy-scout"
+
+// Content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// A gauge describing the governance posture of the org, with its samples.
+type metricFamily struct {
+	name    string // without the namespace, e.g. account_count
+	help    string
+	samples []metricSample
+	// Name of the metric with --publish cloudwatch, not published if empty.
+	// Ratios are published as percentages.
+	cloudWatch string
+	unit       cloudwatchtypes.StandardUnit
+}
+
+type metricSample struct {
+	labels []string // name and value of every label, e.g. "policy_id", "p-1234"
+	value  float64
+}
+
+// newMetricsCmd creates the aws metrics command.
+func newMetricsCmd(deps *dependencies) *cobra.Command {
+	var pushgatewayURL string // Prometheus Pushgateway receiving the metrics, written to the report if empty
+	metricsCmd := &cobra.Command{
+		Use:         "metrics",
+		Short:       "Scans the org and writes its governance metrics in the Prometheus format, or pushes them to a Pushgateway",
+		Annotations: map[string]string{metricsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportMetrics(cmd.Context(), deps, pushgatewayURL)
+		},
+	}
+
+	metricsCmd.Flags().StringVar(&pushgatewayURL, "pushgateway", "", "URL of a Prometheus Pushgateway receiving the metrics, e.g. http://pushgateway:9091")
+
+	return metricsCmd
+}
+
+// exportMetrics collects the metrics of the organization and writes them to the
+// report, or pushes them to the Pushgateway, grouped by organization.
+func exportMetrics(ctx context.Context, deps *dependencies, pushgateway string) error {
+	orgID, families, err := collectMetrics(ctx, deps)
+	if err != nil {
+		return err
+	}
+	if err := publishMetrics(ctx, deps, orgID, cloudWatchMetrics(families)); err != nil {
+		return err
+	}
+	if pushgateway == "" {
+		writeMetrics(deps.report, families)
+		return nil
+	}
+
+	var body bytes.Buffer
+	writeMetrics(&body, families)
+	target := fmt.Sprintf("%s/metrics/job/%s/organization_id/%s", strings.TrimSuffix(pushgateway, "/"), metricsJob, url.PathEscape(orgID))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, target, &body)
+	if err != nil {
+		return fmt.Errorf("invalid Pushgateway URL: %w", err)
+	}
+	request.Header.Set("Content-Type", metricsContentType)
+
+	response, err := deps.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1<<10))
+		return fmt.Errorf("error pushing metrics: unexpected status %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	fmt.Fprintf(deps.stderr, "Metrics of %s pushed to %s\n", orgID, pushgateway)
+	return nil
+}
+
+// Scans the whole organization and computes its metrics. Excluded OUs and
+// accounts are left out.
+func collectMetrics(ctx context.Context, deps *dependencies) (string, []metricFamily, error) {
+	start := deps.now()
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+	tree, err := buildOrgTree(ctx, client, "all", rootID)
+	if err != nil {
+		return "", nil, err
+	}
+	stats := computeTreeStats(tree)
+
+	// Same check as aws unrestricted, SCPs never apply to the management account
+	unrestricted := 0
+	err = tree.Walk(func(node *orgtree.Node, depth int) error {
+		if node.Type != orgtree.AccountNode || node.ManagementAccount {
+			return nil
+		}
+		chain, err := getPolicyChain(ctx, client, node.ID, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return err
+		}
+		if scp.Unrestricted(chain) {
+			unrestricted++
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	orgID := aws.ToString(org.Id)
+	sizes := metricFamily{name: "scp_size_bytes", help: fmt.Sprintf("Size of the document of every SCP, limited to %d characters", maxSCPSize)}
+	summaries, err := listOrganizationPolicies(ctx, client, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return "", nil, err
+	}
+	largest := 0
+	attachments := map[string]int{} // SCPs directly attached, keyed by target ID
+	for _, summary := range summaries {
+		document, err := getPolicyDocument(ctx, client, aws.ToString(summary.Id))
+		if err != nil {
+			return "", nil, err
+		}
+		sizes.samples = append(sizes.samples, metricSample{
+			labels: []string{"organization_id", orgID, "policy_id", aws.ToString(summary.Id), "policy_name", aws.ToString(summary.Name)},
+			value:  float64(len(document)),
+		})
+		largest = max(largest, len(document))
+
+		targets, err := listPolicyTargets(ctx, client, aws.ToString(summary.Id))
+		if err != nil {
+			return "", nil, err
+		}
+		for _, target := range targets {
+			attachments[aws.ToString(target.TargetId)]++
+		}
+	}
+	mostAttached := 0
+	for _, count := range attachments {
+		mostAttached = max(mostAttached, count)
+	}
+
+	orgLabels := []string{"organization_id", orgID}
+	finished := deps.now()
+	return orgID, []metricFamily{
+		{name: "account_count", help: "Accounts of the organization", samples: []metricSample{{orgLabels, float64(stats.Accounts)}},
+			cloudWatch: "AccountCount", unit: cloudwatchtypes.StandardUnitCount},
+		{name: "ou_count", help: "Organizational units of the organization", samples: []metricSample{{orgLabels, float64(stats.OUs)}},
+			cloudWatch: "OUCount", unit: cloudwatchtypes.StandardUnitCount},
+		{name: "accounts_without_scp", help: "Accounts whose SCPs don't restrict anything (only allow-all policies), the management account excluded", samples: []metricSample{{orgLabels, float64(unrestricted)}},
+			cloudWatch: ungovernedAccountsMetric, unit: cloudwatchtypes.StandardUnitCount},
+		sizes,
+		{name: "scp_size_quota_ratio", help: fmt.Sprintf("Size of the largest SCP over the quota of %d characters", maxSCPSize), samples: []metricSample{{orgLabels, float64(largest) / maxSCPSize}},
+			cloudWatch: "SCPSizeQuotaUtilization", unit: cloudwatchtypes.StandardUnitPercent},
+		{name: "scp_attachments_quota_ratio", help: fmt.Sprintf("SCPs directly attached to the most loaded root, OU or account over the quota of %d", maxSCPsPerTarget), samples: []metricSample{{orgLabels, float64(mostAttached) / maxSCPsPerTarget}},
+			cloudWatch: "SCPAttachmentsQuotaUtilization", unit: cloudwatchtypes.StandardUnitPercent},
+		{name: "scan_duration_seconds", help: "Time spent scanning the organization", samples: []metricSample{{orgLabels, finished.Sub(start).Seconds()}},
+			cloudWatch: "ScanDuration", unit: cloudwatchtypes.StandardUnitSeconds},
+		{name: "scan_timestamp_seconds", help: "Time of the end of the scan, as a Unix timestamp", samples: []metricSample{{orgLabels, float64(finished.Unix())}}},
+	}, nil
+}
+
+// Selects the metrics published to CloudWatch, the ones of the whole organization.
+func cloudWatchMetrics(families []metricFamily) []cloudWatchMetric {
+	var metrics []cloudWatchMetric
+	for _, family := range families {
+		if family.cloudWatch == "" || len(family.samples) != 1 {
+			continue
+		}
+		value := family.samples[0].value
+		if family.unit == cloudwatchtypes.StandardUnitPercent {
+			value *= 100
+		}
+		metrics = append(metrics, cloudWatchMetric{name: family.cloudWatch, unit: family.unit, value: value})
+	}
+	return metrics
+}
+
+// Writes the metrics in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, families []metricFamily) {
+	for _, family := range families {
+		name := metricsNamespace + "_" + family.name
+		fmt.Fprintf(w, "# HELP %s %s\n", name, family.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		for _, sample := range family.samples {
+			var labels []string
+			for i := 0; i+1 < len(sample.labels); i += 2 {
+				labels = append(labels, fmt.Sprintf(`%s="%s"`, sample.labels[i], escapeLabelValue(sample.labels[i+1])))
+			}
+			fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(labels, ","), strconv.FormatFloat(sample.value, 'f', -1, 64))
+		}
+	}
+}
+
+// Escapes the characters of a label value the exposition format reserves.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Serves the metrics of the last scan at /metrics for "serve --metrics-interval".
+// The first scan may use the warm cache, the following ones start with an empty
+// cache so they see the changes of the organization.
+type metricsHandler struct {
+	mu      sync.Mutex
+	metrics []byte // nil until the first scan completes
+}
+
+// Scans the organization every interval until the context is cancelled. Failed
+// scans are logged, the metrics of the last successful one are kept.
+func (h *metricsHandler) refresh(ctx context.Context, deps *dependencies, interval time.Duration) {
+	for {
+		if _, families, err := collectMetrics(ctx, deps); err != nil {
+			fmt.Fprintf(deps.stderr, "error collecting metrics: %v\n", err)
+		} else {
+			var body bytes.Buffer
+			writeMetrics(&body, families)
+			h.mu.Lock()
+			h.metrics = body.Bytes()
+			h.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			deps.cache.reset()
+		}
+	}
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	metrics := h.metrics
+	h.mu.Unlock()
+
+	if metrics == nil {
+		http.Error(w, "the first scan is not complete yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Write(metrics) //nolint:errcheck
+}
@@ -0,0 +1,221 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// Group of the policies whose names don't follow any naming convention.
+const uncategorized = "uncategorized"
+
+// policyNaming are the naming conventions of the policies, e.g.
+// "scp-<category>-<nn>", compiled by compileNamingConventions.
+type policyNaming []*regexp.Regexp
+
+// newPoliciesLintNamesCmd creates the aws policies lint-names command.
+func newPoliciesLintNamesCmd(deps *dependencies) *cobra.Command {
+	policiesLintNamesCmd := &cobra.Command{
+		Use:   "lint-names",
+		Short: "Groups the SCPs by category and lists the ones violating the naming conventions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lintPolicyNames(cmd.Context(), deps)
+		},
+	}
+
+	return policiesLintNamesCmd
+}
+
+// Compiles the naming conventions into regular expressions. Placeholders are
+// enclosed in angle brackets: <category> (mandatory) captures the category of the
+// policy, placeholders made of n's (<nn>, <nnn>) match that many digits and any
+// other placeholder matches a run of letters and digits. The rest is matched literally.
+func compileNamingConventions(conventions []string) (policyNaming, error) {
+	placeholder := regexp.MustCompile(`<([a-zA-Z]+)>`)
+
+	var naming policyNaming
+	for _, convention := range conventions {
+		if !strings.Contains(convention, "<category>") {
+			return nil, fmt.Errorf("invalid naming convention %q: the <category> placeholder is missing", convention)
+		}
+
+		var expr strings.Builder
+		expr.WriteString("^")
+		last := 0
+		for _, match := range placeholder.FindAllStringSubmatchIndex(convention, -1) {
+			expr.WriteString(regexp.QuoteMeta(convention[last:match[0]]))
+			switch name := convention[match[2]:match[3]]; {
+			case name == "category":
+				expr.WriteString(`(?P<category>[a-zA-Z0-9]+)`)
+			case strings.Trim(name, "n") == "":
+				expr.WriteString(fmt.Sprintf(`[0-9]{%d}`, len(name)))
+			default:
+				expr.WriteString(`[a-zA-Z0-9]+`)
+			}
+			last = match[1]
+		}
+		expr.WriteString(regexp.QuoteMeta(convention[last:]))
+		expr.WriteString("$")
+
+		pattern, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid naming convention %q: %w", convention, err)
+		}
+		naming = append(naming, pattern)
+	}
+	return naming, nil
+}
+
+// Returns the category of a policy according to the first naming convention its
+// name follows. ok is false when the name doesn't follow any of them.
+func (n policyNaming) category(name string) (category string, ok bool) {
+	for _, pattern := range n {
+		if match := pattern.FindStringSubmatch(name); match != nil {
+			return strings.ToLower(match[pattern.SubexpIndex("category")]), true
+		}
+	}
+	return "", false
+}
+
+// Groups policies by category, in natural order. Policies not following the naming
+// conventions are grouped as uncategorized, which always comes last.
+func (n policyNaming) group(policies []orgtree.Policy) ([]string, map[string][]orgtree.Policy) {
+	groups := map[string][]orgtree.Policy{}
+	for _, policy := range policies {
+		category, ok := n.category(policy.Name)
+		if !ok {
+			category = uncategorized
+		}
+		groups[category] = append(groups[category], policy)
+	}
+
+	categories := make([]string, 0, len(groups))
+	for category, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool { return naturalLess(group[i].Name, group[j].Name) })
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i] == uncategorized || categories[j] == uncategorized {
+			return categories[j] == uncategorized && categories[i] != uncategorized
+		}
+		return naturalLess(categories[i], categories[j])
+	})
+	return categories, groups
+}
+
+// Returns a copy of policies with the category of each one of them.
+func (n policyNaming) withCategories(policies []orgtree.Policy) []orgtree.Policy {
+	categorized := make([]orgtree.Policy, 0, len(policies))
+	for _, policy := range policies {
+		if category, ok := n.category(policy.Name); ok {
+			policy.Category = category
+		} else {
+			policy.Category = uncategorized
+		}
+		categorized = append(categorized, policy)
+	}
+	return categorized
+}
+
+// Compares two strings treating runs of digits as numbers, so scp-net-2 sorts
+// before scp-net-10.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		chunkA, restA := nextChunk(a)
+		chunkB, restB := nextChunk(b)
+		if chunkA != chunkB {
+			if isDigit(chunkA[0]) && isDigit(chunkB[0]) {
+				numA, numB := strings.TrimLeft(chunkA, "0"), strings.TrimLeft(chunkB, "0")
+				if len(numA) != len(numB) {
+					return len(numA) < len(numB)
+				}
+				if numA != numB {
+					return numA < numB
+				}
+			} else {
+				return chunkA < chunkB
+			}
+		}
+		a, b = restA, restB
+	}
+	return len(a) < len(b)
+}
+
+// Splits the leading run of digits (or non-digits) of a non empty string.
+func nextChunk(s string) (chunk, rest string) {
+	i := 1
+	for i < len(s) && isDigit(s[i]) == isDigit(s[0]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lintPolicyNames displays the customer managed SCPs of the organization grouped
+// by category, followed by the ones whose names violate the naming conventions.
+// AWS managed policies can't be renamed, so they are left out.
+func lintPolicyNames(ctx context.Context, deps *dependencies) error {
+	conventions := deps.options.namingConventions
+	if len(conventions) == 0 {
+		return fmt.Errorf("at least one --naming-convention is required")
+	}
+	naming, err := compileNamingConventions(conventions)
+	if err != nil {
+		return err
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	summaries, err := listOrganizationPolicies(ctx, client, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	var compliant, violations []orgtree.Policy
+	for _, summary := range summaries {
+		if summary.AwsManaged {
+			continue
+		}
+		policy := orgtree.Policy{ID: *summary.Id, Name: *summary.Name, ARN: *summary.Arn}
+		if _, ok := naming.category(policy.Name); ok {
+			compliant = append(compliant, policy)
+		} else {
+			violations = append(violations, policy)
+		}
+	}
+
+	fmt.Fprintf(deps.report, "Naming conventions: %s\n", strings.Join(conventions, ", "))
+	categories, groups := naming.group(compliant)
+	for _, category := range categories {
+		fmt.Fprintf(deps.report, "|-- Category: %s\n", category)
+		for _, policy := range groups[category] {
+			fmt.Fprintf(deps.report, "%s|-- %s [%s]\n", indent, policy.Name, policy.ID)
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool { return naturalLess(violations[i].Name, violations[j].Name) })
+	fmt.Fprintln(deps.report, "|-- Violations:")
+	for _, policy := range violations {
+		fmt.Fprintf(deps.report, "%s|-- %s [%s]\n", indent, policy.Name, policy.ID)
+	}
+	fmt.Fprintf(deps.report, "%d of %d customer managed SCPs violate the naming conventions\n", len(violations), len(compliant)+len(violations))
+
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// The test org with SCPs following the scp-<category>-<nn> naming convention,
+// along with a few that don't.
+func newNamingOrg() *awsorgtest.Org {
+	return newTestOrg().
+		AddPolicy("p-net10", "scp-net-10", types.PolicyTypeServiceControlPolicy, denyLeaveDocument).
+		AddPolicy("p-net2", "scp-net-02", types.PolicyTypeServiceControlPolicy, denyLeaveDocument).
+		AddPolicy("p-iam1", "SCP-IAM-01", types.PolicyTypeServiceControlPolicy, denyLeaveDocument).
+		AddPolicy("p-iam", "scp-iam-1", types.PolicyTypeServiceControlPolicy, denyLeaveDocument).
+		AttachPolicy("ou-root-work", "p-net10").
+		AttachPolicy("ou-root-work", "p-iam1")
+}
+
+func TestLintNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		org     *awsorgtest.Org
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "grouped by category",
+			org:  newNamingOrg(),
+			args: []string{"--naming-convention", "scp-<category>-<nn>", "--naming-convention", "SCP-<category>-<nn>"},
+			want: "Naming conventions: scp-<category>-<nn>, SCP-<category>-<nn>\n" +
+				"|-- Category: iam\n" + indent + "|-- SCP-IAM-01 [p-iam1]\n" +
+				"|-- Category: net\n" + indent + "|-- scp-net-02 [p-net2]\n" + indent + "|-- scp-net-10 [p-net10]\n" +
+				"|-- Violations:\n" + indent + "|-- FullAWSAccess [p-FullAWSAccess]\n" + indent + "|-- deny-leave [p-denyleave]\n" + indent + "|-- scp-iam-1 [p-iam]\n" +
+				"3 of 6 customer managed SCPs violate the naming conventions\n",
+		},
+		{
+			name: "placeholders",
+			org:  newNamingOrg(),
+			args: []string{"--naming-convention", "<team>-<category>-<n>"},
+			want: "Naming conventions: <team>-<category>-<n>\n" +
+				"|-- Category: iam\n" + indent + "|-- scp-iam-1 [p-iam]\n" +
+				"|-- Violations:\n" + indent + "|-- FullAWSAccess [p-FullAWSAccess]\n" + indent + "|-- SCP-IAM-01 [p-iam1]\n" +
+				indent + "|-- deny-leave [p-denyleave]\n" + indent + "|-- scp-net-02 [p-net2]\n" + indent + "|-- scp-net-10 [p-net10]\n" +
+				"5 of 6 customer managed SCPs violate the naming conventions\n",
+		},
+		{
+			name: "empty organization",
+			org:  awsorgtest.New("o-example", "r-root", "111111111111"),
+			args: []string{"--naming-convention", "scp-<category>-<nn>"},
+			want: "Naming conventions: scp-<category>-<nn>\n|-- Violations:\n0 of 0 customer managed SCPs violate the naming conventions\n",
+		},
+		{
+			name:    "no convention",
+			org:     newNamingOrg(),
+			wantErr: "at least one --naming-convention is required",
+		},
+		{
+			name:    "no category",
+			org:     newNamingOrg(),
+			args:    []string{"--naming-convention", "scp-<nn>"},
+			wantErr: `invalid naming convention "scp-<nn>": the <category> placeholder is missing`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, tt.org, append([]string{"aws", "policies", "lint-names"}, tt.args...)...)
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("lint-names: %v", err)
+			case got != tt.want:
+				t.Errorf("lint-names wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamingGroupsTheTree(t *testing.T) {
+	got, err := runCommand(t, newNamingOrg(), "aws", "account", "222222222222", "--naming-convention", "scp-<category>-<nn>")
+	if err != nil {
+		t.Fatalf("account: %v", err)
+	}
+	want := "(SCPs: net: scp-net-10; uncategorized: FullAWSAccess, SCP-IAM-01, deny-leave)"
+	if !strings.Contains(got, want) {
+		t.Errorf("account wrote:\n%s\nwant it to contain %s", got, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	names := []string{"scp-net-10", "scp-iam", "scp-net-2", "scp-net-02b", "scp-net-002", "scp-net-1", "scp-iam-1", "scp-net"}
+	sort.SliceStable(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+	want := []string{"scp-iam", "scp-iam-1", "scp-net", "scp-net-1", "scp-net-2", "scp-net-002", "scp-net-02b", "scp-net-10"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("sorted names = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/spf13/cobra"
+)
+
+// Destinations of --notify.
+const (
+	notifySlack     = "slack" // the Slack incoming webhook of --webhook-url
+	notifySNSScheme = "sns:"  // an SNS topic, e.g. sns:arn:aws:sns:us-east-1:111111111111:drift
+)
+
+// Annotation of the commands detecting drift, which can notify it. The commands
+// reporting findings can notify them too.
+const driftAnnotation = "drift"
+
+// Details listed in a notification, the report has all of them.
+const (
+	maxNotifiedChanges  = 50
+	maxNotifiedFindings = 10
+)
+
+// Checks the destinations of --notify apply to cmd. Called before running any
+// command, like validatePublishTargets.
+func validateNotifyTargets(cmd *cobra.Command, run *runOptions) error {
+	for _, target := range run.notifyTargets {
+		if cmd.Annotations[driftAnnotation] == "" && cmd.Annotations[findingsAnnotation] == "" {
+			return fmt.Errorf(`--notify %s only applies to the commands detecting drift or reporting findings: "aws snapshot diff", "aws snapshot watch", "gcp snapshot diff", "aws lint", "aws unrestricted", "aws conform", "aws check" and "aws audit"`, target)
+		}
+		switch {
+		case target == notifySlack:
+			if run.webhookURL == "" {
+				return errors.New("--notify slack posts to a Slack incoming webhook, set it with --webhook-url")
+			}
+		case strings.HasPrefix(target, notifySNSScheme):
+			if _, err := parseSNSTopic(target); err != nil {
+				return err
+			}
+			if run.demo || run.snapshotFile != "" {
+				return fmt.Errorf("--notify %s publishes with the local AWS config, it can't be used with --demo or --from-snapshot", target)
+			}
+		default:
+			return fmt.Errorf(`invalid notify destination %q: valid destinations are "slack" and sns:<topic ARN>`, target)
+		}
+	}
+
+	if run.webhookURL == "" {
+		return nil
+	}
+	if !slices.Contains(run.notifyTargets, notifySlack) {
+		return errors.New("--webhook-url is where --notify slack posts, but slack was not given to --notify")
+	}
+	if !strings.HasPrefix(run.webhookURL, "https://hooks.slack.com/") {
+		return fmt.Errorf("invalid webhook URL %q: expected a Slack incoming webhook, https://hooks.slack.com/...", run.webhookURL)
+	}
+	return nil
+}
+
+// Parses the topic of a sns:<topic ARN> destination.
+func parseSNSTopic(target string) (arn.ARN, error) {
+	topic, err := arn.Parse(strings.TrimPrefix(target, notifySNSScheme))
+	if err != nil || topic.Service != "sns" {
+		return arn.ARN{}, fmt.Errorf("invalid notify destination %q: expected sns:arn:aws:sns:<region>:<account>:<topic>", target)
+	}
+	return topic, nil
+}
+
+// snsAPI is the part of the SNS API used by the commands.
+type snsAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// Creates the SNS client of the local AWS config, in the region of the topic.
+func (d *dependencies) newSNSClient(ctx context.Context, region string) (snsAPI, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sns.NewFromConfig(cfg, func(o *sns.Options) { o.Region = region }), nil
+}
+
+// The changes of a kind between two states of an organization, e.g. the
+// accounts moved.
+type driftSection struct {
+	title   string
+	changes []string
+}
+
+// The drift between two states of an organization, as reported by aws snapshot
+// diff.
+type driftReport struct {
+	organizationID string
+	from, to       string // labels of both states, e.g. "the live organization"
+	sections       []driftSection
+}
+
+func (r driftReport) total() int {
+	total := 0
+	for _, section := range r.sections {
+		total += len(section.changes)
+	}
+	return total
+}
+
+// A summary sent to the --notify destinations: a headline and the counts of
+// what was found, followed by the details.
+type notification struct {
+	organizationID string
+	subject        string   // e.g. "policy-scout: 2 changes in o-exampleorgid"
+	headline       string   // e.g. "Drift of o-exampleorgid from last-audit.json to the live organization: 2 changes"
+	counts         []string // e.g. "Accounts moved: 1"
+	details        []notificationSection
+	unit           string // what is counted, "changes" or "findings"
+	total          int
+	omitted        int // details left out of the notification, the report has them
+}
+
+type notificationSection struct {
+	title string
+	lines []string
+}
+
+// Sends a summary of the drift to every --notify destination. Nothing is sent
+// when there is no drift.
+func notifyDrift(ctx context.Context, deps *dependencies, report driftReport) error {
+	if len(deps.options.notifyTargets) == 0 || report.total() == 0 {
+		return nil
+	}
+
+	n := notification{
+		organizationID: report.organizationID,
+		subject:        fmt.Sprintf("policy-scout: %s changes in %s", formatCount(report.total()), report.organizationID),
+		headline:       fmt.Sprintf("Drift of %s from %s to %s: %s changes", report.organizationID, report.from, report.to, formatCount(report.total())),
+		unit:           "changes",
+		total:          report.total(),
+	}
+	listed := 0
+	for _, section := range report.sections {
+		if len(section.changes) == 0 {
+			continue
+		}
+		n.counts = append(n.counts, fmt.Sprintf("%s: %s", section.title, formatCount(len(section.changes))))
+		if shown := min(len(section.changes), maxNotifiedChanges-listed); shown > 0 {
+			n.details = append(n.details, notificationSection{title: section.title, lines: section.changes[:shown]})
+			listed += shown
+		}
+	}
+	n.omitted = n.total - listed
+	return sendNotification(ctx, deps, n)
+}
+
+// Sends a summary of the findings of a command to every --notify destination,
+// the most severe first. Nothing is sent when there are no findings.
+func notifyFindings(ctx context.Context, deps *dependencies, command string, findings []auditFinding) error {
+	if len(deps.options.notifyTargets) == 0 || len(findings) == 0 {
+		return nil
+	}
+
+	orgID, err := currentOrganizationID(ctx, deps)
+	if err != nil {
+		return err
+	}
+
+	n := notification{
+		organizationID: orgID,
+		subject:        fmt.Sprintf("policy-scout: %s findings of %s in %s", formatCount(len(findings)), command, orgID),
+		headline:       fmt.Sprintf("%s found %s findings in %s", command, formatCount(len(findings)), orgID),
+		counts:         []string{formatSeverityCounts(findings)},
+		unit:           "findings",
+		total:          len(findings),
+	}
+	important := notificationSection{title: "Most important findings"}
+	for _, finding := range sortBySeverity(findings)[:min(len(findings), maxNotifiedFindings)] {
+		important.lines = append(important.lines, fmt.Sprintf("%s %s", finding.severity, finding.title))
+	}
+	n.details = []notificationSection{important}
+	n.omitted = n.total - len(important.lines)
+	return sendNotification(ctx, deps, n)
+}
+
+// Sends a notification to every --notify destination.
+func sendNotification(ctx context.Context, deps *dependencies, n notification) error {
+	for _, target := range deps.options.notifyTargets {
+		if target == notifySlack {
+			if err := postSlackMessage(ctx, deps.httpClient, deps.options.webhookURL, slackMessage{Text: n.slackText()}); err != nil {
+				return fmt.Errorf("error notifying Slack: %w", err)
+			}
+			fmt.Fprintln(deps.stderr, "Notification posted to Slack")
+			continue
+		}
+
+		topic, err := parseSNSTopic(target)
+		if err != nil {
+			return err
+		}
+		client, err := deps.snsClient(ctx, topic.Region)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(topic.String()),
+			Subject:  aws.String(n.subject),
+			Message:  aws.String(n.text()),
+			// Lets the subscriptions filter the notifications
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{
+				"organizationId": {DataType: aws.String("String"), StringValue: aws.String(n.organizationID)},
+				n.unit:           {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(n.total))},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error notifying %s: %w", topic, err)
+		}
+		fmt.Fprintf(deps.stderr, "Notification published to %s\n", topic)
+	}
+	return nil
+}
+
+// Formats the notification as plain text, for SNS.
+func (n notification) text() string {
+	var message strings.Builder
+	fmt.Fprintln(&message, n.headline)
+	for _, count := range n.counts {
+		fmt.Fprintf(&message, "|-- %s\n", count)
+	}
+	for _, section := range n.details {
+		fmt.Fprintf(&message, "\n%s:\n", section.title)
+		for _, line := range section.lines {
+			fmt.Fprintf(&message, "%s|-- %s\n", indent, line)
+		}
+	}
+	if n.omitted > 0 {
+		fmt.Fprintf(&message, "\n%s more %s in the report\n", formatCount(n.omitted), n.unit)
+	}
+	return message.String()
+}
+
+// Formats the notification as Slack mrkdwn, the details as code blocks.
+func (n notification) slackText() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "*%s*\n", slackEscape(n.headline))
+	for _, count := range n.counts {
+		fmt.Fprintf(&message, "• %s\n", slackEscape(count))
+	}
+	for _, section := range n.details {
+		fmt.Fprintf(&message, "*%s*\n```\n%s\n```\n", slackEscape(section.title), slackEscape(strings.Join(section.lines, "\n")))
+	}
+	if n.omitted > 0 {
+		fmt.Fprintf(&message, "_%s more %s in the report_\n", formatCount(n.omitted), n.unit)
+	}
+	return message.String()
+}
+
+// Escapes the characters Slack reserves for links and mentions.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
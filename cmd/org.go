@@ -0,0 +1,212 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/spf13/cobra"
+)
+
+// orgCompareOptions are the flags of the org compare command.
+type orgCompareOptions struct {
+	snapshotA string // first org structure, as exported by "aws tree -o json"
+	snapshotB string // second org structure
+}
+
+// newOrgCmd creates the group of commands that work on previously exported org structures.
+func newOrgCmd(deps *dependencies) *cobra.Command {
+	orgCmd := &cobra.Command{
+		Use:   "org",
+		Short: "Work offline with exported organization structures",
+	}
+
+	orgCmd.AddCommand(newOrgCompareCmd(deps))
+
+	return orgCmd
+}
+
+// newOrgCompareCmd creates the org compare command.
+func newOrgCompareCmd(deps *dependencies) *cobra.Command {
+	options := &orgCompareOptions{}
+	orgCompareCmd := &cobra.Command{
+		Use:   "compare",
+		Short: "Compares the structure and guardrails of two organizations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return compareOrganizations(deps.report, options.snapshotA, options.snapshotB)
+		},
+	}
+
+	orgCompareCmd.Flags().StringVar(&options.snapshotA, "snapshot-a", "", `first organization, as exported by "aws tree -o json"`)
+	orgCompareCmd.MarkFlagRequired("snapshot-a") //nolint:gosec,errcheck
+	orgCompareCmd.Flags().StringVar(&options.snapshotB, "snapshot-b", "", `second organization, as exported by "aws tree -o json"`)
+	orgCompareCmd.MarkFlagRequired("snapshot-b") //nolint:gosec,errcheck
+
+	return orgCompareCmd
+}
+
+// Loads an org structure previously exported in the json output format.
+func loadOrgReport(path string) (*orgtree.Tree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &orgtree.Tree{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("invalid org snapshot %s: %w", path, err)
+	}
+	if report.Root == nil {
+		return nil, fmt.Errorf("invalid org snapshot %s: the org tree is missing", path)
+	}
+	return report, nil
+}
+
+// Indexes the OUs (and the root) of a tree by their path of names, e.g. "Root/Prod/Finance".
+func indexOUsByPath(node *orgtree.Node, parentPath string, index map[string]*orgtree.Node) {
+	if node.Type == orgtree.AccountNode {
+		return
+	}
+
+	path := node.Name
+	if parentPath != "" {
+		path = parentPath + "/" + node.Name
+	}
+	index[path] = node
+
+	for _, child := range node.Children {
+		indexOUsByPath(child, path, index)
+	}
+}
+
+// Collects the names of every policy applied anywhere in the tree.
+func collectPolicyNames(node *orgtree.Node, names map[string]bool) {
+	for _, policy := range node.SCPs {
+		names[policy.Name] = true
+	}
+	for _, child := range node.Children {
+		collectPolicyNames(child, names)
+	}
+}
+
+// Returns the sorted keys of a that are not in b.
+func onlyIn[T any](a, b map[string]T) []string {
+	var keys []string
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the last element of an OU path.
+func ouNameFromPath(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// compareOrganizations aligns the OUs of both organizations by path (or by name when
+// they were moved) and reports the structural and guardrail differences between them.
+func compareOrganizations(w io.Writer, pathA, pathB string) error {
+	orgA, err := loadOrgReport(pathA)
+	if err != nil {
+		return err
+	}
+	orgB, err := loadOrgReport(pathB)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Organization A: %s (%s)\n", orgA.OrganizationID, pathA)
+	fmt.Fprintf(w, "Organization B: %s (%s)\n", orgB.OrganizationID, pathB)
+
+	ousA, ousB := map[string]*orgtree.Node{}, map[string]*orgtree.Node{}
+	indexOUsByPath(orgA.Root, "", ousA)
+	indexOUsByPath(orgB.Root, "", ousB)
+
+	onlyA, onlyB := onlyIn(ousA, ousB), onlyIn(ousB, ousA)
+
+	// OUs that only differ in their location are aligned by name, as long as the name is unambiguous
+	namesB := map[string][]string{}
+	for _, path := range onlyB {
+		namesB[ouNameFromPath(path)] = append(namesB[ouNameFromPath(path)], path)
+	}
+	moved := map[string]string{} // path in A -> path in B
+	for _, path := range onlyA {
+		if candidates := namesB[ouNameFromPath(path)]; len(candidates) == 1 {
+			moved[path] = candidates[0]
+		}
+	}
+	movedB := map[string]bool{}
+	for _, pathB := range moved {
+		movedB[pathB] = true
+	}
+
+	fmt.Fprintln(w, "OUs only in A:")
+	for _, path := range onlyA {
+		if _, ok := moved[path]; !ok {
+			fmt.Fprintf(w, "%s|-- %s\n", indent, path)
+		}
+	}
+	fmt.Fprintln(w, "OUs only in B:")
+	for _, path := range onlyB {
+		if !movedB[path] {
+			fmt.Fprintf(w, "%s|-- %s\n", indent, path)
+		}
+	}
+	fmt.Fprintln(w, "OUs in a different location (matched by name):")
+	for _, path := range onlyA {
+		if pathB, ok := moved[path]; ok {
+			fmt.Fprintf(w, "%s|-- %s (A) -> %s (B)\n", indent, path, pathB)
+		}
+	}
+
+	// Guardrail coverage of every aligned OU
+	pairs := map[string]string{}
+	for path := range ousA {
+		if _, ok := ousB[path]; ok {
+			pairs[path] = path
+		}
+	}
+	for pathA, pathB := range moved {
+		pairs[pathA] = pathB
+	}
+	aligned := make([]string, 0, len(pairs))
+	for path := range pairs {
+		aligned = append(aligned, path)
+	}
+	sort.Strings(aligned)
+
+	fmt.Fprintln(w, "Guardrail differences in matching OUs:")
+	for _, path := range aligned {
+		missing, extra := diffPolicyNames(policyNames(ousA[path].SCPs), policyNames(ousB[pairs[path]].SCPs))
+		if len(missing) == 0 && len(extra) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s|-- %s\n", indent, path)
+		if len(missing) > 0 {
+			fmt.Fprintf(w, "%s%s|-- SCPs only in A: %s\n", indent, indent, strings.Join(missing, ", "))
+		}
+		if len(extra) > 0 {
+			fmt.Fprintf(w, "%s%s|-- SCPs only in B: %s\n", indent, indent, strings.Join(extra, ", "))
+		}
+	}
+
+	policiesA, policiesB := map[string]bool{}, map[string]bool{}
+	collectPolicyNames(orgA.Root, policiesA)
+	collectPolicyNames(orgB.Root, policiesB)
+	fmt.Fprintf(w, "Policies only in A: %s\n", strings.Join(onlyIn(policiesA, policiesB), ", "))
+	fmt.Fprintf(w, "Policies only in B: %s\n", strings.Join(onlyIn(policiesB, policiesA), ", "))
+
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/ariguillegp/policy-scout/pkg/awsorg"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+)
+
+// orgOperations is the part of the Organizations API used by the commands. The
+// traversals take it instead of *organizations.Client, so they can run
+// against a fake organization (see awsorgtest).
+type orgOperations interface {
+	awsorg.API
+	organizations.ListAWSServiceAccessForOrganizationAPIClient
+	organizations.ListDelegatedAdministratorsAPIClient
+	organizations.ListDelegatedServicesForAccountAPIClient
+	organizations.ListPoliciesAPIClient
+	organizations.ListTagsForResourceAPIClient
+	organizations.ListTargetsForPolicyAPIClient
+
+	DescribeEffectivePolicy(ctx context.Context, params *organizations.DescribeEffectivePolicyInput, optFns ...func(*organizations.Options)) (*organizations.DescribeEffectivePolicyOutput, error)
+	DescribePolicy(ctx context.Context, params *organizations.DescribePolicyInput, optFns ...func(*organizations.Options)) (*organizations.DescribePolicyOutput, error)
+}
+
+// orgAPI is the client of the analyzed organization: its operations, along
+// with the Scout walking the organization and resolving its policies with them.
+type orgAPI interface {
+	orgOperations
+	scout() *awsorg.Scout
+	options() *runOptions
+}
+
+// scanClient is the orgAPI of the commands, see newScanClient.
+type scanClient struct {
+	orgOperations
+	organization *awsorg.Scout
+	run          *runOptions
+}
+
+func (c *scanClient) scout() *awsorg.Scout {
+	return c.organization
+}
+
+// The options of the run, deciding what is left out and what is added to
+// every node.
+func (c *scanClient) options() *runOptions {
+	return c.run
+}
+
+// Wraps the client of an organization with its Scout. The Scout keeps the API
+// results in the cache of the run, leaves out the accounts and OUs excluded
+// with flags, and adds the details requested with flags to every node.
+func (d *dependencies) newScanClient(client orgOperations) *scanClient {
+	c := &scanClient{orgOperations: client, organization: awsorg.New(client), run: &d.options}
+	c.organization.Cache = d.cache
+	c.organization.Exclude = func(ctx context.Context, id string) (bool, error) {
+		return isExcluded(ctx, c, id)
+	}
+	c.organization.Decorate = func(ctx context.Context, node *orgtree.Node) error {
+		d.progress.entities.Add(1)
+		return decorateNode(ctx, c, node)
+	}
+	return c
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newAwsOrgCmd creates the group of commands describing the organization itself.
+func newAwsOrgCmd(deps *dependencies) *cobra.Command {
+	awsOrgCmd := &cobra.Command{
+		Use:   "org",
+		Short: "Describes the organization itself",
+	}
+
+	awsOrgCmd.AddCommand(newOrgInfoCmd(deps))
+
+	return awsOrgCmd
+}
+
+// newOrgInfoCmd creates the aws org info command.
+func newOrgInfoCmd(deps *dependencies) *cobra.Command {
+	orgInfoCmd := &cobra.Command{
+		Use:   "info",
+		Short: "Summarizes the posture of the org: feature set, enabled policy types, trusted access and management account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayOrganizationInfo(cmd.Context(), deps)
+		},
+	}
+
+	return orgInfoCmd
+}
+
+// displayOrganizationInfo prints a one-screen summary of the organization.
+func displayOrganizationInfo(ctx context.Context, deps *dependencies) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return err
+	}
+	managementName, err := client.scout().Name(ctx, *org.MasterAccountId)
+	if err != nil {
+		return fmt.Errorf("error getting name for id %s: %w", *org.MasterAccountId, err)
+	}
+
+	roots, err := client.ListRoots(ctx, &organizations.ListRootsInput{})
+	if err != nil {
+		return err
+	}
+	if len(roots.Roots) == 0 {
+		return fmt.Errorf("no roots found in the organization")
+	}
+	root := roots.Roots[0]
+
+	accounts, err := client.scout().Accounts(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing accounts: %w", err)
+	}
+
+	fmt.Fprintf(deps.report, "Organization: %s (%s)\n", *org.Id, *org.Arn)
+	fmt.Fprintf(deps.report, "|-- Feature set: %s\n", org.FeatureSet)
+	fmt.Fprintf(deps.report, "|-- Management account: %s [%s] (%s)\n", managementName, *org.MasterAccountId, aws.ToString(org.MasterAccountEmail))
+	fmt.Fprintf(deps.report, "|-- Root: [%s]\n", *root.Id)
+	fmt.Fprintf(deps.report, "|-- Accounts: %s\n", formatAccountStatuses(accounts))
+
+	// Policies (and trusted access) are only available with all features
+	if org.FeatureSet != types.OrganizationFeatureSetAll {
+		fmt.Fprintf(deps.report, "|-- Policy types: unavailable, they require the ALL feature set\n")
+		return nil
+	}
+
+	statuses := map[types.PolicyType]types.PolicyTypeStatus{}
+	for _, policyType := range root.PolicyTypes {
+		statuses[policyType.Type] = policyType.Status
+	}
+	fmt.Fprintln(deps.report, "|-- Policy types (status on the root):")
+	for _, policyType := range allPolicyTypes {
+		status, ok := statuses[policyType]
+		if !ok {
+			status = "NOT_ENABLED"
+		}
+		fmt.Fprintf(deps.report, "%s|-- %s: %s\n", indent, policyType, status)
+	}
+
+	services, err := listTrustedServices(ctx, client)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(deps.report, "|-- Trusted access:")
+	if len(services) == 0 {
+		fmt.Fprintf(deps.report, "%s(none)\n", indent)
+	}
+	for _, service := range services {
+		fmt.Fprintf(deps.report, "%s|-- %s\n", indent, service)
+	}
+
+	admins, err := listDelegatedAdministrators(ctx, client)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(deps.report, "|-- Delegated administrators: %s (see \"aws delegated-admins\")\n", formatCount(len(admins)))
+
+	return nil
+}
+
+// Counts the accounts by status, e.g. "9 (8 ACTIVE, 1 SUSPENDED)".
+func formatAccountStatuses(accounts []types.Account) string {
+	counts := map[string]int{}
+	for _, account := range accounts {
+		counts[string(account.Status)]++
+	}
+
+	statuses := make([]string, 0, len(counts))
+	for _, status := range sortedKeys(counts) {
+		statuses = append(statuses, fmt.Sprintf("%s %s", formatCount(counts[status]), status))
+	}
+	return fmt.Sprintf("%s (%s)", formatCount(len(accounts)), strings.Join(statuses, ", "))
+}
+
+// Lists the service principals with trusted access to the org, sorted.
+func listTrustedServices(ctx context.Context, client orgAPI) ([]string, error) {
+	var services []string
+	paginator := organizations.NewListAWSServiceAccessForOrganizationPaginator(client, &organizations.ListAWSServiceAccessForOrganizationInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing trusted access services: %w", err)
+		}
+		for _, service := range page.EnabledServicePrincipals {
+			services = append(services, *service.ServicePrincipal)
+		}
+	}
+
+	sort.Strings(services)
+	return services, nil
+}
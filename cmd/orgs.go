@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newOrgsCmd creates the aws orgs command.
+func newOrgsCmd(deps *dependencies) *cobra.Command {
+	format := textFormat
+	orgsCmd := &cobra.Command{
+		Use:   "orgs",
+		Short: "Scans every organization of the config file and merges the results in a single report",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := displayOrganizations(cmd.Context(), deps, deps.options.organizations, format)
+			return finishPartialResults(cmd, deps, err)
+		},
+	}
+
+	orgsCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json"`)
+
+	return orgsCmd
+}
+
+// The report of every organization, keyed by organization ID.
+type multiOrgReport struct {
+	Organizations map[string]*multiOrgEntry `json:"organizations"`
+}
+
+type multiOrgEntry struct {
+	Name       string        `json:"name"` // as given in the config file, the display name of GCP organizations
+	Tree       *orgtree.Node `json:"tree,omitempty"`
+	Standalone bool          `json:"standalone,omitempty"` // the credentials belong to an account outside of any organization, keyed by its ID
+	Caller     string        `json:"caller,omitempty"`     // ARN of the credentials of a standalone account
+}
+
+// Loads the AWS config used to reach one of the configured organizations.
+func (d *dependencies) loadOrgSourceConfig(ctx context.Context, org orgSource) (aws.Config, error) {
+	cfg := offlineAWSConfig()
+	if org.Snapshot == "" {
+		var options []func(*config.LoadOptions) error
+		if org.Profile != "" {
+			options = append(options, config.WithSharedConfigProfile(org.Profile))
+		}
+		var err error
+		if cfg, err = config.LoadDefaultConfig(ctx, options...); err != nil {
+			return aws.Config{}, err
+		}
+		if org.RoleARN != "" {
+			assumeRole(&cfg, org.RoleARN, org.ExternalID)
+		}
+	}
+
+	cfg.APIOptions = append(cfg.APIOptions, d.progress.middleware, loggingMiddleware(d.logger, d.now))
+	if d.options.profileScan {
+		cfg.APIOptions = append(cfg.APIOptions, d.profile.middleware)
+	}
+	return cfg, nil
+}
+
+// displayOrganizations scans the whole tree of every configured organization and
+// merges them in a single report, keyed by organization ID. Exclusions apply to
+// every organization.
+func displayOrganizations(ctx context.Context, deps *dependencies, orgs []orgSource, format outputFormat) error {
+	if len(orgs) == 0 {
+		return errors.New(`no organizations configured, list them in the "organizations" section of the config file`)
+	}
+	if deps.options.demo || deps.options.snapshotFile != "" {
+		return errors.New(`"aws orgs" reads the organizations of the config file, it can't be used with --demo or --from-snapshot`)
+	}
+	if format != textFormat && format != jsonFormat {
+		return fmt.Errorf(`the %q output format is not available for "aws orgs", use "text" or "json"`, format)
+	}
+
+	// An organization that can't be read doesn't prevent reporting the others,
+	// the command then ends with partial results
+	report := multiOrgReport{Organizations: map[string]*multiOrgEntry{}}
+	var failed partialResultsError
+	for _, source := range orgs {
+		err := scanOrganization(ctx, deps, source, format, &report)
+		var duplicate duplicateOrganizationError
+		if errors.As(err, &duplicate) {
+			return err
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("organization %s: %w", source.Name, err))
+		}
+	}
+	if len(failed) == len(orgs) {
+		return failed[0]
+	}
+
+	if format != textFormat {
+		encoder := json.NewEncoder(deps.report)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Scans the whole tree of a configured organization and adds it to the report.
+// The text output is written right away.
+func scanOrganization(ctx context.Context, deps *dependencies, source orgSource, format outputFormat, report *multiOrgReport) error {
+	operations, err := deps.orgSource(ctx, source)
+	if err != nil {
+		return err
+	}
+	client := deps.newScanClient(operations)
+
+	org, err := client.scout().Organization(ctx)
+	var notInUse *types.AWSOrganizationsNotInUseException
+	if errors.As(err, &notInUse) {
+		return addStandaloneAccount(ctx, deps, source, format, report)
+	}
+	if err != nil {
+		return err
+	}
+	if existing, ok := report.Organizations[*org.Id]; ok {
+		return duplicateOrganizationError(fmt.Sprintf("organizations %s and %s are the same organization (%s)", existing.Name, source.Name, *org.Id))
+	}
+
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+
+	if format == textFormat {
+		fmt.Fprintf(deps.report, "Organization: %s (%s)\n", *org.Id, source.Name)
+		if err := writeTextTree(ctx, deps.report, client, "all", rootID); err != nil {
+			return err
+		}
+		report.Organizations[*org.Id] = &multiOrgEntry{Name: source.Name}
+		return nil
+	}
+
+	tree, err := buildOrgTree(ctx, client, "all", rootID)
+	if err != nil {
+		return err
+	}
+	if err := propagateTags(ctx, client, tree, nil); err != nil {
+		return err
+	}
+	report.Organizations[*org.Id] = &multiOrgEntry{Name: source.Name, Tree: tree}
+	return nil
+}
+
+// Adds the account of a profile that isn't a member of any organization to the
+// report, in place of its tree, like the degraded report of the other commands.
+func addStandaloneAccount(ctx context.Context, deps *dependencies, source orgSource, format outputFormat, report *multiOrgReport) error {
+	caller, err := deps.orgCaller(ctx, source)
+	if err != nil {
+		return err
+	}
+	if existing, ok := report.Organizations[caller.AccountID]; ok {
+		return duplicateOrganizationError(fmt.Sprintf("organizations %s and %s are the same standalone account (%s)", existing.Name, source.Name, caller.AccountID))
+	}
+
+	if format == textFormat {
+		fmt.Fprintf(deps.report, "Standalone account: %s (%s) is not a member of an AWS Organization\n", caller.AccountID, source.Name)
+		fmt.Fprintf(deps.report, "|-- Caller: %s\n", caller.ARN)
+	}
+	report.Organizations[caller.AccountID] = &multiOrgEntry{Name: source.Name, Standalone: true, Caller: caller.ARN}
+	return nil
+}
+
+// Returned when two entries of the config file point to the same organization,
+// a mistake in the config file rather than in one of the organizations.
+type duplicateOrganizationError string
+
+func (e duplicateOrganizationError) Error() string { return string(e) }
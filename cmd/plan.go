@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// Version of the plan format, bumped on incompatible changes.
+const attachPlanVersion = 1
+
+// The AttachPolicy operations needed to make the deviating accounts conform to
+// the baseline, meant to be applied by external automation.
+type attachPlan struct {
+	Version    int                    `json:"version"`
+	Baseline   string                 `json:"baseline"`
+	Operations []attachOperation      `json:"operations"`
+	Unresolved []unresolvedAttachment `json:"unresolved,omitempty"` // needing a human decision
+}
+
+// An AttachPolicy call, named after its Organizations API parameters.
+type attachOperation struct {
+	Operation  string           `json:"operation"` // always "AttachPolicy"
+	PolicyID   string           `json:"policyId"`
+	PolicyName string           `json:"policyName"`
+	PolicyType types.PolicyType `json:"policyType"`
+	TargetID   string           `json:"targetId"`
+	TargetName string           `json:"targetName"`
+}
+
+// A missing policy that can't be attached automatically, e.g. because its name
+// matches several policies (names are not unique) or none at all.
+type unresolvedAttachment struct {
+	PolicyName string           `json:"policyName"`
+	PolicyType types.PolicyType `json:"policyType"`
+	TargetID   string           `json:"targetId"`
+	Reason     string           `json:"reason"`
+}
+
+// Policies of the organization by type and name, used to resolve the baseline names.
+type policyIndex map[types.PolicyType]map[string][]types.PolicySummary
+
+func newAttachPlan(baseline string) *attachPlan {
+	return &attachPlan{Version: attachPlanVersion, Baseline: baseline, Operations: []attachOperation{}}
+}
+
+// Adds the operation attaching the policy named policyName to an account.
+func (p *attachPlan) attach(ctx context.Context, client orgAPI, index policyIndex, policyType types.PolicyType, policyName string, account *accountReport) error {
+	if _, ok := index[policyType]; !ok {
+		summaries, err := listOrganizationPolicies(ctx, client, policyType)
+		if err != nil {
+			return err
+		}
+		index[policyType] = map[string][]types.PolicySummary{}
+		for _, summary := range summaries {
+			index[policyType][*summary.Name] = append(index[policyType][*summary.Name], summary)
+		}
+	}
+
+	switch matches := index[policyType][policyName]; len(matches) {
+	case 0:
+		p.Unresolved = append(p.Unresolved, unresolvedAttachment{PolicyName: policyName, PolicyType: policyType, TargetID: account.ID, Reason: "no policy with this name exists"})
+	case 1:
+		p.Operations = append(p.Operations, attachOperation{
+			Operation:  "AttachPolicy",
+			PolicyID:   *matches[0].Id,
+			PolicyName: policyName,
+			PolicyType: policyType,
+			TargetID:   account.ID,
+			TargetName: account.Name,
+		})
+	default:
+		p.Unresolved = append(p.Unresolved, unresolvedAttachment{PolicyName: policyName, PolicyType: policyType, TargetID: account.ID, Reason: fmt.Sprintf("%d policies share this name", len(matches))})
+	}
+	return nil
+}
+
+// Writes the plan as JSON to a sink URI (see --report-to).
+func (p *attachPlan) write(ctx context.Context, deps *dependencies, uri string) error {
+	out, err := openSink(uri, deps)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(p); err != nil {
+		return err
+	}
+	return out.Close(ctx)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newPoliciesCmd creates the group of commands that work on every policy of the organization.
+func newPoliciesCmd(deps *dependencies) *cobra.Command {
+	policiesCmd := &cobra.Command{
+		Use:   "policies",
+		Short: "Inspect every policy of the organization at once",
+	}
+
+	policiesCmd.AddCommand(newPoliciesUnusedCmd(deps))
+	policiesCmd.AddCommand(newPoliciesListCmd(deps))
+	policiesCmd.AddCommand(newPoliciesLintNamesCmd(deps))
+
+	return policiesCmd
+}
+
+// newPoliciesUnusedCmd creates the aws policies unused command.
+func newPoliciesUnusedCmd(deps *dependencies) *cobra.Command {
+	policiesUnusedCmd := &cobra.Command{
+		Use:   "unused",
+		Short: "Lists the SCPs that are not attached to any root, OU or account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listUnusedPolicies(cmd.Context(), deps)
+		},
+	}
+
+	return policiesUnusedCmd
+}
+
+// newPoliciesListCmd creates the aws policies list command.
+func newPoliciesListCmd(deps *dependencies) *cobra.Command {
+	format := textFormat // output format of the list
+	policiesListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists every policy of the organization, of every type, with its attachment count",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listAllPolicies(cmd.Context(), deps, format)
+		},
+	}
+
+	policiesListCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json", "dot"`)
+
+	return policiesListCmd
+}
+
+// Every policy type of Organizations, in the order they are listed.
+var allPolicyTypes = []types.PolicyType{
+	types.PolicyTypeServiceControlPolicy,
+	resourceControlPolicy,
+	types.PolicyTypeTagPolicy,
+	types.PolicyTypeBackupPolicy,
+	types.PolicyTypeAiservicesOptOutPolicy,
+	declarativePolicyEC2,
+}
+
+// A policy of the organization along with the targets it is attached to.
+type listedPolicy struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	ARN         string               `json:"arn"`
+	Type        types.PolicyType     `json:"type"`
+	AWSManaged  bool                 `json:"awsManaged"`
+	Description string               `json:"description,omitempty"`
+	Attachments int                  `json:"attachments"`
+	Targets     []listedPolicyTarget `json:"targets,omitempty"`
+}
+
+// A root, OU or account a policy is directly attached to.
+type listedPolicyTarget struct {
+	ID   string           `json:"id"`
+	Name string           `json:"name"`
+	Type types.TargetType `json:"type"`
+}
+
+// listAllPolicies enumerates the policies of every type enabled in the organization,
+// counting where each one of them is attached.
+func listAllPolicies(ctx context.Context, deps *dependencies, outputFormat outputFormat) error {
+	if outputFormat == csvFormat {
+		return errors.New(`the "csv" output format is only available for accounts, use "text", "json" or "dot"`)
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var policies []listedPolicy
+	for _, policyType := range allPolicyTypes {
+		summaries, err := listOrganizationPolicies(ctx, client, policyType)
+		var notEnabled *types.PolicyTypeNotEnabledException
+		switch {
+		case errors.As(err, &notEnabled):
+			continue
+		case err != nil:
+			return err
+		}
+
+		for _, summary := range summaries {
+			targets, err := listPolicyTargets(ctx, client, *summary.Id)
+			if err != nil {
+				return err
+			}
+
+			policy := listedPolicy{
+				ID:          *summary.Id,
+				Name:        *summary.Name,
+				ARN:         *summary.Arn,
+				Type:        summary.Type,
+				AWSManaged:  summary.AwsManaged,
+				Attachments: len(targets),
+			}
+			if summary.Description != nil {
+				policy.Description = *summary.Description
+			}
+			for _, target := range targets {
+				policy.Targets = append(policy.Targets, listedPolicyTarget{ID: *target.TargetId, Name: *target.Name, Type: target.Type})
+			}
+			policies = append(policies, policy)
+		}
+	}
+
+	switch outputFormat {
+	case jsonFormat:
+		encoder := json.NewEncoder(deps.report)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(policies)
+	case dotFormat:
+		return writePoliciesDot(deps.report, policies)
+	default:
+		printPolicyList(deps.report, policies)
+		return nil
+	}
+}
+
+// Prints the policies grouped by type.
+func printPolicyList(w io.Writer, policies []listedPolicy) {
+	var currentType types.PolicyType
+	for _, policy := range policies {
+		if policy.Type != currentType {
+			currentType = policy.Type
+			fmt.Fprintf(w, "|-- %s\n", currentType)
+		}
+
+		managed := "customer managed"
+		if policy.AWSManaged {
+			managed = "AWS managed"
+		}
+		description := ""
+		if policy.Description != "" {
+			description = ": " + policy.Description
+		}
+		fmt.Fprintf(w, "%s|-- %s [%s] (%s, %s)%s\n", indent, policy.Name, policy.ID, managed, formatQuantity(policy.Attachments, "attachment", "attachments"), description)
+	}
+}
+
+// Writes a graphviz graph linking every policy with the targets it is attached to.
+func writePoliciesDot(w io.Writer, policies []listedPolicy) error {
+	var b strings.Builder
+	b.WriteString("digraph policies {\n  rankdir=LR;\n")
+
+	targets := map[string]listedPolicyTarget{}
+	for _, policy := range policies {
+		fmt.Fprintf(&b, "  %q [shape=note, label=%q];\n", policy.ID, fmt.Sprintf("%s\n%s", policy.Name, policy.Type))
+		for _, target := range policy.Targets {
+			targets[target.ID] = target
+			fmt.Fprintf(&b, "  %q -> %q;\n", policy.ID, target.ID)
+		}
+	}
+	for _, id := range sortedKeys(targets) {
+		fmt.Fprintf(&b, "  %q [shape=box, label=%q];\n", id, fmt.Sprintf("%s\n%s", targets[id].Name, id))
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Lists every policy of the given type in the organization, attached or not.
+func listOrganizationPolicies(ctx context.Context, client orgAPI, policyType types.PolicyType) ([]types.PolicySummary, error) {
+	var policies []types.PolicySummary
+	paginator := organizations.NewListPoliciesPaginator(client, &organizations.ListPoliciesInput{Filter: policyType})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing policies of type %s: %w", policyType, err)
+		}
+		policies = append(policies, page.Policies...)
+	}
+	return policies, nil
+}
+
+// Lists every root, OU and account a policy is directly attached to.
+func listPolicyTargets(ctx context.Context, client orgAPI, policyID string) ([]types.PolicyTargetSummary, error) {
+	var targets []types.PolicyTargetSummary
+	paginator := organizations.NewListTargetsForPolicyPaginator(client, &organizations.ListTargetsForPolicyInput{PolicyId: &policyID})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing targets of policy %s: %w", policyID, err)
+		}
+		targets = append(targets, page.Targets...)
+	}
+	return targets, nil
+}
+
+// listUnusedPolicies cross-references every SCP of the organization with its
+// targets and displays the ones attached to nothing, which can be cleaned up.
+func listUnusedPolicies(ctx context.Context, deps *dependencies) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	policies, err := listOrganizationPolicies(ctx, client, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(deps.report, "SCPs not attached to any target:")
+	unused := 0
+	for _, policy := range policies {
+		targets, err := listPolicyTargets(ctx, client, *policy.Id)
+		if err != nil {
+			return err
+		}
+		if len(targets) > 0 {
+			continue
+		}
+		unused++
+
+		managed := ""
+		if policy.AwsManaged {
+			managed = " (AWS managed)"
+		}
+		fmt.Fprintf(deps.report, "|-- %s [%s]%s\n", *policy.Name, *policy.Id, managed)
+	}
+	fmt.Fprintf(deps.report, "%d of %d SCPs are unused\n", unused, len(policies))
+
+	return nil
+}
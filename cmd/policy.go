@@ -0,0 +1,299 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newPolicyCmd creates the group of commands that inspect individual policies.
+func newPolicyCmd(deps *dependencies) *cobra.Command {
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Inspect individual policies of the organization",
+	}
+
+	policyCmd.AddCommand(newPolicyShowCmd(deps))
+	policyCmd.AddCommand(newPolicyTargetsCmd(deps))
+
+	return policyCmd
+}
+
+// newPolicyShowCmd creates the aws policy show command.
+func newPolicyShowCmd(deps *dependencies) *cobra.Command {
+	var policyID string // ID of the policy to display
+	policyShowCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Displays the details and the full document of a policy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showPolicy(cmd.Context(), deps, policyID)
+		},
+	}
+
+	policyShowCmd.Flags().StringVar(&policyID, "policy-id", "", "ID of the policy to display (p-xxxxxxxx)")
+	policyShowCmd.MarkFlagRequired("policy-id") //nolint:gosec,errcheck
+
+	return policyShowCmd
+}
+
+// newPolicyTargetsCmd creates the aws policy targets command.
+func newPolicyTargetsCmd(deps *dependencies) *cobra.Command {
+	var (
+		policyID      string // ID of the policy whose targets are listed
+		expandTargets bool   // list the accounts affected through OU (and root) attachments
+	)
+	policyTargetsCmd := &cobra.Command{
+		Use:   "targets",
+		Short: "Lists every root, OU and account a policy is attached to",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showPolicyTargets(cmd.Context(), deps, policyID, expandTargets)
+		},
+	}
+
+	policyTargetsCmd.Flags().StringVar(&policyID, "policy-id", "", "ID of the policy whose targets are listed (p-xxxxxxxx)")
+	policyTargetsCmd.MarkFlagRequired("policy-id") //nolint:gosec,errcheck
+	policyTargetsCmd.Flags().BoolVar(&expandTargets, "expand", false, "also list every account affected through OU and root attachments")
+
+	return policyTargetsCmd
+}
+
+// showPolicy prints the metadata of a policy followed by its pretty-printed document.
+func showPolicy(ctx context.Context, deps *dependencies, id string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := client.DescribePolicy(ctx, &organizations.DescribePolicyInput{PolicyId: &id})
+	if err != nil {
+		return fmt.Errorf("error describing policy %s: %w", id, err)
+	}
+	summary := result.Policy.PolicySummary
+
+	fmt.Fprintf(deps.report, "Name: %s\n", *summary.Name)
+	fmt.Fprintf(deps.report, "ID: %s\n", *summary.Id)
+	fmt.Fprintf(deps.report, "ARN: %s\n", *summary.Arn)
+	fmt.Fprintf(deps.report, "Type: %s\n", summary.Type)
+	fmt.Fprintf(deps.report, "AWS managed: %t\n", summary.AwsManaged)
+	if summary.Description != nil && *summary.Description != "" {
+		fmt.Fprintf(deps.report, "Description: %s\n", *summary.Description)
+	}
+
+	document, err := prettyDocument(*result.Policy.Content, "")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(deps.report, "Document:\n%s\n", document)
+
+	return nil
+}
+
+// Gets the document of a policy. Documents are cached since the same policies
+// usually apply to many accounts.
+func getPolicyDocument(ctx context.Context, client orgAPI, id string) (string, error) {
+	if document, ok := cachedDocument(client.scout().Cache, id); ok {
+		return document, nil
+	}
+
+	result, err := client.DescribePolicy(ctx, &organizations.DescribePolicyInput{PolicyId: &id})
+	if err != nil {
+		return "", fmt.Errorf("error describing policy %s: %w", id, err)
+	}
+
+	cacheDocument(client.scout().Cache, id, *result.Policy.Content)
+	return *result.Policy.Content, nil
+}
+
+// Indents a policy document, every line of the result starts with prefix.
+func prettyDocument(document, prefix string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(document), prefix, "  "); err != nil {
+		return "", fmt.Errorf("invalid policy document: %w", err)
+	}
+	return prefix + buf.String(), nil
+}
+
+// Describes the documents of the policies, displayed below the entity they apply
+// to in the text output.
+func policyDocumentItems(policies []orgtree.Policy) ([]textItem, error) {
+	items := make([]textItem, 0, len(policies))
+	for _, policy := range policies {
+		item := textItem{text: fmt.Sprintf("SCP: %s [%s]", policy.Name, policy.ID)}
+		// Truncated documents can be left with the marker alone
+		if len(policy.Document) > 0 {
+			pretty, err := prettyDocument(string(policy.Document), "")
+			if err != nil {
+				return nil, err
+			}
+			item.lines = strings.Split(pretty, "\n")
+		}
+		if policy.Truncated != nil {
+			item.lines = append(item.lines, formatTruncation(policy.Truncated))
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// showPolicyTargets prints where a policy is directly attached and, if requested,
+// every account inheriting it through an OU or the root.
+func showPolicyTargets(ctx context.Context, deps *dependencies, id string, expand bool) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets, err := listPolicyTargets(ctx, client, id)
+	if err != nil {
+		return err
+	}
+	if err := sortPolicyTargets(ctx, client, targets); err != nil {
+		return err
+	}
+
+	affected := map[string]bool{}
+	for _, target := range targets {
+		switch target.Type {
+		case types.TargetTypeRoot:
+			fmt.Fprintf(deps.report, "|-- Root: [%s]\n", *target.TargetId)
+		case types.TargetTypeOrganizationalUnit:
+			fmt.Fprintf(deps.report, "|-- OU: %s [%s]\n", *target.Name, *target.TargetId)
+		default:
+			fmt.Fprintf(deps.report, "|-- Account: %s [%s]\n", *target.Name, *target.TargetId)
+			affected[*target.TargetId] = true
+			continue
+		}
+
+		if !expand {
+			continue
+		}
+		accountIDs, err := collectAccountsInSubtree(ctx, client, *target.TargetId)
+		if err != nil {
+			return err
+		}
+		names := make(map[string]string, len(accountIDs))
+		for _, accountID := range accountIDs {
+			if names[accountID], err = client.scout().Name(ctx, accountID); err != nil {
+				return fmt.Errorf("error getting name for id %s: %w", accountID, err)
+			}
+		}
+		sort.Slice(accountIDs, func(i, j int) bool {
+			if names[accountIDs[i]] != names[accountIDs[j]] {
+				return naturalLess(names[accountIDs[i]], names[accountIDs[j]])
+			}
+			return accountIDs[i] < accountIDs[j]
+		})
+		for _, accountID := range accountIDs {
+			fmt.Fprintf(deps.report, "%s|-- Account: %s [%s] (inherited)\n", indent, names[accountID], accountID)
+			affected[accountID] = true
+		}
+	}
+
+	if expand {
+		fmt.Fprintf(deps.report, "%d accounts affected by the policy\n", len(affected))
+	}
+	return nil
+}
+
+// Sorts the targets of a policy like the tree: the root first, then the OUs by
+// path and the accounts by name, the IDs breaking ties.
+func sortPolicyTargets(ctx context.Context, client orgAPI, targets []types.PolicyTargetSummary) error {
+	rank := map[types.TargetType]int{types.TargetTypeRoot: 0, types.TargetTypeOrganizationalUnit: 1, types.TargetTypeAccount: 2}
+	keys := make(map[string]string, len(targets))
+	for _, target := range targets {
+		key := aws.ToString(target.Name)
+		if target.Type == types.TargetTypeOrganizationalUnit {
+			var err error
+			if key, err = getOUPath(ctx, client, aws.ToString(target.TargetId)); err != nil {
+				return err
+			}
+		}
+		keys[aws.ToString(target.TargetId)] = key
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		if rank[a.Type] != rank[b.Type] {
+			return rank[a.Type] < rank[b.Type]
+		}
+		if keyA, keyB := keys[aws.ToString(a.TargetId)], keys[aws.ToString(b.TargetId)]; keyA != keyB {
+			return naturalLess(keyA, keyB)
+		}
+		return aws.ToString(a.TargetId) < aws.ToString(b.TargetId)
+	})
+	return nil
+}
+
+// Truncates a document larger than maxDocumentBytes (--max-document-bytes, 0
+// for no limit). Whole statements are dropped from the end until it fits, so
+// the result is still a valid policy document, or empty when not even the
+// document without statements fits. truncated is nil when the document is
+// returned untouched.
+func truncateDocument(document string, maxDocumentBytes int) (string, *orgtree.Truncation, error) {
+	if maxDocumentBytes <= 0 || len(document) <= maxDocumentBytes {
+		return document, nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(document), &fields); err != nil {
+		return "", nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+
+	var statements []json.RawMessage
+	if raw, ok := fields["Statement"]; ok {
+		if err := json.Unmarshal(raw, &statements); err != nil {
+			// A single statement object
+			statements = []json.RawMessage{raw}
+		}
+	}
+
+	// Compact the document first, it might fit without dropping anything
+	for kept := len(statements); kept >= 0; kept-- {
+		if statements != nil {
+			fields["Statement"] = mustMarshal(statements[:kept])
+		}
+		compact := mustMarshal(fields)
+		if len(compact) > maxDocumentBytes && kept > 0 {
+			continue
+		}
+		if len(compact) <= maxDocumentBytes && kept == len(statements) {
+			return string(compact), nil, nil
+		}
+
+		truncation := &orgtree.Truncation{OriginalBytes: len(document), OmittedStatements: len(statements) - kept}
+		if len(compact) > maxDocumentBytes {
+			// Not even the document without statements fits, only the marker is left
+			return "", truncation, nil
+		}
+		return string(compact), truncation, nil
+	}
+	return document, nil, nil
+}
+
+// Marshals values that are known to be valid JSON.
+func mustMarshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Describes a truncation for the text output.
+func formatTruncation(t *orgtree.Truncation) string {
+	return fmt.Sprintf("... %s statements omitted, the document has %s (use --full-documents to display it)", formatCount(t.OmittedStatements), formatBytes(t.OriginalBytes))
+}
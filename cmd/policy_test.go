@@ -0,0 +1,134 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+func TestTruncateDocument(t *testing.T) {
+	const (
+		denyLeave = `{"Effect":"Deny","Action":"organizations:LeaveOrganization","Resource":"*"}`
+		allowAll  = `{"Effect":"Allow","Action":"*","Resource":"*"}`
+	)
+	twoStatements := `{"Version":"2012-10-17","Statement":[` + allowAll + `,` + denyLeave + `]}`
+	pretty := "{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [\n    " + allowAll + "\n  ]\n}"
+	noStatements := `{"Version":"2012-10-17","Comment":"` + strings.Repeat("c", 100) + `"}`
+	large := `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:*","Resource":["arn:aws:s3:::` + strings.Repeat("b", 200) + `"]}]}`
+
+	tests := []struct {
+		name          string
+		document      string
+		maxBytes      int
+		want          string
+		wantTruncated *orgtree.Truncation
+	}{
+		{"within the limit", twoStatements, 4096, twoStatements, nil},
+		{"no limit", large, 0, large, nil},
+		{"compacted to fit", pretty, len(pretty) - 10, `{"Statement":[` + allowAll + `],"Version":"2012-10-17"}`, nil},
+		{
+			name:          "statements dropped from the end",
+			document:      twoStatements,
+			maxBytes:      len(twoStatements) - 1,
+			want:          `{"Statement":[` + allowAll + `],"Version":"2012-10-17"}`,
+			wantTruncated: &orgtree.Truncation{OriginalBytes: len(twoStatements), OmittedStatements: 1},
+		},
+		{
+			name:          "single statement over the limit",
+			document:      large,
+			maxBytes:      100,
+			want:          `{"Statement":[],"Version":"2012-10-17"}`,
+			wantTruncated: &orgtree.Truncation{OriginalBytes: len(large), OmittedStatements: 1},
+		},
+		{
+			name:          "nothing fits",
+			document:      large,
+			maxBytes:      20,
+			want:          "",
+			wantTruncated: &orgtree.Truncation{OriginalBytes: len(large), OmittedStatements: 1},
+		},
+		{
+			name:          "no statements",
+			document:      noStatements,
+			maxBytes:      50,
+			want:          "",
+			wantTruncated: &orgtree.Truncation{OriginalBytes: len(noStatements)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated, err := truncateDocument(tt.document, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("truncateDocument: %v", err)
+			}
+			if got != tt.want || !reflect.DeepEqual(truncated, tt.wantTruncated) {
+				t.Errorf("truncateDocument() = %s, %+v, want %s, %+v", got, truncated, tt.want, tt.wantTruncated)
+			}
+			if tt.maxBytes > 0 && len(got) > tt.maxBytes {
+				t.Errorf("truncateDocument() = %d bytes, over the limit of %d", len(got), tt.maxBytes)
+			}
+		})
+	}
+
+	if _, _, err := truncateDocument(`{"Statement":`+strings.Repeat(" ", 100), 50); err == nil || !strings.HasPrefix(err.Error(), "invalid policy document: ") {
+		t.Errorf("error = %v, want the document reported as invalid", err)
+	}
+}
+
+func TestShowDocumentsTruncated(t *testing.T) {
+	got, err := runCommand(t, newTestOrg(), "aws", "account", "222222222222", "--show-documents", "--max-document-bytes", "20")
+	if err != nil {
+		t.Fatalf("account: %v", err)
+	}
+	want := indent + indent + indent + "|-- SCP: deny-leave [p-denyleave]\n" +
+		indent + indent + indent + indent + "... 1 statements omitted, the document has 114 B (use --full-documents to display it)\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("account wrote:\n%s\nwant it to contain:\n%s", got, want)
+	}
+}
+
+func TestPolicyTargetsSorted(t *testing.T) {
+	org := newTestOrg().
+		AddAccount("r-root", "555555555555", "zeta", types.AccountStatusActive).
+		AddOU("r-root", "ou-root-sand", "Sandbox").
+		AddAccount("ou-root-work", "444444444444", "analytics", types.AccountStatusActive).
+		AddAccount("ou-root-sand", "666666666666", "account-10", types.AccountStatusActive).
+		AddAccount("ou-root-sand", "777777777777", "account-9", types.AccountStatusActive).
+		AttachPolicy("555555555555", "p-denyleave").
+		AttachPolicy("ou-root-sand", "p-denyleave").
+		AttachPolicy("r-root", "p-denyleave")
+
+	got, err := runCommand(t, org, "aws", "policy", "targets", "--policy-id", "p-denyleave", "--expand")
+	if err != nil {
+		t.Fatalf("policy targets: %v", err)
+	}
+	want := "|-- Root: [r-root]\n" +
+		indent + "|-- Account: account-9 [777777777777] (inherited)\n" +
+		indent + "|-- Account: account-10 [666666666666] (inherited)\n" +
+		indent + "|-- Account: analytics [444444444444] (inherited)\n" +
+		indent + "|-- Account: legacy [333333333333] (inherited)\n" +
+		indent + "|-- Account: management [111111111111] (inherited)\n" +
+		indent + "|-- Account: payments [222222222222] (inherited)\n" +
+		indent + "|-- Account: zeta [555555555555] (inherited)\n" +
+		"|-- OU: Sandbox [ou-root-sand]\n" +
+		indent + "|-- Account: account-9 [777777777777] (inherited)\n" +
+		indent + "|-- Account: account-10 [666666666666] (inherited)\n" +
+		"|-- OU: Workloads [ou-root-work]\n" +
+		indent + "|-- Account: analytics [444444444444] (inherited)\n" +
+		indent + "|-- Account: legacy [333333333333] (inherited)\n" +
+		indent + "|-- Account: payments [222222222222] (inherited)\n" +
+		"|-- Account: zeta [555555555555]\n" +
+		"7 accounts affected by the policy\n"
+	if got != want {
+		t.Errorf("policy targets wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/aioptout"
+	"github.com/ariguillegp/policy-scout/internal/backuppolicy"
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/ariguillegp/policy-scout/internal/tagpolicy"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// A policy type that can be displayed along with the SCPs.
+type extraPolicyType struct {
+	name       string           // value of the --policy-type flag
+	policyType types.PolicyType // type of the policies in the Organizations API
+	label      string           // e.g. "Tag policies"
+	singular   string           // e.g. "tag policy"
+	// Type of the effective policy computed by Organizations, empty if there is none.
+	effective types.EffectivePolicyType
+	// Describes the content of an effective policy, one line per rule.
+	describe func(content string) ([]string, error)
+}
+
+// Policy types that can be displayed along with the SCPs.
+var extraPolicyTypes = []extraPolicyType{
+	{
+		name:       "tag",
+		policyType: types.PolicyTypeTagPolicy,
+		label:      "Tag policies",
+		singular:   "tag policy",
+		effective:  types.EffectivePolicyTypeTagPolicy,
+		describe:   describeEffectiveTagPolicy,
+	},
+	{
+		name:       "backup",
+		policyType: types.PolicyTypeBackupPolicy,
+		label:      "Backup policies",
+		singular:   "backup policy",
+		effective:  types.EffectivePolicyTypeBackupPolicy,
+		describe:   describeEffectiveBackupPolicy,
+	},
+	{
+		name:       "aiservices-opt-out",
+		policyType: types.PolicyTypeAiservicesOptOutPolicy,
+		label:      "AI services opt-out policies",
+		singular:   "AI services opt-out policy",
+		effective:  types.EffectivePolicyTypeAiservicesOptOutPolicy,
+		describe:   describeEffectiveAIOptOutPolicy,
+	},
+	{
+		name:       "declarative-ec2",
+		policyType: declarativePolicyEC2,
+		label:      "Declarative policies",
+		singular:   "declarative policy",
+		effective:  effectiveDeclarativePolicyEC2,
+		describe:   describeEffectiveDeclarativePolicy,
+	},
+}
+
+// Resolves the policy types displayed along with the SCPs, as given in the
+// command line.
+func resolvePolicyTypes(names []string) ([]extraPolicyType, error) {
+	var selected []extraPolicyType
+	for _, name := range names {
+		found := false
+		for _, pt := range extraPolicyTypes {
+			if strings.EqualFold(name, pt.name) {
+				selected = append(selected, pt)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid policy type %q: valid policy types are %s", name, strings.Join(extraPolicyTypeNames(), ", "))
+		}
+	}
+	return selected, nil
+}
+
+func extraPolicyTypeNames() []string {
+	names := make([]string, 0, len(extraPolicyTypes))
+	for _, pt := range extraPolicyTypes {
+		names = append(names, pt.name)
+	}
+	return names
+}
+
+// Lists the (inherited and directly applied) policies of a type for an entity.
+// enabled is false when the policy type is not enabled in the organization.
+func listExtraPolicies(ctx context.Context, client orgAPI, entityID string, pt extraPolicyType) (policies []orgtree.Policy, enabled bool, err error) {
+	policies, err = client.scout().EffectivePolicies(ctx, entityID, pt.policyType)
+	var notEnabled *types.PolicyTypeNotEnabledException
+	switch {
+	case errors.As(err, &notEnabled):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, fmt.Errorf("error getting %s for %s: %w", strings.ToLower(pt.label), entityID, err)
+	}
+	return policies, true, nil
+}
+
+// Formats the policies of the selected types applied to a node for the text
+// output, e.g. " (Tag policies: CostCenter)".
+func (r textRenderer) formatExtraPolicies(node *orgtree.Node) string {
+	var formatted strings.Builder
+	for _, pt := range r.policyTypes {
+		policies, enabled := node.Policies[string(pt.policyType)]
+		if !enabled {
+			fmt.Fprintf(&formatted, " (%s: not enabled)", pt.label)
+			continue
+		}
+		if len(policies) == 0 {
+			fmt.Fprintf(&formatted, " (%s: none)", pt.label)
+			continue
+		}
+		fmt.Fprintf(&formatted, " (%s: %s)", pt.label, r.formatPolicyList(policies))
+	}
+	return formatted.String()
+}
+
+// Describes the effective policy of the selected types for an account, as merged
+// by Organizations from every policy the account inherits.
+func effectivePolicyItems(node *orgtree.Node, selected []extraPolicyType) ([]textItem, error) {
+	var items []textItem
+	for _, pt := range selected {
+		if pt.effective == "" {
+			continue
+		}
+
+		content, found := node.EffectivePolicies[string(pt.policyType)]
+		if !found {
+			items = append(items, textItem{text: fmt.Sprintf("Effective %s: none", pt.singular)})
+			continue
+		}
+
+		lines, err := pt.describe(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("effective %s of %s: %w", pt.singular, node.ID, err)
+		}
+		item := textItem{text: fmt.Sprintf("Effective %s:", pt.singular)}
+		for _, line := range lines {
+			item.children = append(item.children, textItem{text: line})
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Adds the policies of the selected types (and, for accounts, their effective
+// policies if requested) to a node of the tree.
+func addExtraPolicies(ctx context.Context, client orgAPI, node *orgtree.Node) error {
+	run := client.options()
+	for _, pt := range run.selectedPolicyTypes {
+		policies, enabled, err := listExtraPolicies(ctx, client, node.ID, pt)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			continue
+		}
+		if node.Policies == nil {
+			node.Policies = map[string][]orgtree.Policy{}
+		}
+		node.Policies[string(pt.policyType)] = policies
+
+		if !run.showEffectivePolicies || node.Type != orgtree.AccountNode || pt.effective == "" {
+			continue
+		}
+		content, found, err := getEffectivePolicy(ctx, client, node.ID, pt.effective)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		if node.EffectivePolicies == nil {
+			node.EffectivePolicies = map[string]json.RawMessage{}
+		}
+		node.EffectivePolicies[string(pt.policyType)] = json.RawMessage(content)
+	}
+	return nil
+}
+
+// Describes the tag rules of an effective tag policy.
+func describeEffectiveTagPolicy(content string) ([]string, error) {
+	effective, err := tagpolicy.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(effective.Tags))
+	for _, tag := range effective.Tags {
+		lines = append(lines, "Tag: "+formatTagRule(tag))
+	}
+	return lines, nil
+}
+
+// Describes the backup plans of an effective backup policy, one line per plan.
+func describeEffectiveBackupPolicy(content string) ([]string, error) {
+	effective, err := backuppolicy.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(effective.Plans))
+	for _, plan := range effective.Plans {
+		rules := make([]string, 0, len(plan.Rules))
+		for _, rule := range plan.Rules {
+			rules = append(rules, rule.Name)
+		}
+		lines = append(lines, fmt.Sprintf("Plan: %s (regions: %s; rules: %s; selections: %s)",
+			plan.Name, strings.Join(plan.Regions, ", "), strings.Join(rules, ", "), strings.Join(plan.Selections, ", ")))
+	}
+	return lines, nil
+}
+
+// Describes the opt-out setting of every AI service, starting with the overall coverage.
+func describeEffectiveAIOptOutPolicy(content string) ([]string, error) {
+	effective, err := aioptout.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := "Opted out of every AI service"
+	if !effective.OptedOut() {
+		coverage = "NOT opted out of every AI service"
+	}
+	lines := []string{coverage}
+	for _, service := range effective.Services {
+		lines = append(lines, fmt.Sprintf("Service %s: %s", service.Name, service.Setting))
+	}
+	return lines, nil
+}
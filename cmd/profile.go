@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Sections of the profiling report.
+const (
+	providerPhase = "provider"
+	checkPhase    = "check"
+)
+
+// scanProfile accumulates the time spent in every provider phase (one per API
+// operation, retries included) and every analysis check. Checks include the
+// provider calls they make, so the sections overlap.
+type scanProfile struct {
+	enabled bool // set with --profile-scan
+
+	mu      sync.Mutex
+	start   time.Time
+	entries map[string]*profileEntry // keyed by section and name
+}
+
+type profileEntry struct {
+	section string
+	name    string
+	calls   int
+	total   time.Duration
+}
+
+// Creates the profile of a run, starting now.
+func newScanProfile() *scanProfile {
+	return &scanProfile{start: time.Now(), entries: map[string]*profileEntry{}}
+}
+
+// Records a call of name lasting d. Does nothing unless --profile-scan is set.
+func (p *scanProfile) record(section, name string, d time.Duration) {
+	if !p.enabled {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := section + "/" + name
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &profileEntry{section: section, name: name}
+		p.entries[key] = entry
+	}
+	entry.calls++
+	entry.total += d
+}
+
+// Starts timing a call of name, the returned function stops it:
+//
+//	defer deps.profile.time(checkPhase, "backup")()
+func (p *scanProfile) time(section, name string) func() {
+	start := time.Now()
+	return func() { p.record(section, name, time.Since(start)) }
+}
+
+// Middleware timing every API call, added to the AWS config when profiling. It
+// runs after the service metadata (the operation name) is set.
+func (p *scanProfile) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ProfileScan", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		defer p.time(providerPhase, awsmiddleware.GetServiceID(ctx)+":"+awsmiddleware.GetOperationName(ctx))()
+		return next.HandleInitialize(ctx, in)
+	}), middleware.After)
+}
+
+// Writes the profiling report, slowest first within every section.
+func (p *scanProfile) write(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wall := time.Since(p.start)
+	entries := make([]*profileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].section != entries[j].section {
+			return entries[i].section > entries[j].section // provider first
+		}
+		return entries[i].total > entries[j].total
+	})
+
+	fmt.Fprintf(w, "Scan profile (%s wall time):\n", formatDuration(wall))
+	section := ""
+	for _, entry := range entries {
+		if entry.section != section {
+			section = entry.section
+			fmt.Fprintf(w, "|-- %s\n", section)
+		}
+		fmt.Fprintf(w, "%s|-- %s: %s calls, %s total, %s avg (%.1f%%)\n", indent, entry.name, formatCount(entry.calls),
+			formatDuration(entry.total), formatDuration(entry.total/time.Duration(entry.calls)),
+			100*entry.total.Seconds()/wall.Seconds())
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// How often the progress indicator is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// scanProgress counts the entities discovered and the API calls made while
+// traversing the organization, and redraws a spinner with them on stderr.
+type scanProgress struct {
+	entities atomic.Int64
+	apiCalls atomic.Int64
+
+	w    io.Writer
+	done chan struct{}
+	stop sync.Once
+	wg   sync.WaitGroup
+}
+
+// Starts displaying the progress on deps.stderr. Nothing is displayed with
+// --quiet or when stdout or stderr is not a terminal (e.g. piped to jq or
+// redirected to a file), so scripts and CI logs don't get the spinner, nor
+// with --verbose and --debug, whose logs would be mixed with it.
+func (p *scanProgress) start(deps *dependencies) {
+	run := &deps.options
+	if run.quiet || run.verbose || run.debug || !isTerminal(deps.stdout) || !isTerminal(deps.stderr) {
+		return
+	}
+
+	p.w = deps.stderr
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			select {
+			case <-p.done:
+				// Erase the line so the report starts on a clean one
+				if frame > 0 {
+					fmt.Fprint(p.w, "\r\033[K")
+				}
+				return
+			case <-ticker.C:
+				fmt.Fprintf(p.w, "\r%s Scanning: %s entities discovered, %s API calls", spinnerFrames[frame%len(spinnerFrames)],
+					formatCount(int(p.entities.Load())), formatCount(int(p.apiCalls.Load())))
+			}
+		}
+	}()
+}
+
+// Stops displaying the progress. Safe to call several times, and when it was
+// never displayed.
+func (p *scanProgress) finish() {
+	p.stop.Do(func() {
+		if p.done == nil {
+			return
+		}
+		close(p.done)
+		p.wg.Wait()
+	})
+}
+
+// Tells whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Middleware counting every API call, added to the AWS config of every command.
+func (p *scanProgress) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ScanProgress", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		p.apiCalls.Add(1)
+		return next.HandleInitialize(ctx, in)
+	}), middleware.After)
+}
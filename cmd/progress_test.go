@@ -0,0 +1,50 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestProgressSpinner(t *testing.T) {
+	// A character device, which isTerminal takes for a terminal
+	tty, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Skipf("no %s: %v", os.DevNull, err)
+	}
+	defer tty.Close()
+	if !isTerminal(tty) {
+		t.Skipf("%s isn't a character device", os.DevNull)
+	}
+
+	tests := []struct {
+		name           string
+		stdout, stderr io.Writer
+		quiet          bool
+		want           bool
+	}{
+		{"terminal", tty, tty, false, true},
+		{"quiet", tty, tty, true, false},
+		{"stdout piped", &bytes.Buffer{}, tty, false, false},
+		{"stderr redirected", tty, &bytes.Buffer{}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := newDependencies(tt.stdout, tt.stderr)
+			deps.options.quiet = tt.quiet
+			p := &scanProgress{}
+			p.start(deps)
+			defer p.finish()
+			if got := p.done != nil; got != tt.want {
+				t.Errorf("spinner displayed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Destinations of --publish.
+const (
+	publishSecurityHub = "security-hub" // the findings, imported into Security Hub
+	publishCloudWatch  = "cloudwatch"   // the metrics, published to CloudWatch
+	publishS3Scheme    = "s3"           // the report (or snapshot), archived under s3://bucket/prefix/
+)
+
+// Annotation of the commands reporting findings, which can be published to
+// Security Hub.
+const findingsAnnotation = "findings"
+
+// Checks the destinations of --publish apply to cmd. Called before running any
+// command, so a scan is never wasted on a destination that can't be used.
+func validatePublishTargets(cmd *cobra.Command, run *runOptions) error {
+	archived := false
+	for _, target := range run.publishTargets {
+		switch {
+		case target == publishSecurityHub:
+			if cmd.Annotations[findingsAnnotation] == "" {
+				return fmt.Errorf(`--publish %s only applies to the commands reporting findings: "aws lint", "aws unrestricted", "aws conform", "aws check" and "aws audit"`, target)
+			}
+			if run.demo || run.snapshotFile != "" {
+				return fmt.Errorf("--publish %s imports the findings into the Security Hub of the local AWS config, it can't be used with --demo or --from-snapshot", target)
+			}
+		case target == publishCloudWatch:
+			if cmd.Annotations[metricsAnnotation] == "" {
+				return fmt.Errorf(`--publish %s only applies to the commands computing metrics: "aws metrics", "aws unrestricted", "aws snapshot diff" and "aws snapshot watch"`, target)
+			}
+			if run.demo || run.snapshotFile != "" {
+				return fmt.Errorf("--publish %s publishes the metrics with the local AWS config, it can't be used with --demo or --from-snapshot", target)
+			}
+		case strings.HasPrefix(target, publishS3Scheme+"://"):
+			if _, _, err := parseS3Prefix(target); err != nil {
+				return err
+			}
+			if run.demo || run.snapshotFile != "" {
+				return fmt.Errorf("--publish %s uploads the report with the local AWS config, it can't be used with --demo or --from-snapshot", target)
+			}
+			archived = true
+		default:
+			return fmt.Errorf(`invalid publish destination %q: valid destinations are "security-hub", "cloudwatch" and s3://bucket/prefix/`, target)
+		}
+	}
+	if run.publishKMSKey != "" && !archived {
+		return errors.New("--publish-kms-key encrypts the reports published to S3, but no s3:// destination was given to --publish")
+	}
+	return nil
+}
+
+// Splits an s3://bucket/prefix/ destination. The prefix may be empty, the keys
+// of the objects are appended to it as they are.
+func parseS3Prefix(target string) (bucket, prefix string, err error) {
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" {
+		return "", "", fmt.Errorf("invalid publish destination %q: expected s3://bucket/prefix/", target)
+	}
+	return parsed.Host, strings.TrimPrefix(parsed.Path, "/"), nil
+}
+
+// Tells whether --publish includes an s3:// destination.
+func publishingToS3(run *runOptions) bool {
+	for _, target := range run.publishTargets {
+		if strings.HasPrefix(target, publishS3Scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// Archives the publication to every s3:// destination of --publish, under a key
+// made of the command and the time of the run, e.g.
+// s3://audits/org/aws-tree-20240501T020000Z.json. Called once the command
+// succeeded.
+func publishToS3(ctx context.Context, deps *dependencies, cmd *cobra.Command) error {
+	if !publishingToS3(&deps.options) || deps.publication.Len() == 0 {
+		return nil
+	}
+
+	name := strings.ReplaceAll(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "), " ", "-")
+	key := fmt.Sprintf("%s-%s.%s", name, deps.now().UTC().Format("20060102T150405Z"), publicationExtension(cmd, deps.publication.Bytes()))
+	for _, target := range deps.options.publishTargets {
+		if !strings.HasPrefix(target, publishS3Scheme+"://") {
+			continue
+		}
+		bucket, prefix, err := parseS3Prefix(target)
+		if err != nil {
+			return err
+		}
+
+		object := &s3Sink{bucket: bucket, key: prefix + key, kmsKeyID: deps.options.publishKMSKey, client: deps.s3Client}
+		object.Write(deps.publication.Bytes()) //nolint:errcheck
+		if err := object.Close(ctx); err != nil {
+			return fmt.Errorf("couldn't publish report to s3://%s/%s: %w", bucket, object.key, err)
+		}
+		fmt.Fprintf(deps.stderr, "Report published to s3://%s/%s\n", bucket, object.key)
+	}
+	return nil
+}
+
+// Extension of the published object: the output format of the command, or json
+// for the commands writing JSON (e.g. the snapshot).
+func publicationExtension(cmd *cobra.Command, publication []byte) string {
+	if flag := cmd.Flags().Lookup("output-format"); flag != nil {
+		if flag.Value.String() == string(textFormat) {
+			return "txt"
+		}
+		return flag.Value.String()
+	}
+	if json.Valid(publication) {
+		return "json"
+	}
+	return "txt"
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// newReconcileCmd creates the aws reconcile command.
+func newReconcileCmd(deps *dependencies) *cobra.Command {
+	var expectedAccountsFile string // CSV or JSON list of the accounts the org should contain
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Compares the accounts of the organization with an expected list (finance, CMDB, ...)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reconcileAccounts(cmd.Context(), deps, expectedAccountsFile)
+		},
+	}
+
+	reconcileCmd.Flags().StringVar(&expectedAccountsFile, "expected", "", "CSV (.csv) or JSON (.json) file listing the expected accounts")
+	reconcileCmd.MarkFlagRequired("expected") //nolint:gosec,errcheck
+
+	return reconcileCmd
+}
+
+// An account listed in the expected accounts file. The name is optional.
+type expectedAccount struct {
+	ID   string `json:"accountId"`
+	Name string `json:"name,omitempty"`
+}
+
+// Loads the expected accounts. CSV files need a header with an "account_id" (or
+// "id") column and an optional "name" column. JSON files hold a list of account
+// IDs or of {"accountId": ..., "name": ...} objects.
+func loadExpectedAccounts(path string) ([]expectedAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []expectedAccount
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		accounts, err = parseExpectedAccountsCSV(string(data))
+	case ".json":
+		accounts, err = parseExpectedAccountsJSON(data)
+	default:
+		return nil, fmt.Errorf("unsupported expected accounts file %s: use a .csv or .json file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expected accounts file %s: %w", path, err)
+	}
+
+	for i := range accounts {
+		accounts[i].ID = strings.TrimSpace(accounts[i].ID)
+		accounts[i].Name = strings.TrimSpace(accounts[i].Name)
+		if accounts[i].ID == "" {
+			return nil, fmt.Errorf("invalid expected accounts file %s: entry %d has no account ID", path, i+1)
+		}
+	}
+	return accounts, nil
+}
+
+func parseExpectedAccountsCSV(data string) ([]expectedAccount, error) {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the header is missing")
+	}
+
+	idColumn, nameColumn := -1, -1
+	for i, column := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "account_id", "accountid", "id":
+			idColumn = i
+		case "name", "account_name":
+			nameColumn = i
+		}
+	}
+	if idColumn < 0 {
+		return nil, errors.New(`the header has no "account_id" column`)
+	}
+
+	accounts := make([]expectedAccount, 0, len(records)-1)
+	for _, record := range records[1:] {
+		account := expectedAccount{ID: record[idColumn]}
+		if nameColumn >= 0 {
+			account.Name = record[nameColumn]
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func parseExpectedAccountsJSON(data []byte) ([]expectedAccount, error) {
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err == nil {
+		accounts := make([]expectedAccount, 0, len(ids))
+		for _, id := range ids {
+			accounts = append(accounts, expectedAccount{ID: id})
+		}
+		return accounts, nil
+	}
+
+	var accounts []expectedAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// reconcileAccounts reports the accounts of the org nobody expects, the expected
+// accounts missing from the org and the accounts whose names don't match.
+func reconcileAccounts(ctx context.Context, deps *dependencies, path string) error {
+	expected, err := loadExpectedAccounts(path)
+	if err != nil {
+		return err
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := client.scout().Accounts(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing accounts: %w", err)
+	}
+
+	live := map[string]string{}
+	for _, account := range accounts {
+		live[*account.Id] = *account.Name
+	}
+	wanted := map[string]string{}
+	for _, account := range expected {
+		wanted[account.ID] = account.Name
+	}
+
+	unknown := onlyIn(live, wanted)
+	fmt.Fprintln(deps.report, "Accounts in the organization that are not expected:")
+	for _, id := range unknown {
+		fmt.Fprintf(deps.report, "|-- %s [%s]\n", live[id], id)
+	}
+
+	missing := onlyIn(wanted, live)
+	fmt.Fprintln(deps.report, "Expected accounts missing from the organization:")
+	for _, id := range missing {
+		if name := wanted[id]; name != "" {
+			fmt.Fprintf(deps.report, "|-- %s [%s]\n", name, id)
+		} else {
+			fmt.Fprintf(deps.report, "|-- [%s]\n", id)
+		}
+	}
+
+	var mismatches []string
+	for id, name := range wanted {
+		if liveName, ok := live[id]; ok && name != "" && !strings.EqualFold(name, liveName) {
+			mismatches = append(mismatches, id)
+		}
+	}
+	sort.Strings(mismatches)
+	fmt.Fprintln(deps.report, "Accounts whose name differs from the expected one:")
+	for _, id := range mismatches {
+		fmt.Fprintf(deps.report, "|-- [%s]: %s (expected %s)\n", id, live[id], wanted[id])
+	}
+
+	fmt.Fprintf(deps.report, "%d unknown, %d missing, %d renamed (%d accounts in the organization, %d expected)\n",
+		len(unknown), len(missing), len(mismatches), len(live), len(wanted))
+	return nil
+}
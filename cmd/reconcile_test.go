@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+)
+
+// Writes content to a file called name in a temporary directory, returning its path.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name     string
+		org      *awsorgtest.Org
+		file     string
+		expected string
+		want     string
+	}{
+		{
+			name:     "csv",
+			org:      newTestOrg(),
+			file:     "accounts.csv",
+			expected: "Account_ID,Name,Cost center\n111111111111,management,CC-1\n 222222222222 ,Payments Prod,CC-2\n444444444444,ledger,CC-3\n",
+			want: "Accounts in the organization that are not expected:\n|-- legacy [333333333333]\n" +
+				"Expected accounts missing from the organization:\n|-- ledger [444444444444]\n" +
+				"Accounts whose name differs from the expected one:\n|-- [222222222222]: payments (expected Payments Prod)\n" +
+				"1 unknown, 1 missing, 1 renamed (3 accounts in the organization, 3 expected)\n",
+		},
+		{
+			name:     "json account IDs",
+			org:      newTestOrg(),
+			file:     "accounts.json",
+			expected: `["111111111111", "222222222222", "333333333333"]`,
+			want: "Accounts in the organization that are not expected:\n" +
+				"Expected accounts missing from the organization:\n" +
+				"Accounts whose name differs from the expected one:\n" +
+				"0 unknown, 0 missing, 0 renamed (3 accounts in the organization, 3 expected)\n",
+		},
+		{
+			name:     "json objects",
+			org:      newTestOrg(),
+			file:     "accounts.JSON",
+			expected: `[{"accountId": "222222222222", "name": "PAYMENTS"}, {"accountId": "555555555555"}]`,
+			want: "Accounts in the organization that are not expected:\n|-- management [111111111111]\n|-- legacy [333333333333]\n" +
+				"Expected accounts missing from the organization:\n|-- [555555555555]\n" +
+				"Accounts whose name differs from the expected one:\n" +
+				"2 unknown, 1 missing, 0 renamed (3 accounts in the organization, 2 expected)\n",
+		},
+		{
+			name:     "empty organization",
+			org:      awsorgtest.New("o-example", "r-root", "111111111111"),
+			file:     "accounts.csv",
+			expected: "id\n111111111111\n",
+			want: "Accounts in the organization that are not expected:\n" +
+				"Expected accounts missing from the organization:\n|-- [111111111111]\n" +
+				"Accounts whose name differs from the expected one:\n" +
+				"0 unknown, 1 missing, 0 renamed (0 accounts in the organization, 1 expected)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, tt.org, "aws", "reconcile", "--expected", writeTestFile(t, tt.file, tt.expected))
+			if err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("reconcile wrote:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileInvalidFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+		wantErr  string
+	}{
+		{"unsupported extension", "accounts.txt", "111111111111\n", "use a .csv or .json file"},
+		{"no header", "accounts.csv", "", "the header is missing"},
+		{"no account ID column", "accounts.csv", "name\nmanagement\n", `the header has no "account_id" column`},
+		{"entry without an ID", "accounts.csv", "account_id,name\n111111111111,management\n ,payments\n", "entry 2 has no account ID"},
+		{"invalid JSON", "accounts.json", `{"accountId": "111111111111"}`, "invalid expected accounts file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runCommand(t, newTestOrg(), "aws", "reconcile", "--expected", writeTestFile(t, tt.file, tt.expected))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
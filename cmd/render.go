@@ -0,0 +1,250 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+)
+
+// ANSI colors of the elements of the text tree.
+const (
+	rootColor       = "1;35" // bold magenta
+	ouColor         = "1;34" // bold blue
+	accountColor    = "32"   // green
+	managementColor = "1;33" // bold yellow
+	inactiveColor   = "31"   // red
+	policyColor     = "36"   // cyan
+)
+
+// palette colors the elements of the text tree. The zero palette leaves them
+// as they are.
+type palette struct {
+	enabled bool
+}
+
+// Wraps s in the escape codes of color.
+func (p palette) paint(color, s string) string {
+	if !p.enabled {
+		return s
+	}
+	return "\033[" + color + "m" + s + "\033[0m"
+}
+
+// Tells whether the text output is colored: only when the report goes to a
+// terminal, and neither --no-color nor NO_COLOR (https://no-color.org) is set.
+func useColors(deps *dependencies) bool {
+	if deps.options.noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	reportURI := deps.options.reportURI
+	return (reportURI == "" || reportURI == "-") && isTerminal(deps.stdout)
+}
+
+// treeStyle is the set of prefixes used to draw the branches of the text tree.
+type treeStyle struct {
+	top       string // prefix of the top node
+	topIndent string // prefix of the children of the top node
+	branch    string // prefix of a child followed by other children
+	last      string // prefix of the last child
+	vertical  string // prefix below a child followed by other children
+	blank     string // prefix below the last child
+}
+
+// Styles of --tree-style. The flat style, the default, repeats the same prefix
+// at every level, which keeps the output of previous versions.
+var treeStyles = map[string]treeStyle{
+	"flat":    {top: "|-- ", topIndent: indent, branch: "|-- ", last: "|-- ", vertical: indent, blank: indent},
+	"ascii":   {branch: "|-- ", last: "`-- ", vertical: "|   ", blank: "    "},
+	"unicode": {branch: "├── ", last: "└── ", vertical: "│   ", blank: "    "},
+	"compact": {branch: "├─ ", last: "└─ ", vertical: "│  ", blank: "   "},
+}
+
+// Resolves the style requested with --tree-style.
+func resolveTreeStyle(treeStyleName string) (treeStyle, error) {
+	if treeStyleName == "" {
+		return treeStyles["flat"], nil
+	}
+	style, ok := treeStyles[treeStyleName]
+	if !ok {
+		return treeStyle{}, fmt.Errorf(`invalid tree style %q: valid tree styles are "flat", "ascii", "unicode", "compact"`, treeStyleName)
+	}
+	return style, nil
+}
+
+// textItem is a line of the text tree along with what is displayed below it.
+type textItem struct {
+	text     string
+	lines    []string   // displayed as they are below text, e.g. a policy document
+	children []textItem // displayed as branches below text, after lines
+}
+
+// Writes item as the top node of a tree.
+func (s treeStyle) writeTop(w io.Writer, item textItem) {
+	fmt.Fprintf(w, "%s%s\n", s.top, item.text)
+	s.writeBelow(w, item, s.topIndent)
+}
+
+// Writes the lines and the children of item, every line starting with prefix.
+func (s treeStyle) writeBelow(w io.Writer, item textItem, prefix string) {
+	for _, line := range item.lines {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+	for i, child := range item.children {
+		connector, continuation := s.branch, s.vertical
+		if i == len(item.children)-1 {
+			connector, continuation = s.last, s.blank
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, connector, child.text)
+		s.writeBelow(w, child, prefix+continuation)
+	}
+}
+
+// renderOptions are the flags deciding how a tree is written, shared by the
+// trees of AWS and GCP.
+type renderOptions struct {
+	format        outputFormat
+	showPolicyIDs bool // display policy IDs and ARNs in the text output
+	showDocuments bool // display the full document of every SCP applied to the accounts
+}
+
+// Creates the renderer of the output format, shared by the trees of AWS and
+// GCP. client lists the policies directly attached to the AWS nodes for the
+// cypher format, the GCP nodes only listing the policies set on them. run
+// tells which details of the nodes are displayed.
+func newTreeRenderer(ctx context.Context, run *runOptions, client orgAPI, options renderOptions) (orgtree.Renderer, error) {
+	switch options.format {
+	case dotFormat:
+		return orgtree.DotRenderer{}, nil
+	case jsonFormat:
+		return orgtree.JSONRenderer{}, nil
+	case yamlFormat:
+		return orgtree.YAMLRenderer{}, nil
+	case csvFormat:
+		return csvRenderer{inheritTagKeys: run.inheritTagKeys, alternateContacts: run.alternateContacts, showLiens: run.gcp.showLiens}, nil
+	case cypherFormat:
+		return cypherRenderer{ctx: ctx, client: client}, nil
+	default: // (text) Using default even though format is an enum to prevent an LSP error (missing return)
+		renderer, err := newTextRenderer(run)
+		renderer.showPolicyIDs, renderer.showDocuments = options.showPolicyIDs, options.showDocuments
+		return renderer, err
+	}
+}
+
+// textRenderer writes the tree like output of the text format.
+type textRenderer struct {
+	colors palette
+	style  treeStyle
+
+	showPolicyIDs         bool              // display the IDs (and ARNs) of the policies next to their names
+	showDocuments         bool              // display the documents of the SCPs below every account
+	naming                policyNaming      // groups the SCPs by category, see --naming-convention
+	policyTypes           []extraPolicyType // policies of other types displayed along with the SCPs
+	showEffectivePolicies bool              // display the effective policy of those types below every account
+	alternateContacts     bool              // display the alternate contacts below every active account
+}
+
+// Creates the text renderer of --tree-style, in color when the report goes to a
+// terminal, displaying the details of the nodes requested in run.
+func newTextRenderer(run *runOptions) (textRenderer, error) {
+	style, err := resolveTreeStyle(run.treeStyleName)
+	if err != nil {
+		return textRenderer{}, err
+	}
+	return textRenderer{
+		colors:                palette{enabled: run.colorOutput},
+		style:                 style,
+		naming:                run.namingPatterns,
+		policyTypes:           run.selectedPolicyTypes,
+		showEffectivePolicies: run.showEffectivePolicies,
+		alternateContacts:     run.alternateContacts,
+	}, nil
+}
+
+// Render implements orgtree.Renderer.
+func (r textRenderer) Render(w io.Writer, tree *orgtree.Tree) error {
+	item, err := r.nodeItem(tree.Root)
+	if err != nil {
+		return err
+	}
+	// The zero renderer draws the default style
+	style := r.style
+	if style == (treeStyle{}) {
+		style = treeStyles["flat"]
+	}
+	style.writeTop(w, item)
+	return nil
+}
+
+// Describes node and the nodes below it.
+func (r textRenderer) nodeItem(node *orgtree.Node) (textItem, error) {
+	var item textItem
+	switch node.Type {
+	case orgtree.RootNode:
+		item.text = fmt.Sprintf("%s: [%s]", r.colors.paint(rootColor, "Root"), node.ID)
+	case orgtree.OUNode:
+		item.text = fmt.Sprintf("OU: %s [%s]", r.colors.paint(ouColor, node.Name), node.ID)
+	case orgtree.OrganizationNode:
+		item.text = fmt.Sprintf("%s: %s [%s]%s%s", r.colors.paint(rootColor, "Organization"), node.Name, node.ID, r.formatGCPPolicies(node), formatGCPTags(node))
+		constraints, err := customConstraintItems(node)
+		if err != nil {
+			return textItem{}, err
+		}
+		item.children = append(item.children, constraints...)
+	case orgtree.FolderNode:
+		item.text = fmt.Sprintf("Folder: %s [%s]%s%s", r.colors.paint(ouColor, node.Name), node.ID, r.formatGCPPolicies(node), formatGCPTags(node))
+	case orgtree.ProjectNode:
+		name := r.colors.paint(accountColor, node.Name)
+		// Projects pending deletion are flagged like suspended accounts
+		if !node.Active() {
+			name += r.colors.paint(inactiveColor, fmt.Sprintf(" (%s)", node.Status))
+		}
+		item.text = fmt.Sprintf("Project: %s [%s]%s%s", name, node.ID, r.formatGCPPolicies(node), formatGCPTags(node))
+		item.children = append(item.children, lienItems(node)...)
+	default:
+		name := r.colors.paint(accountColor, node.Name)
+		// Add an indicator to the account name in case it is the org management account
+		if node.ManagementAccount {
+			name = r.colors.paint(managementColor, node.Name+" (Management Account)")
+		}
+		// Suspended and closing accounts are flagged as well
+		if !node.Active() {
+			name += r.colors.paint(inactiveColor, fmt.Sprintf(" (%s)", node.Status))
+		}
+		item.text = fmt.Sprintf("Account: %s [%s] (SCPs: %s)%s", name, node.ID, r.formatPolicies(node.SCPs), r.formatExtraPolicies(node))
+
+		if r.showEffectivePolicies {
+			effective, err := effectivePolicyItems(node, r.policyTypes)
+			if err != nil {
+				return textItem{}, err
+			}
+			item.children = append(item.children, effective...)
+		}
+		if r.alternateContacts && node.Active() {
+			item.children = append(item.children, alternateContactItems(node)...)
+		}
+		if r.showDocuments {
+			documents, err := policyDocumentItems(node.SCPs)
+			if err != nil {
+				return textItem{}, err
+			}
+			item.children = append(item.children, documents...)
+		}
+	}
+
+	for _, child := range node.Children {
+		childItem, err := r.nodeItem(child)
+		if err != nil {
+			return textItem{}, err
+		}
+		item.children = append(item.children, childItem)
+	}
+	return item, nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/ariguillegp/policy-scout/pkg/awsorg"
+)
+
+// Builds the tree of the test organization like the CLI does, sorted by name.
+func buildTestTree(t *testing.T) *orgtree.Tree {
+	t.Helper()
+	tree, err := awsorg.New(newTestOrg()).BuildTree(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Root.Sort(orgtree.SortByName)
+	return tree
+}
+
+func TestTreeRenderers(t *testing.T) {
+	tests := []struct {
+		name     string
+		renderer orgtree.Renderer
+		want     string
+	}{
+		{
+			"text", textRenderer{},
+			`|-- Root: [r-root]
+    |-- Account: management (Management Account) [111111111111] (SCPs: FullAWSAccess)
+    |-- OU: Workloads [ou-root-work]
+        |-- Account: legacy (SUSPENDED) [333333333333] (SCPs: deny-leave, FullAWSAccess)
+        |-- Account: payments [222222222222] (SCPs: deny-leave, FullAWSAccess)
+`,
+		},
+		{
+			"text with policy IDs", textRenderer{showPolicyIDs: true, style: treeStyles["unicode"]},
+			`Root: [r-root]
+├── Account: management (Management Account) [111111111111] (SCPs: FullAWSAccess [p-FullAWSAccess, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess])
+└── OU: Workloads [ou-root-work]
+    ├── Account: legacy (SUSPENDED) [333333333333] (SCPs: deny-leave [p-denyleave, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave], FullAWSAccess [p-FullAWSAccess, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess])
+    └── Account: payments [222222222222] (SCPs: deny-leave [p-denyleave, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave], FullAWSAccess [p-FullAWSAccess, arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess])
+`,
+		},
+		{
+			"json", orgtree.JSONRenderer{},
+			`{
+  "organizationId": "o-example",
+  "tree": {
+    "type": "root",
+    "id": "r-root",
+    "name": "Root",
+    "scps": [
+      {
+        "id": "p-FullAWSAccess",
+        "name": "FullAWSAccess",
+        "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess"
+      }
+    ],
+    "children": [
+      {
+        "type": "account",
+        "id": "111111111111",
+        "name": "management",
+        "managementAccount": true,
+        "status": "ACTIVE",
+        "scps": [
+          {
+            "id": "p-FullAWSAccess",
+            "name": "FullAWSAccess",
+            "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess"
+          }
+        ]
+      },
+      {
+        "type": "ou",
+        "id": "ou-root-work",
+        "name": "Workloads",
+        "scps": [
+          {
+            "id": "p-denyleave",
+            "name": "deny-leave",
+            "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave"
+          },
+          {
+            "id": "p-FullAWSAccess",
+            "name": "FullAWSAccess",
+            "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess"
+          }
+        ],
+        "children": [
+          {
+            "type": "account",
+            "id": "333333333333",
+            "name": "legacy",
+            "status": "SUSPENDED",
+            "scps": [
+              {
+                "id": "p-denyleave",
+                "name": "deny-leave",
+                "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave"
+              },
+              {
+                "id": "p-FullAWSAccess",
+                "name": "FullAWSAccess",
+                "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess"
+              }
+            ]
+          },
+          {
+            "type": "account",
+            "id": "222222222222",
+            "name": "payments",
+            "status": "ACTIVE",
+            "scps": [
+              {
+                "id": "p-denyleave",
+                "name": "deny-leave",
+                "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave"
+              },
+              {
+                "id": "p-FullAWSAccess",
+                "name": "FullAWSAccess",
+                "arn": "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-FullAWSAccess"
+              }
+            ]
+          }
+        ]
+      }
+    ]
+  }
+}
+`,
+		},
+		{
+			"csv", csvRenderer{},
+			`account_id,account_name,ou_path,management_account,status,scps
+111111111111,management,/Root,true,ACTIVE,FullAWSAccess
+333333333333,legacy,/Root/Workloads,false,SUSPENDED,deny-leave;FullAWSAccess
+222222222222,payments,/Root/Workloads,false,ACTIVE,deny-leave;FullAWSAccess
+`,
+		},
+		{
+			"dot", orgtree.DotRenderer{},
+			`digraph organization {
+  rankdir=LR;
+  "r-root" [shape=folder, label="Root\nr-root"];
+  "r-root" -> "111111111111";
+  "r-root" -> "ou-root-work";
+  "111111111111" [shape=box, label="management (Management Account)\n111111111111\nSCPs: FullAWSAccess"];
+  "ou-root-work" [shape=folder, label="OU: Workloads\nou-root-work"];
+  "ou-root-work" -> "333333333333";
+  "ou-root-work" -> "222222222222";
+  "333333333333" [shape=box, label="legacy (SUSPENDED)\n333333333333\nSCPs: deny-leave, FullAWSAccess"];
+  "222222222222" [shape=box, label="payments\n222222222222\nSCPs: deny-leave, FullAWSAccess"];
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tt.renderer.Render(&out, buildTestTree(t)); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("%s renderer wrote:\n%s\nwant:\n%s", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatExtraPolicies(t *testing.T) {
+	renderer := textRenderer{policyTypes: extraPolicyTypes[:2]}
+	costCenter := orgtree.Policy{ID: "p-costcenter", Name: "cost-center"}
+
+	tests := []struct {
+		name     string
+		policies map[string][]orgtree.Policy
+		want     string
+	}{
+		{
+			name: "types not enabled",
+			want: " (Tag policies: not enabled) (Backup policies: not enabled)",
+		},
+		{
+			name:     "nothing attached",
+			policies: map[string][]orgtree.Policy{"TAG_POLICY": nil, "BACKUP_POLICY": {}},
+			want:     " (Tag policies: none) (Backup policies: none)",
+		},
+		{
+			name:     "attached policies",
+			policies: map[string][]orgtree.Policy{"TAG_POLICY": {costCenter}, "BACKUP_POLICY": nil},
+			want:     " (Tag policies: cost-center) (Backup policies: none)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &orgtree.Node{Type: orgtree.AccountNode, ID: "222222222222", Name: "payments", Policies: tt.policies}
+			if got := renderer.formatExtraPolicies(node); got != tt.want {
+				t.Errorf("formatExtraPolicies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,34 +18,174 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-// rootCmd represents the base command when called without any subcommands.
-var rootCmd = &cobra.Command{
-	Use:   "policy-scout",
-	Short: "Explore policies within your org from a single interface",
-}
-
-// Execute adds all child commands to the root command and sets flags appropriately.
-// This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+// newRootCmd creates the base command, when called without any subcommands,
+// along with every command of the tool. Commands reach the outside world only
+// through deps.
+func newRootCmd(deps *dependencies) *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "policy-scout",
+		Short: "Explore policies within your org from a single interface",
+		// Errors are printed by Execute, see reportStandaloneAccount
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		// The scope of the config file, the warm cache and the report destination
+		// apply to every command
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			options := &deps.options
+			var err error
+			if deps.logger, err = newLogger(deps.stderr, options); err != nil {
+				return err
+			}
+			deps.cache.logger = deps.logger
+			deps.profile.enabled = options.profileScan
+			if err := options.loadConfig(); err != nil {
+				return err
+			}
+			if err := options.scope.validate(); err != nil {
+				return err
+			}
+			if options.demo && options.snapshotFile != "" {
+				return errors.New("--demo and --from-snapshot can't be used together")
+			}
+			if err := validatePublishTargets(cmd, options); err != nil {
+				return err
+			}
+			if err := validateHistoryTable(options); err != nil {
+				return err
+			}
+			if err := validateNotifyTargets(cmd, options); err != nil {
+				return err
+			}
+			// The warm cache holds the live organization, never mix it with the
+			// demo or with a snapshot
+			if !options.demo && options.snapshotFile == "" {
+				if err := loadWarmCache(deps); err != nil {
+					return err
+				}
+			}
+			if err := openReportSink(deps); err != nil {
+				return err
+			}
+			options.colorOutput = useColors(deps)
+			deps.progress.start(deps)
+			return nil
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			return finishReport(cmd, deps)
+		},
 	}
-}
+	rootCmd.SetOut(deps.stdout)
+	rootCmd.SetErr(deps.stderr)
 
-func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.policy-scout.yaml)")
+	rootCmd.PersistentFlags().StringVar(&deps.options.configFile, "config", "", "config file (default is $HOME/.policy-scout.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&deps.options.demo, "demo", false, "explore every feature against an embedded fictional organization, no credentials needed")
+	rootCmd.PersistentFlags().StringVar(&deps.options.snapshotFile, "from-snapshot", "", "run read-only commands offline against a snapshot written by \"aws snapshot\"")
+	rootCmd.PersistentFlags().StringVar(&deps.options.reportURI, "report-to", "-", `where reports are sent: "-" (stdout), a file path, file://, s3://bucket/key or https:// (POST)`)
+	rootCmd.PersistentFlags().StringArrayVar(&deps.options.publishTargets, "publish", nil, `where the results are published besides the report: "security-hub" imports the findings of lint, unrestricted, conform, check and audit, "cloudwatch" the metrics of metrics, unrestricted, snapshot diff and snapshot watch, s3://bucket/prefix/ archives the report (or snapshot) under a timestamped key (repeatable)`)
+	rootCmd.PersistentFlags().StringVar(&deps.options.cloudWatchNamespace, "cloudwatch-namespace", defaultCloudWatchNamespace, "namespace of the metrics published with --publish cloudwatch")
+	rootCmd.PersistentFlags().StringArrayVar(&deps.options.notifyTargets, "notify", nil, `where the drift found by "aws snapshot diff", "aws snapshot watch" and "gcp snapshot diff" and the findings of lint, unrestricted, conform, check and audit are notified: "slack" posts a summary to --webhook-url, sns:<topic ARN> publishes it to an SNS topic (repeatable)`)
+	rootCmd.PersistentFlags().StringVar(&deps.options.webhookURL, "webhook-url", "", "Slack incoming webhook receiving the notifications of --notify slack")
+	rootCmd.PersistentFlags().StringVar(&deps.options.historyTable, "history-table", "", `DynamoDB table keeping the snapshots of "aws snapshot" and the findings of lint, unrestricted, conform, check and audit, read by "aws history" and "aws snapshot diff --from"`)
+	rootCmd.PersistentFlags().StringVar(&deps.options.publishKMSKey, "publish-kms-key", "", "ID, ARN or alias of the KMS key encrypting the reports published to S3 (SSE-KMS)")
+	rootCmd.PersistentFlags().BoolVarP(&deps.options.verbose, "verbose", "v", false, "log retries and failed API calls to stderr")
+	rootCmd.PersistentFlags().BoolVar(&deps.options.debug, "debug", false, "log every API call and cache hit to stderr, along with what --verbose logs")
+	rootCmd.PersistentFlags().StringVar(&deps.options.logFormat, "log-format", "text", `format of the logs: "text" or "json"`)
+	rootCmd.PersistentFlags().BoolVarP(&deps.options.quiet, "quiet", "q", false, "don't display the progress of the scan on stderr")
+	rootCmd.PersistentFlags().BoolVar(&deps.options.noColor, "no-color", false, "don't color the text output, as does setting NO_COLOR")
+	rootCmd.PersistentFlags().BoolVar(&deps.options.profileScan, "profile-scan", false, "print the time spent per API operation and per analysis check to stderr")
+
+	rootCmd.PersistentFlags().StringVar(&deps.options.cacheFile, "cache-file", defaultCacheFile(), "warm cache written by \"cache warm\" and used by every command")
+	rootCmd.PersistentFlags().DurationVar(&deps.options.cacheMaxAge, "cache-max-age", 24*time.Hour, "warm caches older than this are ignored")
+	rootCmd.PersistentFlags().BoolVar(&deps.options.noCache, "no-cache", false, "ignore the warm cache and query the APIs")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+
+	rootCmd.AddCommand(newAwsCmd(deps))
+	rootCmd.AddCommand(newGcpCmd(deps))
+	rootCmd.AddCommand(newOrgCmd(deps))
+	rootCmd.AddCommand(newServeCmd(deps))
+	rootCmd.AddCommand(newCacheCmd(deps))
+
+	return rootCmd
+}
+
+// Sends the report to its sink and publishes it once the command is done.
+func finishReport(cmd *cobra.Command, deps *dependencies) error {
+	deps.progress.finish()
+	if err := closeReportSink(cmd.Context(), deps); err != nil {
+		return err
+	}
+	if err := publishToS3(cmd.Context(), deps, cmd); err != nil {
+		return err
+	}
+	if deps.options.profileScan {
+		deps.profile.write(deps.stderr)
+	}
+	return nil
+}
+
+// Cobra skips PersistentPostRunE when the command fails, but partial results
+// are a report all the same: it is finished before returning the error.
+func finishPartialResults(cmd *cobra.Command, deps *dependencies, err error) error {
+	var partial partialResultsError
+	if !errors.As(err, &partial) {
+		return err
+	}
+	if finishErr := finishReport(cmd, deps); finishErr != nil {
+		return fmt.Errorf("%w (%v)", finishErr, err)
+	}
+	return err
+}
+
+// Execute builds the commands with the real dependencies and runs the one of
+// the command line. This is called by main.main().
+// Interrupting the process (Ctrl-C, SIGTERM on spot reclaim) cancels the context
+// shared by all the commands so they can stop gracefully.
+func Execute() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// The first signal lets the scan save its checkpoint, a second one kills the process
+	context.AfterFunc(ctx, stop)
+
+	deps := defaultDependencies()
+	cmd, err := newRootCmd(deps).ExecuteContextC(ctx)
+	if err == nil {
+		return
+	}
+	deps.progress.finish()
+
+	// Standalone accounts get a degraded report instead of the error
+	if deps.standalone.Load() {
+		reportErr := reportStandaloneAccount(ctx, deps)
+		if reportErr == nil {
+			return
+		}
+		err = fmt.Errorf("%w (standalone account: %v)", err, reportErr)
+	}
+
+	cmd.PrintErrln(cmd.ErrPrefix(), err.Error())
+	// The usage only helps with mistakes in the command line, not with the
+	// outcomes of the exit code contract
+	code := exitCode(err)
+	if code == exitFailure {
+		cmd.Println(cmd.UsageString())
+	}
+	os.Exit(code)
 }
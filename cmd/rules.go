@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Custom rules evaluated by aws check --rules, e.g.
+//
+//	maxDepth: 4
+//	rules:
+//	  - name: production-guardrails
+//	    path: /Root/Workloads/Production
+//	    severity: HIGH
+//	    requiredSCPs: [scp-regions-01]
+//	    forbiddenSCPs: [scp-legacy-01]
+//	  - name: cost-allocation
+//	    path: /Root/Workloads/*/*
+//	    requiredTags: [CostCenter]
+type rulesFile struct {
+	MaxDepth int        `yaml:"maxDepth"` // levels of OUs below the root, unlimited if 0
+	Rules    []yamlRule `yaml:"rules"`
+}
+
+type yamlRule struct {
+	Name string `yaml:"name"`
+	// Glob pattern on the paths of the root, OUs and accounts (e.g. /Root/Sandbox/*),
+	// every one of them if empty
+	Path          string   `yaml:"path"`
+	Severity      string   `yaml:"severity"`      // MEDIUM if empty
+	RequiredSCPs  []string `yaml:"requiredSCPs"`  // names or IDs, attached or inherited
+	ForbiddenSCPs []string `yaml:"forbiddenSCPs"` // names or IDs, attached or inherited
+	RequiredTags  []string `yaml:"requiredTags"`  // keys, the root has no tags
+}
+
+// Loads and validates a rules file, unknown fields being errors so typos don't
+// silently disable a rule.
+func loadRulesFile(file string) (*rulesFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read rules file: %w", err)
+	}
+
+	rules := &rulesFile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(rules); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid rules file %s: %w", file, err)
+	}
+
+	if rules.MaxDepth < 0 {
+		return nil, fmt.Errorf("invalid rules file %s: maxDepth can't be negative", file)
+	}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("invalid rules file %s: rule #%d has no name", file, i+1)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("invalid rules file %s: rule %s: invalid path %q: %w", file, rule.Name, rule.Path, err)
+		}
+		if _, err := parseSeverity(rule.Severity); err != nil {
+			return nil, fmt.Errorf("invalid rules file %s: rule %s: %w", file, rule.Name, err)
+		}
+		if len(rule.RequiredSCPs)+len(rule.ForbiddenSCPs)+len(rule.RequiredTags) == 0 {
+			return nil, fmt.Errorf("invalid rules file %s: rule %s checks nothing, set requiredSCPs, forbiddenSCPs or requiredTags", file, rule.Name)
+		}
+	}
+	return rules, nil
+}
+
+// Evaluates the rules against the snapshot, checking the root, then every OU
+// and every account.
+func (r *rulesFile) evaluate(snapshot *orgSnapshot) []ruleViolation {
+	ids := []string{snapshot.RootID}
+	for _, ou := range snapshot.OUs {
+		ids = append(ids, ou.ID)
+	}
+	for _, account := range snapshot.Accounts {
+		ids = append(ids, account.ID)
+	}
+
+	var violations []ruleViolation
+	if r.MaxDepth > 0 {
+		for _, ou := range snapshot.OUs {
+			// The path of an OU right below the root is /Root/<name>
+			if depth := strings.Count(snapshot.path(ou.ID), "/") - 1; depth > r.MaxDepth {
+				violations = append(violations, ruleViolation{
+					Rule:     "max-depth",
+					Message:  fmt.Sprintf("nested %d levels below the root, more than %d", depth, r.MaxDepth),
+					Resource: ou.ID,
+				})
+			}
+		}
+	}
+
+	for _, rule := range r.Rules {
+		for _, id := range ids {
+			if match, _ := path.Match(rule.Path, snapshot.path(id)); rule.Path != "" && !match {
+				continue
+			}
+			violation := func(format string, args ...any) {
+				violations = append(violations, ruleViolation{Rule: rule.Name, Message: fmt.Sprintf(format, args...), Severity: rule.Severity, Resource: id})
+			}
+
+			applied := snapshot.appliedPolicies(id, string(types.PolicyTypeServiceControlPolicy))
+			for _, required := range rule.RequiredSCPs {
+				if !slices.ContainsFunc(applied, func(policy snapshotPolicy) bool { return policyIs(policy, required) }) {
+					violation("required SCP %s is not applied", required)
+				}
+			}
+			for _, forbidden := range rule.ForbiddenSCPs {
+				for _, policy := range applied {
+					if policyIs(policy, forbidden) {
+						violation("forbidden SCP %s [%s] is applied", policy.Name, policy.ID)
+					}
+				}
+			}
+
+			if id == snapshot.RootID {
+				continue
+			}
+			tags := snapshot.tags(id)
+			for _, key := range rule.RequiredTags {
+				if _, ok := tags[key]; !ok {
+					violation("required tag %s is missing", key)
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// Reports whether a policy is the one named or identified by nameOrID.
+func policyIs(policy snapshotPolicy, nameOrID string) bool {
+	return policy.ID == nameOrID || policy.Name == nameOrID
+}
+
+// Lists the policies of policyType applied to an entity, attached to it or
+// inherited from its parents, each policy once.
+func (o *orgSnapshot) appliedPolicies(id, policyType string) []snapshotPolicy {
+	var applied []snapshotPolicy
+	for current, ok := id, true; ok && current != ""; current, ok = o.parent(current) {
+		for _, policy := range o.attachedPolicies(current, policyType) {
+			if !slices.ContainsFunc(applied, func(p snapshotPolicy) bool { return p.ID == policy.ID }) {
+				applied = append(applied, policy)
+			}
+		}
+	}
+	return applied
+}
+
+func (o *orgSnapshot) tags(id string) map[string]string {
+	if account, ok := o.account(id); ok {
+		return account.Tags
+	}
+	for _, ou := range o.OUs {
+		if ou.ID == id {
+			return ou.Tags
+		}
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ariguillegp/policy-scout/internal/aioptout"
+	"github.com/ariguillegp/policy-scout/internal/backuppolicy"
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/ariguillegp/policy-scout/internal/tagpolicy"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// scoreOptions are the flags of the aws score command.
+type scoreOptions struct {
+	ouID      string // OU whose subtree is scored, the whole org if empty
+	badgesDir string // where the SVG badges are written, none if empty
+}
+
+// newScoreCmd creates the aws score command.
+func newScoreCmd(deps *dependencies) *cobra.Command {
+	options := &scoreOptions{}
+	scoreCmd := &cobra.Command{
+		Use:   "score",
+		Short: "Computes a 0-100 governance score per OU and account, optionally as SVG badges",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayGovernanceScores(cmd.Context(), deps, options.ouID, options.badgesDir)
+		},
+	}
+
+	scoreCmd.Flags().StringVar(&options.ouID, "ou-id", "", "OU ID whose subtree is scored (defaults to the org root)")
+	scoreCmd.Flags().StringVar(&options.badgesDir, "badges-dir", "", "directory where an SVG badge is written for every OU and account")
+
+	return scoreCmd
+}
+
+// Default weight of every governance check in the score, they can be changed in
+// the config file.
+var defaultScoreWeights = map[string]int{
+	"scp":      40, // the SCPs restrict something (not only FullAWSAccess)
+	"backup":   20, // there is an effective backup plan
+	"tags":     20, // there is an effective tag policy
+	"aiOptOut": 20, // opted out of every AI service
+}
+
+// A governance check of an account. applies is false when the check makes no sense
+// for the account, e.g. SCPs never restrict the management account.
+type governanceCheck func(ctx context.Context, client orgAPI, accountID string, management bool) (passed, applies bool, err error)
+
+// Governance checks, keyed by name.
+var governanceChecks = map[string]governanceCheck{
+	"scp":      checkSCPRestrictions,
+	"backup":   checkBackupCoverage,
+	"tags":     checkTagPolicy,
+	"aiOptOut": checkAIOptOut,
+}
+
+// The score of an account, or the average score of the accounts below an OU.
+type scoredNode struct {
+	Type     string
+	ID       string
+	Name     string
+	Score    int
+	Accounts int      // accounts contributing to the score
+	Failed   []string // failed checks, accounts only
+	Children []*scoredNode
+}
+
+// displayGovernanceScores scores every account of the subtree and every OU (the
+// average of the accounts below it), optionally writing an SVG badge for each one.
+func displayGovernanceScores(ctx context.Context, deps *dependencies, startOUID, badgesDir string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	startID, err := getStartingID(ctx, client, startOUID)
+	if err != nil {
+		return err
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	tree, err := scoreSubtree(ctx, deps, client, startID, managementAccountID)
+	if err != nil {
+		return err
+	}
+
+	if badgesDir != "" {
+		if err := os.MkdirAll(badgesDir, 0o755); err != nil {
+			return err
+		}
+	}
+	return printScores(deps.report, tree, "", badgesDir)
+}
+
+// Scores the accounts below parentID, skipping excluded entities.
+func scoreSubtree(ctx context.Context, deps *dependencies, client orgAPI, parentID, managementAccountID string) (*scoredNode, error) {
+	name, err := client.scout().Name(ctx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting name for id %s: %w", parentID, err)
+	}
+	node := &scoredNode{Type: orgtree.OUNode, ID: parentID, Name: name}
+	if strings.HasPrefix(parentID, "r-") {
+		node.Type = orgtree.RootNode
+	}
+
+	total := 0
+	childAccounts, err := client.scout().Children(ctx, parentID, types.ChildTypeAccount)
+	if err != nil {
+		return nil, err
+	}
+	for _, childID := range childAccounts {
+		excluded, err := isExcluded(ctx, client, childID)
+		if err != nil {
+			return nil, err
+		}
+		if excluded {
+			continue
+		}
+
+		account, err := scoreAccount(ctx, deps, client, childID, childID == managementAccountID)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, account)
+		total += account.Score
+		node.Accounts++
+	}
+
+	childOUs, err := client.scout().Children(ctx, parentID, types.ChildTypeOrganizationalUnit)
+	if err != nil {
+		return nil, err
+	}
+	for _, childID := range childOUs {
+		excluded, err := isExcluded(ctx, client, childID)
+		if err != nil {
+			return nil, err
+		}
+		if excluded {
+			continue
+		}
+
+		ou, err := scoreSubtree(ctx, deps, client, childID, managementAccountID)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, ou)
+		total += ou.Score * ou.Accounts
+		node.Accounts += ou.Accounts
+	}
+
+	if node.Accounts > 0 {
+		node.Score = int(math.Round(float64(total) / float64(node.Accounts)))
+	}
+	return node, nil
+}
+
+// Runs every governance check on an account and weighs the results with the
+// weights of the run.
+func scoreAccount(ctx context.Context, deps *dependencies, client orgAPI, accountID string, management bool) (*scoredNode, error) {
+	name, err := client.scout().Name(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting name for id %s: %w", accountID, err)
+	}
+	node := &scoredNode{Type: orgtree.AccountNode, ID: accountID, Name: name, Accounts: 1}
+
+	passedWeight, totalWeight := 0, 0
+	for _, checkName := range sortedKeys(governanceChecks) {
+		stop := deps.profile.time(checkPhase, checkName)
+		passed, applies, err := governanceChecks[checkName](ctx, client, accountID, management)
+		stop()
+		if err != nil {
+			return nil, err
+		}
+		if !applies {
+			continue
+		}
+		totalWeight += deps.options.scoreWeights[checkName]
+		if passed {
+			passedWeight += deps.options.scoreWeights[checkName]
+		} else {
+			node.Failed = append(node.Failed, checkName)
+		}
+	}
+
+	if totalWeight > 0 {
+		node.Score = int(math.Round(100 * float64(passedWeight) / float64(totalWeight)))
+	}
+	return node, nil
+}
+
+func checkSCPRestrictions(ctx context.Context, client orgAPI, accountID string, management bool) (bool, bool, error) {
+	if management {
+		return false, false, nil
+	}
+	chain, err := getPolicyChain(ctx, client, accountID, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return false, false, err
+	}
+	return !scp.Unrestricted(chain), true, nil
+}
+
+func checkBackupCoverage(ctx context.Context, client orgAPI, accountID string, _ bool) (bool, bool, error) {
+	content, found, err := getEffectivePolicy(ctx, client, accountID, types.EffectivePolicyTypeBackupPolicy)
+	if err != nil || !found {
+		return false, true, err
+	}
+	effective, err := backuppolicy.Parse(content)
+	if err != nil {
+		return false, true, fmt.Errorf("effective backup policy of %s: %w", accountID, err)
+	}
+	return len(effective.Plans) > 0, true, nil
+}
+
+func checkTagPolicy(ctx context.Context, client orgAPI, accountID string, _ bool) (bool, bool, error) {
+	content, found, err := getEffectivePolicy(ctx, client, accountID, types.EffectivePolicyTypeTagPolicy)
+	if err != nil || !found {
+		return false, true, err
+	}
+	effective, err := tagpolicy.Parse(content)
+	if err != nil {
+		return false, true, fmt.Errorf("effective tag policy of %s: %w", accountID, err)
+	}
+	return len(effective.Tags) > 0, true, nil
+}
+
+func checkAIOptOut(ctx context.Context, client orgAPI, accountID string, _ bool) (bool, bool, error) {
+	content, found, err := getEffectivePolicy(ctx, client, accountID, types.EffectivePolicyTypeAiservicesOptOutPolicy)
+	if err != nil || !found {
+		return false, true, err
+	}
+	effective, err := aioptout.Parse(content)
+	if err != nil {
+		return false, true, fmt.Errorf("effective AI services opt-out policy of %s: %w", accountID, err)
+	}
+	return effective.OptedOut(), true, nil
+}
+
+// Prints the scores as a tree, writing the badge of every node if requested.
+func printScores(w io.Writer, node *scoredNode, prefix, badgesDir string) error {
+	switch {
+	case node.Type == orgtree.AccountNode:
+		failed := ""
+		if len(node.Failed) > 0 {
+			failed = " (failing: " + strings.Join(node.Failed, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%s|-- Account: %s [%s]: %d/100%s\n", prefix, node.Name, node.ID, node.Score, failed)
+	case node.Accounts == 0:
+		fmt.Fprintf(w, "%s|-- %s [%s]: no accounts\n", prefix, scoredNodeLabel(node), node.ID)
+	default:
+		fmt.Fprintf(w, "%s|-- %s [%s]: %d/100 (%d accounts)\n", prefix, scoredNodeLabel(node), node.ID, node.Score, node.Accounts)
+	}
+
+	if badgesDir != "" && node.Accounts > 0 {
+		if err := writeBadge(filepath.Join(badgesDir, node.ID+".svg"), "governance", fmt.Sprintf("%d%%", node.Score), badgeColor(node.Score)); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range node.Children {
+		if err := printScores(w, child, prefix+indent, badgesDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scoredNodeLabel(node *scoredNode) string {
+	if node.Type == orgtree.RootNode {
+		return "Root"
+	}
+	return "OU: " + node.Name
+}
+
+// Colors of the badges, like the usual coverage badges.
+func badgeColor(score int) string {
+	switch {
+	case score >= 90:
+		return "#4c1"
+	case score >= 75:
+		return "#97ca00"
+	case score >= 50:
+		return "#dfb317"
+	case score >= 25:
+		return "#fe7d37"
+	default:
+		return "#e05d44"
+	}
+}
+
+// Writes an SVG badge in the style of shields.io. Text widths are estimated,
+// which is good enough for short labels.
+func writeBadge(path, label, value, color string) error {
+	tmpl, err := template.ParseFS(templates, "templates/badge.svg")
+	if err != nil {
+		return err
+	}
+
+	const charWidth, padding = 7, 10
+	labelWidth := len(label)*charWidth + padding
+	valueWidth := len(value)*charWidth + padding
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return tmpl.Execute(f, map[string]interface{}{
+		"Label":      label,
+		"Value":      value,
+		"Color":      color,
+		"Width":      labelWidth + valueWidth,
+		"LabelWidth": labelWidth,
+		"ValueWidth": valueWidth,
+		"LabelX":     labelWidth / 2,
+		"ValueX":     labelWidth + valueWidth/2,
+	})
+}
+
+// Returns the keys of a map in alphabetical order.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
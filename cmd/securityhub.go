@@ -0,0 +1,200 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	securityhubtypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+)
+
+// Version of the AWS Security Finding Format (ASFF) of the imported findings.
+const asffSchemaVersion = "2018-10-08"
+
+// BatchImportFindings accepts up to 100 findings per call.
+const securityHubBatchSize = 100
+
+// auditFinding is a problem reported by lint, unrestricted or conform, in a
+// shape that can be converted to ASFF.
+type auditFinding struct {
+	check       string // e.g. "lint/statement-size", also part of the ID of the finding
+	severity    securityhubtypes.SeverityLabel
+	title       string
+	description string
+	// The resource the finding is about: an SCP (its ARN) or an account (its ID)
+	resourceType string
+	resourceID   string
+	detail       string // distinguishes findings of the same check on the same resource, e.g. a statement
+}
+
+// Resource types of the findings. Security Hub has no type for the
+// Organizations policies and roots.
+const (
+	accountResource = "AwsAccount"
+	ouResource      = "AwsOrganizationsOrganizationalUnit"
+	policyResource  = "Other"
+	rootResource    = "Other"
+)
+
+// securityHubAPI is the part of the Security Hub API used by the commands.
+type securityHubAPI interface {
+	BatchImportFindings(ctx context.Context, params *securityhub.BatchImportFindingsInput, optFns ...func(*securityhub.Options)) (*securityhub.BatchImportFindingsOutput, error)
+}
+
+// securityHub is where the findings are imported: the default product of the
+// account and region of the local AWS config.
+type securityHub struct {
+	client    securityHubAPI
+	accountID string
+	region    string
+}
+
+// Creates the Security Hub of the local AWS config.
+func (d *dependencies) newSecurityHub(ctx context.Context) (*securityHub, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caller, err := d.getCallerIdentity(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &securityHub{client: securityhub.NewFromConfig(cfg), accountID: caller.AccountID, region: caller.Region}, nil
+}
+
+// Imports the findings of a command into Security Hub with --publish
+// security-hub, keeps them in the history with --history-table and notifies them
+// with --notify. The IDs of the findings are stable, so publishing the same
+// findings again updates them.
+func publishFindings(ctx context.Context, deps *dependencies, command string, findings []auditFinding) error {
+	if err := recordFindings(ctx, deps, command, findings); err != nil {
+		return err
+	}
+	if err := notifyFindings(ctx, deps, command, findings); err != nil {
+		return err
+	}
+	if !slices.Contains(deps.options.publishTargets, publishSecurityHub) || len(findings) == 0 {
+		return nil
+	}
+
+	hub, err := deps.securityHub(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := deps.now().UTC().Format(time.RFC3339)
+	imported := 0
+	var failed []string
+	for start := 0; start < len(findings); start += securityHubBatchSize {
+		batch := findings[start:min(start+securityHubBatchSize, len(findings))]
+		asff := make([]securityhubtypes.AwsSecurityFinding, 0, len(batch))
+		for _, finding := range batch {
+			asff = append(asff, hub.convert(finding, now))
+		}
+
+		result, err := hub.client.BatchImportFindings(ctx, &securityhub.BatchImportFindingsInput{Findings: asff})
+		if err != nil {
+			return fmt.Errorf("error importing findings into Security Hub: %w", err)
+		}
+		imported += int(aws.ToInt32(result.SuccessCount))
+		for _, failure := range result.FailedFindings {
+			failed = append(failed, fmt.Sprintf("%s: %s", aws.ToString(failure.Id), aws.ToString(failure.ErrorMessage)))
+		}
+	}
+
+	fmt.Fprintf(deps.stderr, "%s findings imported into Security Hub (account %s, %s)\n", formatCount(imported), hub.accountID, hub.region)
+	if len(failed) > 0 {
+		return fmt.Errorf("%s findings couldn't be imported into Security Hub: %s", formatCount(len(failed)), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Converts a finding to ASFF. Findings belong to the account importing them, the
+// account (or policy) they are about is their resource.
+func (h *securityHub) convert(finding auditFinding, now string) securityhubtypes.AwsSecurityFinding {
+	id := fmt.Sprintf("policy-scout/%s/%s", finding.check, finding.resourceID)
+	if finding.detail != "" {
+		id += "/" + finding.detail
+	}
+	return securityhubtypes.AwsSecurityFinding{
+		SchemaVersion: aws.String(asffSchemaVersion),
+		Id:            aws.String(id),
+		ProductArn:    aws.String(fmt.Sprintf("arn:aws:securityhub:%s:%s:product/%s/default", h.region, h.accountID, h.accountID)),
+		GeneratorId:   aws.String("policy-scout/" + finding.check),
+		AwsAccountId:  aws.String(h.accountID),
+		Types:         []string{"Software and Configuration Checks/AWS Security Best Practices"},
+		CreatedAt:     aws.String(now),
+		UpdatedAt:     aws.String(now),
+		Severity:      &securityhubtypes.Severity{Label: finding.severity},
+		Title:         aws.String(finding.title),
+		Description:   aws.String(finding.description),
+		Resources: []securityhubtypes.Resource{{
+			Type: aws.String(finding.resourceType),
+			Id:   aws.String(finding.resourceID),
+		}},
+		RecordState: securityhubtypes.RecordStateActive,
+	}
+}
+
+// ID of an account as a resource of a finding.
+func accountResourceID(accountID string) string {
+	return "AWS::::Account:" + accountID
+}
+
+// Severities of the findings, the most severe first.
+var severityLabels = []securityhubtypes.SeverityLabel{
+	securityhubtypes.SeverityLabelCritical,
+	securityhubtypes.SeverityLabelHigh,
+	securityhubtypes.SeverityLabelMedium,
+	securityhubtypes.SeverityLabelLow,
+	securityhubtypes.SeverityLabelInformational,
+}
+
+// Sorts the findings from the most to the least severe, keeping the order of the
+// findings of the same severity.
+func sortBySeverity(findings []auditFinding) []auditFinding {
+	sorted := slices.Clone(findings)
+	slices.SortStableFunc(sorted, func(a, b auditFinding) int {
+		return slices.Index(severityLabels, a.severity) - slices.Index(severityLabels, b.severity)
+	})
+	return sorted
+}
+
+// Counts the findings by severity, e.g. "1 HIGH, 2 MEDIUM".
+func formatSeverityCounts(findings []auditFinding) string {
+	counts := map[securityhubtypes.SeverityLabel]int{}
+	for _, finding := range findings {
+		counts[finding.severity]++
+	}
+	var bySeverity []string
+	for _, severity := range severityLabels {
+		if counts[severity] > 0 {
+			bySeverity = append(bySeverity, fmt.Sprintf("%s %s", formatCount(counts[severity]), severity))
+		}
+	}
+	return strings.Join(bySeverity, ", ")
+}
+
+// Severity of the findings of the lint checks and of Access Analyzer.
+func lintSeverity(severity string) securityhubtypes.SeverityLabel {
+	switch severity {
+	case scp.Error, "security warning":
+		return securityhubtypes.SeverityLabelHigh
+	case scp.Warning:
+		return securityhubtypes.SeverityLabelMedium
+	case scp.Info, "suggestion":
+		return securityhubtypes.SeverityLabelLow
+	default:
+		return securityhubtypes.SeverityLabelInformational
+	}
+}
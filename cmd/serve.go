@@ -0,0 +1,79 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Environment variable holding the signing secret of the Slack app.
+const slackSigningSecretEnv = "SLACK_SIGNING_SECRET"
+
+// newServeCmd creates the serve command.
+func newServeCmd(deps *dependencies) *cobra.Command {
+	var (
+		listenAddress   string        // address where the HTTP server listens
+		metricsInterval time.Duration // time between the scans of the metrics served at /metrics, disabled if 0
+	)
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serves the lookups over HTTP, e.g. as the backend of a Slack slash command",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(cmd.Context(), deps, listenAddress, metricsInterval)
+		},
+	}
+
+	serveCmd.Flags().StringVar(&listenAddress, "listen", ":8080", "address where the HTTP server listens")
+	serveCmd.Flags().DurationVar(&metricsInterval, "metrics-interval", 0, "serve the Prometheus metrics of \"aws metrics\" at /metrics, scanning the org again at this interval (disabled if 0)")
+
+	return serveCmd
+}
+
+// serve runs the HTTP server until the context is cancelled (Ctrl-C, SIGTERM).
+// The Slack slash command endpoint is enabled when the signing secret of the
+// Slack app is available in the environment, the metrics endpoint when
+// --metrics-interval is set.
+func serve(ctx context.Context, deps *dependencies, address string, metricsInterval time.Duration) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	if secret := os.Getenv(slackSigningSecretEnv); secret != "" {
+		mux.Handle("/slack/commands", &slackCommandHandler{ctx: ctx, deps: deps, client: client, signingSecret: []byte(secret)})
+	} else {
+		fmt.Fprintf(deps.stderr, "%s is not set, the Slack endpoint is disabled\n", slackSigningSecretEnv)
+	}
+	if metricsInterval > 0 {
+		metrics := &metricsHandler{}
+		go metrics.refresh(ctx, deps, metricsInterval)
+		mux.Handle("/metrics", metrics)
+	}
+
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx) //nolint:errcheck
+	}()
+
+	// The server runs until stopped, there is no scan to report the progress of
+	deps.progress.finish()
+	fmt.Fprintf(deps.stdout, "Listening on %s\n", address)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// simulateOptions are the flags of the aws simulate command.
+type simulateOptions struct {
+	accountID string   // account where the action is simulated
+	action    string   // action being simulated, e.g. s3:PutObject
+	region    string   // region of the request (aws:RequestedRegion)
+	resource  string   // ARN of the resource of the request
+	context   []string // additional condition keys, as key=value
+}
+
+// newSimulateCmd creates the aws simulate command.
+func newSimulateCmd(deps *dependencies) *cobra.Command {
+	options := &simulateOptions{}
+	simulateCmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Decides whether the SCPs of an account allow an action",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request, err := buildSimulationRequest(options.action, options.region, options.resource, options.context)
+			if err != nil {
+				return err
+			}
+			return simulateRequest(cmd.Context(), deps, options.accountID, request)
+		},
+	}
+
+	simulateCmd.Flags().StringVar(&options.accountID, "account-id", "", "aws account ID where the action is simulated")
+	simulateCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+	simulateCmd.Flags().StringVar(&options.action, "action", "", "action to simulate, e.g. s3:PutObject")
+	simulateCmd.MarkFlagRequired("action") //nolint:gosec,errcheck
+
+	simulateCmd.Flags().StringVar(&options.region, "region", "", "region of the request, used for aws:RequestedRegion conditions")
+	simulateCmd.Flags().StringVar(&options.resource, "resource", "", "ARN of the resource of the request (any resource if empty)")
+	simulateCmd.Flags().StringArrayVar(&options.context, "context", nil, "condition key of the request as key=value, e.g. aws:PrincipalArn=arn:aws:iam::123456789012:role/Admin (repeatable)")
+
+	return simulateCmd
+}
+
+// Builds the simulated request from the command line flags.
+func buildSimulationRequest(action, region, resource string, keyValues []string) (scp.Request, error) {
+	if !strings.Contains(action, ":") {
+		return scp.Request{}, fmt.Errorf("invalid action %q: it must look like service:Action", action)
+	}
+
+	request := scp.Request{Action: action, Resource: resource, Context: map[string][]string{}}
+	if region != "" {
+		request.Context["aws:RequestedRegion"] = []string{region}
+	}
+	for _, kv := range keyValues {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return scp.Request{}, fmt.Errorf("invalid context %q: it must look like key=value", kv)
+		}
+		request.Context[key] = append(request.Context[key], value)
+	}
+	return request, nil
+}
+
+// Evaluates the request against the SCP inheritance chain of the account and
+// explains the decision.
+func simulateRequest(ctx context.Context, deps *dependencies, targetAccountID string, request scp.Request) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	chain, err := getPolicyChain(ctx, client, targetAccountID, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+	account := chain[len(chain)-1]
+	if targetAccountID == managementAccountID {
+		fmt.Fprintf(deps.report, "%s for account %s [%s]: ALLOWED (SCPs don't apply to the management account)\n", requestSubject(request), account.TargetName, account.TargetID)
+		return nil
+	}
+
+	decision := scp.Evaluate(chain, request)
+	printDecision(deps.report, account, request, decision)
+	return nil
+}
+
+// Prints a decision along with the statements responsible for it.
+func printDecision(w io.Writer, account scp.Level, request scp.Request, decision scp.Decision) {
+	verdict := "DENIED"
+	if decision.Allowed {
+		verdict = "ALLOWED"
+	}
+	// Denies could still apply to an allowed request, allows to an implicitly denied one
+	for _, rule := range decision.Unevaluated {
+		if decision.DeniedBy == nil && (rule.Statement.Effect == scp.Deny) == decision.Allowed {
+			verdict += ", unless a condition that can't be evaluated matches"
+			break
+		}
+	}
+
+	fmt.Fprintf(w, "%s for account %s [%s]: %s\n", requestSubject(request), account.TargetName, account.TargetID, verdict)
+
+	switch {
+	case decision.DeniedBy != nil:
+		fmt.Fprintf(w, "%s|-- Explicit deny: %s\n", indent, formatRule(*decision.DeniedBy))
+	case decision.NotAllowedAt != nil:
+		fmt.Fprintf(w, "%s|-- Implicit deny: no SCP attached to %s [%s] allows it\n", indent, decision.NotAllowedAt.TargetName, decision.NotAllowedAt.TargetID)
+	default:
+		for _, rule := range decision.AllowedBy {
+			source := rule.PolicyName
+			if rule.Statement.Sid != "" {
+				source += ", statement " + rule.Statement.Sid
+			}
+			fmt.Fprintf(w, "%s|-- %s [%s]: allowed by %s\n", indent, rule.TargetName, rule.TargetID, source)
+		}
+	}
+
+	printUnevaluated(w, indent, decision)
+
+	if len(decision.MissingKeys) > 0 {
+		fmt.Fprintf(w, "%s|-- Assumed absent from the request (use --context to set them): %s\n", indent, strings.Join(decision.MissingKeys, ", "))
+	}
+}
+
+// Prints the statements of a decision whose conditions couldn't be evaluated,
+// the decision only holds if they don't match.
+func printUnevaluated(w io.Writer, prefix string, decision scp.Decision) {
+	for _, rule := range decision.Unevaluated {
+		fmt.Fprintf(w, "%s|-- Unevaluated condition (unsupported %s), assumed not to match: %s %s\n", prefix, strings.Join(rule.Statement.Condition.UnsupportedOperators(), ", "), strings.ToLower(rule.Statement.Effect), formatRule(rule))
+	}
+}
+
+// Describes what a request does, e.g. "s3:PutObject on arn:aws:s3:::bucket in eu-west-1".
+func requestSubject(request scp.Request) string {
+	subject := request.Action
+	if request.Resource != "" {
+		subject += " on " + request.Resource
+	}
+	if region, ok := request.Context["aws:RequestedRegion"]; ok {
+		subject += " in " + strings.Join(region, ", ")
+	}
+	return subject
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+func TestUnevaluatedConditions(t *testing.T) {
+	const denyBinaryDocument = `{"Version":"2012-10-17","Statement":[{"Sid":"DenyBinary","Effect":"Deny","Action":"s3:*","Resource":"*","Condition":{"BinaryEquals":{"aws:SourceIdentity":"QmluYXJ5"}}}]}`
+	org := newTestOrg().
+		AddPolicy("p-denybinary", "deny-binary", types.PolicyTypeServiceControlPolicy, denyBinaryDocument).
+		AttachPolicy("ou-root-work", "p-FullAWSAccess").
+		AttachPolicy("222222222222", "p-FullAWSAccess").
+		AttachPolicy("ou-root-work", "p-denybinary")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant string
+	}{
+		{
+			name: "simulate",
+			args: []string{"aws", "simulate", "--account-id", "222222222222", "--action", "s3:PutObject"},
+			want: []string{
+				"s3:PutObject for account payments [222222222222]: ALLOWED, unless a condition that can't be evaluated matches\n",
+				indent + "|-- Unevaluated condition (unsupported BinaryEquals), assumed not to match: deny s3:* when BinaryEquals aws:SourceIdentity [QmluYXJ5] (deny-binary, statement DenyBinary, attached to Workloads [ou-root-work])\n",
+			},
+		},
+		{
+			name:    "simulate of another action",
+			args:    []string{"aws", "simulate", "--account-id", "222222222222", "--action", "ec2:RunInstances"},
+			want:    []string{"ec2:RunInstances for account payments [222222222222]: ALLOWED\n"},
+			notWant: "Unevaluated condition",
+		},
+		{
+			name: "explain",
+			args: []string{"aws", "explain", "--account-id", "222222222222", "--action", "s3:PutObject"},
+			want: []string{indent + "|-- Denied by deny-binary, statement DenyBinary, when BinaryEquals aws:SourceIdentity [QmluYXJ5] (unsupported BinaryEquals, can't be evaluated by aws simulate)\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runCommand(t, org, tt.args...)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("%s wrote:\n%s\nwant it to contain:\n%s", tt.name, got, want)
+				}
+			}
+			if tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("%s wrote:\n%s\nwant it not to contain %q", tt.name, got, tt.notWant)
+			}
+		})
+	}
+}
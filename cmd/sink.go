@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// sink is a destination for a report. Reports are written to the sink as they are
+// generated and published when it is closed, so a failed command never leaves a
+// partial report behind (stdout excepted).
+type sink interface {
+	io.Writer
+	Close(ctx context.Context) error
+}
+
+// Opens the sink selected by uri, reports sent to "-" are written to stdout:
+//
+//   - standard output
+//     report.txt, file:///...  a local file
+//     s3://bucket/key          an S3 object, written with the AWS credentials
+//     https://host/path        an HTTP POST request with the report as its body
+func openSink(uri string, deps *dependencies) (sink, error) {
+	if uri == "" || uri == "-" {
+		return stdoutSink{w: deps.stdout, progress: deps.progress}, nil
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" {
+		return &fileSink{path: uri}, nil
+	}
+
+	switch parsed.Scheme {
+	case "file":
+		if parsed.Path == "" {
+			return nil, fmt.Errorf("invalid report destination %q: no file path", uri)
+		}
+		return &fileSink{path: parsed.Path}, nil
+	case "s3":
+		key := strings.TrimPrefix(parsed.Path, "/")
+		if parsed.Host == "" || key == "" {
+			return nil, fmt.Errorf("invalid report destination %q: expected s3://bucket/key", uri)
+		}
+		return &s3Sink{bucket: parsed.Host, key: key, demo: deps.options.demo, client: deps.s3Client}, nil
+	case "https", "http":
+		return &httpSink{url: uri, client: deps.httpClient}, nil
+	default:
+		return nil, fmt.Errorf("invalid report destination %q: unsupported scheme %s", uri, parsed.Scheme)
+	}
+}
+
+// Opens the sink of --report-to. Called before running any command.
+func openReportSink(deps *dependencies) error {
+	var err error
+	if deps.sink, err = openSink(deps.options.reportURI, deps); err != nil {
+		return err
+	}
+	deps.report = deps.sink
+	// A copy is kept to be archived with --publish s3://
+	if publishingToS3(&deps.options) {
+		deps.report = io.MultiWriter(deps.sink, &deps.publication)
+	}
+	return nil
+}
+
+// Publishes the report written by the command. Called once it succeeded.
+func closeReportSink(ctx context.Context, deps *dependencies) error {
+	if deps.sink == nil {
+		return nil
+	}
+	if err := deps.sink.Close(ctx); err != nil {
+		return fmt.Errorf("couldn't send report to %s: %w", deps.options.reportURI, err)
+	}
+	return nil
+}
+
+// Writes the report as it is generated, there is nothing to publish. The
+// progress indicator shares the terminal, so it stops when the report starts.
+type stdoutSink struct {
+	w        io.Writer
+	progress *scanProgress
+}
+
+func (s stdoutSink) Write(p []byte) (int, error) {
+	s.progress.finish()
+	return s.w.Write(p)
+}
+
+func (stdoutSink) Close(context.Context) error { return nil }
+
+type fileSink struct {
+	bytes.Buffer
+	path string
+}
+
+func (s *fileSink) Close(context.Context) error {
+	return os.WriteFile(s.path, s.Bytes(), 0o644) //nolint:gosec
+}
+
+// s3API is the part of the S3 API used by the commands.
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Creates the S3 client of the local AWS config.
+func (d *dependencies) newS3Client(ctx context.Context) (s3API, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+type s3Sink struct {
+	bytes.Buffer
+	bucket, key string
+	kmsKeyID    string // SSE-KMS key, the default encryption of the bucket if empty
+	demo        bool   // S3 is not available in demo mode
+	client      func(ctx context.Context) (s3API, error)
+}
+
+func (s *s3Sink) Close(ctx context.Context) error {
+	if s.demo {
+		return errors.New("S3 is not available in demo mode")
+	}
+
+	client, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	contentType := http.DetectContentType(s.Bytes())
+	input := &s3.PutObjectInput{
+		Bucket:      &s.bucket,
+		Key:         &s.key,
+		Body:        bytes.NewReader(s.Bytes()),
+		ContentType: &contentType,
+	}
+	if s.kmsKeyID != "" {
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = &s.kmsKeyID
+	}
+	_, err = client.PutObject(ctx, input)
+	return err
+}
+
+type httpSink struct {
+	bytes.Buffer
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Close(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(s.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(s.Bytes()))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests older than this are rejected to prevent replay attacks.
+const slackMaxRequestAge = 5 * time.Minute
+
+// Time given to a lookup before giving up, Slack accepts delayed responses for 30 minutes.
+const slackLookupTimeout = 5 * time.Minute
+
+// Help displayed for unknown slash command invocations.
+const slackUsage = "Usage: `/policy-scout path ACCOUNT_ID` displays the path from the org root to the account and its SCPs"
+
+// Handles the invocations of the /policy-scout Slack slash command.
+type slackCommandHandler struct {
+	ctx           context.Context // cancelled when the server stops
+	deps          *dependencies
+	client        orgAPI
+	signingSecret []byte
+}
+
+// A message sent back to Slack.
+type slackMessage struct {
+	ResponseType string `json:"response_type,omitempty"` // "ephemeral" (only the user sees it) or "in_channel", unused by incoming webhooks
+	Text         string `json:"text"`
+}
+
+// ServeHTTP verifies the request comes from Slack and runs the requested lookup.
+// Slack expects an answer within 3 seconds, so lookups are acknowledged right away
+// and their result is posted later to the response URL of the command.
+func (h *slackCommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.verify(r.Header, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) != 2 || args[0] != "path" {
+		writeSlackMessage(w, slackMessage{ResponseType: "ephemeral", Text: slackUsage})
+		return
+	}
+
+	targetAccountID, responseURL := args[1], form.Get("response_url")
+	go h.lookupPath(targetAccountID, responseURL)
+
+	writeSlackMessage(w, slackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf("Looking up account %s...", targetAccountID)})
+}
+
+// Checks the signature of the request, as described in
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func (h *slackCommandHandler) verify(header http.Header, body []byte) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp")
+	}
+	if age := h.deps.now().Sub(time.Unix(seconds, 0)); age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return fmt.Errorf("request timestamp too far from the current time")
+	}
+
+	mac := hmac.New(sha256.New, h.signingSecret)
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("invalid request signature")
+	}
+	return nil
+}
+
+// Runs the path/SCP lookup of an account and posts the result to the response URL.
+func (h *slackCommandHandler) lookupPath(targetAccountID, responseURL string) {
+	ctx, cancel := context.WithTimeout(h.ctx, slackLookupTimeout)
+	defer cancel()
+
+	// Pick up the latest data of "cache warm"
+	if err := loadWarmCache(h.deps); err != nil {
+		fmt.Fprintf(h.deps.stderr, "%v\n", err)
+	}
+
+	message := slackMessage{ResponseType: "in_channel"}
+	var tree bytes.Buffer
+	if err := h.writePath(ctx, &tree, targetAccountID); err != nil {
+		message = slackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf("Lookup of account %s failed: %v", targetAccountID, err)}
+	} else {
+		message.Text = fmt.Sprintf("Account %s:\n```\n%s\n```", targetAccountID, strings.TrimRight(tree.String(), "\n"))
+	}
+
+	if err := postSlackMessage(ctx, h.deps.httpClient, responseURL, message); err != nil {
+		fmt.Fprintf(h.deps.stderr, "error replying to Slack: %v\n", err)
+	}
+}
+
+// Writes the same tree displayed by "aws account <id>", without
+// colors as Slack doesn't render them.
+func (h *slackCommandHandler) writePath(ctx context.Context, w io.Writer, targetAccountID string) error {
+	rootID, err := h.client.scout().RootID(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+	return writeOrganizationTree(ctx, w, h.client, targetAccountID, rootID, textRenderer{})
+}
+
+func writeSlackMessage(w http.ResponseWriter, message slackMessage) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message) //nolint:errcheck
+}
+
+// Posts a delayed response to the response URL of a slash command invocation, or
+// a message to an incoming webhook.
+func postSlackMessage(ctx context.Context, client *http.Client, responseURL string, message slackMessage) error {
+	if !strings.HasPrefix(responseURL, "https://hooks.slack.com/") {
+		return fmt.Errorf("unexpected response URL %q", responseURL)
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,756 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/account"
+	accounttypes "github.com/aws/aws-sdk-go-v2/service/account/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// Version of the snapshot format written by this release. Snapshots of other
+// versions are rejected instead of being misread.
+const snapshotVersion int = 1
+
+// newSnapshotCmd creates the aws snapshot command.
+func newSnapshotCmd(deps *dependencies) *cobra.Command {
+	var out string // where the snapshot is written
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Captures the hierarchy, policy attachments and policy documents of the org for offline analysis",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return writeSnapshot(cmd.Context(), deps, out)
+		},
+	}
+
+	snapshotCmd.Flags().StringVar(&out, "out", "", "where the snapshot is written, any --report-to destination")
+	snapshotCmd.MarkFlagRequired("out") //nolint:gosec,errcheck
+
+	snapshotCmd.AddCommand(newSnapshotDiffCmd(deps))
+	snapshotCmd.AddCommand(newSnapshotWatchCmd(deps))
+
+	return snapshotCmd
+}
+
+// The state of an organization at a point in time. It is described as a flat
+// list of OUs, accounts and policies (with the IDs of the entities they are
+// attached to), which also makes it easy to write by hand.
+type orgSnapshot struct {
+	Version                int               `json:"version"`
+	ID                     string            `json:"id"`
+	FeatureSet             string            `json:"featureSet,omitempty"` // ALL if empty
+	ManagementAccountID    string            `json:"managementAccountId"`
+	ManagementAccountEmail string            `json:"managementAccountEmail"`
+	RootID                 string            `json:"rootId"`
+	PolicyTypes            []string          `json:"policyTypes"` // enabled in the root
+	TrustedServices        []string          `json:"trustedServices,omitempty"`
+	OUs                    []snapshotOU      `json:"ous"`
+	Accounts               []snapshotAccount `json:"accounts"`
+	Policies               []snapshotPolicy  `json:"policies"`
+}
+
+type snapshotOU struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	ParentID string            `json:"parentId"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+type snapshotAccount struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Email    string            `json:"email"`
+	Status   string            `json:"status"`
+	ParentID string            `json:"parentId"`
+	Joined   int64             `json:"joined"` // unix time
+	Tags     map[string]string `json:"tags,omitempty"`
+	// Service principals the account is a delegated administrator for.
+	DelegatedServices []string `json:"delegatedServices,omitempty"`
+	// Effective policies computed by Organizations, keyed by effective policy type.
+	EffectivePolicies map[string]json.RawMessage `json:"effectivePolicies,omitempty"`
+	// Alternate contacts, keyed by type. They are not captured, as they are not
+	// part of the Organizations API, but can be written by hand.
+	AlternateContacts map[string]orgtree.Contact `json:"alternateContacts,omitempty"`
+}
+
+type snapshotPolicy struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	AWSManaged  bool            `json:"awsManaged"`
+	Targets     []string        `json:"targets"`
+	Content     json.RawMessage `json:"content"`
+}
+
+// Reads a snapshot, rejecting the ones written in another format version.
+func parseSnapshot(data []byte) (*orgSnapshot, error) {
+	snapshot := &orgSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, this release reads version %d", snapshot.Version, snapshotVersion)
+	}
+	return snapshot, nil
+}
+
+// Reads the organization answering the requests when running offline, the one
+// of the demo or the snapshot of --from-snapshot. It is nil when the
+// organization is read from AWS.
+func offlineSnapshot(run *runOptions) (*orgSnapshot, error) {
+	switch {
+	case run.demo:
+		return parseSnapshot(demoSnapshot)
+	case run.snapshotFile != "":
+		return readSnapshot(run.snapshotFile)
+	}
+	return nil, nil
+}
+
+// The config of the other AWS services when running offline: no credentials are
+// needed, and every request fails as they are not part of snapshots.
+func offlineAWSConfig() aws.Config {
+	return aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient:  offlineHTTPClient{},
+	}
+}
+
+type offlineHTTPClient struct{}
+
+func (offlineHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s is not available when running offline", req.URL.Host)
+}
+
+// writeSnapshot captures the whole organization and writes it to out.
+func writeSnapshot(ctx context.Context, deps *dependencies, out string) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := captureSnapshot(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	data, err := saveSnapshot(ctx, deps, snapshot, out)
+	if err != nil {
+		return err
+	}
+	// The snapshot is what gets archived with --publish s3://
+	if publishingToS3(&deps.options) {
+		deps.publication.Write(append(data, '\n')) //nolint:errcheck
+	}
+
+	fmt.Fprintf(deps.stderr, "Snapshot of %s saved to %s: %s OUs, %s accounts, %s policies\n", snapshot.ID, out, formatCount(len(snapshot.OUs)), formatCount(len(snapshot.Accounts)), formatCount(len(snapshot.Policies)))
+	return recordSnapshot(ctx, deps, snapshot, data)
+}
+
+// Writes a snapshot to out, any --report-to destination, and returns its content.
+func saveSnapshot(ctx context.Context, deps *dependencies, snapshot *orgSnapshot, out string) ([]byte, error) {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	destination, err := openSink(out, deps)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := destination.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	if err := destination.Close(ctx); err != nil {
+		return nil, fmt.Errorf("couldn't write snapshot to %s: %w", out, err)
+	}
+	return data, nil
+}
+
+// Captures the hierarchy, the policies of every enabled type with their targets
+// and documents, and the effective policies of every account. Exclusions don't
+// apply, the analyses of the snapshot apply them with scopeSnapshot.
+func captureSnapshot(ctx context.Context, client orgAPI) (*orgSnapshot, error) {
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := client.ListRoots(ctx, &organizations.ListRootsInput{})
+	if err != nil {
+		return nil, err
+	}
+	if len(roots.Roots) == 0 {
+		return nil, errors.New("no roots found in the organization")
+	}
+	root := roots.Roots[0]
+
+	snapshot := &orgSnapshot{
+		Version:                snapshotVersion,
+		ID:                     *org.Id,
+		FeatureSet:             string(org.FeatureSet),
+		ManagementAccountID:    *org.MasterAccountId,
+		ManagementAccountEmail: aws.ToString(org.MasterAccountEmail),
+		RootID:                 *root.Id,
+	}
+	for _, policyType := range root.PolicyTypes {
+		if policyType.Status == types.PolicyTypeStatusEnabled {
+			snapshot.PolicyTypes = append(snapshot.PolicyTypes, string(policyType.Type))
+		}
+	}
+
+	if org.FeatureSet == types.OrganizationFeatureSetAll {
+		if snapshot.TrustedServices, err = listTrustedServices(ctx, client); err != nil {
+			return nil, err
+		}
+	}
+
+	// Parents are found walking the tree, the rest of the details of the accounts
+	// are listed at once
+	accounts, err := client.scout().Accounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing accounts: %w", err)
+	}
+	parents := map[string]string{}
+	toBeProcessed := []string{*root.Id}
+	for len(toBeProcessed) > 0 {
+		parentID := toBeProcessed[0]
+		toBeProcessed = toBeProcessed[1:]
+
+		childAccounts, err := client.scout().Children(ctx, parentID, types.ChildTypeAccount)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range childAccounts {
+			parents[childID] = parentID
+		}
+
+		childOUs, err := client.scout().Children(ctx, parentID, types.ChildTypeOrganizationalUnit)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range childOUs {
+			name, err := client.scout().Name(ctx, childID)
+			if err != nil {
+				return nil, fmt.Errorf("error getting name for id %s: %w", childID, err)
+			}
+			tags, err := getResourceTags(ctx, client, childID)
+			if err != nil {
+				return nil, fmt.Errorf("error listing tags of %s: %w", childID, err)
+			}
+			snapshot.OUs = append(snapshot.OUs, snapshotOU{ID: childID, Name: name, ParentID: parentID, Tags: tags})
+			toBeProcessed = append(toBeProcessed, childID)
+		}
+	}
+
+	admins, err := listDelegatedAdministrators(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	delegated := map[string][]string{}
+	for _, admin := range admins {
+		if delegated[*admin.Id], err = listDelegatedServices(ctx, client, *admin.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, account := range accounts {
+		tags, err := getResourceTags(ctx, client, *account.Id)
+		if err != nil {
+			return nil, fmt.Errorf("error listing tags of %s: %w", *account.Id, err)
+		}
+
+		captured := snapshotAccount{
+			ID:                *account.Id,
+			Name:              *account.Name,
+			Email:             aws.ToString(account.Email),
+			Status:            string(account.Status),
+			ParentID:          parents[*account.Id],
+			Tags:              tags,
+			DelegatedServices: delegated[*account.Id],
+			EffectivePolicies: map[string]json.RawMessage{},
+		}
+		if account.JoinedTimestamp != nil {
+			captured.Joined = account.JoinedTimestamp.Unix()
+		}
+
+		for _, pt := range extraPolicyTypes {
+			if pt.effective == "" || !snapshot.enabled(string(pt.policyType)) {
+				continue
+			}
+			content, found, err := getEffectivePolicy(ctx, client, *account.Id, pt.effective)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				captured.EffectivePolicies[string(pt.effective)] = json.RawMessage(content)
+			}
+		}
+		snapshot.Accounts = append(snapshot.Accounts, captured)
+	}
+
+	for _, policyType := range snapshot.PolicyTypes {
+		summaries, err := listOrganizationPolicies(ctx, client, types.PolicyType(policyType))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, summary := range summaries {
+			targets, err := listPolicyTargets(ctx, client, *summary.Id)
+			if err != nil {
+				return nil, err
+			}
+			document, err := getPolicyDocument(ctx, client, *summary.Id)
+			if err != nil {
+				return nil, err
+			}
+
+			policy := snapshotPolicy{
+				ID:          *summary.Id,
+				Name:        *summary.Name,
+				Type:        policyType,
+				Description: aws.ToString(summary.Description),
+				AWSManaged:  summary.AwsManaged,
+				Targets:     []string{},
+				Content:     json.RawMessage(document),
+			}
+			for _, target := range targets {
+				policy.Targets = append(policy.Targets, *target.TargetId)
+			}
+			snapshot.Policies = append(snapshot.Policies, policy)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// The snapshot answers the Organizations API calls, like the in-memory
+// organization of awsorgtest, and the alternate contacts calls of the Account
+// Management API. Results are never paginated.
+var (
+	_ orgOperations = (*orgSnapshot)(nil)
+	_ accountAPI    = (*orgSnapshot)(nil)
+)
+
+// DescribeOrganization implements orgOperations.
+func (o *orgSnapshot) DescribeOrganization(_ context.Context, _ *organizations.DescribeOrganizationInput, _ ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error) {
+	return &organizations.DescribeOrganizationOutput{Organization: &types.Organization{
+		Id:                   aws.String(o.ID),
+		Arn:                  aws.String(o.arn("organization", o.ID)),
+		FeatureSet:           types.OrganizationFeatureSet(o.featureSet()),
+		MasterAccountId:      aws.String(o.ManagementAccountID),
+		MasterAccountArn:     aws.String(o.arn("account", o.ManagementAccountID)),
+		MasterAccountEmail:   aws.String(o.ManagementAccountEmail),
+		AvailablePolicyTypes: o.policyTypes(),
+	}}, nil
+}
+
+// ListRoots implements orgOperations.
+func (o *orgSnapshot) ListRoots(_ context.Context, _ *organizations.ListRootsInput, _ ...func(*organizations.Options)) (*organizations.ListRootsOutput, error) {
+	return &organizations.ListRootsOutput{Roots: []types.Root{{
+		Id:          aws.String(o.RootID),
+		Arn:         aws.String(o.arn("root", o.RootID)),
+		Name:        aws.String("Root"),
+		PolicyTypes: o.policyTypes(),
+	}}}, nil
+}
+
+// ListChildren implements orgOperations.
+func (o *orgSnapshot) ListChildren(_ context.Context, params *organizations.ListChildrenInput, _ ...func(*organizations.Options)) (*organizations.ListChildrenOutput, error) {
+	output := &organizations.ListChildrenOutput{}
+	for _, id := range o.children(aws.ToString(params.ParentId), params.ChildType) {
+		output.Children = append(output.Children, types.Child{Id: aws.String(id), Type: params.ChildType})
+	}
+	return output, nil
+}
+
+// ListParents implements orgOperations.
+func (o *orgSnapshot) ListParents(_ context.Context, params *organizations.ListParentsInput, _ ...func(*organizations.Options)) (*organizations.ListParentsOutput, error) {
+	parentID, ok := o.parent(aws.ToString(params.ChildId))
+	if !ok {
+		return nil, &types.ChildNotFoundException{Message: aws.String(fmt.Sprintf("child %s not found", aws.ToString(params.ChildId)))}
+	}
+	parentType := types.ParentTypeOrganizationalUnit
+	if parentID == o.RootID {
+		parentType = types.ParentTypeRoot
+	}
+	return &organizations.ListParentsOutput{Parents: []types.Parent{{Id: aws.String(parentID), Type: parentType}}}, nil
+}
+
+// DescribeAccount implements orgOperations.
+func (o *orgSnapshot) DescribeAccount(_ context.Context, params *organizations.DescribeAccountInput, _ ...func(*organizations.Options)) (*organizations.DescribeAccountOutput, error) {
+	account, ok := o.account(aws.ToString(params.AccountId))
+	if !ok {
+		return nil, &types.AccountNotFoundException{Message: aws.String(fmt.Sprintf("account %s not found", aws.ToString(params.AccountId)))}
+	}
+	return &organizations.DescribeAccountOutput{Account: o.accountOutput(account)}, nil
+}
+
+// ListAccounts implements orgOperations.
+func (o *orgSnapshot) ListAccounts(_ context.Context, _ *organizations.ListAccountsInput, _ ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error) {
+	output := &organizations.ListAccountsOutput{}
+	for _, account := range o.Accounts {
+		output.Accounts = append(output.Accounts, *o.accountOutput(account))
+	}
+	return output, nil
+}
+
+// DescribeOrganizationalUnit implements orgOperations.
+func (o *orgSnapshot) DescribeOrganizationalUnit(_ context.Context, params *organizations.DescribeOrganizationalUnitInput, _ ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error) {
+	for _, ou := range o.OUs {
+		if ou.ID == aws.ToString(params.OrganizationalUnitId) {
+			return &organizations.DescribeOrganizationalUnitOutput{OrganizationalUnit: &types.OrganizationalUnit{
+				Id:   aws.String(ou.ID),
+				Name: aws.String(ou.Name),
+				Arn:  aws.String(o.arn("ou", ou.ID)),
+			}}, nil
+		}
+	}
+	return nil, &types.OrganizationalUnitNotFoundException{Message: aws.String(fmt.Sprintf("OU %s not found", aws.ToString(params.OrganizationalUnitId)))}
+}
+
+// ListDelegatedAdministrators implements orgOperations.
+func (o *orgSnapshot) ListDelegatedAdministrators(_ context.Context, _ *organizations.ListDelegatedAdministratorsInput, _ ...func(*organizations.Options)) (*organizations.ListDelegatedAdministratorsOutput, error) {
+	output := &organizations.ListDelegatedAdministratorsOutput{}
+	for _, account := range o.Accounts {
+		if len(account.DelegatedServices) == 0 {
+			continue
+		}
+		described := o.accountOutput(account)
+		output.DelegatedAdministrators = append(output.DelegatedAdministrators, types.DelegatedAdministrator{
+			Id:              described.Id,
+			Arn:             described.Arn,
+			Name:            described.Name,
+			Email:           described.Email,
+			Status:          described.Status,
+			JoinedMethod:    described.JoinedMethod,
+			JoinedTimestamp: described.JoinedTimestamp,
+		})
+	}
+	return output, nil
+}
+
+// ListDelegatedServicesForAccount implements orgOperations.
+func (o *orgSnapshot) ListDelegatedServicesForAccount(_ context.Context, params *organizations.ListDelegatedServicesForAccountInput, _ ...func(*organizations.Options)) (*organizations.ListDelegatedServicesForAccountOutput, error) {
+	accountID := aws.ToString(params.AccountId)
+	account, ok := o.account(accountID)
+	if !ok {
+		return nil, &types.AccountNotFoundException{Message: aws.String(fmt.Sprintf("account %s not found", accountID))}
+	}
+	if len(account.DelegatedServices) == 0 {
+		return nil, &types.AccountNotRegisteredException{Message: aws.String(fmt.Sprintf("account %s is not a delegated administrator", accountID))}
+	}
+
+	output := &organizations.ListDelegatedServicesForAccountOutput{}
+	for _, service := range account.DelegatedServices {
+		output.DelegatedServices = append(output.DelegatedServices, types.DelegatedService{ServicePrincipal: aws.String(service)})
+	}
+	return output, nil
+}
+
+// ListAWSServiceAccessForOrganization implements orgOperations.
+func (o *orgSnapshot) ListAWSServiceAccessForOrganization(_ context.Context, _ *organizations.ListAWSServiceAccessForOrganizationInput, _ ...func(*organizations.Options)) (*organizations.ListAWSServiceAccessForOrganizationOutput, error) {
+	output := &organizations.ListAWSServiceAccessForOrganizationOutput{}
+	for _, service := range o.TrustedServices {
+		output.EnabledServicePrincipals = append(output.EnabledServicePrincipals, types.EnabledServicePrincipal{ServicePrincipal: aws.String(service)})
+	}
+	return output, nil
+}
+
+// ListTagsForResource implements orgOperations.
+func (o *orgSnapshot) ListTagsForResource(_ context.Context, params *organizations.ListTagsForResourceInput, _ ...func(*organizations.Options)) (*organizations.ListTagsForResourceOutput, error) {
+	resourceID := aws.ToString(params.ResourceId)
+	var resourceTags map[string]string
+	if account, ok := o.account(resourceID); ok {
+		resourceTags = account.Tags
+	}
+	for _, ou := range o.OUs {
+		if ou.ID == resourceID {
+			resourceTags = ou.Tags
+		}
+	}
+
+	output := &organizations.ListTagsForResourceOutput{}
+	for _, key := range sortedKeys(resourceTags) {
+		output.Tags = append(output.Tags, types.Tag{Key: aws.String(key), Value: aws.String(resourceTags[key])})
+	}
+	return output, nil
+}
+
+// ListPolicies implements orgOperations. Types that aren't enabled have no
+// policies.
+func (o *orgSnapshot) ListPolicies(_ context.Context, params *organizations.ListPoliciesInput, _ ...func(*organizations.Options)) (*organizations.ListPoliciesOutput, error) {
+	output := &organizations.ListPoliciesOutput{}
+	if !o.enabled(string(params.Filter)) {
+		return output, nil
+	}
+	for _, policy := range o.Policies {
+		if policy.Type == string(params.Filter) {
+			output.Policies = append(output.Policies, o.policySummary(policy))
+		}
+	}
+	return output, nil
+}
+
+// ListPoliciesForTarget implements orgOperations.
+func (o *orgSnapshot) ListPoliciesForTarget(_ context.Context, params *organizations.ListPoliciesForTargetInput, _ ...func(*organizations.Options)) (*organizations.ListPoliciesForTargetOutput, error) {
+	output := &organizations.ListPoliciesForTargetOutput{}
+	for _, policy := range o.attachedPolicies(aws.ToString(params.TargetId), string(params.Filter)) {
+		output.Policies = append(output.Policies, o.policySummary(policy))
+	}
+	return output, nil
+}
+
+// ListTargetsForPolicy implements orgOperations.
+func (o *orgSnapshot) ListTargetsForPolicy(_ context.Context, params *organizations.ListTargetsForPolicyInput, _ ...func(*organizations.Options)) (*organizations.ListTargetsForPolicyOutput, error) {
+	policy, ok := o.policy(aws.ToString(params.PolicyId))
+	if !ok {
+		return nil, &types.PolicyNotFoundException{Message: aws.String(fmt.Sprintf("policy %s not found", aws.ToString(params.PolicyId)))}
+	}
+
+	output := &organizations.ListTargetsForPolicyOutput{}
+	for _, id := range policy.Targets {
+		output.Targets = append(output.Targets, o.target(id))
+	}
+	return output, nil
+}
+
+// DescribePolicy implements orgOperations.
+func (o *orgSnapshot) DescribePolicy(_ context.Context, params *organizations.DescribePolicyInput, _ ...func(*organizations.Options)) (*organizations.DescribePolicyOutput, error) {
+	policy, ok := o.policy(aws.ToString(params.PolicyId))
+	if !ok {
+		return nil, &types.PolicyNotFoundException{Message: aws.String(fmt.Sprintf("policy %s not found", aws.ToString(params.PolicyId)))}
+	}
+	summary := o.policySummary(policy)
+	return &organizations.DescribePolicyOutput{Policy: &types.Policy{
+		PolicySummary: &summary,
+		Content:       aws.String(compactJSON(policy.Content)),
+	}}, nil
+}
+
+// DescribeEffectivePolicy implements orgOperations.
+func (o *orgSnapshot) DescribeEffectivePolicy(_ context.Context, params *organizations.DescribeEffectivePolicyInput, _ ...func(*organizations.Options)) (*organizations.DescribeEffectivePolicyOutput, error) {
+	policyType, targetID := string(params.PolicyType), aws.ToString(params.TargetId)
+	if !o.enabled(policyType) {
+		return nil, &types.PolicyTypeNotEnabledException{Message: aws.String(fmt.Sprintf("policy type %s is not enabled", policyType))}
+	}
+	content, ok := o.effectivePolicy(targetID, policyType)
+	if !ok {
+		return nil, &types.EffectivePolicyNotFoundException{Message: aws.String(fmt.Sprintf("no effective policy of type %s for %s", policyType, targetID))}
+	}
+	return &organizations.DescribeEffectivePolicyOutput{EffectivePolicy: &types.EffectivePolicy{
+		PolicyContent: aws.String(compactJSON(content)),
+		PolicyType:    params.PolicyType,
+		TargetId:      aws.String(targetID),
+	}}, nil
+}
+
+// GetAlternateContact implements accountAPI, the account being the management
+// account when none is given.
+func (o *orgSnapshot) GetAlternateContact(_ context.Context, params *account.GetAlternateContactInput, _ ...func(*account.Options)) (*account.GetAlternateContactOutput, error) {
+	accountID := aws.ToString(params.AccountId)
+	if accountID == "" {
+		accountID = o.ManagementAccountID
+	}
+	captured, ok := o.account(accountID)
+	if !ok {
+		return nil, &accounttypes.AccessDeniedException{Message: aws.String(fmt.Sprintf("account %s is not part of the organization", accountID))}
+	}
+	contact, ok := captured.AlternateContacts[string(params.AlternateContactType)]
+	if !ok {
+		return nil, &accounttypes.ResourceNotFoundException{Message: aws.String(fmt.Sprintf("no %s contact for %s", params.AlternateContactType, accountID))}
+	}
+	return &account.GetAlternateContactOutput{AlternateContact: &accounttypes.AlternateContact{
+		AlternateContactType: params.AlternateContactType,
+		Name:                 aws.String(contact.Name),
+		Title:                aws.String(contact.Title),
+		EmailAddress:         aws.String(contact.Email),
+		PhoneNumber:          aws.String(contact.Phone),
+	}}, nil
+}
+
+func compactJSON(document json.RawMessage) string {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, document); err != nil {
+		return string(document)
+	}
+	return buffer.String()
+}
+
+func (o *orgSnapshot) arn(kind, id string) string {
+	if kind == "organization" {
+		return fmt.Sprintf("arn:aws:organizations::%s:organization/%s", o.ManagementAccountID, id)
+	}
+	return fmt.Sprintf("arn:aws:organizations::%s:%s/%s/%s", o.ManagementAccountID, kind, o.ID, id)
+}
+
+func (o *orgSnapshot) featureSet() string {
+	if o.FeatureSet == "" {
+		return string(types.OrganizationFeatureSetAll)
+	}
+	return o.FeatureSet
+}
+
+func (o *orgSnapshot) policyTypes() []types.PolicyTypeSummary {
+	var policyTypes []types.PolicyTypeSummary
+	for _, policyType := range o.PolicyTypes {
+		policyTypes = append(policyTypes, types.PolicyTypeSummary{Type: types.PolicyType(policyType), Status: types.PolicyTypeStatusEnabled})
+	}
+	return policyTypes
+}
+
+func (o *orgSnapshot) enabled(policyType string) bool {
+	for _, enabled := range o.PolicyTypes {
+		if enabled == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the effective policy of an account. Snapshots written by "aws snapshot"
+// hold the ones computed by Organizations. Otherwise, instead of merging the
+// inherited policies, the policy closest to the account is used (effective
+// policy types are named after the policy types, and the parsers accept the
+// @@assign operators of the policies as well).
+func (o *orgSnapshot) effectivePolicy(accountID, policyType string) (json.RawMessage, bool) {
+	if account, ok := o.account(accountID); ok && account.EffectivePolicies != nil {
+		content, ok := account.EffectivePolicies[policyType]
+		return content, ok
+	}
+
+	for id, ok := accountID, true; ok; id, ok = o.parent(id) {
+		if policies := o.attachedPolicies(id, policyType); len(policies) > 0 {
+			return policies[0].Content, true
+		}
+	}
+	return nil, false
+}
+
+func (o *orgSnapshot) children(parentID string, childType types.ChildType) []string {
+	var children []string
+	if childType == types.ChildTypeAccount {
+		for _, account := range o.Accounts {
+			if account.ParentID == parentID {
+				children = append(children, account.ID)
+			}
+		}
+	} else {
+		for _, ou := range o.OUs {
+			if ou.ParentID == parentID {
+				children = append(children, ou.ID)
+			}
+		}
+	}
+	return children
+}
+
+func (o *orgSnapshot) parent(id string) (string, bool) {
+	if account, ok := o.account(id); ok {
+		return account.ParentID, true
+	}
+	for _, ou := range o.OUs {
+		if ou.ID == id {
+			return ou.ParentID, true
+		}
+	}
+	return "", false
+}
+
+func (o *orgSnapshot) account(id string) (snapshotAccount, bool) {
+	for _, account := range o.Accounts {
+		if account.ID == id {
+			return account, true
+		}
+	}
+	return snapshotAccount{}, false
+}
+
+func (o *orgSnapshot) accountOutput(account snapshotAccount) *types.Account {
+	return &types.Account{
+		Id:              aws.String(account.ID),
+		Arn:             aws.String(o.arn("account", account.ID)),
+		Name:            aws.String(account.Name),
+		Email:           aws.String(account.Email),
+		Status:          types.AccountStatus(account.Status),
+		JoinedMethod:    types.AccountJoinedMethodCreated,
+		JoinedTimestamp: aws.Time(time.Unix(account.Joined, 0)),
+	}
+}
+
+func (o *orgSnapshot) policy(id string) (snapshotPolicy, bool) {
+	for _, policy := range o.Policies {
+		if policy.ID == id {
+			return policy, true
+		}
+	}
+	return snapshotPolicy{}, false
+}
+
+// Lists the policies of policyType directly attached to targetID.
+func (o *orgSnapshot) attachedPolicies(targetID, policyType string) []snapshotPolicy {
+	var policies []snapshotPolicy
+	for _, policy := range o.Policies {
+		if policy.Type != policyType {
+			continue
+		}
+		for _, id := range policy.Targets {
+			if id == targetID {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	return policies
+}
+
+func (o *orgSnapshot) policySummary(policy snapshotPolicy) types.PolicySummary {
+	arn := fmt.Sprintf("arn:aws:organizations::%s:policy/%s/%s/%s", o.ManagementAccountID, o.ID, strings.ToLower(policy.Type), policy.ID)
+	if policy.AWSManaged {
+		arn = fmt.Sprintf("arn:aws:organizations::aws:policy/%s/%s", strings.ToLower(policy.Type), policy.ID)
+	}
+	return types.PolicySummary{
+		Id:          aws.String(policy.ID),
+		Arn:         aws.String(arn),
+		Name:        aws.String(policy.Name),
+		Description: aws.String(policy.Description),
+		Type:        types.PolicyType(policy.Type),
+		AwsManaged:  policy.AWSManaged,
+	}
+}
+
+func (o *orgSnapshot) target(id string) types.PolicyTargetSummary {
+	target := types.PolicyTargetSummary{TargetId: aws.String(id)}
+	switch {
+	case id == o.RootID:
+		target.Type, target.Name, target.Arn = types.TargetTypeRoot, aws.String("Root"), aws.String(o.arn("root", id))
+	case strings.HasPrefix(id, "ou-"):
+		target.Type, target.Arn = types.TargetTypeOrganizationalUnit, aws.String(o.arn("ou", id))
+		for _, ou := range o.OUs {
+			if ou.ID == id {
+				target.Name = aws.String(ou.Name)
+			}
+		}
+	default:
+		account, _ := o.account(id)
+		target.Type, target.Name, target.Arn = types.TargetTypeAccount, aws.String(account.Name), aws.String(o.arn("account", id))
+	}
+	return target
+}
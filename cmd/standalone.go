@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Middleware detecting standalone accounts, whatever API call finds out: the
+// Organizations API reports the credentials belong to an account that isn't a
+// member of any organization.
+func (d *dependencies) standaloneMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("DetectStandaloneAccount", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		var notInUse *types.AWSOrganizationsNotInUseException
+		if errors.As(err, &notInUse) {
+			d.standalone.Store(true)
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// reportStandaloneAccount is the degraded mode used when the account isn't part of
+// an organization: instead of the SDK error, it reports what is known about the
+// account and why the policy reports don't apply.
+func reportStandaloneAccount(ctx context.Context, deps *dependencies) error {
+	caller, err := deps.caller(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(deps.report, "Standalone account: %s is not a member of an AWS Organization\n", caller.AccountID)
+	fmt.Fprintf(deps.report, "|-- Account: %s\n", caller.AccountID)
+	if caller.Alias != "" {
+		fmt.Fprintf(deps.report, "|-- Alias: %s\n", caller.Alias)
+	}
+	fmt.Fprintf(deps.report, "|-- Caller: %s\n", caller.ARN)
+	if caller.Region != "" {
+		fmt.Fprintf(deps.report, "|-- Region: %s\n", caller.Region)
+	}
+	fmt.Fprintln(deps.report, "SCPs and the other organization policies (tag, backup, AI services opt-out, declarative)")
+	fmt.Fprintln(deps.report, "only exist within an organization: nothing restricts this account beyond its own IAM policies.")
+	fmt.Fprintln(deps.report, "Run policy-scout with credentials of an organization member (or --role-arn) to analyze one.")
+
+	return closeReportSink(ctx, deps)
+}
+
+// The account and ARN of the credentials used to reach an organization.
+type callerIdentity struct {
+	AccountID string
+	ARN       string
+	Alias     string // alias of the account, empty when it has none or it can't be read
+	Region    string // region of the AWS config
+}
+
+// stsAPI is the part of the STS API used by the commands.
+type stsAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// accountAliasAPI is the part of the IAM API reading the alias of an account.
+type accountAliasAPI interface {
+	ListAccountAliases(ctx context.Context, params *iam.ListAccountAliasesInput, optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error)
+}
+
+// Creates the STS client of cfg, whichever organization it reaches.
+func newSTSClient(cfg aws.Config) stsAPI {
+	return sts.NewFromConfig(cfg)
+}
+
+// Creates the IAM client of cfg reading the alias of its account.
+func newAccountAliasClient(cfg aws.Config) accountAliasAPI {
+	return iam.NewFromConfig(cfg)
+}
+
+// Gets the caller identity of the credentials of cfg.
+func (d *dependencies) getCallerIdentity(ctx context.Context, cfg aws.Config) (callerIdentity, error) {
+	identity, err := d.stsClient(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return callerIdentity{}, fmt.Errorf("error getting caller identity: %w", err)
+	}
+
+	return callerIdentity{AccountID: aws.ToString(identity.Account), ARN: aws.ToString(identity.Arn), Region: cfg.Region}, nil
+}
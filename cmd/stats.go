@@ -0,0 +1,183 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newStatsCmd creates the aws stats command.
+func newStatsCmd(deps *dependencies) *cobra.Command {
+	format := textFormat // output format of the statistics
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarizes the topology of the org: accounts, OUs, nesting depth and policies",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayStats(cmd.Context(), deps, format)
+		},
+	}
+
+	statsCmd.Flags().VarP(&format, "output-format", "o", `valid output formats are: "text", "json"`)
+
+	return statsCmd
+}
+
+// Topology of the organization, as displayed by aws stats.
+type orgStats struct {
+	OrganizationID        string         `json:"organizationId"`
+	Accounts              int            `json:"accounts"`
+	OUs                   int            `json:"ous"`
+	MaxDepth              int            `json:"maxDepth"`                       // OU levels below the root on the deepest path
+	PoliciesByType        map[string]int `json:"policiesByType"`                 // policies of every type enabled on the root, attached or not
+	AWSManagedSCPs        int            `json:"awsManagedScps"`                 // SCPs of the policies by type managed by AWS
+	AverageSCPsPerAccount float64        `json:"averageScpsPerAccount"`          // directly applied and inherited
+	AccountsPerOU         []ouStats      `json:"accountsPerOu"`                  // the root included
+	AverageAccountsPerOU  float64        `json:"averageAccountsPerOu,omitempty"` // the root included
+}
+
+type ouStats struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Accounts int    `json:"accounts"` // directly below the OU
+}
+
+// displayStats computes the statistics of the whole organization. Excluded OUs
+// and accounts are left out.
+func displayStats(ctx context.Context, deps *dependencies, format outputFormat) error {
+	if format != textFormat && format != jsonFormat {
+		return fmt.Errorf(`the %q output format is not available for "aws stats", use "text" or "json"`, format)
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return err
+	}
+	roots, err := client.ListRoots(ctx, &organizations.ListRootsInput{})
+	if err != nil {
+		return err
+	}
+	if len(roots.Roots) == 0 {
+		return fmt.Errorf("no roots found in the organization")
+	}
+	root := roots.Roots[0]
+
+	tree, err := buildOrgTree(ctx, client, "all", *root.Id)
+	if err != nil {
+		return err
+	}
+
+	stats := computeTreeStats(tree)
+	stats.OrganizationID = *org.Id
+	stats.PoliciesByType = map[string]int{}
+	// Policies of the types enabled on the root
+	enabled := map[types.PolicyType]bool{}
+	for _, policyType := range root.PolicyTypes {
+		enabled[policyType.Type] = policyType.Status == types.PolicyTypeStatusEnabled
+	}
+	for _, policyType := range allPolicyTypes {
+		if !enabled[policyType] {
+			continue
+		}
+		summaries, err := listOrganizationPolicies(ctx, client, policyType)
+		if err != nil {
+			return err
+		}
+
+		stats.PoliciesByType[string(policyType)] = len(summaries)
+		if policyType != types.PolicyTypeServiceControlPolicy {
+			continue
+		}
+		for _, summary := range summaries {
+			if summary.AwsManaged {
+				stats.AWSManagedSCPs++
+			}
+		}
+	}
+
+	if format == jsonFormat {
+		encoder := json.NewEncoder(deps.report)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+	printStats(deps.report, stats)
+	return nil
+}
+
+// Computes the statistics that only depend on the tree.
+func computeTreeStats(tree *orgtree.Node) orgStats {
+	var stats orgStats
+	scps := 0
+	tree.Walk(func(node *orgtree.Node, depth int) error { //nolint:errcheck
+		switch node.Type {
+		case orgtree.AccountNode:
+			stats.Accounts++
+			scps += len(node.SCPs)
+		default:
+			if node.Type == orgtree.OUNode {
+				stats.OUs++
+				stats.MaxDepth = max(stats.MaxDepth, depth)
+			}
+			ou := ouStats{ID: node.ID, Name: node.Name}
+			if node.Type == orgtree.RootNode {
+				ou.Name = "Root"
+			}
+			for _, child := range node.Children {
+				if child.Type == orgtree.AccountNode {
+					ou.Accounts++
+				}
+			}
+			stats.AccountsPerOU = append(stats.AccountsPerOU, ou)
+		}
+		return nil
+	})
+
+	if stats.Accounts > 0 {
+		stats.AverageSCPsPerAccount = float64(scps) / float64(stats.Accounts)
+	}
+	if len(stats.AccountsPerOU) > 0 {
+		stats.AverageAccountsPerOU = float64(stats.Accounts) / float64(len(stats.AccountsPerOU))
+	}
+	return stats
+}
+
+func printStats(w io.Writer, stats orgStats) {
+	fmt.Fprintf(w, "Organization: %s\n", stats.OrganizationID)
+	fmt.Fprintf(w, "|-- Accounts: %s\n", formatCount(stats.Accounts))
+	fmt.Fprintf(w, "|-- OUs: %s\n", formatCount(stats.OUs))
+	fmt.Fprintf(w, "|-- Max nesting depth: %s\n", formatCount(stats.MaxDepth))
+
+	fmt.Fprintln(w, "|-- Policies by type:")
+	for _, policyType := range allPolicyTypes {
+		count, enabled := stats.PoliciesByType[string(policyType)]
+		switch {
+		case !enabled:
+			fmt.Fprintf(w, "%s|-- %s: not enabled\n", indent, policyType)
+		case policyType == types.PolicyTypeServiceControlPolicy:
+			fmt.Fprintf(w, "%s|-- %s: %s (%s AWS managed)\n", indent, policyType, formatCount(count), formatCount(stats.AWSManagedSCPs))
+		default:
+			fmt.Fprintf(w, "%s|-- %s: %s\n", indent, policyType, formatCount(count))
+		}
+	}
+	fmt.Fprintf(w, "|-- Average SCPs per account: %s\n", formatDecimal(stats.AverageSCPsPerAccount))
+
+	fmt.Fprintf(w, "|-- Accounts per OU (average %s):\n", formatDecimal(stats.AverageAccountsPerOU))
+	for _, ou := range stats.AccountsPerOU {
+		fmt.Fprintf(w, "%s|-- %s [%s]: %s\n", indent, ou.Name, ou.ID, formatCount(ou.Accounts))
+	}
+}
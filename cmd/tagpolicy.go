@@ -0,0 +1,105 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/tagpolicy"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// newTagPolicyCmd creates the aws tag-policy command.
+func newTagPolicyCmd(deps *dependencies) *cobra.Command {
+	var (
+		accountID    string // account whose effective tag policy is displayed, or "all"
+		showDocument bool   // display the merged policy document too
+	)
+	tagPolicyCmd := &cobra.Command{
+		Use:   "tag-policy",
+		Short: "Displays the effective tag policy of accounts: the enforced tag keys and values",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return displayEffectiveTagPolicies(cmd.Context(), deps, accountID, showDocument)
+		},
+	}
+
+	tagPolicyCmd.Flags().StringVar(&accountID, "account-id", "", `aws account ID that will be analyzed, "all" for every account`)
+	tagPolicyCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+
+	tagPolicyCmd.Flags().BoolVar(&showDocument, "show-document", false, "display the merged document of the effective tag policy")
+
+	return tagPolicyCmd
+}
+
+// displayEffectiveTagPolicies reports, for every account, the tag rules resulting
+// from merging all the tag policies it inherits (with their inheritance operators).
+func displayEffectiveTagPolicies(ctx context.Context, deps *dependencies, targetAccountID string, showDocument bool) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	accountIDs, err := resolveAccountIDs(ctx, client, targetAccountID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range accountIDs {
+		name, err := client.scout().Name(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting name for id %s: %w", id, err)
+		}
+
+		content, found, err := getEffectivePolicy(ctx, client, id, types.EffectivePolicyTypeTagPolicy)
+		if err != nil {
+			return err
+		}
+		if !found {
+			fmt.Fprintf(deps.report, "|-- Account: %s [%s]: no effective tag policy\n", name, id)
+			continue
+		}
+
+		rules, err := describeEffectiveTagPolicy(content)
+		if err != nil {
+			return fmt.Errorf("effective tag policy of %s: %w", id, err)
+		}
+
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s]\n", name, id)
+		for _, rule := range rules {
+			fmt.Fprintf(deps.report, "%s|-- %s\n", indent, rule)
+		}
+
+		if showDocument {
+			document, err := prettyDocument(content, indent+indent)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(deps.report, "%s|-- Document:\n%s\n", indent, document)
+		}
+	}
+
+	return nil
+}
+
+// Describes the rule enforced on a tag key, e.g. "CostCenter = 100 | 200, enforced for ec2:instance".
+func formatTagRule(tag tagpolicy.Tag) string {
+	values := "any value"
+	if len(tag.Values) > 0 {
+		values = strings.Join(tag.Values, " | ")
+	}
+
+	formatted := fmt.Sprintf("%s = %s", tag.Key, values)
+	if len(tag.EnforcedFor) > 0 {
+		formatted += ", enforced for " + strings.Join(tag.EnforcedFor, ", ")
+	}
+	if len(tag.RequiredFor) > 0 {
+		formatted += ", required for " + strings.Join(tag.RequiredFor, ", ")
+	}
+	return formatted
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+)
+
+// Source of the tags set on the account itself.
+const accountTagSource = "account"
+
+// Resolves the tags of --inherit-tag for every account of the tree. Values of
+// the account itself take precedence over the inherited ones.
+// Tags (e.g. cost-center, environment) are set at OU level but needed per
+// account by the consumers of the structured outputs.
+func propagateTags(ctx context.Context, client orgAPI, node *orgtree.Node, inherited map[string]orgtree.Tag) error {
+	inheritTagKeys := client.options().inheritTagKeys
+	if len(inheritTagKeys) == 0 {
+		return nil
+	}
+
+	tags, err := getResourceTags(ctx, client, node.ID)
+	if err != nil {
+		return err
+	}
+
+	source := node.ID
+	if node.Type == orgtree.AccountNode {
+		source = accountTagSource
+	}
+	resolved := make(map[string]orgtree.Tag, len(inheritTagKeys))
+	for _, key := range inheritTagKeys {
+		if value, ok := tags[key]; ok {
+			resolved[key] = orgtree.Tag{Value: value, Source: source}
+		} else if tag, ok := inherited[key]; ok {
+			resolved[key] = tag
+		}
+	}
+
+	if node.Type == orgtree.AccountNode {
+		if len(resolved) > 0 {
+			node.Tags = resolved
+		}
+		return nil
+	}
+	for _, child := range node.Children {
+		if err := propagateTags(ctx, client, child, resolved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvRenderer writes one row per account. Every tag of --inherit-tag gets a
+// column with its value and another one with its source, and with
+// --alternate-contacts every contact gets a column per field. GCP trees get a
+// row per project instead, with a column of liens with --show-liens, see
+// writeProjectRows.
+type csvRenderer struct {
+	inheritTagKeys    []string // tags copied down to the accounts, see --inherit-tag
+	alternateContacts bool     // the alternate contacts of the accounts were fetched
+	showLiens         bool     // the liens of the projects were fetched
+}
+
+// Render implements orgtree.Renderer.
+func (r csvRenderer) Render(w io.Writer, tree *orgtree.Tree) error {
+	writer := csv.NewWriter(w)
+	// GCP trees start at the organization, or at the folder of --folder-id
+	if tree.Root.Type == orgtree.OrganizationNode || tree.Root.Type == orgtree.FolderNode {
+		header := []string{"project_id", "project_name", "folder_path", "state", "org_policies", "deny_policies", "tags"}
+		if r.showLiens {
+			header = append(header, "liens")
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		if err := r.writeProjectRows(writer, tree.Root, ""); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	header := []string{"account_id", "account_name", "ou_path", "management_account", "status", "scps"}
+	for _, key := range r.inheritTagKeys {
+		header = append(header, key, key+"_source")
+	}
+	if r.alternateContacts {
+		for _, contactType := range alternateContactTypes {
+			prefix := strings.ToLower(string(contactType)) + "_contact"
+			header = append(header, prefix+"_name", prefix+"_title", prefix+"_email", prefix+"_phone")
+		}
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := r.writeAccountRows(writer, tree.Root, ""); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes the rows of the accounts below node, whose path of names is parentPath.
+func (r csvRenderer) writeAccountRows(writer *csv.Writer, node *orgtree.Node, parentPath string) error {
+	if node.Type == orgtree.AccountNode {
+		management := "false"
+		if node.ManagementAccount {
+			management = "true"
+		}
+		row := []string{node.ID, node.Name, parentPath, management, node.Status, strings.Join(policyNames(node.SCPs), ";")}
+		for _, key := range r.inheritTagKeys {
+			tag := node.Tags[key]
+			row = append(row, tag.Value, tag.Source)
+		}
+		if r.alternateContacts {
+			for _, contactType := range alternateContactTypes {
+				contact := node.AlternateContacts[string(contactType)]
+				row = append(row, contact.Name, contact.Title, contact.Email, contact.Phone)
+			}
+		}
+		return writer.Write(row)
+	}
+
+	path := parentPath + "/" + node.Name
+	for _, child := range node.Children {
+		if err := r.writeAccountRows(writer, child, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
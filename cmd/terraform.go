@@ -0,0 +1,125 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// Characters not allowed in the names of Terraform resources.
+var terraformNameInvalid = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// newExportTerraformCmd creates the aws export terraform command.
+func newExportTerraformCmd(deps *dependencies) *cobra.Command {
+	return &cobra.Command{
+		Use:   "terraform",
+		Short: "Generates the Terraform resources and import blocks of the policies of the org and their attachments",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportTerraform(cmd.Context(), deps)
+		},
+	}
+}
+
+// exportTerraform writes an aws_organizations_policy resource per policy of the
+// organization and an aws_organizations_policy_attachment per attachment, along
+// with the import blocks (Terraform 1.5+) adopting the live ones, so the plan of
+// the generated configuration is empty. The policies managed by AWS can't be
+// managed by Terraform, their attachments refer to them by ID.
+func exportTerraform(ctx context.Context, deps *dependencies) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, err := captureSnapshot(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Policies of %s and their attachments, generated by policy-scout\n", snapshot.ID)
+	names := map[string]bool{} // of the resources, unique per resource type
+	for _, policy := range snapshot.Policies {
+		policyID := strconv.Quote(policy.ID)
+		if !policy.AWSManaged {
+			name := terraformName(names, "aws_organizations_policy", policy.Name)
+			content, err := terraformHeredoc(policy.Content)
+			if err != nil {
+				return fmt.Errorf("policy %s: %w", policy.ID, err)
+			}
+
+			fmt.Fprintf(&b, "\nresource \"aws_organizations_policy\" %q {\n", name)
+			fmt.Fprintf(&b, "  name        = %s\n", terraformString(policy.Name))
+			fmt.Fprintf(&b, "  description = %s\n", terraformString(policy.Description))
+			// The provider defaults to SCPs
+			if policy.Type != string(types.PolicyTypeServiceControlPolicy) {
+				fmt.Fprintf(&b, "  type        = %q\n", policy.Type)
+			}
+			fmt.Fprintf(&b, "  content     = %s\n}\n", content)
+			writeTerraformImport(&b, "aws_organizations_policy."+name, policy.ID)
+			policyID = "aws_organizations_policy." + name + ".id"
+		}
+
+		for _, target := range policy.Targets {
+			name := terraformName(names, "aws_organizations_policy_attachment", policy.Name+"_"+snapshot.name(target))
+			fmt.Fprintf(&b, "\nresource \"aws_organizations_policy_attachment\" %q {\n", name)
+			fmt.Fprintf(&b, "  policy_id = %s\n", policyID)
+			fmt.Fprintf(&b, "  target_id = %q # %s\n}\n", target, snapshot.path(target))
+			writeTerraformImport(&b, "aws_organizations_policy_attachment."+name, target+":"+policy.ID)
+		}
+	}
+
+	_, err = deps.report.Write(b.Bytes())
+	return err
+}
+
+func writeTerraformImport(w io.Writer, address, id string) {
+	fmt.Fprintf(w, "\nimport {\n  to = %s\n  id = %q\n}\n", address, id)
+}
+
+// Derives the name of a resource from the name of what it manages, e.g.
+// scp_guardrails_01 for scp-guardrails-01, numbered when it is already taken.
+func terraformName(taken map[string]bool, resourceType, name string) string {
+	base := strings.Trim(terraformNameInvalid.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if base == "" || (base[0] >= '0' && base[0] <= '9') {
+		base = "policy_" + base
+	}
+	candidate := base
+	for i := 2; taken[resourceType+"."+candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", base, i)
+	}
+	taken[resourceType+"."+candidate] = true
+	return candidate
+}
+
+// Quotes a string, escaping the template sequences of Terraform too.
+func terraformString(value string) string {
+	return terraformEscape(strconv.Quote(value))
+}
+
+// Writes a policy document as an indented heredoc, e.g. for the content of a
+// policy. Policy variables like ${aws:username} are escaped so Terraform keeps
+// them as they are.
+func terraformHeredoc(document json.RawMessage) (string, error) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, document, "    ", "  "); err != nil {
+		return "", err
+	}
+	return "<<-EOT\n    " + terraformEscape(indented.String()) + "\n  EOT", nil
+}
+
+func terraformEscape(value string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(value)
+}
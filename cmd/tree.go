@@ -0,0 +1,140 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+)
+
+// Keeps the children in the order of the API, which varies between runs.
+const sortNone = "none"
+
+// Builds the org tree below startID. When targetAccountID is not "all", the tree
+// only contains the path from startID to that account. Children are sorted
+// according to --sort, so every output format is stable and diffable.
+func buildOrgTree(ctx context.Context, client orgAPI, targetAccountID, startID string) (*orgtree.Node, error) {
+	sortKey := client.options().sortKey
+	switch sortKey {
+	case "", orgtree.SortByName, orgtree.SortByID, sortNone:
+	default:
+		return nil, fmt.Errorf(`invalid sort key %q: valid sort keys are "name", "id", "none"`, sortKey)
+	}
+
+	if strings.ToLower(targetAccountID) == "all" {
+		tree, err := client.scout().BuildTree(ctx, startID)
+		if err != nil {
+			return nil, err
+		}
+		if sortKey != sortNone {
+			tree.Root.Sort(sortKey)
+		}
+		return tree.Root, nil
+	}
+
+	tree, err := client.scout().BuildAccountPath(ctx, startID, targetAccountID)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return nil, accountNotFoundError(targetAccountID)
+	}
+	return tree.Root, nil
+}
+
+// Adds the details requested with flags to a node built by the Scout: the
+// categories of its SCPs, and the policies of other types.
+func decorateNode(ctx context.Context, client orgAPI, node *orgtree.Node) error {
+	if naming := client.options().namingPatterns; len(naming) > 0 {
+		node.SCPs = naming.withCategories(node.SCPs)
+	}
+
+	return addExtraPolicies(ctx, client, node)
+}
+
+// Adds the document of every SCP to the nodes of the tree.
+func addDocuments(ctx context.Context, client orgAPI, root *orgtree.Node) error {
+	return root.Walk(func(node *orgtree.Node, depth int) error {
+		scps, err := withDocuments(ctx, client, node.SCPs)
+		if err != nil {
+			return err
+		}
+		node.SCPs = scps
+		return nil
+	})
+}
+
+// Returns a copy of policies including the document of each one of them.
+func withDocuments(ctx context.Context, client orgAPI, policies []orgtree.Policy) ([]orgtree.Policy, error) {
+	maxDocumentBytes := client.options().maxDocumentBytes
+	if client.options().fullDocuments {
+		maxDocumentBytes = 0
+	}
+	documented := make([]orgtree.Policy, 0, len(policies))
+	for _, policy := range policies {
+		document, err := getPolicyDocument(ctx, client, policy.ID)
+		if err != nil {
+			return nil, err
+		}
+		if document, policy.Truncated, err = truncateDocument(document, maxDocumentBytes); err != nil {
+			return nil, err
+		}
+		policy.Document = json.RawMessage(document)
+		documented = append(documented, policy)
+	}
+	return documented, nil
+}
+
+// Builds the org tree, labeled with the org ID, with the tags of --inherit-tag
+// resolved for every account. Policy IDs and ARNs are always part of the tree,
+// renderers decide whether to display them.
+func buildOrganizationTree(ctx context.Context, client orgAPI, targetAccountID, rootID string) (*orgtree.Tree, error) {
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := buildOrgTree(ctx, client, targetAccountID, rootID)
+	if err != nil {
+		return nil, err
+	}
+	if err := propagateTags(ctx, client, tree, nil); err != nil {
+		return nil, err
+	}
+
+	return &orgtree.Tree{OrganizationID: *org.Id, Root: tree}, nil
+}
+
+// Builds the org tree and writes it with renderer.
+func writeOrganizationTree(ctx context.Context, w io.Writer, client orgAPI, targetAccountID, rootID string, renderer orgtree.Renderer) error {
+	tree, err := buildOrganizationTree(ctx, client, targetAccountID, rootID)
+	if err != nil {
+		return err
+	}
+	return renderer.Render(w, tree)
+}
+
+// Writes the text tree, see newTextRenderer.
+func writeTextTree(ctx context.Context, w io.Writer, client orgAPI, targetAccountID, rootID string) error {
+	renderer, err := newTextRenderer(client.options())
+	if err != nil {
+		return err
+	}
+	return writeOrganizationTree(ctx, w, client, targetAccountID, rootID, renderer)
+}
+
+// Returned when the target account is not part of the analyzed tree, see
+// exitAccountNotFound.
+type accountNotFoundError string
+
+func (e accountNotFoundError) Error() string {
+	return fmt.Sprintf("target account ID %s was not found in the organization", string(e))
+}
@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Human-readable units used by the text and HTML outputs. Structured outputs
+// (json) always keep the raw values.
+
+// Separators of the numbers, following the locale of the environment.
+type numberFormat struct {
+	group   string // thousands separator
+	decimal string
+}
+
+// Languages whose thousands separator isn't a comma, by the prefix of the locale
+// name (e.g. de_DE.UTF-8).
+var numberFormats = map[string]numberFormat{
+	"da": {".", ","}, "de": {".", ","}, "es": {".", ","}, "id": {".", ","}, "it": {".", ","},
+	"nl": {".", ","}, "pt": {".", ","}, "tr": {".", ","},
+	"cs": {" ", ","}, "fi": {" ", ","}, "fr": {" ", ","}, "nb": {" ", ","}, "pl": {" ", ","},
+	"ru": {" ", ","}, "sv": {" ", ","}, "uk": {" ", ","},
+}
+
+// Gets the number format of the locale, in the precedence order of POSIX.
+func localNumberFormat() numberFormat {
+	for _, name := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		language, _, _ := strings.Cut(locale, "_")
+		if format, ok := numberFormats[strings.ToLower(language)]; ok {
+			return format
+		}
+		break
+	}
+	return numberFormat{group: ",", decimal: "."}
+}
+
+// Formats a count with thousands separators, e.g. 12,345.
+func formatCount(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	separator := localNumberFormat().group
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String()
+}
+
+// Formats a count followed by the singular or plural form of its noun, e.g.
+// 1 attachment or 12,345 attachments.
+func formatQuantity(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return formatCount(n) + " " + plural
+}
+
+// Formats a size in bytes using binary units, e.g. 512 B or 4.2 KiB.
+func formatBytes(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%s B", formatCount(n))
+	}
+
+	size, unit := float64(n)/1024, "KiB"
+	for _, next := range []string{"MiB", "GiB"} {
+		if size < 1024 {
+			break
+		}
+		size, unit = size/1024, next
+	}
+	return fmt.Sprintf("%s %s", formatDecimal(size), unit)
+}
+
+// Formats a number with a single decimal, e.g. 2.5.
+func formatDecimal(f float64) string {
+	return strings.Replace(strconv.FormatFloat(f, 'f', 1, 64), ".", localNumberFormat().decimal, 1)
+}
+
+// Formats a duration with a precision that depends on its magnitude, e.g. 3m42s,
+// 1.25s or 340ms. Zero units at the end are dropped (2h instead of 2h0m0s).
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		d = d.Round(time.Second)
+	case d >= time.Second:
+		d = d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		d = d.Round(time.Millisecond)
+	default:
+		d = d.Round(time.Microsecond)
+	}
+
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+)
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		got    func() string
+		want   string
+	}{
+		{"count", "", func() string { return formatCount(1234567) }, "1,234,567"},
+		{"small count", "", func() string { return formatCount(999) }, "999"},
+		{"negative count", "", func() string { return formatCount(-12345) }, "-12,345"},
+		{"count in German", "de_DE.UTF-8", func() string { return formatCount(12345) }, "12.345"},
+		{"count in French", "fr_FR", func() string { return formatCount(12345) }, "12 345"},
+		{"unknown locale", "xx_XX", func() string { return formatCount(12345) }, "12,345"},
+		{"quantity of one", "", func() string { return formatQuantity(1, "attachment", "attachments") }, "1 attachment"},
+		{"quantity", "de_DE", func() string { return formatQuantity(1234, "policy", "policies") }, "1.234 policies"},
+		{"quantity of zero", "", func() string { return formatQuantity(0, "policy", "policies") }, "0 policies"},
+		{"bytes", "", func() string { return formatBytes(512) }, "512 B"},
+		{"kibibytes", "", func() string { return formatBytes(5120) }, "5.0 KiB"},
+		{"mebibytes", "", func() string { return formatBytes(3 << 20) }, "3.0 MiB"},
+		{"kibibytes in German", "de_DE", func() string { return formatBytes(4300) }, "4,2 KiB"},
+		{"minutes", "", func() string { return formatDuration(3*time.Minute + 42*time.Second + 300*time.Millisecond) }, "3m42s"},
+		{"whole minutes", "", func() string { return formatDuration(2 * time.Minute) }, "2m"},
+		{"whole hours", "", func() string { return formatDuration(2 * time.Hour) }, "2h"},
+		{"seconds", "", func() string { return formatDuration(1254 * time.Millisecond) }, "1.25s"},
+		{"milliseconds", "", func() string { return formatDuration(340400 * time.Microsecond) }, "340ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", "")
+			t.Setenv("LC_NUMERIC", "")
+			t.Setenv("LANG", tt.locale)
+			if got := tt.got(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		org  *awsorgtest.Org
+		args []string
+		want []string
+	}{
+		{
+			name: "text",
+			org:  newTestOrg(),
+			want: []string{"|-- Accounts: 3\n", "|-- Average SCPs per account: 1,7\n", "|-- Accounts per OU (average 1,5):\n", indent + "|-- Workloads [ou-root-work]: 2\n"},
+		},
+		{
+			name: "json keeps the raw values",
+			org:  newTestOrg(),
+			args: []string{"-o", "json"},
+			want: []string{`"accounts": 3,`, `"averageScpsPerAccount": 1.6666666666666667,`, `"averageAccountsPerOu": 1.5`},
+		},
+		{
+			name: "empty organization",
+			org:  awsorgtest.New("o-example", "r-root", "111111111111"),
+			want: []string{"|-- Accounts: 0\n", "|-- Average SCPs per account: 0,0\n", indent + "|-- SERVICE_CONTROL_POLICY: not enabled\n", indent + "|-- Root [r-root]: 0\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", "de_DE.UTF-8")
+			got, err := runCommand(t, tt.org, append([]string{"aws", "stats"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("stats: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("stats wrote:\n%s\nwant it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	securityhubtypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"github.com/spf13/cobra"
+)
+
+// newUnrestrictedCmd creates the aws unrestricted command.
+func newUnrestrictedCmd(deps *dependencies) *cobra.Command {
+	var ouID string // OU whose accounts are checked, the whole org if empty
+	unrestrictedCmd := &cobra.Command{
+		Use:         "unrestricted",
+		Short:       "Finds the accounts whose SCPs don't restrict anything (e.g. only FullAWSAccess)",
+		Annotations: map[string]string{findingsAnnotation: "true", metricsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return findUnrestrictedAccounts(cmd.Context(), deps, ouID)
+		},
+	}
+
+	unrestrictedCmd.Flags().StringVar(&ouID, "ou-id", "", "OU ID whose accounts are checked (defaults to the org root)")
+
+	return unrestrictedCmd
+}
+
+// findUnrestrictedAccounts evaluates the SCP chain of every account and reports
+// the ones only governed by allow-all policies. The management account is left
+// out since SCPs never apply to it.
+func findUnrestrictedAccounts(ctx context.Context, deps *dependencies, startOUID string) error {
+	naming, err := compileNamingConventions(deps.options.namingConventions)
+	if err != nil {
+		return err
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+	renderer := textRenderer{naming: naming}
+
+	startID, err := getStartingID(ctx, client, startOUID)
+	if err != nil {
+		return err
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	accountIDs, err := listAccountsInSubtree(ctx, client, startID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(deps.report, "Accounts without real SCP restrictions (only allow-all policies such as FullAWSAccess):")
+	checked, unrestricted := 0, 0
+	var published []auditFinding
+	for _, id := range accountIDs {
+		if id == managementAccountID {
+			continue
+		}
+		checked++
+
+		chain, err := getPolicyChain(ctx, client, id, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return err
+		}
+		if !scp.Unrestricted(chain) {
+			continue
+		}
+		unrestricted++
+
+		scps, err := client.scout().EffectivePolicies(ctx, id, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return fmt.Errorf("error getting SCPs for %s: %w", id, err)
+		}
+		account := chain[len(chain)-1]
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s] (SCPs: %s)\n", account.TargetName, account.TargetID, renderer.formatPolicies(scps))
+		published = append(published, auditFinding{
+			check:        "ungoverned-account",
+			severity:     securityhubtypes.SeverityLabelHigh,
+			title:        fmt.Sprintf("Account %s is not restricted by any SCP", account.TargetName),
+			description:  fmt.Sprintf("Only allow-all policies apply to account %s [%s] (SCPs: %s), nothing limits what its principals can do.", account.TargetName, account.TargetID, renderer.formatPolicies(scps)),
+			resourceType: accountResource,
+			resourceID:   accountResourceID(id),
+		})
+	}
+	fmt.Fprintf(deps.report, "%d of %d accounts have no SCP restrictions (the management account is not affected by SCPs)\n", unrestricted, checked)
+
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return err
+	}
+	if err := publishMetrics(ctx, deps, aws.ToString(org.Id), []cloudWatchMetric{{name: ungovernedAccountsMetric, unit: cloudwatchtypes.StandardUnitCount, value: float64(unrestricted)}}); err != nil {
+		return err
+	}
+	return publishFindings(ctx, deps, "aws unrestricted", published)
+}
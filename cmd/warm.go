@@ -0,0 +1,142 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/spf13/cobra"
+)
+
+// newCacheCmd creates the group of commands that manage the warm cache.
+func newCacheCmd(deps *dependencies) *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache used to answer instantly from fresh data",
+	}
+
+	cacheCmd.AddCommand(newCacheWarmCmd(deps))
+
+	return cacheCmd
+}
+
+// newCacheWarmCmd creates the cache warm command.
+func newCacheWarmCmd(deps *dependencies) *cobra.Command {
+	var provider string // cloud provider whose data is cached
+	cacheWarmCmd := &cobra.Command{
+		Use:   "warm",
+		Short: "Refreshes the warm cache, intended to be run periodically (e.g. from cron)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return warmCache(cmd.Context(), deps, provider, deps.options.cacheFile)
+		},
+	}
+
+	cacheWarmCmd.Flags().StringVar(&provider, "provider", "", `cloud provider whose data is cached: "aws"`)
+	cacheWarmCmd.MarkFlagRequired("provider") //nolint:gosec,errcheck
+
+	return cacheWarmCmd
+}
+
+// Location of the warm cache in the user cache directory.
+func defaultCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "policy-scout", "aws-cache.json")
+}
+
+// Loads the warm cache, if there is a fresh enough one. It is reloaded only when
+// the file changed since the last time, so long running commands (serve) can call
+// it before every request.
+func loadWarmCache(deps *dependencies) error {
+	cacheFile := deps.options.cacheFile
+	if deps.options.noCache || cacheFile == "" {
+		return nil
+	}
+
+	info, err := os.Stat(cacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read warm cache: %w", err)
+	}
+
+	deps.cache.warmMu.Lock()
+	defer deps.cache.warmMu.Unlock()
+	if !info.ModTime().After(deps.cache.warmModified) {
+		return nil
+	}
+	if age := deps.now().Sub(info.ModTime()); age > deps.options.cacheMaxAge {
+		fmt.Fprintf(deps.stderr, "Ignoring warm cache %s, it is %s old (see --cache-max-age)\n", cacheFile, formatDuration(age.Round(time.Minute)))
+		return nil
+	}
+
+	if err := deps.cache.load(cacheFile); err != nil {
+		return fmt.Errorf("couldn't load warm cache %s: %w", cacheFile, err)
+	}
+	deps.cache.warmModified = info.ModTime()
+	return nil
+}
+
+// warmCache walks the whole organization with an empty cache, so every result is
+// fetched again, and saves the results for the next commands.
+func warmCache(ctx context.Context, deps *dependencies, provider, path string) error {
+	if provider != "aws" {
+		return fmt.Errorf("invalid provider %q: only \"aws\" is supported", provider)
+	}
+	if path == "" {
+		return errors.New("no cache file, use --cache-file")
+	}
+
+	deps.cache.reset()
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	rootID, err := client.scout().RootID(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get organization's root ID: %w", err)
+	}
+
+	// Building the tree fetches the names and the SCPs of every entity, only
+	// the documents of the SCPs are left
+	start := deps.now()
+	tree, err := client.scout().BuildTree(ctx, rootID)
+	if err != nil {
+		return err
+	}
+	err = tree.Root.Walk(func(node *orgtree.Node, depth int) error {
+		for _, policy := range node.SCPs {
+			if _, err := getPolicyDocument(ctx, client, policy.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := deps.cache.save(path); err != nil {
+		return fmt.Errorf("couldn't save warm cache: %w", err)
+	}
+
+	fmt.Fprintf(deps.stdout, "Warm cache saved to %s in %s\n", path, formatDuration(deps.now().Sub(start)))
+	return nil
+}
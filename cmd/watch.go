@@ -0,0 +1,383 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/spf13/cobra"
+)
+
+// snapshotWatchOptions are the flags of the aws snapshot watch command.
+type snapshotWatchOptions struct {
+	queueURL string // SQS queue the EventBridge rule forwards the Organizations events to
+	baseline string // snapshot the watch starts from, the live organization if empty
+	out      string // where the snapshot is written after every change, not written if empty
+}
+
+// Messages received at once, and how long a receive waits for them (long polling).
+const (
+	watchBatchSize   = 10
+	watchWaitSeconds = 20
+)
+
+// Source of the events of Organizations, as forwarded by EventBridge.
+const organizationsEventSource = "aws.organizations"
+
+// sqsAPI is the part of the SQS API used by the commands.
+type sqsAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+}
+
+// Creates the SQS client of the local AWS config, in the region of the queue.
+func (d *dependencies) newSQSClient(ctx context.Context, region string) (sqsAPI, error) {
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) { o.Region = region }), nil
+}
+
+// newSnapshotWatchCmd creates the aws snapshot watch command.
+func newSnapshotWatchCmd(deps *dependencies) *cobra.Command {
+	options := &snapshotWatchOptions{}
+	snapshotWatchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Follows the changes of the organization from its CloudTrail events and reports the drift as it happens",
+		Long: `Follows the changes of the organization from the CloudTrail events of
+Organizations, forwarded by an EventBridge rule to an SQS queue:
+
+  {"source": ["aws.organizations"], "detail-type": ["AWS API Call via CloudTrail", "AWS Service Event via CloudTrail"]}
+
+Organizations sends its events to the EventBridge of us-east-1, the rule has to
+be created there. Accounts moved, policies attached, detached, created, updated
+or deleted and OUs created, renamed or deleted are applied to the snapshot as
+they are received, any other event (e.g. an account joining) takes a new one.
+The drift of every change is reported and sent to the --notify destinations.`,
+		Annotations: map[string]string{driftAnnotation: "true", metricsAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return watchOrganization(cmd.Context(), deps, options.queueURL, options.baseline, options.out)
+		},
+	}
+
+	snapshotWatchCmd.Flags().StringVar(&options.queueURL, "queue-url", "", "URL of the SQS queue receiving the Organizations events, e.g. https://sqs.us-east-1.amazonaws.com/111111111111/org-events")
+	snapshotWatchCmd.MarkFlagRequired("queue-url") //nolint:gosec,errcheck
+	snapshotWatchCmd.Flags().StringVar(&options.baseline, "baseline", "", "snapshot the changes are applied to (defaults to a snapshot of the live organization)")
+	snapshotWatchCmd.Flags().StringVar(&options.out, "out", "", `file (or s3://bucket/key, or "-" for stdout) rewritten with the snapshot after every change`)
+
+	return snapshotWatchCmd
+}
+
+// watchOrganization receives the events of the queue until the context is
+// cancelled, keeping a snapshot of the organization up to date and reporting
+// the drift of every batch of events. The messages are deleted once applied.
+func watchOrganization(ctx context.Context, deps *dependencies, queueURL, baseline, out string) error {
+	if deps.options.demo || deps.options.snapshotFile != "" {
+		return errors.New("aws snapshot watch follows the live organization, it can't be used with --demo or --from-snapshot")
+	}
+	region, err := queueRegion(queueURL)
+	if err != nil {
+		return err
+	}
+	queue, err := deps.sqsClient(ctx, region)
+	if err != nil {
+		return err
+	}
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var current *orgSnapshot
+	if baseline != "" {
+		if current, err = readSnapshot(baseline); err != nil {
+			return err
+		}
+	} else if current, err = captureSnapshot(ctx, client); err != nil {
+		return err
+	}
+
+	// The watch runs until stopped, there is no scan to report the progress of
+	deps.progress.finish()
+	fmt.Fprintf(deps.stderr, "Watching the changes of %s from %s\n", current.ID, queueURL)
+
+	since := deps.now().UTC().Format(time.RFC3339)
+	for {
+		received, err := queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: watchBatchSize,
+			WaitTimeSeconds:     watchWaitSeconds,
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error receiving events from %s: %w", queueURL, err)
+		}
+		if len(received.Messages) == 0 {
+			continue
+		}
+
+		previous, err := current.clone()
+		if err != nil {
+			return err
+		}
+		var unknown []string // events that couldn't be applied
+		for _, message := range received.Messages {
+			event, err := parseOrganizationsEvent(aws.ToString(message.Body))
+			if err != nil {
+				fmt.Fprintf(deps.stderr, "Ignoring message %s: %v\n", aws.ToString(message.MessageId), err)
+				continue
+			}
+			// Failed calls, and read-only ones, don't change anything
+			if event.Detail.ErrorCode != "" || event.Detail.ReadOnly {
+				continue
+			}
+			if !current.apply(event) {
+				unknown = append(unknown, event.Detail.EventName)
+			}
+		}
+		if len(unknown) > 0 {
+			slices.Sort(unknown)
+			fmt.Fprintf(deps.stderr, "Taking a new snapshot after %s\n", strings.Join(slices.Compact(unknown), ", "))
+			deps.cache.reset()
+			if current, err = captureSnapshot(ctx, client); err != nil {
+				return err
+			}
+		}
+
+		now := deps.now().UTC().Format(time.RFC3339)
+		report := compareSnapshots(previous, current, "the organization at "+since, "the organization at "+now)
+		if report.total() > 0 {
+			if err := reportWatchedDrift(ctx, deps, report, current, out); err != nil {
+				return err
+			}
+			since = now
+		}
+
+		if err := deleteMessages(ctx, queue, queueURL, received.Messages); err != nil {
+			return err
+		}
+	}
+}
+
+// Reports the drift of a batch of events: printed, published to CloudWatch, sent
+// to the --notify destinations, and the snapshot saved to out.
+func reportWatchedDrift(ctx context.Context, deps *dependencies, report driftReport, current *orgSnapshot, out string) error {
+	printDrift(deps.report, report)
+	if err := publishMetrics(ctx, deps, report.organizationID, []cloudWatchMetric{{name: driftMetric, unit: cloudwatchtypes.StandardUnitCount, value: float64(report.total())}}); err != nil {
+		return err
+	}
+	if err := notifyDrift(ctx, deps, report); err != nil {
+		return err
+	}
+	if out == "" {
+		return nil
+	}
+	_, err := saveSnapshot(ctx, deps, current, out)
+	return err
+}
+
+func deleteMessages(ctx context.Context, queue sqsAPI, queueURL string, messages []sqstypes.Message) error {
+	entries := make([]sqstypes.DeleteMessageBatchRequestEntry, 0, len(messages))
+	for i, message := range messages {
+		entries = append(entries, sqstypes.DeleteMessageBatchRequestEntry{Id: aws.String(fmt.Sprint(i)), ReceiptHandle: message.ReceiptHandle})
+	}
+	output, err := queue.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries})
+	if err != nil {
+		return fmt.Errorf("error deleting events from %s: %w", queueURL, err)
+	}
+	if len(output.Failed) > 0 {
+		return fmt.Errorf("error deleting events from %s: %s", queueURL, aws.ToString(output.Failed[0].Message))
+	}
+	return nil
+}
+
+// Extracts the region of an SQS queue URL, e.g.
+// https://sqs.us-east-1.amazonaws.com/111111111111/org-events.
+func queueRegion(queueURL string) (string, error) {
+	parsed, err := url.Parse(queueURL)
+	if err == nil {
+		parts := strings.Split(parsed.Hostname(), ".")
+		switch {
+		case len(parts) > 2 && parts[0] == "sqs":
+			return parts[1], nil
+		case len(parts) > 2 && parts[1] == "queue": // legacy https://us-east-1.queue.amazonaws.com/...
+			return parts[0], nil
+		}
+	}
+	return "", fmt.Errorf("invalid queue URL %q: expected https://sqs.<region>.amazonaws.com/<account>/<queue>", queueURL)
+}
+
+// An Organizations API call recorded by CloudTrail, as EventBridge delivers it.
+// Only the parameters the watch applies are decoded.
+type organizationsEvent struct {
+	Source string `json:"source"`
+	Detail struct {
+		EventName         string `json:"eventName"`
+		ErrorCode         string `json:"errorCode"`
+		ReadOnly          bool   `json:"readOnly"`
+		RequestParameters struct {
+			AccountID            string  `json:"accountId"`
+			DestinationParentID  string  `json:"destinationParentId"`
+			PolicyID             string  `json:"policyId"`
+			TargetID             string  `json:"targetId"`
+			OrganizationalUnitID string  `json:"organizationalUnitId"`
+			ParentID             string  `json:"parentId"`
+			Name                 *string `json:"name"`
+			Description          *string `json:"description"`
+			Content              *string `json:"content"`
+		} `json:"requestParameters"`
+		ResponseElements struct {
+			Policy struct {
+				PolicySummary struct {
+					ID          string `json:"id"`
+					Name        string `json:"name"`
+					Description string `json:"description"`
+					Type        string `json:"type"`
+					AWSManaged  bool   `json:"awsManaged"`
+				} `json:"policySummary"`
+				Content string `json:"content"`
+			} `json:"policy"`
+			OrganizationalUnit struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"organizationalUnit"`
+		} `json:"responseElements"`
+	} `json:"detail"`
+}
+
+func parseOrganizationsEvent(body string) (organizationsEvent, error) {
+	var event organizationsEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return event, fmt.Errorf("not an EventBridge event: %w", err)
+	}
+	if event.Source != organizationsEventSource {
+		return event, fmt.Errorf("unexpected event source %q, expected %s", event.Source, organizationsEventSource)
+	}
+	return event, nil
+}
+
+// Applies the change made by the call of an event to the snapshot. It returns
+// false when the event is not one the watch knows, or its parameters don't
+// match the snapshot, so a new snapshot has to be taken.
+func (o *orgSnapshot) apply(event organizationsEvent) bool {
+	request, response := event.Detail.RequestParameters, event.Detail.ResponseElements
+	accountIndex := slices.IndexFunc(o.Accounts, func(a snapshotAccount) bool { return a.ID == request.AccountID })
+	policyIndex := slices.IndexFunc(o.Policies, func(p snapshotPolicy) bool { return p.ID == request.PolicyID })
+	ouIndex := slices.IndexFunc(o.OUs, func(ou snapshotOU) bool { return ou.ID == request.OrganizationalUnitID })
+
+	switch event.Detail.EventName {
+	case "MoveAccount":
+		if accountIndex < 0 {
+			return false
+		}
+		o.Accounts[accountIndex].ParentID = request.DestinationParentID
+	case "CloseAccount":
+		if accountIndex < 0 {
+			return false
+		}
+		o.Accounts[accountIndex].Status = string(types.AccountStatusPendingClosure)
+	case "RemoveAccountFromOrganization":
+		if accountIndex < 0 {
+			return false
+		}
+		o.Accounts = slices.Delete(o.Accounts, accountIndex, accountIndex+1)
+		o.detachAll(request.AccountID)
+	case "AttachPolicy":
+		if policyIndex < 0 {
+			return false
+		}
+		if !slices.Contains(o.Policies[policyIndex].Targets, request.TargetID) {
+			o.Policies[policyIndex].Targets = append(o.Policies[policyIndex].Targets, request.TargetID)
+		}
+	case "DetachPolicy":
+		if policyIndex < 0 {
+			return false
+		}
+		o.Policies[policyIndex].Targets = slices.DeleteFunc(o.Policies[policyIndex].Targets, func(id string) bool { return id == request.TargetID })
+	case "CreatePolicy":
+		summary := response.Policy.PolicySummary
+		if summary.ID == "" || !json.Valid([]byte(response.Policy.Content)) {
+			return false
+		}
+		o.Policies = append(o.Policies, snapshotPolicy{
+			ID:          summary.ID,
+			Name:        summary.Name,
+			Type:        summary.Type,
+			Description: summary.Description,
+			AWSManaged:  summary.AWSManaged,
+			Targets:     []string{},
+			Content:     json.RawMessage(response.Policy.Content),
+		})
+	case "UpdatePolicy":
+		if policyIndex < 0 || (request.Content != nil && !json.Valid([]byte(*request.Content))) {
+			return false
+		}
+		if request.Name != nil {
+			o.Policies[policyIndex].Name = *request.Name
+		}
+		if request.Description != nil {
+			o.Policies[policyIndex].Description = *request.Description
+		}
+		if request.Content != nil {
+			o.Policies[policyIndex].Content = json.RawMessage(*request.Content)
+		}
+	case "DeletePolicy":
+		if policyIndex < 0 {
+			return false
+		}
+		o.Policies = slices.Delete(o.Policies, policyIndex, policyIndex+1)
+	case "CreateOrganizationalUnit":
+		if response.OrganizationalUnit.ID == "" {
+			return false
+		}
+		o.OUs = append(o.OUs, snapshotOU{ID: response.OrganizationalUnit.ID, Name: response.OrganizationalUnit.Name, ParentID: request.ParentID})
+	case "UpdateOrganizationalUnit":
+		if ouIndex < 0 || request.Name == nil {
+			return false
+		}
+		o.OUs[ouIndex].Name = *request.Name
+	case "DeleteOrganizationalUnit":
+		if ouIndex < 0 {
+			return false
+		}
+		o.OUs = slices.Delete(o.OUs, ouIndex, ouIndex+1)
+		o.detachAll(request.OrganizationalUnitID)
+	default:
+		return false
+	}
+	return true
+}
+
+// Removes a target from the targets of every policy.
+func (o *orgSnapshot) detachAll(targetID string) {
+	for i := range o.Policies {
+		o.Policies[i].Targets = slices.DeleteFunc(o.Policies[i].Targets, func(id string) bool { return id == targetID })
+	}
+}
+
+// Deep copy of the snapshot, the state before a batch of events is applied.
+func (o *orgSnapshot) clone() (*orgSnapshot, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshot(data)
+}
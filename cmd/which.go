@@ -0,0 +1,129 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// whichOptions are the flags of the aws which command.
+type whichOptions struct {
+	action string // action looked up, e.g. ec2:RunInstances
+	effect string // "deny" or "allow"
+	ouID   string // OU whose accounts are checked, the whole org if empty
+}
+
+// newWhichCmd creates the aws which command.
+func newWhichCmd(deps *dependencies) *cobra.Command {
+	options := &whichOptions{}
+	whichCmd := &cobra.Command{
+		Use:   "which",
+		Short: "Finds the accounts where the SCPs deny (or allow) an action",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return findAccountsByEffect(cmd.Context(), deps, options.action, options.effect, options.ouID)
+		},
+	}
+
+	whichCmd.Flags().StringVar(&options.action, "action", "", "action looked up, e.g. ec2:RunInstances")
+	whichCmd.MarkFlagRequired("action") //nolint:gosec,errcheck
+	whichCmd.Flags().StringVar(&options.effect, "effect", "deny", `effect looked up: "deny" or "allow"`)
+	whichCmd.Flags().StringVar(&options.ouID, "ou-id", "", "OU ID whose accounts are checked (defaults to the org root)")
+
+	return whichCmd
+}
+
+// findAccountsByEffect walks the SCP chain of every account and lists the ones
+// where the action has the requested effect. Actions only denied under some
+// conditions are listed for both effects, along with those conditions.
+func findAccountsByEffect(ctx context.Context, deps *dependencies, action, effect, startOUID string) error {
+	if !strings.Contains(action, ":") {
+		return fmt.Errorf("invalid action %q: it must look like service:Action", action)
+	}
+	if effect != "deny" && effect != "allow" {
+		return fmt.Errorf(`invalid effect %q: it must be "deny" or "allow"`, effect)
+	}
+
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	startID, err := getStartingID(ctx, client, startOUID)
+	if err != nil {
+		return err
+	}
+
+	managementAccountID, err := getManagementAccountID(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	accountIDs, err := listAccountsInSubtree(ctx, client, startID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(deps.report, "Accounts where %s is %s:\n", action, map[string]string{"deny": "denied", "allow": "allowed"}[effect])
+	matched := 0
+	for _, id := range accountIDs {
+		// SCPs never apply to the management account
+		if id == managementAccountID {
+			if effect == "allow" {
+				name, err := client.scout().Name(ctx, id)
+				if err != nil {
+					return fmt.Errorf("error getting name for id %s: %w", id, err)
+				}
+				fmt.Fprintf(deps.report, "|-- Account: %s [%s]: management account, SCPs don't apply\n", name, id)
+				matched++
+			}
+			continue
+		}
+
+		chain, err := getPolicyChain(ctx, client, id, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return err
+		}
+		account := chain[len(chain)-1]
+		explanation := scp.Explain(chain, action)
+
+		var reason string
+		switch {
+		case explanation.DeniedBy != nil && effect == "deny":
+			reason = "explicit deny by " + formatRule(*explanation.DeniedBy)
+		case explanation.NotAllowedAt != nil && effect == "deny":
+			reason = "implicit deny, nothing allows it at " + levelLabel(*explanation.NotAllowedAt)
+		case explanation.Allowed() && len(explanation.ConditionalDenies) > 0:
+			reason = conditionalDenies(explanation.ConditionalDenies, effect)
+		case explanation.Allowed() && effect == "allow":
+			reason = "allowed at every level"
+		default:
+			continue
+		}
+		fmt.Fprintf(deps.report, "|-- Account: %s [%s]: %s\n", account.TargetName, account.TargetID, reason)
+		matched++
+	}
+	fmt.Fprintf(deps.report, "%d of %d accounts\n", matched, len(accountIDs))
+
+	return nil
+}
+
+// Describes the deny statements only applying under some conditions.
+func conditionalDenies(denies []scp.Rule, effect string) string {
+	formatted := make([]string, 0, len(denies))
+	for _, rule := range denies {
+		formatted = append(formatted, fmt.Sprintf("%s (%s)", denyScope(rule.Statement), ruleSource(rule)))
+	}
+	if effect == "deny" {
+		return "only denied " + strings.Join(formatted, "; ")
+	}
+	return "allowed, except " + strings.Join(formatted, "; ")
+}
@@ -0,0 +1,311 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package cmd contains all the commands included in this utility
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/ariguillegp/policy-scout/internal/scp"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/spf13/cobra"
+)
+
+// whoCanOptions are the flags of the aws whocan command.
+type whoCanOptions struct {
+	accountID  string   // account of the role
+	roleName   string   // role whose permissions are evaluated
+	action     string   // action evaluated, e.g. s3:PutObject
+	resource   string   // ARN of the resource of the request
+	region     string   // region of the request (aws:RequestedRegion)
+	context    []string // additional condition keys, as key=value
+	accessRole string   // read-only role assumed in the account to read IAM
+}
+
+// Path of the service-linked roles, which SCPs don't restrict.
+const serviceLinkedRolePath = "/aws-service-role/"
+
+// newWhoCanCmd creates the aws whocan command.
+func newWhoCanCmd(deps *dependencies) *cobra.Command {
+	options := &whoCanOptions{}
+	whocanCmd := &cobra.Command{
+		Use:   "whocan",
+		Short: "Decides whether a role can perform an action, combining the SCPs of its account with its identity policies and permissions boundary",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request, err := buildSimulationRequest(options.action, options.region, options.resource, options.context)
+			if err != nil {
+				return err
+			}
+			return evaluateRoleRequest(cmd.Context(), deps, options.accountID, options.roleName, options.accessRole, request)
+		},
+	}
+
+	whocanCmd.Flags().StringVar(&options.accountID, "account-id", "", "aws account ID of the role")
+	whocanCmd.MarkFlagRequired("account-id") //nolint:gosec,errcheck
+	whocanCmd.Flags().StringVar(&options.roleName, "role-name", "", "name of the IAM role whose permissions are evaluated")
+	whocanCmd.MarkFlagRequired("role-name") //nolint:gosec,errcheck
+	whocanCmd.Flags().StringVar(&options.action, "action", "", "action to evaluate, e.g. s3:PutObject")
+	whocanCmd.MarkFlagRequired("action") //nolint:gosec,errcheck
+
+	whocanCmd.Flags().StringVar(&options.resource, "resource", "", "ARN of the resource of the request (any resource if empty)")
+	whocanCmd.Flags().StringVar(&options.region, "region", "", "region of the request, used for aws:RequestedRegion conditions")
+	whocanCmd.Flags().StringArrayVar(&options.context, "context", nil, "condition key of the request as key=value (repeatable), aws:PrincipalArn and aws:PrincipalAccount are set from the role")
+	whocanCmd.Flags().StringVar(&options.accessRole, "access-role", "", "name of a read-only role assumed in the account to read the IAM policies of the role (the local credentials are used if empty)")
+
+	return whocanCmd
+}
+
+// iamAPI is the part of the IAM API used by the commands.
+type iamAPI interface {
+	iam.ListAttachedRolePoliciesAPIClient
+	iam.ListRolePoliciesAPIClient
+
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error)
+	GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+}
+
+// Creates the IAM client of an account, with the credentials of the role of
+// --access-role in that account, or the local ones. The demo and the snapshots
+// only describe the organization, IAM is not part of them.
+func (d *dependencies) newIAMClient(ctx context.Context, accountID, accessRole string) (iamAPI, error) {
+	if d.options.demo || d.options.snapshotFile != "" {
+		return nil, errors.New("IAM roles are not part of the demo organization nor of snapshots, run this command against AWS")
+	}
+
+	cfg, err := d.loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if accessRole != "" {
+		assumeRole(&cfg, fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, accessRole), "")
+	}
+	return iam.NewFromConfig(cfg), nil
+}
+
+// The policies that decide what a role can do, besides the resource-based ones.
+type rolePermissions struct {
+	arn      string
+	path     string
+	identity scp.Level  // inline and managed policies of the role
+	boundary *scp.Level // nil when the role has no permissions boundary
+}
+
+// Evaluates the request against the SCPs of the account, and the identity
+// policies and permissions boundary of the role, and explains the decision. Like
+// IAM does, an explicit deny in any of them wins, otherwise all of them must
+// allow the request. Resource-based policies and session policies are not
+// evaluated.
+func evaluateRoleRequest(ctx context.Context, deps *dependencies, accountID, roleName, accessRole string, request scp.Request) error {
+	client, err := deps.orgClient(ctx)
+	if err != nil {
+		return err
+	}
+	org, err := client.scout().Organization(ctx)
+	if err != nil {
+		return err
+	}
+	accountName, err := client.scout().Name(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("error getting name for id %s: %w", accountID, err)
+	}
+
+	iamClient, err := deps.iamClient(ctx, accountID, accessRole)
+	if err != nil {
+		return err
+	}
+	role, err := getRolePermissions(ctx, iamClient, roleName)
+	if err != nil {
+		return err
+	}
+
+	// The principal of the request is the role, unless stated otherwise
+	if _, ok := request.Context["aws:PrincipalArn"]; !ok {
+		request.Context["aws:PrincipalArn"] = []string{role.arn}
+	}
+	if _, ok := request.Context["aws:PrincipalAccount"]; !ok {
+		request.Context["aws:PrincipalAccount"] = []string{accountID}
+	}
+
+	// SCPs restrict neither the management account nor the service-linked roles
+	var scpDecision *scp.Decision
+	var scpExemption string
+	switch {
+	case accountID == aws.ToString(org.MasterAccountId):
+		scpExemption = "not applied to the management account"
+	case role.path == serviceLinkedRolePath:
+		scpExemption = "not applied to service-linked roles"
+	default:
+		chain, err := getPolicyChain(ctx, client, accountID, types.PolicyTypeServiceControlPolicy)
+		if err != nil {
+			return err
+		}
+		decision := scp.Evaluate(chain, request)
+		scpDecision = &decision
+	}
+
+	identityDecision := scp.Evaluate([]scp.Level{role.identity}, request)
+	var boundaryDecision *scp.Decision
+	if role.boundary != nil {
+		decision := scp.Evaluate([]scp.Level{*role.boundary}, request)
+		boundaryDecision = &decision
+	}
+
+	allowed := identityDecision.Allowed && (scpDecision == nil || scpDecision.Allowed) && (boundaryDecision == nil || boundaryDecision.Allowed)
+	verdict := "DENIED"
+	if allowed {
+		verdict = "ALLOWED"
+	}
+	subject := request.Action
+	if request.Resource != "" {
+		subject += " on " + request.Resource
+	}
+	if region, ok := request.Context["aws:RequestedRegion"]; ok {
+		subject += " in " + strings.Join(region, ", ")
+	}
+	fmt.Fprintf(deps.report, "%s by role %s in account %s [%s]: %s\n", subject, roleName, accountName, accountID, verdict)
+
+	missing := map[string]bool{}
+	if scpDecision == nil {
+		fmt.Fprintf(deps.report, "%s|-- SCPs: %s\n", indent, scpExemption)
+	} else {
+		printPolicyDecision(deps.report, "SCPs", *scpDecision)
+		for _, key := range scpDecision.MissingKeys {
+			missing[key] = true
+		}
+	}
+	printPolicyDecision(deps.report, "Identity policies", identityDecision)
+	for _, key := range identityDecision.MissingKeys {
+		missing[key] = true
+	}
+	if boundaryDecision == nil {
+		fmt.Fprintf(deps.report, "%s|-- Permissions boundary: none\n", indent)
+	} else {
+		printPolicyDecision(deps.report, "Permissions boundary", *boundaryDecision)
+		for _, key := range boundaryDecision.MissingKeys {
+			missing[key] = true
+		}
+	}
+
+	if len(missing) > 0 {
+		fmt.Fprintf(deps.report, "%s|-- Assumed absent from the request (use --context to set them): %s\n", indent, strings.Join(sortedKeys(missing), ", "))
+	}
+	fmt.Fprintf(deps.report, "%s|-- Resource-based and session policies are not evaluated\n", indent)
+	return nil
+}
+
+// Prints the decision of one kind of policies along with the statements
+// responsible for it.
+func printPolicyDecision(w io.Writer, kind string, decision scp.Decision) {
+	switch {
+	case decision.DeniedBy != nil:
+		fmt.Fprintf(w, "%s|-- %s: explicit deny by %s\n", indent, kind, formatRule(*decision.DeniedBy))
+	case decision.NotAllowedAt != nil:
+		fmt.Fprintf(w, "%s|-- %s: implicit deny, nothing in %s [%s] allows it\n", indent, kind, decision.NotAllowedAt.TargetName, decision.NotAllowedAt.TargetID)
+	default:
+		fmt.Fprintf(w, "%s|-- %s: allowed\n", indent, kind)
+		for _, rule := range decision.AllowedBy {
+			source := rule.PolicyName
+			if rule.Statement.Sid != "" {
+				source += ", statement " + rule.Statement.Sid
+			}
+			fmt.Fprintf(w, "%s%s|-- %s [%s]: allowed by %s\n", indent, indent, rule.TargetName, rule.TargetID, source)
+		}
+	}
+	printUnevaluated(w, indent+indent, decision)
+}
+
+// Reads the inline and managed policies of a role, and its permissions boundary.
+func getRolePermissions(ctx context.Context, client iamAPI, roleName string) (rolePermissions, error) {
+	result, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: &roleName})
+	if err != nil {
+		return rolePermissions{}, fmt.Errorf("error getting role %s: %w", roleName, err)
+	}
+	role := rolePermissions{
+		arn:      aws.ToString(result.Role.Arn),
+		path:     aws.ToString(result.Role.Path),
+		identity: scp.Level{TargetID: aws.ToString(result.Role.Arn), TargetName: roleName},
+	}
+
+	inline := iam.NewListRolePoliciesPaginator(client, &iam.ListRolePoliciesInput{RoleName: &roleName})
+	for inline.HasMorePages() {
+		page, err := inline.NextPage(ctx)
+		if err != nil {
+			return rolePermissions{}, fmt.Errorf("error listing inline policies of role %s: %w", roleName, err)
+		}
+		for _, name := range page.PolicyNames {
+			policy, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{RoleName: &roleName, PolicyName: aws.String(name)})
+			if err != nil {
+				return rolePermissions{}, fmt.Errorf("error getting inline policy %s of role %s: %w", name, roleName, err)
+			}
+			parsed, err := parseIAMDocument(aws.ToString(policy.PolicyDocument))
+			if err != nil {
+				return rolePermissions{}, fmt.Errorf("inline policy %s: %w", name, err)
+			}
+			role.identity.Policies = append(role.identity.Policies, scp.Policy{ID: name, Name: name, Document: parsed})
+		}
+	}
+
+	attached := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{RoleName: &roleName})
+	for attached.HasMorePages() {
+		page, err := attached.NextPage(ctx)
+		if err != nil {
+			return rolePermissions{}, fmt.Errorf("error listing managed policies of role %s: %w", roleName, err)
+		}
+		for _, summary := range page.AttachedPolicies {
+			policy, err := getManagedPolicy(ctx, client, aws.ToString(summary.PolicyArn))
+			if err != nil {
+				return rolePermissions{}, err
+			}
+			role.identity.Policies = append(role.identity.Policies, policy)
+		}
+	}
+
+	if result.Role.PermissionsBoundary != nil {
+		boundaryARN := aws.ToString(result.Role.PermissionsBoundary.PermissionsBoundaryArn)
+		policy, err := getManagedPolicy(ctx, client, boundaryARN)
+		if err != nil {
+			return rolePermissions{}, err
+		}
+		role.boundary = &scp.Level{TargetID: boundaryARN, TargetName: policy.Name, Policies: []scp.Policy{policy}}
+	}
+
+	return role, nil
+}
+
+// Reads the default version of a managed policy.
+func getManagedPolicy(ctx context.Context, client iamAPI, policyARN string) (scp.Policy, error) {
+	policy, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: &policyARN})
+	if err != nil {
+		return scp.Policy{}, fmt.Errorf("error getting policy %s: %w", policyARN, err)
+	}
+	version, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{PolicyArn: &policyARN, VersionId: policy.Policy.DefaultVersionId})
+	if err != nil {
+		return scp.Policy{}, fmt.Errorf("error getting the default version of policy %s: %w", policyARN, err)
+	}
+	parsed, err := parseIAMDocument(aws.ToString(version.PolicyVersion.Document))
+	if err != nil {
+		return scp.Policy{}, fmt.Errorf("policy %s: %w", policyARN, err)
+	}
+	return scp.Policy{ID: policyARN, Name: aws.ToString(policy.Policy.PolicyName), Document: parsed}, nil
+}
+
+// Parses a policy document returned by IAM, which is URL encoded. Identity
+// policies share the grammar of the SCPs.
+func parseIAMDocument(encoded string) (*scp.Document, error) {
+	document, err := url.QueryUnescape(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	return scp.Parse(document)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package aioptout reads the effective AI services opt-out policies computed by
+// AWS Organizations, which decide whether AWS AI services can store and use the
+// content of an account to improve themselves.
+package aioptout
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Values of the opt_out_policy setting.
+const (
+	OptIn  = "optIn"
+	OptOut = "optOut"
+)
+
+// Service is the opt-out setting of an AI service ("default" applies to every
+// service without its own setting).
+type Service struct {
+	Name    string
+	Setting string // OptIn or OptOut
+}
+
+// Effective is an effective AI services opt-out policy.
+type Effective struct {
+	Services []Service // sorted by name, "default" first
+}
+
+// OptedOut reports whether the account is opted out of every AI service.
+func (e *Effective) OptedOut() bool {
+	defaultOptedOut := false
+	for _, service := range e.Services {
+		if service.Setting != OptOut {
+			return false
+		}
+		if service.Name == "default" {
+			defaultOptedOut = true
+		}
+	}
+	return defaultOptedOut
+}
+
+// Parse reads the content of an effective AI services opt-out policy. Values
+// still wrapped in @@assign (as in the policies themselves) are accepted too.
+func Parse(content string) (*Effective, error) {
+	var document struct {
+		Services map[string]struct {
+			OptOutPolicy json.RawMessage `json:"opt_out_policy"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		return nil, fmt.Errorf("invalid AI services opt-out policy: %v", err)
+	}
+
+	effective := &Effective{}
+	for name, service := range document.Services {
+		setting, err := value(service.OptOutPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid opt_out_policy of %s: %v", name, err)
+		}
+		effective.Services = append(effective.Services, Service{Name: name, Setting: setting})
+	}
+	sort.Slice(effective.Services, func(i, j int) bool {
+		a, b := effective.Services[i].Name, effective.Services[j].Name
+		if a == "default" || b == "default" {
+			return a == "default" && b != "default"
+		}
+		return a < b
+	})
+
+	return effective, nil
+}
+
+// Reads a string, possibly wrapped in an @@assign operator.
+func value(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	var assign map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &assign); err == nil {
+		return value(assign["@@assign"])
+	}
+
+	var setting string
+	if err := json.Unmarshal(raw, &setting); err != nil {
+		return "", err
+	}
+	return setting, nil
+}
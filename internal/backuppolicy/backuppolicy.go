@@ -0,0 +1,211 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package backuppolicy reads the effective backup policies computed by AWS
+// Organizations, which are the result of merging every backup policy inherited
+// by an account.
+package backuppolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rule is a backup rule of a plan.
+type Rule struct {
+	Name             string
+	Schedule         string // cron expression
+	TargetVault      string
+	DeleteAfterDays  string // retention, empty if backups are kept forever
+	CopyDestinations []string
+}
+
+// Plan is a backup plan deployed to the account.
+type Plan struct {
+	Name       string
+	Regions    []string
+	Rules      []Rule   // sorted by name
+	Selections []string // resource selections, e.g. "datatype (by tags)"
+}
+
+// Effective is an effective backup policy.
+type Effective struct {
+	Plans []Plan // sorted by name
+}
+
+// Parse reads the content of an effective backup policy. Effective policies don't
+// contain inheritance operators anymore, but values still wrapped in @@assign
+// or @@append (as in the policies themselves) are accepted too, and any other
+// operator is skipped.
+func Parse(content string) (*Effective, error) {
+	var document struct {
+		Plans json.RawMessage `json:"plans"`
+	}
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		return nil, fmt.Errorf("invalid backup policy: %v", err)
+	}
+	plans, err := objects(document.Plans)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup policy: %v", err)
+	}
+
+	effective := &Effective{}
+	for name, raw := range plans {
+		var plan struct {
+			Regions    json.RawMessage `json:"regions"`
+			Rules      json.RawMessage `json:"rules"`
+			Selections json.RawMessage `json:"selections"`
+		}
+		if err := json.Unmarshal(raw, &plan); err != nil {
+			return nil, fmt.Errorf("invalid plan %s: %v", name, err)
+		}
+
+		regions, err := values(plan.Regions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regions of plan %s: %v", name, err)
+		}
+		parsed := Plan{Name: name, Regions: regions}
+
+		rules, err := objects(plan.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules of plan %s: %v", name, err)
+		}
+		for ruleName, raw := range rules {
+			fields, err := objects(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule %s: %v", ruleName, err)
+			}
+			rule := Rule{Name: ruleName}
+			if rule.Schedule, err = value(fields["schedule_expression"]); err != nil {
+				return nil, fmt.Errorf("invalid schedule of rule %s: %v", ruleName, err)
+			}
+			if rule.TargetVault, err = value(fields["target_backup_vault_name"]); err != nil {
+				return nil, fmt.Errorf("invalid target vault of rule %s: %v", ruleName, err)
+			}
+			lifecycle, err := objects(fields["lifecycle"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid lifecycle of rule %s: %v", ruleName, err)
+			}
+			if rule.DeleteAfterDays, err = value(lifecycle["delete_after_days"]); err != nil {
+				return nil, fmt.Errorf("invalid lifecycle of rule %s: %v", ruleName, err)
+			}
+			copies, err := objects(fields["copy_actions"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid copy actions of rule %s: %v", ruleName, err)
+			}
+			for destination := range copies {
+				rule.CopyDestinations = append(rule.CopyDestinations, destination)
+			}
+			sort.Strings(rule.CopyDestinations)
+			parsed.Rules = append(parsed.Rules, rule)
+		}
+		sort.Slice(parsed.Rules, func(i, j int) bool { return parsed.Rules[i].Name < parsed.Rules[j].Name })
+
+		// Selections are grouped by kind: "tags" or "resources"
+		kinds, err := objects(plan.Selections)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selections of plan %s: %v", name, err)
+		}
+		for kind, raw := range kinds {
+			selections, err := objects(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s selections of plan %s: %v", kind, name, err)
+			}
+			for selection := range selections {
+				parsed.Selections = append(parsed.Selections, fmt.Sprintf("%s (by %s)", selection, kind))
+			}
+		}
+		sort.Strings(parsed.Selections)
+
+		effective.Plans = append(effective.Plans, parsed)
+	}
+	sort.Slice(effective.Plans, func(i, j int) bool { return effective.Plans[i].Name < effective.Plans[j].Name })
+
+	return effective, nil
+}
+
+// Reads an object keyed by name (plans, rules, copy actions, ...), skipping the
+// inheritance operators next to the names, e.g. @@operators_allowed_for_child_policies.
+func objects(raw json.RawMessage) (map[string]json.RawMessage, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for key := range fields {
+		if strings.HasPrefix(key, "@@") {
+			delete(fields, key)
+		}
+	}
+	return fields, nil
+}
+
+// Reads a field holding a single value (string or number), possibly wrapped in
+// an @@assign or @@append operator.
+func value(raw json.RawMessage) (string, error) {
+	list, err := values(raw)
+	if err != nil || len(list) == 0 {
+		return "", err
+	}
+	return list[0], nil
+}
+
+// Reads a field that can be a scalar, a list of them or any of them wrapped in
+// the @@assign and @@append operators.
+func values(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var operators map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &operators); err == nil {
+		assigned, err := values(operators["@@assign"])
+		if err != nil {
+			return nil, err
+		}
+		appended, err := values(operators["@@append"])
+		if err != nil {
+			return nil, err
+		}
+		return append(assigned, appended...), nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		var result []string
+		for _, item := range list {
+			single, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, single)
+		}
+		return result, nil
+	}
+
+	single, err := scalar(raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{single}, nil
+}
+
+// Reads a string, number or boolean.
+func scalar(raw json.RawMessage) (string, error) {
+	var single interface{}
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return "", err
+	}
+	switch single.(type) {
+	case string, float64, bool:
+		return fmt.Sprint(single), nil
+	default:
+		return "", fmt.Errorf("unexpected value %s", raw)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package backuppolicy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Effective
+	}{
+		{
+			name: "effective policy",
+			content: `{"plans":{"daily":{
+				"regions":["eu-west-1","us-east-1"],
+				"rules":{
+					"weekly":{"schedule_expression":"cron(0 5 ? * 1 *)","target_backup_vault_name":"Default"},
+					"daily":{"schedule_expression":"cron(0 5 ? * * *)","target_backup_vault_name":"Default","lifecycle":{"delete_after_days":35},
+						"copy_actions":{"arn:aws:backup:us-east-1:$account:backup-vault:Secondary":{},"arn:aws:backup:eu-central-1:$account:backup-vault:Dr":{}}}
+				},
+				"selections":{"tags":{"datatype":{},"critical":{}},"resources":{"databases":{}}}
+			}}}`,
+			want: &Effective{Plans: []Plan{{
+				Name:    "daily",
+				Regions: []string{"eu-west-1", "us-east-1"},
+				Rules: []Rule{
+					{
+						Name:             "daily",
+						Schedule:         "cron(0 5 ? * * *)",
+						TargetVault:      "Default",
+						DeleteAfterDays:  "35",
+						CopyDestinations: []string{"arn:aws:backup:eu-central-1:$account:backup-vault:Dr", "arn:aws:backup:us-east-1:$account:backup-vault:Secondary"},
+					},
+					{Name: "weekly", Schedule: "cron(0 5 ? * 1 *)", TargetVault: "Default"},
+				},
+				Selections: []string{"critical (by tags)", "databases (by resources)", "datatype (by tags)"},
+			}}},
+		},
+		{
+			name:    "plans sorted by name",
+			content: `{"plans":{"weekly":{},"daily":{}}}`,
+			want:    &Effective{Plans: []Plan{{Name: "daily"}, {Name: "weekly"}}},
+		},
+		{
+			name:    "no plans",
+			content: `{}`,
+			want:    &Effective{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInheritanceOperators(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Plan
+	}{
+		{
+			name: "values wrapped in @@assign",
+			content: `{"plans":{"prod":{
+				"regions":{"@@assign":["eu-west-1"]},
+				"rules":{"hourly":{"schedule_expression":{"@@assign":"cron(0 * ? * * *)"},"target_backup_vault_name":{"@@assign":"Prod"},"lifecycle":{"delete_after_days":{"@@assign":"7"}}}}
+			}}}`,
+			want: []Plan{{
+				Name:    "prod",
+				Regions: []string{"eu-west-1"},
+				Rules:   []Rule{{Name: "hourly", Schedule: "cron(0 * ? * * *)", TargetVault: "Prod", DeleteAfterDays: "7"}},
+			}},
+		},
+		{
+			name:    "@@append adds to @@assign",
+			content: `{"plans":{"prod":{"regions":{"@@assign":["eu-west-1"],"@@append":["us-east-1","eu-central-1"]}}}}`,
+			want:    []Plan{{Name: "prod", Regions: []string{"eu-west-1", "us-east-1", "eu-central-1"}}},
+		},
+		{
+			name:    "@@append alone",
+			content: `{"plans":{"prod":{"regions":{"@@append":["us-east-1"]},"rules":{"daily":{"lifecycle":{"delete_after_days":{"@@append":35}}}}}}}`,
+			want:    []Plan{{Name: "prod", Regions: []string{"us-east-1"}, Rules: []Rule{{Name: "daily", DeleteAfterDays: "35"}}}},
+		},
+		{
+			name:    "@@remove is skipped",
+			content: `{"plans":{"prod":{"regions":{"@@assign":["eu-west-1"],"@@remove":["us-east-1"]}}}}`,
+			want:    []Plan{{Name: "prod", Regions: []string{"eu-west-1"}}},
+		},
+		{
+			name: "operators allowed for child policies at every level",
+			content: `{"plans":{
+				"@@operators_allowed_for_child_policies":["@@none"],
+				"prod":{
+					"@@operators_allowed_for_child_policies":["@@append"],
+					"regions":{"@@operators_allowed_for_child_policies":["@@append"],"@@assign":["eu-west-1"]},
+					"rules":{
+						"@@operators_allowed_for_child_policies":["@@none"],
+						"daily":{
+							"@@operators_allowed_for_child_policies":["@@none"],
+							"target_backup_vault_name":{"@@assign":"Prod"},
+							"copy_actions":{"@@operators_allowed_for_child_policies":["@@none"],"arn:aws:backup:us-east-1:$account:backup-vault:Dr":{}}
+						}
+					},
+					"selections":{
+						"@@operators_allowed_for_child_policies":["@@none"],
+						"tags":{"@@operators_allowed_for_child_policies":["@@append"],"datatype":{}}
+					}
+				}
+			}}`,
+			want: []Plan{{
+				Name:       "prod",
+				Regions:    []string{"eu-west-1"},
+				Rules:      []Rule{{Name: "daily", TargetVault: "Prod", CopyDestinations: []string{"arn:aws:backup:us-east-1:$account:backup-vault:Dr"}}},
+				Selections: []string{"datatype (by tags)"},
+			}},
+		},
+		{
+			name:    "first of several values",
+			content: `{"plans":{"prod":{"rules":{"daily":{"target_backup_vault_name":{"@@assign":["Prod","Dr"]}}}}}}`,
+			want:    []Plan{{Name: "prod", Rules: []Rule{{Name: "daily", TargetVault: "Prod"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Plans, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got.Plans, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"invalid document", `{"plans":[]}`, "invalid backup policy: "},
+		{"plan that is not an object", `{"plans":{"daily":"eu-west-1"}}`, "invalid plan daily: "},
+		{"invalid regions", `{"plans":{"daily":{"regions":[{"name":"eu-west-1"}]}}}`, "invalid regions of plan daily: unexpected value"},
+		{"invalid @@append", `{"plans":{"daily":{"regions":{"@@assign":["eu-west-1"],"@@append":[null]}}}}`, "invalid regions of plan daily: unexpected value null"},
+		{"invalid lifecycle", `{"plans":{"daily":{"rules":{"daily":{"lifecycle":"35"}}}}}`, "invalid lifecycle of rule daily: "},
+		{"invalid copy actions", `{"plans":{"daily":{"rules":{"daily":{"copy_actions":["Dr"]}}}}}`, "invalid copy actions of rule daily: "},
+		{"invalid selections", `{"plans":{"daily":{"selections":{"tags":["datatype"]}}}}`, "invalid tags selections of plan daily: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != nil {
+				t.Errorf("Parse() = %+v, want nil", got)
+			}
+		})
+	}
+}
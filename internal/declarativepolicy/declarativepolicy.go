@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package declarativepolicy reads the effective declarative policies for EC2
+// computed by AWS Organizations, which enforce the configuration of EC2 account
+// attributes (serial console access, image block public access, ...).
+package declarativepolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Setting is a value enforced on an EC2 account attribute.
+type Setting struct {
+	// Path of the setting inside the attribute, e.g. "state" or "image_criteria.c1.allowed_image_providers".
+	Path  string
+	Value string
+}
+
+// Attribute is an EC2 account attribute enforced by the policy.
+type Attribute struct {
+	Name     string // e.g. "serial_console_access"
+	Settings []Setting
+}
+
+// Effective is an effective declarative policy for EC2.
+type Effective struct {
+	Attributes []Attribute // sorted by name
+}
+
+// Parse reads the content of an effective declarative policy for EC2. Values
+// still wrapped in @@assign or @@append (as in the policies themselves) are
+// accepted too, and any other inheritance operator is skipped.
+func Parse(content string) (*Effective, error) {
+	var document struct {
+		Attributes map[string]json.RawMessage `json:"ec2_attributes"`
+	}
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		return nil, fmt.Errorf("invalid declarative policy: %v", err)
+	}
+
+	effective := &Effective{}
+	for name, raw := range document.Attributes {
+		// e.g. @@operators_allowed_for_child_policies next to the attributes
+		if strings.HasPrefix(name, "@@") {
+			continue
+		}
+		var value map[string]interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("invalid attribute %s: %v", name, err)
+		}
+
+		attribute := Attribute{Name: name}
+		if err := flatten("", value, &attribute.Settings); err != nil {
+			return nil, fmt.Errorf("invalid attribute %s: %v", name, err)
+		}
+		sort.Slice(attribute.Settings, func(i, j int) bool { return attribute.Settings[i].Path < attribute.Settings[j].Path })
+		effective.Attributes = append(effective.Attributes, attribute)
+	}
+	sort.Slice(effective.Attributes, func(i, j int) bool { return effective.Attributes[i].Name < effective.Attributes[j].Name })
+
+	return effective, nil
+}
+
+// Flattens nested settings into dotted paths, reading the values assigned or
+// appended by inheritance operators and skipping the rest of them.
+func flatten(path string, value interface{}, settings *[]Setting) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// A list appended to the assigned one is a single setting
+		assigned, isList := v["@@assign"].([]interface{})
+		if appended, ok := v["@@append"].([]interface{}); ok && isList {
+			return flatten(path, append(assigned[:len(assigned):len(assigned)], appended...), settings)
+		}
+		for key, child := range v {
+			childPath := path
+			switch {
+			case key == "@@assign" || key == "@@append":
+			case strings.HasPrefix(key, "@@"):
+				continue
+			case key == "" || strings.Contains(key, "."):
+				return fmt.Errorf("invalid setting %q in %s", key, display(path))
+			default:
+				childPath = join(path, key)
+			}
+			if err := flatten(childPath, child, settings); err != nil {
+				return err
+			}
+		}
+	case nil:
+		return fmt.Errorf("setting %s has no value", display(path))
+	case []interface{}:
+		if path == "" {
+			return fmt.Errorf("list %v outside of a setting", v)
+		}
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		*settings = append(*settings, Setting{Path: path, Value: strings.Join(items, ", ")})
+	default:
+		if path == "" {
+			return fmt.Errorf("value %v outside of a setting", v)
+		}
+		*settings = append(*settings, Setting{Path: path, Value: fmt.Sprint(v)})
+	}
+	return nil
+}
+
+// The path of a setting for error messages.
+func display(path string) string {
+	if path == "" {
+		return "the attribute"
+	}
+	return path
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
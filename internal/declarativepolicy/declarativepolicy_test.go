@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package declarativepolicy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Effective
+	}{
+		{
+			name: "effective policy",
+			content: `{"ec2_attributes":{
+				"serial_console_access":{"status":"disabled"},
+				"image_block_public_access":{"state":"block_new_sharing"}
+			}}`,
+			want: &Effective{Attributes: []Attribute{
+				{Name: "image_block_public_access", Settings: []Setting{{Path: "state", Value: "block_new_sharing"}}},
+				{Name: "serial_console_access", Settings: []Setting{{Path: "status", Value: "disabled"}}},
+			}},
+		},
+		{
+			name: "nested settings and lists",
+			content: `{"ec2_attributes":{"allowed_images_settings":{
+				"state":{"@@assign":"enabled"},
+				"image_criteria":{"c1":{"allowed_image_providers":{"@@assign":["amazon","123456789012"]}}}
+			}}}`,
+			want: &Effective{Attributes: []Attribute{{
+				Name: "allowed_images_settings",
+				Settings: []Setting{
+					{Path: "image_criteria.c1.allowed_image_providers", Value: "amazon, 123456789012"},
+					{Path: "state", Value: "enabled"},
+				},
+			}}},
+		},
+		{
+			name:    "no attributes",
+			content: `{}`,
+			want:    &Effective{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInheritanceOperators(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Setting
+	}{
+		{
+			name:    "value wrapped in @@assign",
+			content: `{"ec2_attributes":{"snapshot_block_public_access":{"state":{"@@assign":"block_all_sharing"}}}}`,
+			want:    []Setting{{Path: "state", Value: "block_all_sharing"}},
+		},
+		{
+			name:    "@@append adds to @@assign",
+			content: `{"ec2_attributes":{"snapshot_block_public_access":{"providers":{"@@assign":["amazon"],"@@append":["123456789012"]}}}}`,
+			want:    []Setting{{Path: "providers", Value: "amazon, 123456789012"}},
+		},
+		{
+			name: "operators allowed for child policies skipped",
+			content: `{"ec2_attributes":{
+				"@@operators_allowed_for_child_policies":["@@none"],
+				"snapshot_block_public_access":{
+					"@@operators_allowed_for_child_policies":["@@none"],
+					"state":{"@@operators_allowed_for_child_policies":["@@none"],"@@assign":"block_all_sharing"}
+				}
+			}}`,
+			want: []Setting{{Path: "state", Value: "block_all_sharing"}},
+		},
+		{
+			name:    "@@remove skipped",
+			content: `{"ec2_attributes":{"snapshot_block_public_access":{"state":{"@@assign":"block_all_sharing","@@remove":"unblocked"}}}}`,
+			want:    []Setting{{Path: "state", Value: "block_all_sharing"}},
+		},
+		{
+			name:    "operator around the settings",
+			content: `{"ec2_attributes":{"snapshot_block_public_access":{"@@assign":{"state":"block_all_sharing"}}}}`,
+			want:    []Setting{{Path: "state", Value: "block_all_sharing"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			want := &Effective{Attributes: []Attribute{{Name: "snapshot_block_public_access", Settings: tt.want}}}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseInvalidPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"invalid document", `{"ec2_attributes":"serial_console_access"}`, "invalid declarative policy: "},
+		{"attribute that is not an object", `{"ec2_attributes":{"serial_console_access":"disabled"}}`, "invalid attribute serial_console_access: "},
+		{"value outside of a setting", `{"ec2_attributes":{"serial_console_access":{"@@assign":"disabled"}}}`, "invalid attribute serial_console_access: value disabled outside of a setting"},
+		{"list outside of a setting", `{"ec2_attributes":{"allowed_images_settings":{"@@assign":["amazon"]}}}`, "invalid attribute allowed_images_settings: list [amazon] outside of a setting"},
+		{"empty setting", `{"ec2_attributes":{"serial_console_access":{"":"disabled"}}}`, `invalid attribute serial_console_access: invalid setting "" in the attribute`},
+		{"dotted setting", `{"ec2_attributes":{"allowed_images_settings":{"image_criteria":{"c1.providers":["amazon"]}}}}`, `invalid attribute allowed_images_settings: invalid setting "c1.providers" in image_criteria`},
+		{"setting without a value", `{"ec2_attributes":{"serial_console_access":{"status":{"@@assign":null}}}}`, "invalid attribute serial_console_access: setting status has no value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != nil {
+				t.Errorf("Parse() = %+v, want nil", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Prefix of the names of the custom constraints, the ones defined by the
+// organization itself with a CEL condition.
+const CustomPrefix = "custom."
+
+// IsCustom reports whether a constraint is a custom one, e.g.
+// custom.denyPublicBuckets, rather than one predefined by Google.
+func IsCustom(constraint string) bool {
+	return strings.HasPrefix(constraint, CustomPrefix)
+}
+
+// CustomConstraintName is the name of a custom constraint, as used in the
+// policies enforcing it, e.g. custom.denyPublicBuckets for
+// organizations/1/customConstraints/custom.denyPublicBuckets.
+func CustomConstraintName(name string) string {
+	_, constraint, _ := strings.Cut(name, "/customConstraints/")
+	return constraint
+}
+
+// DescribeCustomConstraint summarizes what a custom constraint checks when
+// enforced, e.g. "DENY CREATE, UPDATE of storage.googleapis.com/Bucket when
+// resource.iamConfiguration.publicAccessPrevention != 'enforced'". An ALLOW
+// constraint denies the operations whose resource doesn't match the condition.
+func DescribeCustomConstraint(constraint *orgpolicy.GoogleCloudOrgpolicyV2CustomConstraint) string {
+	return fmt.Sprintf("%s %s of %s when %s",
+		constraint.ActionType, strings.Join(constraint.MethodTypes, ", "), strings.Join(constraint.ResourceTypes, ", "), constraint.Condition)
+}
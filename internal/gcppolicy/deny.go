@@ -0,0 +1,64 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/iam/v2"
+)
+
+// Deny is a rule of an IAM deny policy applying to a resource, along with the
+// policy and the resource it is attached to.
+type Deny struct {
+	Rule     *iam.GoogleIamV2DenyRule
+	Policy   string // display name of the policy, its ID when it has none
+	Resource string // e.g. folders/123
+}
+
+// Denies lists the deny rules applying to the last level of the chain, from the
+// organization down. Unlike org policies, deny policies can't be overridden
+// below: every one attached along the chain applies, like SCPs.
+func Denies(chain []Level) []Deny {
+	var denies []Deny
+	for _, level := range chain {
+		for _, policy := range level.DenyPolicies {
+			for _, rule := range policy.Rules {
+				if rule.DenyRule == nil {
+					continue
+				}
+				denies = append(denies, Deny{Rule: rule.DenyRule, Policy: DenyPolicyName(policy), Resource: level.ResourceName})
+			}
+		}
+	}
+	return denies
+}
+
+// DenyPolicyName is the display name of a deny policy, or its ID (the last
+// segment of its resource name) when it has none.
+func DenyPolicyName(policy *iam.GoogleIamV2Policy) string {
+	if policy.DisplayName != "" {
+		return policy.DisplayName
+	}
+	return policy.Name[strings.LastIndex(policy.Name, "/")+1:]
+}
+
+// DescribeDenyRule summarizes a deny rule in a line, e.g. "denies
+// iam.googleapis.com/serviceAccountKeys.create to principalSet://goog/public:all
+// except group:admins@example.com".
+func DescribeDenyRule(rule *iam.GoogleIamV2DenyRule) string {
+	description := fmt.Sprintf("denies %s to %s", strings.Join(rule.DeniedPermissions, ", "), strings.Join(rule.DeniedPrincipals, ", "))
+	if len(rule.ExceptionPrincipals) > 0 {
+		description += " except " + strings.Join(rule.ExceptionPrincipals, ", ")
+	}
+	if len(rule.ExceptionPermissions) > 0 {
+		description += ", not denying " + strings.Join(rule.ExceptionPermissions, ", ")
+	}
+	if condition := rule.DenialCondition; condition != nil {
+		description += " when " + describeCondition(condition.Title, condition.Expression)
+	}
+	return description
+}
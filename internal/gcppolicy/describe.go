@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Describe summarizes rules in a line, e.g. "allowed values: in:eu-locations"
+// or "not enforced when Legacy CI, enforced otherwise". The values of the
+// unconditional rules are merged, as they are when a policy inherits from its
+// parent; conditional rules are listed first, since they are evaluated first.
+func Describe(rules []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule) string {
+	var conditional, unconditional []string
+	var allowed, denied []string
+	for _, rule := range rules {
+		if rule.Condition != nil {
+			conditional = append(conditional, fmt.Sprintf("%s when %s", describeRule(rule), describeCondition(rule.Condition.Title, rule.Condition.Expression)))
+			continue
+		}
+		if rule.Values != nil && !rule.AllowAll && !rule.DenyAll {
+			if len(rule.Values.AllowedValues)+len(rule.Values.DeniedValues) == 0 {
+				unconditional = append(unconditional, "no values")
+			}
+			allowed = append(allowed, rule.Values.AllowedValues...)
+			denied = append(denied, rule.Values.DeniedValues...)
+			continue
+		}
+		unconditional = append(unconditional, describeRule(rule))
+	}
+	if len(allowed) > 0 {
+		unconditional = append(unconditional, "allowed values: "+strings.Join(unique(allowed), ", "))
+	}
+	if len(denied) > 0 {
+		unconditional = append(unconditional, "denied values: "+strings.Join(unique(denied), ", "))
+	}
+
+	if len(conditional) == 0 {
+		if len(unconditional) == 0 {
+			return "no rules"
+		}
+		return strings.Join(unique(unconditional), ", ")
+	}
+	if len(unconditional) == 0 {
+		return strings.Join(conditional, ", ")
+	}
+	return strings.Join(conditional, ", ") + ", " + strings.Join(unique(unconditional), ", ") + " otherwise"
+}
+
+func describeRule(rule *orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule) string {
+	switch {
+	case rule.DenyAll:
+		return "deny all"
+	case rule.AllowAll:
+		return "allow all"
+	case rule.Values != nil:
+		var parts []string
+		if len(rule.Values.AllowedValues) > 0 {
+			parts = append(parts, "allowed values: "+strings.Join(rule.Values.AllowedValues, ", "))
+		}
+		if len(rule.Values.DeniedValues) > 0 {
+			parts = append(parts, "denied values: "+strings.Join(rule.Values.DeniedValues, ", "))
+		}
+		return strings.Join(parts, ", ")
+	case rule.Enforce:
+		return "enforced"
+	default:
+		return "not enforced"
+	}
+}
+
+// Describes a CEL condition by its title and expression, or its expression
+// when untitled.
+func describeCondition(title, expression string) string {
+	if title == "" {
+		return expression
+	}
+	return fmt.Sprintf("%s (%s)", title, expression)
+}
+
+// Drops the duplicates of values, keeping their order.
+func unique(values []string) []string {
+	seen := map[string]bool{}
+	kept := values[:0:0]
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package gcppolicy evaluates GCP organization policies the way the Org Policy
+// service does, along with the IAM deny policies, so the tool can tell what
+// actually applies to a project instead of just listing the policies set
+// along its ancestry.
+package gcppolicy
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/api/iam/v2"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Level is a node of the hierarchy (organization, folder or project) along
+// with the org policies set on it and the IAM deny policies attached to it.
+type Level struct {
+	ResourceName string // e.g. folders/123
+	DisplayName  string
+	Policies     []*orgpolicy.GoogleCloudOrgpolicyV2Policy
+	DenyPolicies []*iam.GoogleIamV2Policy
+}
+
+// Effective is the policy of a constraint applying to the last level of a
+// chain.
+type Effective struct {
+	Constraint string // e.g. compute.vmExternalIpAccess
+	// Rules in force, none when the constraint is back to its default behavior
+	Rules []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule
+	// Policies the rules come from, from the organization down
+	Sources []string
+	// Whether a policy of the chain restored the default behavior, discarding
+	// what was set above it
+	Reset bool
+}
+
+// Resolve computes the effective policy of every constraint set along the
+// chain, ordered from the organization down to the resource. Like the Org
+// Policy service does, a policy replaces the one inherited from above, unless
+// it sets inheritFromParent (list constraints), in which case their rules are
+// merged, or reset, in which case the constraint is back to its default.
+// Policies without a live spec (dry-run only) don't apply.
+func Resolve(chain []Level) []Effective {
+	effective := map[string]*Effective{}
+	for _, level := range chain {
+		for _, policy := range level.Policies {
+			spec := policy.Spec
+			if spec == nil {
+				continue
+			}
+			constraint := ConstraintName(policy.Name)
+			inherited, found := effective[constraint]
+			switch {
+			case spec.Reset:
+				effective[constraint] = &Effective{Constraint: constraint, Sources: []string{policy.Name}, Reset: true}
+			case spec.InheritFromParent && found:
+				inherited.Rules = append(append([]*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{}, inherited.Rules...), spec.Rules...)
+				inherited.Sources = append(inherited.Sources, policy.Name)
+				inherited.Reset = false
+			default:
+				effective[constraint] = &Effective{Constraint: constraint, Rules: spec.Rules, Sources: []string{policy.Name}}
+			}
+		}
+	}
+
+	resolved := make([]Effective, 0, len(effective))
+	for _, policy := range effective {
+		resolved = append(resolved, *policy)
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Constraint < resolved[j].Constraint })
+	return resolved
+}
+
+// ConstraintName is the constraint of a policy, e.g. compute.vmExternalIpAccess
+// for projects/123/policies/compute.vmExternalIpAccess.
+func ConstraintName(policyName string) string {
+	_, constraint, _ := strings.Cut(policyName, "/policies/")
+	return constraint
+}
+
+// Parent is the resource a policy is set on, e.g. projects/123 for
+// projects/123/policies/compute.vmExternalIpAccess.
+func Parent(policyName string) string {
+	parent, _, _ := strings.Cut(policyName, "/policies/")
+	return parent
+}
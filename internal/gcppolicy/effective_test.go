@@ -0,0 +1,256 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/iam/v2"
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+type rule = orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule
+
+func enforced(enforce bool) *rule {
+	return &rule{Enforce: enforce}
+}
+
+func allowedValues(values ...string) *rule {
+	return &rule{Values: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRuleStringValues{AllowedValues: values}}
+}
+
+func deniedValues(values ...string) *rule {
+	return &rule{Values: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRuleStringValues{DeniedValues: values}}
+}
+
+func conditional(r *rule, title string) *rule {
+	r.Condition = &orgpolicy.GoogleTypeExpr{Title: title, Expression: "resource.matchTag('env', 'ci')"}
+	return r
+}
+
+// A policy of constraint set on resource with a live spec.
+func testPolicy(resource, constraint string, spec *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec) *orgpolicy.GoogleCloudOrgpolicyV2Policy {
+	return &orgpolicy.GoogleCloudOrgpolicyV2Policy{Name: resource + "/policies/" + constraint, Spec: spec}
+}
+
+func rules(rules ...*rule) *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec {
+	return &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{Rules: rules}
+}
+
+func inherited(rules ...*rule) *orgpolicy.GoogleCloudOrgpolicyV2PolicySpec {
+	return &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{Rules: rules, InheritFromParent: true}
+}
+
+func testLevel(resource string, policies ...*orgpolicy.GoogleCloudOrgpolicyV2Policy) Level {
+	return Level{ResourceName: resource, DisplayName: resource, Policies: policies}
+}
+
+// What is compared of an effective policy.
+type effectiveSummary struct {
+	Constraint string
+	Rules      string // see Describe
+	Sources    []string
+	Reset      bool
+}
+
+func TestResolve(t *testing.T) {
+	const locations = "gcp.resourceLocations"
+	const osLogin = "compute.requireOsLogin"
+	reset := &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{Reset: true}
+
+	tests := []struct {
+		name  string
+		chain []Level
+		want  []effectiveSummary
+	}{
+		{
+			name:  "set on the organization",
+			chain: []Level{testLevel("organizations/1", testPolicy("organizations/1", osLogin, rules(enforced(true)))), testLevel("projects/3")},
+			want:  []effectiveSummary{{osLogin, "enforced", []string{"organizations/1/policies/" + osLogin}, false}},
+		},
+		{
+			name: "replaced below",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", locations, rules(allowedValues("in:us-locations")))),
+				testLevel("projects/3", testPolicy("projects/3", locations, rules(allowedValues("in:eu-locations")))),
+			},
+			want: []effectiveSummary{{locations, "allowed values: in:eu-locations", []string{"projects/3/policies/" + locations}, false}},
+		},
+		{
+			name: "inherited from the parent",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", locations, rules(allowedValues("in:us-locations")))),
+				testLevel("folders/2", testPolicy("folders/2", locations, inherited(deniedValues("us-west1")))),
+				testLevel("projects/3", testPolicy("projects/3", locations, inherited(allowedValues("europe-west1")))),
+			},
+			want: []effectiveSummary{{
+				locations,
+				"allowed values: in:us-locations, europe-west1, denied values: us-west1",
+				[]string{"organizations/1/policies/" + locations, "folders/2/policies/" + locations, "projects/3/policies/" + locations},
+				false,
+			}},
+		},
+		{
+			name:  "inheriting from nothing",
+			chain: []Level{testLevel("organizations/1"), testLevel("projects/3", testPolicy("projects/3", locations, inherited(allowedValues("us-east1"))))},
+			want:  []effectiveSummary{{locations, "allowed values: us-east1", []string{"projects/3/policies/" + locations}, false}},
+		},
+		{
+			name: "reset to the default",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", osLogin, rules(enforced(true)))),
+				testLevel("folders/2", testPolicy("folders/2", osLogin, reset)),
+				testLevel("projects/3"),
+			},
+			want: []effectiveSummary{{osLogin, "no rules", []string{"folders/2/policies/" + osLogin}, true}},
+		},
+		{
+			name: "inherited below a reset",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", locations, rules(allowedValues("in:us-locations")))),
+				testLevel("folders/2", testPolicy("folders/2", locations, reset)),
+				testLevel("projects/3", testPolicy("projects/3", locations, inherited(allowedValues("us-east1")))),
+			},
+			want: []effectiveSummary{{locations, "allowed values: us-east1", []string{"folders/2/policies/" + locations, "projects/3/policies/" + locations}, false}},
+		},
+		{
+			name: "boolean constraint turned off below",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", osLogin, rules(enforced(true)))),
+				testLevel("projects/3", testPolicy("projects/3", osLogin, rules(conditional(enforced(false), "CI"), enforced(true)))),
+			},
+			want: []effectiveSummary{{osLogin, "not enforced when CI (resource.matchTag('env', 'ci')), enforced otherwise", []string{"projects/3/policies/" + osLogin}, false}},
+		},
+		{
+			name: "dry run only",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", osLogin, rules(enforced(true)))),
+				testLevel("projects/3", &orgpolicy.GoogleCloudOrgpolicyV2Policy{Name: "projects/3/policies/" + osLogin, DryRunSpec: rules(enforced(false))}),
+			},
+			want: []effectiveSummary{{osLogin, "enforced", []string{"organizations/1/policies/" + osLogin}, false}},
+		},
+		{
+			name: "sorted by constraint",
+			chain: []Level{
+				testLevel("organizations/1", testPolicy("organizations/1", locations, rules(allowedValues("in:us-locations"))), testPolicy("organizations/1", osLogin, rules(enforced(true)))),
+			},
+			want: []effectiveSummary{
+				{osLogin, "enforced", []string{"organizations/1/policies/" + osLogin}, false},
+				{locations, "allowed values: in:us-locations", []string{"organizations/1/policies/" + locations}, false},
+			},
+		},
+		{
+			name:  "nothing set",
+			chain: []Level{testLevel("organizations/1"), testLevel("projects/3")},
+			want:  []effectiveSummary{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []effectiveSummary{}
+			for _, effective := range Resolve(tt.chain) {
+				got = append(got, effectiveSummary{effective.Constraint, Describe(effective.Rules), effective.Sources, effective.Reset})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDoesNotChangeThePolicies(t *testing.T) {
+	parent := testPolicy("organizations/1", "gcp.resourceLocations", rules(allowedValues("in:us-locations")))
+	child := testPolicy("projects/3", "gcp.resourceLocations", inherited(allowedValues("us-east1")))
+	Resolve([]Level{testLevel("organizations/1", parent), testLevel("projects/3", child)})
+
+	if len(parent.Spec.Rules) != 1 || len(child.Spec.Rules) != 1 {
+		t.Errorf("the rules of the policies were changed: %s and %s", Describe(parent.Spec.Rules), Describe(child.Spec.Rules))
+	}
+}
+
+func TestDenies(t *testing.T) {
+	denyKeys := &iam.GoogleIamV2Policy{
+		Name:        "policies/cloudresourcemanager.googleapis.com%2Forganizations%2F1/denypolicies/deny-keys",
+		DisplayName: "Deny SA keys",
+		Rules: []*iam.GoogleIamV2PolicyRule{
+			{DenyRule: &iam.GoogleIamV2DenyRule{DeniedPermissions: []string{"iam.googleapis.com/serviceAccountKeys.create"}, DeniedPrincipals: []string{"principalSet://goog/public:all"}}},
+			{Description: "not a deny rule"},
+		},
+	}
+	denyDelete := &iam.GoogleIamV2Policy{
+		Name: "policies/cloudresourcemanager.googleapis.com%2Fprojects%2F3/denypolicies/deny-delete",
+		Rules: []*iam.GoogleIamV2PolicyRule{{DenyRule: &iam.GoogleIamV2DenyRule{
+			DeniedPermissions:   []string{"storage.googleapis.com/buckets.delete"},
+			DeniedPrincipals:    []string{"principalSet://goog/public:all"},
+			ExceptionPrincipals: []string{"group:admins@example.com"},
+		}}},
+	}
+	chain := []Level{
+		{ResourceName: "organizations/1", DenyPolicies: []*iam.GoogleIamV2Policy{denyKeys}},
+		{ResourceName: "folders/2"},
+		{ResourceName: "projects/3", DenyPolicies: []*iam.GoogleIamV2Policy{denyDelete}},
+	}
+
+	var got []string
+	for _, deny := range Denies(chain) {
+		got = append(got, deny.Policy+" on "+deny.Resource+": "+DescribeDenyRule(deny.Rule))
+	}
+	want := []string{
+		"Deny SA keys on organizations/1: denies iam.googleapis.com/serviceAccountKeys.create to principalSet://goog/public:all",
+		"deny-delete on projects/3: denies storage.googleapis.com/buckets.delete to principalSet://goog/public:all except group:admins@example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Denies() = %q, want %q", got, want)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []*rule
+		want  string
+	}{
+		{"no rules", nil, "no rules"},
+		{"enforced", []*rule{enforced(true)}, "enforced"},
+		{"values merged", []*rule{allowedValues("a", "b"), allowedValues("b", "c"), deniedValues("d")}, "allowed values: a, b, c, denied values: d"},
+		{"empty values", []*rule{allowedValues()}, "no values"},
+		{"allow all", []*rule{{AllowAll: true}}, "allow all"},
+		{"conditional only", []*rule{conditional(&rule{DenyAll: true}, "")}, "deny all when resource.matchTag('env', 'ci')"},
+		{"conditional first", []*rule{{DenyAll: true}, conditional(&rule{AllowAll: true}, "CI")}, "allow all when CI (resource.matchTag('env', 'ci')), deny all otherwise"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Describe(tt.rules); got != tt.want {
+				t.Errorf("Describe() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintName(t *testing.T) {
+	tests := []struct {
+		policy         string
+		wantConstraint string
+		wantParent     string
+	}{
+		{"projects/3/policies/compute.vmExternalIpAccess", "compute.vmExternalIpAccess", "projects/3"},
+		{"organizations/1/policies/custom.denyPublicBuckets", "custom.denyPublicBuckets", "organizations/1"},
+		{"projects/3", "", "projects/3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			if got := ConstraintName(tt.policy); got != tt.wantConstraint {
+				t.Errorf("ConstraintName(%q) = %q, want %q", tt.policy, got, tt.wantConstraint)
+			}
+			if got := Parent(tt.policy); got != tt.wantParent {
+				t.Errorf("Parent(%q) = %q, want %q", tt.policy, got, tt.wantParent)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Kinds of constraints. The Org Policy API doesn't tell them apart in the
+// policies, their rules do: boolean constraints are enforced or not, list
+// constraints allow or deny values.
+const (
+	BooleanConstraint = "boolean"
+	ListConstraint    = "list"
+)
+
+// Severities of the lint findings.
+const (
+	Error   = "error"
+	Warning = "warning"
+	Info    = "info"
+)
+
+// Finding is a problem found in an org policy.
+type Finding struct {
+	Check    string // name of the check that found it
+	Severity string
+	Policy   string // resource name of the policy
+	Message  string
+}
+
+// Check is a lint check run on every org policy.
+type Check struct {
+	Name string
+	Run  func(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []Finding
+}
+
+// Checks are the lint checks run on every org policy.
+var Checks = []Check{
+	{Name: "mixed-rules", Run: lintMixedRules},
+	{Name: "empty-values", Run: lintEmptyValues},
+	{Name: "allow-all", Run: lintAllowAll},
+	{Name: "deny-all", Run: lintDenyAll},
+	{Name: "not-enforced", Run: lintNotEnforced},
+}
+
+// Kind tells whether a policy configures a boolean or a list constraint from
+// its rules (the dry-run ones when it has no live spec), custom constraints
+// being boolean. It is empty when the rules don't tell, e.g. for a reset.
+func Kind(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) string {
+	if IsCustom(ConstraintName(policy.Name)) {
+		return BooleanConstraint
+	}
+	spec := policy.Spec
+	if spec == nil {
+		spec = policy.DryRunSpec
+	}
+	if spec == nil || len(spec.Rules) == 0 {
+		return ""
+	}
+	for _, rule := range spec.Rules {
+		if isListRule(rule) {
+			return ListConstraint
+		}
+	}
+	return BooleanConstraint
+}
+
+func isListRule(rule *orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule) bool {
+	return rule.Values != nil || rule.AllowAll || rule.DenyAll
+}
+
+// Rules of both kinds in the same policy. The API rejects them, but exports
+// and hand-written policies may still hold them.
+func lintMixedRules(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []Finding {
+	if policy.Spec == nil {
+		return nil
+	}
+	for _, rule := range policy.Spec.Rules {
+		switch {
+		case isListRule(rule) && IsCustom(ConstraintName(policy.Name)):
+			return []Finding{newFinding("mixed-rules", Error, policy, "custom constraints are boolean, but a rule sets values")}
+		case rule.Enforce && Kind(policy) == ListConstraint:
+			return []Finding{newFinding("mixed-rules", Error, policy, "mixes enforce with values, allowAll or denyAll, a constraint is either boolean or a list")}
+		}
+	}
+	return nil
+}
+
+// List rules without any allowed or denied value, which restrict nothing while
+// looking like they do, e.g. an allow list that was emptied.
+func lintEmptyValues(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []Finding {
+	var findings []Finding
+	for _, rule := range liveRules(policy) {
+		if rule.Values != nil && len(rule.Values.AllowedValues)+len(rule.Values.DeniedValues) == 0 && !rule.AllowAll && !rule.DenyAll {
+			findings = append(findings, newFinding("empty-values", Warning, policy, "a rule"+when(rule)+" lists no allowed or denied value, set them or remove the rule"))
+		}
+	}
+	return findings
+}
+
+// List rules allowing every value. Unconditionally, the constraint restricts
+// nothing below the resource, whatever its ancestors set.
+func lintAllowAll(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []Finding {
+	var findings []Finding
+	for _, rule := range liveRules(policy) {
+		if !rule.AllowAll {
+			continue
+		}
+		if rule.Condition != nil {
+			findings = append(findings, newFinding("allow-all", Info, policy, "allows every value"+when(rule)+", make sure the condition is narrow"))
+			continue
+		}
+		findings = append(findings, newFinding("allow-all", Warning, policy, "allows every value, the constraint restricts nothing here and below, prefer listing the allowed values"))
+	}
+	return findings
+}
+
+// List rules denying every value, as strict as it gets: worth a look for the
+// resources that may need an exception.
+func lintDenyAll(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []Finding {
+	var findings []Finding
+	for _, rule := range liveRules(policy) {
+		if rule.DenyAll {
+			findings = append(findings, newFinding("deny-all", Info, policy, "denies every value"+when(rule)+", resources needing one need a policy of their own"))
+		}
+	}
+	return findings
+}
+
+// Boolean policies turning the constraint off unconditionally, usually an
+// exception to an ancestor enforcing it.
+func lintNotEnforced(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []Finding {
+	if Kind(policy) != BooleanConstraint {
+		return nil
+	}
+	for _, rule := range liveRules(policy) {
+		// The values of a custom constraint are reported by mixed-rules
+		if rule.Condition == nil && !rule.Enforce && !isListRule(rule) {
+			return []Finding{newFinding("not-enforced", Info, policy, "turns the constraint off here and below")}
+		}
+	}
+	return nil
+}
+
+// The rules of the live spec of a policy.
+func liveRules(policy *orgpolicy.GoogleCloudOrgpolicyV2Policy) []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule {
+	if policy.Spec == nil {
+		return nil
+	}
+	return policy.Spec.Rules
+}
+
+// Describes the condition of a rule, e.g. " when Legacy CI", nothing for
+// unconditional rules.
+func when(rule *orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule) string {
+	if rule.Condition == nil {
+		return ""
+	}
+	return " when " + describeCondition(rule.Condition.Title, rule.Condition.Expression)
+}
+
+func newFinding(check, severity string, policy *orgpolicy.GoogleCloudOrgpolicyV2Policy, message string) Finding {
+	return Finding{Check: check, Severity: severity, Policy: policy.Name, Message: message}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *orgpolicy.GoogleCloudOrgpolicyV2Policy
+		want   string
+	}{
+		{"enforced", testPolicy("projects/3", "compute.requireOsLogin", rules(enforced(true))), BooleanConstraint},
+		{"values", testPolicy("projects/3", "gcp.resourceLocations", rules(allowedValues("in:us-locations"))), ListConstraint},
+		{"allow all", testPolicy("projects/3", "gcp.resourceLocations", rules(&rule{AllowAll: true})), ListConstraint},
+		{"custom", testPolicy("projects/3", "custom.denyPublicBuckets", rules(allowedValues("x"))), BooleanConstraint},
+		{"reset", testPolicy("projects/3", "gcp.resourceLocations", &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{Reset: true}), ""},
+		{"no spec", testPolicy("projects/3", "gcp.resourceLocations", nil), ""},
+		{
+			"dry run only",
+			&orgpolicy.GoogleCloudOrgpolicyV2Policy{Name: "projects/3/policies/gcp.resourceLocations", DryRunSpec: rules(deniedValues("us-west1"))},
+			ListConstraint,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Kind(tt.policy); got != tt.want {
+				t.Errorf("Kind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *orgpolicy.GoogleCloudOrgpolicyV2Policy
+		want   []string // check and severity of the findings, in the order of Checks
+	}{
+		{
+			name:   "clean list policy",
+			policy: testPolicy("projects/3", "gcp.resourceLocations", rules(allowedValues("in:eu-locations"))),
+		},
+		{
+			name:   "clean boolean policy",
+			policy: testPolicy("projects/3", "compute.requireOsLogin", rules(enforced(true))),
+		},
+		{
+			name:   "enforce mixed with values",
+			policy: testPolicy("projects/3", "gcp.resourceLocations", rules(allowedValues("in:eu-locations"), enforced(true))),
+			want:   []string{"mixed-rules/error"},
+		},
+		{
+			name:   "values in a custom constraint",
+			policy: testPolicy("projects/3", "custom.denyPublicBuckets", rules(deniedValues("x"))),
+			want:   []string{"mixed-rules/error"},
+		},
+		{
+			name:   "empty values",
+			policy: testPolicy("projects/3", "gcp.resourceLocations", rules(allowedValues())),
+			want:   []string{"empty-values/warning"},
+		},
+		{
+			name:   "allow all",
+			policy: testPolicy("projects/3", "gcp.resourceLocations", rules(&rule{AllowAll: true})),
+			want:   []string{"allow-all/warning"},
+		},
+		{
+			name:   "allow all under a condition",
+			policy: testPolicy("projects/3", "gcp.resourceLocations", rules(conditional(&rule{AllowAll: true}, "CI"), allowedValues("in:eu-locations"))),
+			want:   []string{"allow-all/info"},
+		},
+		{
+			name:   "deny all",
+			policy: testPolicy("projects/3", "gcp.resourceLocations", rules(&rule{DenyAll: true})),
+			want:   []string{"deny-all/info"},
+		},
+		{
+			name:   "not enforced",
+			policy: testPolicy("projects/3", "compute.requireOsLogin", rules(enforced(false))),
+			want:   []string{"not-enforced/info"},
+		},
+		{
+			name:   "not enforced under a condition",
+			policy: testPolicy("projects/3", "compute.requireOsLogin", rules(conditional(enforced(false), "CI"), enforced(true))),
+		},
+		{
+			name:   "dry run only",
+			policy: &orgpolicy.GoogleCloudOrgpolicyV2Policy{Name: "projects/3/policies/gcp.resourceLocations", DryRunSpec: rules(&rule{AllowAll: true}, allowedValues())},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, check := range Checks {
+				for _, finding := range check.Run(tt.policy) {
+					if finding.Check != check.Name || finding.Policy != tt.policy.Name {
+						t.Errorf("finding %+v of %s, want it to name the check and the policy", finding, check.Name)
+					}
+					got = append(got, finding.Check+"/"+finding.Severity)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+// Verdicts of a simulation.
+const (
+	Allowed     = "ALLOWED"
+	Denied      = "DENIED"
+	Conditional = "CONDITIONAL" // depends on a condition or a value group that can't be evaluated offline
+)
+
+// Decision is the outcome of a simulation along with why.
+type Decision struct {
+	Verdict string
+	Reasons []string
+}
+
+// EvaluateConstraint decides whether the effective policy of a constraint
+// blocks a change: using value for list constraints (e.g. a location for
+// gcp.resourceLocations), or the behavior a boolean constraint restricts, in
+// which case value is ignored. A nil policy means the constraint is not set
+// along the chain. Conditions and value groups (in:) can't be evaluated
+// offline, so they make the verdict CONDITIONAL when they could change it.
+func EvaluateConstraint(policy *Effective, value string) Decision {
+	if policy == nil || policy.Reset {
+		return Decision{Verdict: Allowed, Reasons: []string{"the constraint has its default behavior, which may enforce it for some constraints"}}
+	}
+
+	var unconditional []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule
+	for _, rule := range policy.Rules {
+		if rule.Condition == nil {
+			unconditional = append(unconditional, rule)
+		}
+	}
+	decision := evaluateRules(unconditional, value)
+
+	// Conditional rules take precedence when their condition matches
+	for _, rule := range policy.Rules {
+		if rule.Condition == nil {
+			continue
+		}
+		conditional := evaluateRules([]*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{rule}, value)
+		if conditional.Verdict != decision.Verdict {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("%s instead when %s: %s",
+				conditional.Verdict, describeCondition(rule.Condition.Title, rule.Condition.Expression), strings.Join(conditional.Reasons, ", ")))
+			decision.Verdict = Conditional
+		}
+	}
+	return decision
+}
+
+// Decides whether unconditional rules block a change, see EvaluateConstraint.
+func evaluateRules(rules []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule, value string) Decision {
+	var allowed, denied []string
+	restricted := false // some rule restricts the values
+	for _, rule := range rules {
+		switch {
+		case rule.DenyAll:
+			return Decision{Verdict: Denied, Reasons: []string{"every value is denied"}}
+		case rule.AllowAll:
+			return Decision{Verdict: Allowed, Reasons: []string{"every value is allowed"}}
+		case rule.Values != nil:
+			allowed = append(allowed, rule.Values.AllowedValues...)
+			denied = append(denied, rule.Values.DeniedValues...)
+			restricted = true
+		case rule.Enforce:
+			return Decision{Verdict: Denied, Reasons: []string{"the constraint is enforced"}}
+		}
+	}
+	switch {
+	case !restricted:
+		return Decision{Verdict: Allowed, Reasons: []string{"the constraint is not enforced"}}
+	case value == "":
+		return Decision{Verdict: Conditional, Reasons: []string{"it depends on the value, " + Describe(rules)}}
+	case slices.Contains(denied, value):
+		return Decision{Verdict: Denied, Reasons: []string{value + " is a denied value"}}
+	}
+
+	// Denied values take precedence over the allowed ones
+	var unknowns []string
+	if groups := valueGroups(denied); len(groups) > 0 {
+		unknowns = append(unknowns, "it doesn't belong to "+strings.Join(groups, ", "))
+	}
+	if len(allowed) > 0 && !slices.Contains(allowed, value) {
+		groups := valueGroups(allowed)
+		if len(groups) == 0 {
+			return Decision{Verdict: Denied, Reasons: []string{fmt.Sprintf("%s is not an allowed value (%s)", value, strings.Join(allowed, ", "))}}
+		}
+		unknowns = append(unknowns, "it belongs to "+strings.Join(groups, ", "))
+	}
+
+	switch {
+	case len(unknowns) > 0:
+		return Decision{Verdict: Conditional, Reasons: []string{fmt.Sprintf("%s is only allowed if %s", value, strings.Join(unknowns, " and "))}}
+	case len(allowed) == 0:
+		return Decision{Verdict: Allowed, Reasons: []string{value + " is not a denied value"}}
+	default:
+		return Decision{Verdict: Allowed, Reasons: []string{value + " is an allowed value"}}
+	}
+}
+
+// The value groups among values, e.g. in:us-locations.
+func valueGroups(values []string) []string {
+	var groups []string
+	for _, value := range values {
+		if strings.HasPrefix(value, "in:") {
+			groups = append(groups, value)
+		}
+	}
+	return groups
+}
+
+// EvaluateDenies decides whether the deny rules of a chain deny a permission
+// to a principal. The permission is given in the format of the IAM roles
+// (storage.buckets.delete) and the principal as an email; denied
+// principals are matched when they are the principal (user or service
+// account) or everyone, while groups and domains can't be resolved offline,
+// making the verdict CONDITIONAL.
+func EvaluateDenies(denies []Deny, permission, principal string) Decision {
+	denyPermission := DenyPermission(permission)
+	principals := []string{
+		"principal://goog/subject/" + principal,
+		"principal://iam.googleapis.com/projects/-/serviceAccounts/" + principal,
+		"principalSet://goog/public:all",
+	}
+
+	decision := Decision{Verdict: Allowed}
+	for _, deny := range denies {
+		if !matchesPermission(deny.Rule.DeniedPermissions, denyPermission) || matchesPermission(deny.Rule.ExceptionPermissions, denyPermission) {
+			continue
+		}
+		source := fmt.Sprintf("%s on %s", deny.Policy, deny.Resource)
+		if slices.ContainsFunc(deny.Rule.ExceptionPrincipals, func(p string) bool { return slices.Contains(principals, p) }) {
+			continue
+		}
+
+		certain := slices.ContainsFunc(deny.Rule.DeniedPrincipals, func(p string) bool { return slices.Contains(principals, p) })
+		if certain && len(deny.Rule.ExceptionPrincipals) == 0 && deny.Rule.DenialCondition == nil {
+			return Decision{Verdict: Denied, Reasons: []string{"denied by " + source}}
+		}
+		var unknowns []string
+		if !certain {
+			unknowns = append(unknowns, "the principal is one of "+strings.Join(deny.Rule.DeniedPrincipals, ", "))
+		}
+		if len(deny.Rule.ExceptionPrincipals) > 0 {
+			unknowns = append(unknowns, "the principal is not one of "+strings.Join(deny.Rule.ExceptionPrincipals, ", "))
+		}
+		if deny.Rule.DenialCondition != nil {
+			unknowns = append(unknowns, "the request matches "+describeCondition(deny.Rule.DenialCondition.Title, deny.Rule.DenialCondition.Expression))
+		}
+		decision.Verdict = Conditional
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("denied by %s if %s", source, strings.Join(unknowns, " and ")))
+	}
+	if decision.Verdict == Allowed {
+		decision.Reasons = []string{"no deny policy of the ancestry denies it"}
+	}
+	return decision
+}
+
+// DenyPermission is the name of a permission in the deny policies, e.g.
+// storage.googleapis.com/buckets.delete for storage.buckets.delete.
+func DenyPermission(permission string) string {
+	if strings.Contains(permission, "/") {
+		return permission
+	}
+	service, rest, _ := strings.Cut(permission, ".")
+	return service + ".googleapis.com/" + rest
+}
+
+// Reports whether a permission matches any of the patterns of a deny rule,
+// which can use wildcards (e.g. storage.googleapis.com/buckets.*).
+func matchesPermission(patterns []string, permission string) bool {
+	for _, pattern := range patterns {
+		if match, _ := path.Match(pattern, permission); match {
+			return true
+		}
+	}
+	return false
+}
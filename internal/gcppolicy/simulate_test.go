@@ -0,0 +1,265 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package gcppolicy
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/iam/v2"
+)
+
+func TestEvaluateConstraint(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Effective
+		value  string
+		want   Decision
+	}{
+		{
+			name:   "not set",
+			policy: nil,
+			value:  "us-east1",
+			want:   Decision{Allowed, []string{"the constraint has its default behavior, which may enforce it for some constraints"}},
+		},
+		{
+			name:   "reset",
+			policy: &Effective{Reset: true},
+			want:   Decision{Allowed, []string{"the constraint has its default behavior, which may enforce it for some constraints"}},
+		},
+		{
+			name:   "boolean enforced",
+			policy: &Effective{Rules: []*rule{enforced(true)}},
+			want:   Decision{Denied, []string{"the constraint is enforced"}},
+		},
+		{
+			name:   "boolean not enforced",
+			policy: &Effective{Rules: []*rule{enforced(false)}},
+			want:   Decision{Allowed, []string{"the constraint is not enforced"}},
+		},
+		{
+			name:   "boolean enforced except under a condition",
+			policy: &Effective{Rules: []*rule{conditional(enforced(false), "CI"), enforced(true)}},
+			want: Decision{Conditional, []string{
+				"the constraint is enforced",
+				"ALLOWED instead when CI (resource.matchTag('env', 'ci')): the constraint is not enforced",
+			}},
+		},
+		{
+			name:   "condition with the same verdict",
+			policy: &Effective{Rules: []*rule{conditional(enforced(true), "CI"), enforced(true)}},
+			want:   Decision{Denied, []string{"the constraint is enforced"}},
+		},
+		{
+			name:   "allowed value",
+			policy: &Effective{Rules: []*rule{allowedValues("us-east1", "us-west1")}},
+			value:  "us-east1",
+			want:   Decision{Allowed, []string{"us-east1 is an allowed value"}},
+		},
+		{
+			name:   "value not allowed",
+			policy: &Effective{Rules: []*rule{allowedValues("us-east1", "us-west1")}},
+			value:  "europe-west1",
+			want:   Decision{Denied, []string{"europe-west1 is not an allowed value (us-east1, us-west1)"}},
+		},
+		{
+			name:   "denied value",
+			policy: &Effective{Rules: []*rule{deniedValues("us-west1")}},
+			value:  "us-west1",
+			want:   Decision{Denied, []string{"us-west1 is a denied value"}},
+		},
+		{
+			name:   "value not denied",
+			policy: &Effective{Rules: []*rule{deniedValues("us-west1")}},
+			value:  "us-east1",
+			want:   Decision{Allowed, []string{"us-east1 is not a denied value"}},
+		},
+		{
+			name:   "denied value of the merged rules",
+			policy: &Effective{Rules: []*rule{allowedValues("us-west1"), deniedValues("us-west1")}},
+			value:  "us-west1",
+			want:   Decision{Denied, []string{"us-west1 is a denied value"}},
+		},
+		{
+			name:   "allowed value group",
+			policy: &Effective{Rules: []*rule{allowedValues("in:us-locations")}},
+			value:  "us-east1",
+			want:   Decision{Conditional, []string{"us-east1 is only allowed if it belongs to in:us-locations"}},
+		},
+		{
+			name:   "denied value group",
+			policy: &Effective{Rules: []*rule{deniedValues("in:asia-locations")}},
+			value:  "us-east1",
+			want:   Decision{Conditional, []string{"us-east1 is only allowed if it doesn't belong to in:asia-locations"}},
+		},
+		{
+			name:   "allowed value in a denied group",
+			policy: &Effective{Rules: []*rule{allowedValues("us-east1"), deniedValues("in:us-east1-locations")}},
+			value:  "us-east1",
+			want:   Decision{Conditional, []string{"us-east1 is only allowed if it doesn't belong to in:us-east1-locations"}},
+		},
+		{
+			name:   "no value for a list constraint",
+			policy: &Effective{Rules: []*rule{allowedValues("in:us-locations")}},
+			want:   Decision{Conditional, []string{"it depends on the value, allowed values: in:us-locations"}},
+		},
+		{
+			name:   "deny all",
+			policy: &Effective{Rules: []*rule{{DenyAll: true}}},
+			value:  "us-east1",
+			want:   Decision{Denied, []string{"every value is denied"}},
+		},
+		{
+			name:   "allow all",
+			policy: &Effective{Rules: []*rule{{AllowAll: true}}},
+			value:  "us-east1",
+			want:   Decision{Allowed, []string{"every value is allowed"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EvaluateConstraint(tt.policy, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateConstraint() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateDenies(t *testing.T) {
+	deny := func(rule iam.GoogleIamV2DenyRule) []Deny {
+		return []Deny{{Rule: &rule, Policy: "guardrails", Resource: "organizations/1"}}
+	}
+
+	tests := []struct {
+		name       string
+		denies     []Deny
+		permission string
+		principal  string
+		want       Decision
+	}{
+		{
+			name:       "no deny policy",
+			permission: "storage.buckets.delete",
+			principal:  "alice@example.com",
+			want:       Decision{Allowed, []string{"no deny policy of the ancestry denies it"}},
+		},
+		{
+			name: "denied to everyone",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions: []string{"storage.googleapis.com/buckets.delete"},
+				DeniedPrincipals:  []string{"principalSet://goog/public:all"},
+			}),
+			permission: "storage.buckets.delete",
+			principal:  "alice@example.com",
+			want:       Decision{Denied, []string{"denied by guardrails on organizations/1"}},
+		},
+		{
+			name: "denied to the principal with a wildcard",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions: []string{"storage.googleapis.com/buckets.*"},
+				DeniedPrincipals:  []string{"principal://goog/subject/alice@example.com"},
+			}),
+			permission: "storage.googleapis.com/buckets.delete",
+			principal:  "alice@example.com",
+			want:       Decision{Denied, []string{"denied by guardrails on organizations/1"}},
+		},
+		{
+			name: "service account",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions: []string{"storage.googleapis.com/buckets.delete"},
+				DeniedPrincipals:  []string{"principal://iam.googleapis.com/projects/-/serviceAccounts/ci@project.iam.gserviceaccount.com"},
+			}),
+			permission: "storage.buckets.delete",
+			principal:  "ci@project.iam.gserviceaccount.com",
+			want:       Decision{Denied, []string{"denied by guardrails on organizations/1"}},
+		},
+		{
+			name: "another permission",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions: []string{"storage.googleapis.com/buckets.delete"},
+				DeniedPrincipals:  []string{"principalSet://goog/public:all"},
+			}),
+			permission: "storage.buckets.create",
+			principal:  "alice@example.com",
+			want:       Decision{Allowed, []string{"no deny policy of the ancestry denies it"}},
+		},
+		{
+			name: "exception permission",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions:    []string{"storage.googleapis.com/*"},
+				ExceptionPermissions: []string{"storage.googleapis.com/buckets.get"},
+				DeniedPrincipals:     []string{"principalSet://goog/public:all"},
+			}),
+			permission: "storage.buckets.get",
+			principal:  "alice@example.com",
+			want:       Decision{Allowed, []string{"no deny policy of the ancestry denies it"}},
+		},
+		{
+			name: "exception principal",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions:   []string{"storage.googleapis.com/buckets.delete"},
+				DeniedPrincipals:    []string{"principalSet://goog/public:all"},
+				ExceptionPrincipals: []string{"principal://goog/subject/alice@example.com"},
+			}),
+			permission: "storage.buckets.delete",
+			principal:  "alice@example.com",
+			want:       Decision{Allowed, []string{"no deny policy of the ancestry denies it"}},
+		},
+		{
+			name: "group exception",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions:   []string{"storage.googleapis.com/buckets.delete"},
+				DeniedPrincipals:    []string{"principalSet://goog/public:all"},
+				ExceptionPrincipals: []string{"principalSet://goog/group/admins@example.com"},
+			}),
+			permission: "storage.buckets.delete",
+			principal:  "alice@example.com",
+			want: Decision{Conditional, []string{
+				"denied by guardrails on organizations/1 if the principal is not one of principalSet://goog/group/admins@example.com",
+			}},
+		},
+		{
+			name: "denied to a group with a condition",
+			denies: deny(iam.GoogleIamV2DenyRule{
+				DeniedPermissions: []string{"storage.googleapis.com/buckets.delete"},
+				DeniedPrincipals:  []string{"principalSet://goog/group/contractors@example.com"},
+				DenialCondition:   &iam.GoogleTypeExpr{Title: "Production", Expression: "resource.matchTag('env', 'prod')"},
+			}),
+			permission: "storage.buckets.delete",
+			principal:  "alice@example.com",
+			want: Decision{Conditional, []string{
+				"denied by guardrails on organizations/1 if the principal is one of principalSet://goog/group/contractors@example.com and the request matches Production (resource.matchTag('env', 'prod'))",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EvaluateDenies(tt.denies, tt.permission, tt.principal); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateDenies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenyPermission(t *testing.T) {
+	tests := []struct {
+		permission string
+		want       string
+	}{
+		{"storage.buckets.delete", "storage.googleapis.com/buckets.delete"},
+		{"iam.serviceAccountKeys.create", "iam.googleapis.com/serviceAccountKeys.create"},
+		{"storage.googleapis.com/buckets.delete", "storage.googleapis.com/buckets.delete"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			if got := DenyPermission(tt.permission); got != tt.want {
+				t.Errorf("DenyPermission(%q) = %q, want %q", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
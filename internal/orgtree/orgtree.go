@@ -0,0 +1,157 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package orgtree models an organization as a tree of root, OU and account
+// nodes (organization, folder and project nodes on GCP) along with the
+// policies applied to them. The tree is built first and
+// rendered afterwards, so traversing the organization and formatting the
+// results are independent and new output formats are just new renderers.
+package orgtree
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Kinds of nodes in the tree.
+const (
+	RootNode    = "root"
+	OUNode      = "ou"
+	AccountNode = "account"
+
+	OrganizationNode = "organization" // GCP
+	FolderNode       = "folder"       // GCP
+	ProjectNode      = "project"      // GCP
+)
+
+// Account statuses, as reported by Organizations.
+const (
+	StatusActive = "ACTIVE"
+)
+
+// Policy is a policy applied to a node. Names are not unique, IDs and ARNs are.
+type Policy struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	ARN       string          `json:"arn,omitempty"`      // AWS only
+	Category  string          `json:"category,omitempty"` // according to the naming conventions
+	Document  json.RawMessage `json:"document,omitempty"`
+	Truncated *Truncation     `json:"truncated,omitempty"`
+}
+
+// Truncation describes how a document was shortened to fit a size limit.
+type Truncation struct {
+	OriginalBytes     int `json:"originalBytes"`
+	OmittedStatements int `json:"omittedStatements"`
+}
+
+// Tag is the value of a tag of an account along with where it comes from: the
+// account itself, or the closest OU (or root) above it carrying the tag. On
+// GCP, the same goes for the tags of the projects and their folders.
+type Tag struct {
+	Value  string `json:"value"`
+	Source string `json:"source"` // "account" ("project" on GCP), or the ID of the OU (folder) the value is inherited from
+}
+
+// Contact is an alternate contact of an account, e.g. the team to reach about
+// its security findings.
+type Contact struct {
+	Name  string `json:"name"`
+	Title string `json:"title,omitempty"`
+	Email string `json:"email"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// Lien is a lien of a GCP project, preventing the operations of its
+// restrictions (usually the deletion of the project).
+type Lien struct {
+	Reason       string   `json:"reason"`
+	Origin       string   `json:"origin"` // who placed it, e.g. xpn.googleapis.com
+	Restrictions []string `json:"restrictions"`
+	CreateTime   string   `json:"createTime,omitempty"`
+}
+
+// Node is a root, OU or account of the tree.
+type Node struct {
+	Type              string                     `json:"type"`
+	ID                string                     `json:"id"`
+	Name              string                     `json:"name"`
+	ManagementAccount bool                       `json:"managementAccount,omitempty"`
+	Status            string                     `json:"status,omitempty"` // accounts only
+	SCPs              []Policy                   `json:"scps,omitempty"`
+	Policies          map[string][]Policy        `json:"policies,omitempty"`          // other policy types, keyed by type
+	EffectivePolicies map[string]json.RawMessage `json:"effectivePolicies,omitempty"` // accounts only, as merged by Organizations
+	Tags              map[string]Tag             `json:"tags,omitempty"`              // accounts, folders and projects
+	AlternateContacts map[string]Contact         `json:"alternateContacts,omitempty"` // accounts only, keyed by type (SECURITY, BILLING, OPERATIONS)
+	Liens             []Lien                     `json:"liens,omitempty"`             // projects only
+	Children          []*Node                    `json:"children,omitempty"`
+}
+
+// Tree is an organization, or the part of it that was analyzed.
+type Tree struct {
+	OrganizationID string `json:"organizationId"`
+	Root           *Node  `json:"tree"`
+}
+
+// Renderer writes a tree in an output format.
+type Renderer interface {
+	Render(w io.Writer, tree *Tree) error
+}
+
+// Walk calls fn for node and every node below it, parents before their
+// children. depth is 0 for node itself.
+func (n *Node) Walk(fn func(node *Node, depth int) error) error {
+	return n.walk(fn, 0)
+}
+
+func (n *Node) walk(fn func(node *Node, depth int) error, depth int) error {
+	if err := fn(n, depth); err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		if err := child.walk(fn, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Active reports whether an account is active. Nodes without a status are
+// considered active.
+func (n *Node) Active() bool {
+	return n.Status == "" || n.Status == StatusActive
+}
+
+// Keys the children of a node can be sorted by.
+const (
+	SortByName = "name"
+	SortByID   = "id"
+)
+
+// Leaf reports whether the node is an account or a project, which have no
+// children.
+func (n *Node) Leaf() bool {
+	return n.Type == AccountNode || n.Type == ProjectNode
+}
+
+// Sort orders the children of n, and of every node below it, so the tree is the
+// same whatever order the API returned them in: accounts (or projects) first,
+// then OUs (or folders), each group sorted by key (SortByName or SortByID). Names are not unique, ties are
+// broken by ID.
+func (n *Node) Sort(key string) {
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Leaf() != b.Leaf() {
+			return a.Leaf()
+		}
+		if key == SortByName && a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	for _, child := range n.Children {
+		child.Sort(key)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package orgtree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSONRenderer writes the tree as indented JSON.
+type JSONRenderer struct{}
+
+// Render implements Renderer.
+func (JSONRenderer) Render(w io.Writer, tree *Tree) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(tree)
+}
+
+// YAMLRenderer writes the tree as YAML, with the fields in the order of the
+// JSON output.
+type YAMLRenderer struct{}
+
+// Render implements Renderer.
+func (YAMLRenderer) Render(w io.Writer, tree *Tree) error {
+	return EncodeYAML(w, tree)
+}
+
+// EncodeYAML writes v as YAML, with the field names and order of its JSON
+// encoding.
+func EncodeYAML(w io.Writer, v any) error {
+	// JSON is YAML, so decoding the JSON encoding keeps its field names and
+	// order, which encoding v directly wouldn't
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	blockStyle(&document)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Drops the JSON flow style and quoting of a node and the nodes below it, so
+// they are written the YAML way.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// DotRenderer writes the tree as a graphviz digraph, every account labeled
+// with its SCPs.
+type DotRenderer struct{}
+
+// Render implements Renderer.
+func (DotRenderer) Render(w io.Writer, tree *Tree) error {
+	var b strings.Builder
+	b.WriteString("digraph organization {\n  rankdir=LR;\n")
+
+	err := tree.Root.Walk(func(node *Node, _ int) error {
+		fmt.Fprintf(&b, "  %q [shape=%s, label=%q];\n", node.ID, dotShape(node), dotLabel(node))
+		for _, child := range node.Children {
+			fmt.Fprintf(&b, "  %q -> %q;\n", node.ID, child.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.WriteString("}\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func dotShape(node *Node) string {
+	if node.Leaf() {
+		return "box"
+	}
+	return "folder"
+}
+
+func dotLabel(node *Node) string {
+	switch node.Type {
+	case RootNode:
+		return "Root\n" + node.ID
+	case OUNode:
+		return fmt.Sprintf("OU: %s\n%s", node.Name, node.ID)
+	case OrganizationNode:
+		return fmt.Sprintf("Organization: %s\n%s", node.Name, node.ID)
+	case FolderNode:
+		return fmt.Sprintf("Folder: %s\n%s", node.Name, node.ID)
+	case ProjectNode:
+		label := node.Name
+		if !node.Active() {
+			label += fmt.Sprintf(" (%s)", node.Status)
+		}
+		return fmt.Sprintf("Project: %s\n%s", label, node.ID)
+	}
+
+	label := node.Name
+	if node.ManagementAccount {
+		label += " (Management Account)"
+	}
+	if !node.Active() {
+		label += fmt.Sprintf(" (%s)", node.Status)
+	}
+	names := make([]string, 0, len(node.SCPs))
+	for _, policy := range node.SCPs {
+		names = append(names, policy.Name)
+	}
+	return fmt.Sprintf("%s\n%s\nSCPs: %s", label, node.ID, strings.Join(names, ", "))
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package orgtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rewrites the golden files with the current output: go test ./internal/orgtree -update
+var update = flag.Bool("update", false, "update the golden files")
+
+// An AWS organization using every field of the nodes.
+func awsTestTree() *Tree {
+	fullAccess := Policy{ID: "p-FullAWSAccess", Name: "FullAWSAccess", ARN: "arn:aws:organizations::aws:policy/service_control_policy/p-FullAWSAccess"}
+	denyLeave := Policy{
+		ID:       "p-denyleave",
+		Name:     "scp-guardrail-01",
+		ARN:      "arn:aws:organizations::111111111111:policy/o-example/service_control_policy/p-denyleave",
+		Category: "guardrail",
+		Document: json.RawMessage(`{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"organizations:LeaveOrganization","Resource":"*"}]}`),
+	}
+	truncated := denyLeave
+	truncated.Truncated = &Truncation{OriginalBytes: 8192, OmittedStatements: 3}
+	costCenter := Policy{ID: "p-costcenter", Name: "cost-center", ARN: "arn:aws:organizations::111111111111:policy/o-example/tag_policy/p-costcenter"}
+
+	return &Tree{
+		OrganizationID: "o-example",
+		Root: &Node{
+			Type: RootNode,
+			ID:   "r-root",
+			Name: "Root",
+			SCPs: []Policy{fullAccess},
+			Children: []*Node{
+				{Type: AccountNode, ID: "111111111111", Name: "management", ManagementAccount: true, Status: StatusActive, SCPs: []Policy{fullAccess}},
+				{
+					Type:     OUNode,
+					ID:       "ou-root-work",
+					Name:     "Workloads",
+					SCPs:     []Policy{denyLeave, fullAccess},
+					Policies: map[string][]Policy{"TAG_POLICY": {costCenter}},
+					Children: []*Node{
+						{
+							Type:              AccountNode,
+							ID:                "222222222222",
+							Name:              "payments",
+							Status:            StatusActive,
+							SCPs:              []Policy{truncated, fullAccess},
+							Policies:          map[string][]Policy{"TAG_POLICY": {costCenter}, "BACKUP_POLICY": nil},
+							EffectivePolicies: map[string]json.RawMessage{"TAG_POLICY": json.RawMessage(`{"tags":{"CostCenter":{"tag_key":{"@@assign":"CostCenter"}}}}`)},
+							Tags:              map[string]Tag{"CostCenter": {Value: "1234", Source: "ou-root-work"}, "Owner": {Value: "payments-team", Source: "account"}},
+							AlternateContacts: map[string]Contact{"SECURITY": {Name: "Security Team", Title: "SecOps", Email: "security@example.com", Phone: "+1 555 0100"}},
+						},
+						{Type: AccountNode, ID: "333333333333", Name: "legacy", Status: "SUSPENDED", SCPs: []Policy{denyLeave, fullAccess}},
+					},
+				},
+				{Type: OUNode, ID: "ou-root-empty", Name: "Empty", SCPs: []Policy{fullAccess}},
+			},
+		},
+	}
+}
+
+// A GCP organization with a folder and its projects.
+func gcpTestTree() *Tree {
+	locations := Policy{ID: "organizations/123456789012/policies/gcp.resourceLocations", Name: "gcp.resourceLocations", Document: json.RawMessage(`{"spec":{"rules":[{"values":{"allowedValues":["in:us-locations"]}}]}}`)}
+	return &Tree{
+		OrganizationID: "123456789012",
+		Root: &Node{
+			Type:     OrganizationNode,
+			ID:       "123456789012",
+			Name:     "example.com",
+			Policies: map[string][]Policy{"orgPolicies": {locations}},
+			Children: []*Node{
+				{
+					Type: FolderNode,
+					ID:   "200000000001",
+					Name: "Production",
+					Tags: map[string]Tag{"env": {Value: "prod", Source: "200000000001"}},
+					Children: []*Node{
+						{
+							Type:   ProjectNode,
+							ID:     "payments-prod",
+							Name:   "Payments",
+							Status: StatusActive,
+							Tags:   map[string]Tag{"env": {Value: "prod", Source: "200000000001"}},
+							Liens:  []Lien{{Reason: "Shared VPC host", Origin: "xpn.googleapis.com", Restrictions: []string{"resourcemanager.projects.delete"}, CreateTime: "2024-05-01T10:00:00Z"}},
+						},
+						{Type: ProjectNode, ID: "legacy-prod", Name: "Legacy", Status: "DELETE_REQUESTED"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRenderersGolden(t *testing.T) {
+	renderers := map[string]Renderer{"json": JSONRenderer{}, "yaml": YAMLRenderer{}, "dot": DotRenderer{}}
+	trees := map[string]*Tree{"aws": awsTestTree(), "gcp": gcpTestTree()}
+
+	for treeName, tree := range trees {
+		for extension, renderer := range renderers {
+			name := treeName + "." + extension
+			t.Run(name, func(t *testing.T) {
+				var out bytes.Buffer
+				if err := renderer.Render(&out, tree); err != nil {
+					t.Fatal(err)
+				}
+
+				golden := filepath.Join("testdata", name)
+				if *update {
+					if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out.Bytes(), want) {
+					t.Errorf("%s doesn't match %s:\n%s\nrun go test ./internal/orgtree -update if the change is intended", extension, golden, out.String())
+				}
+			})
+		}
+	}
+}
+
+// The YAML output has the same content as the JSON one.
+func TestYAMLMatchesJSON(t *testing.T) {
+	var jsonOut, yamlOut bytes.Buffer
+	tree := awsTestTree()
+	if err := (JSONRenderer{}).Render(&jsonOut, tree); err != nil {
+		t.Fatal(err)
+	}
+	if err := (YAMLRenderer{}).Render(&yamlOut, tree); err != nil {
+		t.Fatal(err)
+	}
+
+	var fromJSON, fromYAML any
+	if err := json.Unmarshal(jsonOut.Bytes(), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(yamlOut.Bytes(), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	// Both are compared through JSON, which sorts the keys and unifies numbers
+	a, err := json.Marshal(fromJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(fromYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("the YAML output differs from the JSON one:\n%s\n%s", a, b)
+	}
+}
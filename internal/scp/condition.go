@@ -0,0 +1,245 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Evaluates the conditions of a statement against the request context. All the
+// operators (and all the keys within an operator) must match. Keys missing from the
+// context are reported so callers can flag results that depend on assumptions.
+// Operators that can't be evaluated (see supportedOperator) are reported too,
+// matches then tells whether the rest of the conditions match.
+func (c Conditions) evaluate(context map[string][]string) (matches bool, missing, unevaluated []string) {
+	matches = true
+	for operator, keys := range c {
+		if !supportedOperator(operator) {
+			unevaluated = append(unevaluated, operator)
+			continue
+		}
+		for key, values := range keys {
+			requestValues, present := lookup(context, key)
+			if !present {
+				missing = append(missing, key)
+			}
+			if !evaluateOperator(operator, values, requestValues, present) {
+				matches = false
+			}
+		}
+	}
+	sort.Strings(unevaluated)
+	return matches, missing, unevaluated
+}
+
+// UnsupportedOperators returns the operators of the conditions that can't be
+// evaluated against a request, sorted.
+func (c Conditions) UnsupportedOperators() []string {
+	var unsupported []string
+	for operator := range c {
+		if !supportedOperator(operator) {
+			unsupported = append(unsupported, operator)
+		}
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
+
+// Condition keys are case insensitive.
+func lookup(context map[string][]string, key string) ([]string, bool) {
+	for k, v := range context {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Splits a condition operator into its set prefix ("ForAnyValue:", "ForAllValues:"
+// or none), its base operator and whether "IfExists" is used.
+func parseOperator(operator string) (set, op string, ifExists bool) {
+	op = operator
+	for _, prefix := range []string{"ForAnyValue:", "ForAllValues:"} {
+		if strings.HasPrefix(op, prefix) {
+			set, op = prefix, strings.TrimPrefix(op, prefix)
+		}
+	}
+	ifExists = strings.HasSuffix(op, "IfExists")
+	return set, strings.TrimSuffix(op, "IfExists"), ifExists
+}
+
+// Reports whether evaluateOperator knows the operator. "Null" takes neither a
+// set prefix nor "IfExists".
+func supportedOperator(operator string) bool {
+	set, op, ifExists := parseOperator(operator)
+	if op == "Null" {
+		return set == "" && !ifExists
+	}
+	return valueMatcher(strings.Replace(op, "Not", "", 1)) != nil
+}
+
+// Compares a policy value with a request value for a base operator, nil if the
+// operator isn't supported.
+func valueMatcher(op string) func(policyValue, requestValue string) bool {
+	switch op {
+	case "StringEquals", "ArnEquals":
+		return func(p, r string) bool { return p == r }
+	case "StringEqualsIgnoreCase":
+		return strings.EqualFold
+	case "StringLike", "ArnLike":
+		return func(p, r string) bool { return wildcardMatch(p, r) }
+	case "Bool":
+		return strings.EqualFold
+	case "NumericEquals":
+		return func(p, r string) bool { return compareNumbers(p, r, func(a, b float64) bool { return a == b }) }
+	case "NumericLessThan":
+		return func(p, r string) bool { return compareNumbers(p, r, func(a, b float64) bool { return b < a }) }
+	case "NumericLessThanEquals":
+		return func(p, r string) bool { return compareNumbers(p, r, func(a, b float64) bool { return b <= a }) }
+	case "NumericGreaterThan":
+		return func(p, r string) bool { return compareNumbers(p, r, func(a, b float64) bool { return b > a }) }
+	case "NumericGreaterThanEquals":
+		return func(p, r string) bool { return compareNumbers(p, r, func(a, b float64) bool { return b >= a }) }
+	case "DateEquals":
+		return func(p, r string) bool { return compareDates(p, r, func(a, b time.Time) bool { return b.Equal(a) }) }
+	case "DateLessThan":
+		return func(p, r string) bool { return compareDates(p, r, func(a, b time.Time) bool { return b.Before(a) }) }
+	case "DateLessThanEquals":
+		return func(p, r string) bool { return compareDates(p, r, func(a, b time.Time) bool { return !b.After(a) }) }
+	case "DateGreaterThan":
+		return func(p, r string) bool { return compareDates(p, r, func(a, b time.Time) bool { return b.After(a) }) }
+	case "DateGreaterThanEquals":
+		return func(p, r string) bool { return compareDates(p, r, func(a, b time.Time) bool { return !b.Before(a) }) }
+	case "IpAddress":
+		return matchAddress
+	default:
+		return nil
+	}
+}
+
+// Evaluates a single supported condition operator following the IAM semantics:
+//   - keys missing from the request make positive operators fail and negated ones
+//     ("StringNotEquals", "ArnNotLike", ...) succeed, unless "IfExists" is used,
+//   - a request value matching any of the policy values is a match, negated
+//     operators match the values matching none of them,
+//   - "ForAllValues" operators need every request value to match, so they succeed
+//     on a missing key or an empty set of values,
+//   - "ForAnyValue" operators need at least one request value to match, so they
+//     fail on a missing key or an empty set of values, unless "IfExists" is used.
+func evaluateOperator(operator string, policyValues, requestValues []string, present bool) bool {
+	set, op, ifExists := parseOperator(operator)
+
+	if op == "Null" {
+		// "Null": "true" means the key must be absent
+		for _, v := range policyValues {
+			if strings.EqualFold(v, "true") == !present {
+				return true
+			}
+		}
+		return false
+	}
+
+	match := valueMatcher(strings.Replace(op, "Not", "", 1))
+	if match == nil {
+		return false
+	}
+	negated := strings.Contains(op, "Not")
+	matchesValue := func(requestValue string) bool {
+		for _, p := range policyValues {
+			if match(p, requestValue) {
+				return !negated
+			}
+		}
+		return negated
+	}
+
+	switch set {
+	case "ForAllValues:":
+		for _, r := range requestValues {
+			if !matchesValue(r) {
+				return false
+			}
+		}
+		return true
+	case "ForAnyValue:":
+		if len(requestValues) == 0 {
+			return ifExists && !present
+		}
+		for _, r := range requestValues {
+			if matchesValue(r) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !present {
+		return ifExists || negated
+	}
+	// A single valued key is matched against every policy value at once
+	for _, r := range requestValues {
+		for _, p := range policyValues {
+			if match(p, r) {
+				return !negated
+			}
+		}
+	}
+	return negated
+}
+
+func compareNumbers(policyValue, requestValue string, compare func(policy, request float64) bool) bool {
+	p, err := strconv.ParseFloat(policyValue, 64)
+	if err != nil {
+		return false
+	}
+	r, err := strconv.ParseFloat(requestValue, 64)
+	if err != nil {
+		return false
+	}
+	return compare(p, r)
+}
+
+// Dates are ISO 8601 (e.g. "2024-01-01T00:00:00Z") or epoch seconds.
+func compareDates(policyValue, requestValue string, compare func(policy, request time.Time) bool) bool {
+	p, ok := parseDate(policyValue)
+	if !ok {
+		return false
+	}
+	r, ok := parseDate(requestValue)
+	if !ok {
+		return false
+	}
+	return compare(p, r)
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	return time.Time{}, false
+}
+
+// Reports whether a request IP address is within a policy CIDR block (or is the
+// policy address).
+func matchAddress(policyValue, requestValue string) bool {
+	address, err := netip.ParseAddr(requestValue)
+	if err != nil {
+		return false
+	}
+	if prefix, err := netip.ParsePrefix(policyValue); err == nil {
+		return prefix.Contains(address)
+	}
+	policyAddress, err := netip.ParseAddr(policyValue)
+	return err == nil && policyAddress == address
+}
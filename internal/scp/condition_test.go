@@ -0,0 +1,194 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateOperator(t *testing.T) {
+	tests := []struct {
+		operator      string
+		policyValues  []string
+		requestValues []string
+		present       bool
+		want          bool
+	}{
+		{"StringEquals", []string{"eu-west-1", "us-east-1"}, []string{"us-east-1"}, true, true},
+		{"StringEquals", []string{"eu-west-1"}, []string{"EU-WEST-1"}, true, false},
+		{"StringEquals", []string{"eu-west-1"}, nil, false, false},
+		{"StringNotEquals", []string{"eu-west-1", "us-east-1"}, []string{"ap-south-1"}, true, true},
+		{"StringNotEquals", []string{"eu-west-1", "us-east-1"}, []string{"eu-west-1"}, true, false},
+		{"StringNotEquals", []string{"eu-west-1"}, nil, false, true},
+		{"StringEqualsIgnoreCase", []string{"eu-west-1"}, []string{"EU-WEST-1"}, true, true},
+		{"StringNotEqualsIgnoreCase", []string{"eu-west-1"}, []string{"EU-WEST-1"}, true, false},
+		{"StringLike", []string{"arn:aws:iam::*:role/Admin*"}, []string{"arn:aws:iam::123456789012:role/AdminBreakGlass"}, true, true},
+		{"StringLike", []string{"arn:aws:iam::*:role/Admin*"}, []string{"arn:aws:iam::123456789012:role/Developer"}, true, false},
+		{"StringNotLike", []string{"arn:aws:iam::*:role/Admin*"}, []string{"arn:aws:iam::123456789012:role/Developer"}, true, true},
+		{"ArnEquals", []string{"arn:aws:iam::123456789012:role/Admin"}, []string{"arn:aws:iam::123456789012:role/Admin"}, true, true},
+		{"ArnLike", []string{"arn:aws:iam::*:role/Admin"}, []string{"arn:aws:iam::123456789012:role/Admin"}, true, true},
+		{"ArnNotLike", []string{"arn:aws:iam::*:role/Admin"}, nil, false, true},
+		{"StringEqualsIfExists", []string{"eu-west-1"}, nil, false, true},
+		{"StringEqualsIfExists", []string{"eu-west-1"}, []string{"us-east-1"}, true, false},
+		{"Bool", []string{"true"}, []string{"TRUE"}, true, true},
+		{"Bool", []string{"true"}, []string{"false"}, true, false},
+		{"BoolIfExists", []string{"false"}, nil, false, true},
+		{"NumericEquals", []string{"10"}, []string{"10.0"}, true, true},
+		{"NumericNotEquals", []string{"10"}, []string{"10"}, true, false},
+		{"NumericLessThan", []string{"3600"}, []string{"900"}, true, true},
+		{"NumericLessThan", []string{"3600"}, []string{"3600"}, true, false},
+		{"NumericLessThanEquals", []string{"3600"}, []string{"3600"}, true, true},
+		{"NumericGreaterThan", []string{"3600"}, []string{"7200"}, true, true},
+		{"NumericGreaterThanEquals", []string{"3600"}, []string{"900"}, true, false},
+		{"NumericEquals", []string{"ten"}, []string{"10"}, true, false},
+		{"Null", []string{"true"}, nil, false, true},
+		{"Null", []string{"true"}, []string{"x"}, true, false},
+		{"Null", []string{"false"}, []string{"x"}, true, true},
+		{"ForAnyValue:StringEquals", []string{"Admin"}, []string{"Dev", "Admin"}, true, true},
+		{"ForAllValues:StringLike", []string{"team-*"}, []string{"team-payments"}, true, true},
+		{"ForAllValues:StringEquals", []string{"team-payments"}, nil, false, true},
+		{"ForAllValues:StringEquals", []string{"team-payments"}, []string{}, true, true},
+		{"ForAllValues:StringNotEquals", []string{"team-payments"}, nil, false, true},
+		{"ForAnyValue:StringEquals", []string{"team-payments"}, nil, false, false},
+		{"ForAllValues:StringEquals", []string{"a", "b"}, []string{"a", "b"}, true, true},
+		{"ForAllValues:StringEquals", []string{"a", "b"}, []string{"a", "c"}, true, false},
+		{"ForAllValues:StringNotEquals", []string{"a"}, []string{"b", "c"}, true, true},
+		{"ForAllValues:StringNotEquals", []string{"a"}, []string{"a", "c"}, true, false},
+		{"ForAnyValue:StringEquals", []string{"a", "b"}, []string{"c", "d"}, true, false},
+		{"ForAnyValue:StringNotEquals", []string{"a"}, []string{"a", "c"}, true, true},
+		{"ForAnyValue:StringNotEquals", []string{"a"}, []string{"a"}, true, false},
+		{"ForAnyValue:StringNotEquals", []string{"a"}, nil, false, false},
+		{"ForAnyValue:StringEqualsIfExists", []string{"a"}, nil, false, true},
+		{"ForAnyValue:StringLike", []string{"team-*"}, []string{"ops", "team-payments"}, true, true},
+		{"StringNotEquals", []string{"a"}, []string{"a", "c"}, true, false},
+		{"DateGreaterThan", []string{"2024-01-01T00:00:00Z"}, []string{"2025-01-01T00:00:00Z"}, true, true},
+		{"DateLessThan", []string{"2024-01-01T00:00:00Z"}, []string{"1735689600"}, true, false},
+		{"DateNotEquals", []string{"2024-01-01"}, []string{"2024-01-01T00:00:00Z"}, true, false},
+		{"IpAddress", []string{"203.0.113.0/24"}, []string{"203.0.113.7"}, true, true},
+		{"IpAddress", []string{"203.0.113.0/24"}, []string{"198.51.100.7"}, true, false},
+		{"NotIpAddress", []string{"203.0.113.0/24", "2001:db8::/32"}, []string{"198.51.100.7"}, true, true},
+		{"NotIpAddress", []string{"203.0.113.7"}, []string{"203.0.113.7"}, true, false},
+	}
+
+	for _, tt := range tests {
+		if got := evaluateOperator(tt.operator, tt.policyValues, tt.requestValues, tt.present); got != tt.want {
+			t.Errorf("evaluateOperator(%q, %v, %v, %v) = %v, want %v", tt.operator, tt.policyValues, tt.requestValues, tt.present, got, tt.want)
+		}
+	}
+}
+
+func TestSupportedOperator(t *testing.T) {
+	tests := []struct {
+		operator string
+		want     bool
+	}{
+		{"StringNotEqualsIfExists", true},
+		{"ForAllValues:ArnLike", true},
+		{"DateLessThanEquals", true},
+		{"NotIpAddress", true},
+		{"Null", true},
+		{"ForAnyValue:Null", false},
+		{"BinaryEquals", false},
+		{"StringMatches", false},
+	}
+
+	for _, tt := range tests {
+		if got := supportedOperator(tt.operator); got != tt.want {
+			t.Errorf("supportedOperator(%q) = %v, want %v", tt.operator, got, tt.want)
+		}
+	}
+}
+
+func TestConditionsEvaluate(t *testing.T) {
+	conditions := Conditions{
+		"StringNotEquals": {"aws:RequestedRegion": {"eu-west-1", "us-east-1"}},
+		"ArnNotLike":      {"aws:PrincipalArn": {"arn:aws:iam::*:role/BreakGlass"}},
+	}
+
+	tests := []struct {
+		name        string
+		context     map[string][]string
+		wantMatches bool
+		wantMissing []string
+	}{
+		{
+			name:        "every operator matches",
+			context:     map[string][]string{"aws:RequestedRegion": {"ap-south-1"}, "aws:PrincipalArn": {"arn:aws:iam::123456789012:role/Developer"}},
+			wantMatches: true,
+		},
+		{
+			name:        "one operator doesn't match",
+			context:     map[string][]string{"aws:RequestedRegion": {"ap-south-1"}, "aws:PrincipalArn": {"arn:aws:iam::123456789012:role/BreakGlass"}},
+			wantMatches: false,
+		},
+		{
+			name:        "keys are case insensitive",
+			context:     map[string][]string{"AWS:RequestedRegion": {"eu-west-1"}, "aws:principalarn": {"arn:aws:iam::123456789012:role/Developer"}},
+			wantMatches: false,
+		},
+		{
+			name:        "missing keys are reported",
+			context:     map[string][]string{"aws:RequestedRegion": {"ap-south-1"}},
+			wantMatches: true,
+			wantMissing: []string{"aws:PrincipalArn"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, missing, _ := conditions.evaluate(tt.context)
+			if matches != tt.wantMatches {
+				t.Errorf("matches = %v, want %v", matches, tt.wantMatches)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestConditionsEvaluateUnsupported(t *testing.T) {
+	tests := []struct {
+		name            string
+		conditions      Conditions
+		wantMatches     bool
+		wantUnevaluated []string
+	}{
+		{
+			name:            "only unsupported operators",
+			conditions:      Conditions{"BinaryEquals": {"aws:SourceIdentity": {"QmluYXJ5"}}},
+			wantMatches:     true,
+			wantUnevaluated: []string{"BinaryEquals"},
+		},
+		{
+			name:            "the rest matches",
+			conditions:      Conditions{"BinaryEquals": {"aws:SourceIdentity": {"QmluYXJ5"}}, "StringEquals": {"aws:RequestedRegion": {"eu-west-1"}}},
+			wantMatches:     true,
+			wantUnevaluated: []string{"BinaryEquals"},
+		},
+		{
+			name:            "the rest doesn't match",
+			conditions:      Conditions{"BinaryEquals": {"aws:SourceIdentity": {"QmluYXJ5"}}, "StringEquals": {"aws:RequestedRegion": {"us-east-1"}}},
+			wantMatches:     false,
+			wantUnevaluated: []string{"BinaryEquals"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, _, unevaluated := tt.conditions.evaluate(map[string][]string{"aws:RequestedRegion": {"eu-west-1"}})
+			if matches != tt.wantMatches {
+				t.Errorf("matches = %v, want %v", matches, tt.wantMatches)
+			}
+			if !reflect.DeepEqual(unevaluated, tt.wantUnevaluated) {
+				t.Errorf("unevaluated = %v, want %v", unevaluated, tt.wantUnevaluated)
+			}
+			if got := tt.conditions.UnsupportedOperators(); !reflect.DeepEqual(got, tt.wantUnevaluated) {
+				t.Errorf("UnsupportedOperators() = %v, want %v", got, tt.wantUnevaluated)
+			}
+		})
+	}
+}
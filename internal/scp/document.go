@@ -0,0 +1,153 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package scp parses service control policy documents and evaluates them the
+// way AWS Organizations does, so the tool can reason about what is actually
+// permitted in an account instead of just listing policy names.
+package scp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Statement effects.
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
+// StringList is a policy element that can be written either as a single string
+// or as a list of strings (e.g. "Action": "s3:*" or "Action": ["s3:*", "ec2:*"]).
+type StringList []string
+
+// UnmarshalJSON accepts both a string and a list of strings.
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %v", err)
+	}
+	*l = list
+	return nil
+}
+
+// Conditions maps a condition operator to the keys it evaluates and their values,
+// e.g. {"StringNotEquals": {"aws:RequestedRegion": ["eu-west-1"]}}.
+type Conditions map[string]map[string]StringList
+
+// Statement is a single statement of a policy document.
+type Statement struct {
+	Sid         string     `json:"Sid,omitempty"`
+	Effect      string     `json:"Effect"`
+	Action      StringList `json:"Action,omitempty"`
+	NotAction   StringList `json:"NotAction,omitempty"`
+	Resource    StringList `json:"Resource,omitempty"`
+	NotResource StringList `json:"NotResource,omitempty"`
+	Condition   Conditions `json:"Condition,omitempty"`
+}
+
+// statements is the Statement element, which can be a single statement or a list.
+type statements []Statement
+
+// UnmarshalJSON accepts both a single statement and a list of statements.
+func (s *statements) UnmarshalJSON(data []byte) error {
+	var single Statement
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = statements{single}
+		return nil
+	}
+
+	var list []Statement
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// Document is a parsed policy document.
+type Document struct {
+	Version   string      `json:"Version"`
+	Statement []Statement `json:"-"`
+}
+
+// Parse parses the JSON content of a policy.
+func Parse(content string) (*Document, error) {
+	var raw struct {
+		Version   string     `json:"Version"`
+		Statement statements `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(content), &raw); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %v", err)
+	}
+
+	for i, statement := range raw.Statement {
+		if statement.Effect != Allow && statement.Effect != Deny {
+			return nil, fmt.Errorf("invalid policy document: statement %d has an invalid effect %q", i, statement.Effect)
+		}
+	}
+
+	return &Document{Version: raw.Version, Statement: raw.Statement}, nil
+}
+
+// MatchesAction reports whether the statement applies to action, taking
+// NotAction into account.
+func (s Statement) MatchesAction(action string) bool {
+	if len(s.NotAction) > 0 {
+		return !matchAny(s.NotAction, action)
+	}
+	return matchAny(s.Action, action)
+}
+
+// Conditional reports whether the statement only applies when its conditions are met.
+func (s Statement) Conditional() bool {
+	return len(s.Condition) > 0
+}
+
+// Policy is a policy document along with the policy it belongs to.
+type Policy struct {
+	ID       string
+	Name     string
+	Document *Document
+}
+
+// Level is a node of the inheritance chain (root, OU or account) along with the
+// policies directly attached to it.
+type Level struct {
+	TargetID   string
+	TargetName string
+	Policies   []Policy
+}
+
+// String formats the conditions in a compact, deterministic way, e.g.
+// "StringNotEquals aws:RequestedRegion [eu-west-1, us-east-1]".
+func (c Conditions) String() string {
+	operators := make([]string, 0, len(c))
+	for operator := range c {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	var parts []string
+	for _, operator := range operators {
+		keys := make([]string, 0, len(c[operator]))
+		for key := range c[operator] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			parts = append(parts, fmt.Sprintf("%s %s [%s]", operator, key, strings.Join(c[operator][key], ", ")))
+		}
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import "sort"
+
+// Rule is a statement found in the inheritance chain, along with where it comes from.
+type Rule struct {
+	TargetID   string // root, OU or account the policy is attached to
+	TargetName string
+	PolicyID   string
+	PolicyName string
+	Statement  Statement
+}
+
+// Creates the rule of a statement attached to a level of the chain.
+func newRule(level *Level, policy Policy, statement Statement) Rule {
+	return Rule{
+		TargetID:   level.TargetID,
+		TargetName: level.TargetName,
+		PolicyID:   policy.ID,
+		PolicyName: policy.Name,
+		Statement:  statement,
+	}
+}
+
+// Effective is the result of combining every policy of an inheritance chain.
+type Effective struct {
+	// Action patterns allowed at every level of the chain. SCPs only permit an
+	// action if every level (root, each OU and the account) allows it.
+	Allowed []string
+	// Deny statements of the chain. A matching deny always wins over allows.
+	Denies []Rule
+}
+
+// Analyze combines the policies of an inheritance chain, ordered from the root
+// down to the account. Allow statements using NotAction are approximated as "*".
+func Analyze(chain []Level) Effective {
+	var effective Effective
+
+	for i, level := range chain {
+		var levelAllows []string
+		for _, policy := range level.Policies {
+			for _, statement := range policy.Document.Statement {
+				switch statement.Effect {
+				case Allow:
+					if len(statement.NotAction) > 0 {
+						levelAllows = append(levelAllows, "*")
+					} else {
+						levelAllows = append(levelAllows, statement.Action...)
+					}
+				case Deny:
+					effective.Denies = append(effective.Denies, newRule(&level, policy, statement))
+				}
+			}
+		}
+
+		if i == 0 {
+			effective.Allowed = normalize(levelAllows)
+		} else {
+			effective.Allowed = intersect(effective.Allowed, levelAllows)
+		}
+	}
+
+	return effective
+}
+
+// Intersects two sets of action patterns, keeping the narrowest pattern of each
+// overlapping pair.
+func intersect(a, b []string) []string {
+	var result []string
+	for _, p := range a {
+		for _, q := range b {
+			switch {
+			case Covers(p, q):
+				result = append(result, q)
+			case Covers(q, p):
+				result = append(result, p)
+			}
+		}
+	}
+	return normalize(result)
+}
+
+// Removes the patterns already covered by a broader one and sorts the rest.
+func normalize(patterns []string) []string {
+	var result []string
+	for i, p := range patterns {
+		covered := false
+		for j, q := range patterns {
+			if i == j {
+				continue
+			}
+			// Identical patterns only keep the first occurrence
+			if Covers(q, p) && (!Covers(p, q) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Unrestricted reports whether the chain doesn't restrict anything: every level
+// allows every action on every resource unconditionally (like FullAWSAccess does)
+// and there are no deny statements at all.
+func Unrestricted(chain []Level) bool {
+	for _, level := range chain {
+		allowsAll := false
+		for _, policy := range level.Policies {
+			for _, statement := range policy.Document.Statement {
+				switch {
+				case statement.Effect == Deny:
+					return false
+				case statement.allowsAll():
+					allowsAll = true
+				}
+			}
+		}
+		if !allowsAll {
+			return false
+		}
+	}
+	return len(chain) > 0
+}
+
+// Reports whether the statement unconditionally allows every action on every resource.
+func (s Statement) allowsAll() bool {
+	if s.Effect != Allow || len(s.NotAction) > 0 || len(s.NotResource) > 0 || s.Conditional() {
+		return false
+	}
+	return coversAll(s.Action, "*:*") && (len(s.Resource) == 0 || coversAll(s.Resource, "*"))
+}
+
+// Reports whether any of the patterns covers the given wildcard pattern.
+func coversAll(patterns []string, wildcard string) bool {
+	for _, pattern := range patterns {
+		if Covers(pattern, wildcard) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	fullAccess := testPolicy(t, "FullAWSAccess", fullAccessDocument)
+	denyLeave := testPolicy(t, "deny-leave", denyLeaveDocument)
+	s3Only := testPolicy(t, "s3-only", s3OnlyDocument)
+	storage := testPolicy(t, "storage", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:Get*","s3:List*","dynamodb:*"],"Resource":"*"}]}`)
+	notIAM := testPolicy(t, "not-iam", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`)
+
+	tests := []struct {
+		name        string
+		chain       []Level
+		wantAllowed []string
+		wantDenies  []string // names of the policies of the deny statements
+	}{
+		{
+			name:        "full access everywhere",
+			chain:       []Level{testLevel("r-root", fullAccess), testLevel("ou-work", fullAccess), testLevel("222222222222", fullAccess)},
+			wantAllowed: []string{"*"},
+		},
+		{
+			name:        "intersection across OUs",
+			chain:       []Level{testLevel("r-root", fullAccess), testLevel("ou-work", s3Only), testLevel("ou-data", storage), testLevel("222222222222", fullAccess)},
+			wantAllowed: []string{"s3:Get*", "s3:List*"},
+		},
+		{
+			name:  "nothing allowed at a level",
+			chain: []Level{testLevel("r-root", fullAccess), testLevel("ou-work", denyLeave), testLevel("222222222222", fullAccess)},
+			// Only denies at ou-work, so it allows nothing
+			wantDenies: []string{"deny-leave"},
+		},
+		{
+			name:        "denies are collected from every level",
+			chain:       []Level{testLevel("r-root", fullAccess, denyLeave), testLevel("ou-work", fullAccess, denyLeave), testLevel("222222222222", s3Only)},
+			wantAllowed: []string{"s3:*", "sts:*"},
+			wantDenies:  []string{"deny-leave", "deny-leave"},
+		},
+		{
+			name:        "NotAction allow approximated as everything",
+			chain:       []Level{testLevel("r-root", notIAM), testLevel("222222222222", s3Only)},
+			wantAllowed: []string{"s3:*", "sts:*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effective := Analyze(tt.chain)
+			if !reflect.DeepEqual(effective.Allowed, tt.wantAllowed) {
+				t.Errorf("Allowed = %v, want %v", effective.Allowed, tt.wantAllowed)
+			}
+			var denies []string
+			for _, rule := range effective.Denies {
+				denies = append(denies, rule.PolicyName)
+			}
+			if !reflect.DeepEqual(denies, tt.wantDenies) {
+				t.Errorf("Denies = %v, want %v", denies, tt.wantDenies)
+			}
+		})
+	}
+}
+
+func TestUnrestricted(t *testing.T) {
+	fullAccess := testPolicy(t, "FullAWSAccess", fullAccessDocument)
+	denyLeave := testPolicy(t, "deny-leave", denyLeaveDocument)
+	s3Only := testPolicy(t, "s3-only", s3OnlyDocument)
+	conditional := testPolicy(t, "conditional", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringEquals":{"aws:RequestedRegion":"eu-west-1"}}}]}`)
+
+	tests := []struct {
+		name  string
+		chain []Level
+		want  bool
+	}{
+		{"full access everywhere", []Level{testLevel("r-root", fullAccess), testLevel("222222222222", fullAccess)}, true},
+		{"deny statement", []Level{testLevel("r-root", fullAccess, denyLeave), testLevel("222222222222", fullAccess)}, false},
+		{"restricted allow", []Level{testLevel("r-root", fullAccess), testLevel("222222222222", s3Only)}, false},
+		{"conditional allow", []Level{testLevel("r-root", fullAccess), testLevel("222222222222", conditional)}, false},
+		{"empty chain", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unrestricted(tt.chain); got != tt.want {
+				t.Errorf("Unrestricted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
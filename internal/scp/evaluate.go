@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import "sort"
+
+// Request describes the API call being simulated.
+type Request struct {
+	Action   string              // e.g. "s3:PutObject"
+	Resource string              // resource ARN, any resource if empty
+	Context  map[string][]string // condition keys, e.g. {"aws:RequestedRegion": ["eu-west-1"]}
+}
+
+// Decision is the outcome of evaluating a request against an inheritance chain.
+type Decision struct {
+	Allowed bool
+	// The deny statement responsible for an explicit deny.
+	DeniedBy *Rule
+	// The level (root, OU or account) where no policy allows the action (implicit deny).
+	NotAllowedAt *Level
+	// The statement allowing the action at every level, when allowed.
+	AllowedBy []Rule
+	// Condition keys referenced by the evaluated statements but missing from the
+	// request context. The decision assumes they are absent from the real request.
+	MissingKeys []string
+	// Statements matching the request except for conditions whose operators can't
+	// be evaluated (see Conditions.UnsupportedOperators). The decision assumes
+	// they don't apply, so it only holds if their conditions don't match.
+	Unevaluated []Rule
+}
+
+// Evaluate decides whether the request is allowed by the chain (ordered from the
+// root down to the account). Like Organizations does, an explicit deny anywhere in
+// the chain wins, otherwise every level must have a policy allowing the request.
+func Evaluate(chain []Level, request Request) Decision {
+	var decision Decision
+	missing := map[string]bool{}
+
+	applies := func(level *Level, policy Policy, statement Statement) bool {
+		if !statement.MatchesAction(request.Action) || !statement.matchesResource(request.Resource) {
+			return false
+		}
+		matches, keys, unevaluated := statement.Condition.evaluate(request.Context)
+		for _, key := range keys {
+			missing[key] = true
+		}
+		if matches && len(unevaluated) > 0 {
+			decision.Unevaluated = append(decision.Unevaluated, newRule(level, policy, statement))
+			return false
+		}
+		return matches
+	}
+
+	// Explicit denies first
+	for i := range chain {
+		level := &chain[i]
+		for _, policy := range level.Policies {
+			for _, statement := range policy.Document.Statement {
+				if statement.Effect == Deny && applies(level, policy, statement) && decision.DeniedBy == nil {
+					rule := newRule(level, policy, statement)
+					decision.DeniedBy = &rule
+				}
+			}
+		}
+	}
+
+	// Every level must allow the request
+	if decision.DeniedBy == nil {
+		for i := range chain {
+			level := &chain[i]
+			allowed := false
+			for _, policy := range level.Policies {
+				for _, statement := range policy.Document.Statement {
+					if !allowed && statement.Effect == Allow && applies(level, policy, statement) {
+						decision.AllowedBy = append(decision.AllowedBy, newRule(level, policy, statement))
+						allowed = true
+					}
+				}
+			}
+			if !allowed {
+				decision.NotAllowedAt = level
+				break
+			}
+		}
+		decision.Allowed = decision.NotAllowedAt == nil && len(chain) > 0
+	}
+
+	for key := range missing {
+		decision.MissingKeys = append(decision.MissingKeys, key)
+	}
+	sort.Strings(decision.MissingKeys)
+
+	return decision
+}
+
+// Reports whether the statement applies to the resource. An empty resource stands
+// for any resource, so the Resource element is not taken into account.
+func (s Statement) matchesResource(resource string) bool {
+	if resource == "" {
+		return true
+	}
+	if len(s.NotResource) > 0 {
+		for _, pattern := range s.NotResource {
+			if wildcardMatch(pattern, resource) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(s.Resource) == 0 {
+		return true
+	}
+	for _, pattern := range s.Resource {
+		if wildcardMatch(pattern, resource) {
+			return true
+		}
+	}
+	return false
+}
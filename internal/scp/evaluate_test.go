@@ -0,0 +1,172 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	fullAccessDocument = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`
+	denyLeaveDocument  = `{"Version":"2012-10-17","Statement":[{"Sid":"DenyLeave","Effect":"Deny","Action":"organizations:LeaveOrganization","Resource":"*"}]}`
+	regionsDocument    = `{"Version":"2012-10-17","Statement":[{"Sid":"DenyRegions","Effect":"Deny","NotAction":["iam:*","sts:*"],"Resource":"*","Condition":{"StringNotEquals":{"aws:RequestedRegion":["eu-west-1","us-east-1"]}}}]}`
+	s3OnlyDocument     = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:*","sts:*"],"Resource":"*"}]}`
+	bucketDocument     = `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"s3:DeleteBucket","Resource":"arn:aws:s3:::audit-*"}]}`
+)
+
+// Parses a policy document, failing the test if it is invalid.
+func testPolicy(t *testing.T, name, document string) Policy {
+	t.Helper()
+	parsed, err := Parse(document)
+	if err != nil {
+		t.Fatalf("policy %s: %v", name, err)
+	}
+	return Policy{ID: "p-" + name, Name: name, Document: parsed}
+}
+
+func testLevel(id string, policies ...Policy) Level {
+	return Level{TargetID: id, TargetName: id, Policies: policies}
+}
+
+func TestEvaluate(t *testing.T) {
+	fullAccess := testPolicy(t, "FullAWSAccess", fullAccessDocument)
+	denyLeave := testPolicy(t, "deny-leave", denyLeaveDocument)
+	regions := testPolicy(t, "regions", regionsDocument)
+	s3Only := testPolicy(t, "s3-only", s3OnlyDocument)
+	bucket := testPolicy(t, "audit-buckets", bucketDocument)
+
+	tests := []struct {
+		name         string
+		chain        []Level
+		request      Request
+		wantAllowed  bool
+		wantDeniedBy string // name of the policy
+		wantNotAt    string // level without an allow
+		wantMissing  []string
+	}{
+		{
+			name:        "allowed at every level",
+			chain:       []Level{testLevel("r-root", fullAccess), testLevel("ou-work", fullAccess), testLevel("222222222222", fullAccess)},
+			request:     Request{Action: "s3:PutObject"},
+			wantAllowed: true,
+		},
+		{
+			name:         "explicit deny wins over allow",
+			chain:        []Level{testLevel("r-root", fullAccess), testLevel("ou-work", fullAccess, denyLeave), testLevel("222222222222", fullAccess)},
+			request:      Request{Action: "organizations:LeaveOrganization"},
+			wantDeniedBy: "deny-leave",
+		},
+		{
+			name:      "implicit deny at a level without allow",
+			chain:     []Level{testLevel("r-root", fullAccess), testLevel("ou-work", denyLeave), testLevel("222222222222", fullAccess)},
+			request:   Request{Action: "s3:PutObject"},
+			wantNotAt: "ou-work",
+		},
+		{
+			name:      "allow of another service",
+			chain:     []Level{testLevel("r-root", fullAccess), testLevel("ou-work", s3Only), testLevel("222222222222", fullAccess)},
+			request:   Request{Action: "ec2:RunInstances"},
+			wantNotAt: "ou-work",
+		},
+		{
+			name:         "condition met",
+			chain:        []Level{testLevel("r-root", fullAccess, regions), testLevel("222222222222", fullAccess)},
+			request:      Request{Action: "ec2:RunInstances", Context: map[string][]string{"aws:RequestedRegion": {"ap-south-1"}}},
+			wantDeniedBy: "regions",
+		},
+		{
+			name:        "condition not met",
+			chain:       []Level{testLevel("r-root", fullAccess, regions), testLevel("222222222222", fullAccess)},
+			request:     Request{Action: "ec2:RunInstances", Context: map[string][]string{"aws:RequestedRegion": {"eu-west-1"}}},
+			wantAllowed: true,
+		},
+		{
+			name:        "excluded by NotAction",
+			chain:       []Level{testLevel("r-root", fullAccess, regions), testLevel("222222222222", fullAccess)},
+			request:     Request{Action: "iam:CreateRole", Context: map[string][]string{"aws:RequestedRegion": {"ap-south-1"}}},
+			wantAllowed: true,
+		},
+		{
+			name:         "missing key assumed absent",
+			chain:        []Level{testLevel("r-root", fullAccess, regions), testLevel("222222222222", fullAccess)},
+			request:      Request{Action: "ec2:RunInstances"},
+			wantDeniedBy: "regions",
+			wantMissing:  []string{"aws:RequestedRegion"},
+		},
+		{
+			name:         "resource matched",
+			chain:        []Level{testLevel("r-root", fullAccess, bucket), testLevel("222222222222", fullAccess)},
+			request:      Request{Action: "s3:DeleteBucket", Resource: "arn:aws:s3:::audit-logs"},
+			wantDeniedBy: "audit-buckets",
+		},
+		{
+			name:        "other resource",
+			chain:       []Level{testLevel("r-root", fullAccess, bucket), testLevel("222222222222", fullAccess)},
+			request:     Request{Action: "s3:DeleteBucket", Resource: "arn:aws:s3:::scratch"},
+			wantAllowed: true,
+		},
+		{
+			name:    "empty chain",
+			chain:   nil,
+			request: Request{Action: "s3:PutObject"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Evaluate(tt.chain, tt.request)
+			if decision.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, want %v", decision.Allowed, tt.wantAllowed)
+			}
+
+			deniedBy := ""
+			if decision.DeniedBy != nil {
+				deniedBy = decision.DeniedBy.PolicyName
+			}
+			if deniedBy != tt.wantDeniedBy {
+				t.Errorf("DeniedBy = %q, want %q", deniedBy, tt.wantDeniedBy)
+			}
+
+			notAt := ""
+			if decision.NotAllowedAt != nil {
+				notAt = decision.NotAllowedAt.TargetID
+			}
+			if notAt != tt.wantNotAt {
+				t.Errorf("NotAllowedAt = %q, want %q", notAt, tt.wantNotAt)
+			}
+
+			if tt.wantAllowed && len(decision.AllowedBy) != len(tt.chain) {
+				t.Errorf("AllowedBy = %+v, want a statement per level", decision.AllowedBy)
+			}
+			if !reflect.DeepEqual(decision.MissingKeys, tt.wantMissing) {
+				t.Errorf("MissingKeys = %v, want %v", decision.MissingKeys, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestEvaluateUnevaluatedConditions(t *testing.T) {
+	fullAccess := testPolicy(t, "FullAWSAccess", fullAccessDocument)
+	binary := testPolicy(t, "binary", `{"Version":"2012-10-17","Statement":[{"Sid":"DenyBinary","Effect":"Deny","Action":"s3:*","Resource":"*","Condition":{"BinaryEquals":{"aws:SourceIdentity":"QmluYXJ5"}}}]}`)
+	chain := []Level{testLevel("r-root", fullAccess, binary), testLevel("222222222222", fullAccess)}
+
+	t.Run("deny that might apply", func(t *testing.T) {
+		decision := Evaluate(chain, Request{Action: "s3:PutObject"})
+		if !decision.Allowed || decision.DeniedBy != nil {
+			t.Errorf("Allowed = %v, DeniedBy = %+v, want allowed unless the condition matches", decision.Allowed, decision.DeniedBy)
+		}
+		if len(decision.Unevaluated) != 1 || decision.Unevaluated[0].Statement.Sid != "DenyBinary" {
+			t.Errorf("Unevaluated = %+v, want the DenyBinary statement", decision.Unevaluated)
+		}
+	})
+
+	t.Run("deny of another action", func(t *testing.T) {
+		decision := Evaluate(chain, Request{Action: "ec2:RunInstances"})
+		if !decision.Allowed || len(decision.Unevaluated) > 0 {
+			t.Errorf("Allowed = %v, Unevaluated = %+v, want allowed without unevaluated statements", decision.Allowed, decision.Unevaluated)
+		}
+	})
+}
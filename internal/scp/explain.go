@@ -0,0 +1,70 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+// LevelExplanation lists the statements of a level of the chain matching an action.
+type LevelExplanation struct {
+	Level  *Level
+	Allows []Rule
+	Denies []Rule
+}
+
+// Explanation details how every level of a chain treats an action, regardless of
+// the request context: conditional denies are reported as such instead of being
+// evaluated.
+type Explanation struct {
+	Levels []LevelExplanation // from the root down to the account
+	// The first deny statement matching the action without conditions.
+	DeniedBy *Rule
+	// The first level where no statement allows the action (implicit deny).
+	NotAllowedAt *Level
+	// Deny statements matching the action only under some conditions.
+	ConditionalDenies []Rule
+}
+
+// Explain walks the chain (ordered from the root down to the account) collecting
+// the statements matching the action, on any resource.
+func Explain(chain []Level, action string) Explanation {
+	var explanation Explanation
+
+	for i := range chain {
+		level := &chain[i]
+		matched := LevelExplanation{Level: level}
+		for _, policy := range level.Policies {
+			for _, statement := range policy.Document.Statement {
+				if !statement.MatchesAction(action) {
+					continue
+				}
+				rule := newRule(level, policy, statement)
+				switch statement.Effect {
+				case Allow:
+					matched.Allows = append(matched.Allows, rule)
+				case Deny:
+					matched.Denies = append(matched.Denies, rule)
+					switch {
+					case statement.Conditional() || !statement.OnEveryResource():
+						explanation.ConditionalDenies = append(explanation.ConditionalDenies, rule)
+					case explanation.DeniedBy == nil:
+						denied := rule
+						explanation.DeniedBy = &denied
+					}
+				}
+			}
+		}
+
+		if len(matched.Allows) == 0 && explanation.NotAllowedAt == nil {
+			explanation.NotAllowedAt = level
+		}
+		explanation.Levels = append(explanation.Levels, matched)
+	}
+
+	return explanation
+}
+
+// Allowed reports whether the action is allowed, at least when the conditions of
+// the conditional denies don't match.
+func (e Explanation) Allowed() bool {
+	return e.DeniedBy == nil && e.NotAllowedAt == nil && len(e.Levels) > 0
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Severities of the lint findings.
+const (
+	Error   = "error"
+	Warning = "warning"
+	Info    = "info"
+)
+
+// MaxStatementSize is the recommended maximum size of a statement, in characters
+// of its minified JSON. Larger statements are hard to review and eat the 5120
+// characters quota of the policy.
+const MaxStatementSize = 1024
+
+// Finding is a problem found in a policy.
+type Finding struct {
+	Check      string // name of the check that found it
+	Severity   string
+	PolicyID   string
+	PolicyName string
+	Sid        string // statement, or its position if it has no Sid
+	Message    string
+}
+
+// Check is a lint check run on every policy on its own.
+type Check struct {
+	Name string
+	Run  func(policy Policy) []Finding
+}
+
+// Checks are the lint checks run on every policy. Duplicate statements need the
+// inheritance chain, see LintChain.
+var Checks = []Check{
+	{Name: "broad-allow", Run: lintBroadAllow},
+	{Name: "unconditional-deny", Run: lintUnconditionalDeny},
+	{Name: "statement-size", Run: lintStatementSize},
+}
+
+// Allow statements for every action. FullAWSAccess does that on purpose, but
+// customer managed policies should list what they allow.
+func lintBroadAllow(policy Policy) []Finding {
+	var findings []Finding
+	for i, statement := range policy.Document.Statement {
+		if statement.Effect != Allow {
+			continue
+		}
+		switch {
+		case len(statement.NotAction) > 0:
+			findings = append(findings, newFinding("broad-allow", Warning, policy, i, "allows every action except "+strings.Join(statement.NotAction, ", ")+", prefer listing the allowed actions"))
+		case coversAll(statement.Action, "*:*"):
+			findings = append(findings, newFinding("broad-allow", Warning, policy, i, "allows every action (Action: *), prefer listing the allowed services"))
+		}
+	}
+	return findings
+}
+
+// Deny statements on everything (NotAction, "*") or on whole services without a
+// condition. They apply to everyone, break-glass roles included, so a condition
+// (aws:PrincipalArn, aws:RequestedRegion, ...) is expected.
+func lintUnconditionalDeny(policy Policy) []Finding {
+	var findings []Finding
+	for i, statement := range policy.Document.Statement {
+		if statement.Effect != Deny || statement.Conditional() {
+			continue
+		}
+
+		var denied string
+		switch {
+		case len(statement.NotAction) > 0:
+			denied = "every action except " + strings.Join(statement.NotAction, ", ")
+		case coversAll(statement.Action, "*:*"):
+			denied = "every action"
+		default:
+			var services []string
+			for _, action := range statement.Action {
+				if strings.HasSuffix(action, ":*") {
+					services = append(services, action)
+				}
+			}
+			if len(services) == 0 {
+				continue
+			}
+			denied = strings.Join(services, ", ")
+		}
+		findings = append(findings, newFinding("unconditional-deny", Warning, policy, i, fmt.Sprintf("denies %s without a condition, even to break-glass roles (e.g. exempt them with aws:PrincipalArn)", denied)))
+	}
+	return findings
+}
+
+// Statements larger than MaxStatementSize.
+func lintStatementSize(policy Policy) []Finding {
+	var findings []Finding
+	for i, statement := range policy.Document.Statement {
+		data, _ := json.Marshal(statement)
+		if size := len(data); size > MaxStatementSize {
+			findings = append(findings, newFinding("statement-size", Info, policy, i, fmt.Sprintf("statement of %d characters, over the recommended %d: consider splitting it", size, MaxStatementSize)))
+		}
+	}
+	return findings
+}
+
+// LintChain finds the statements repeated in the inheritance chain of an account,
+// ordered from the root down. The findings are reported on the policy closest
+// to the account, as the copy inherited from above already applies.
+func LintChain(chain []Level) []Finding {
+	type occurrence struct {
+		level  string
+		policy Policy
+		index  int
+	}
+
+	var findings []Finding
+	seen := map[string]occurrence{}
+	for _, level := range chain {
+		for _, policy := range level.Policies {
+			for i, statement := range policy.Document.Statement {
+				key := statement.Key()
+				first, ok := seen[key]
+				switch {
+				case !ok:
+					seen[key] = occurrence{level: level.TargetName, policy: policy, index: i}
+				case first.policy.ID == policy.ID && first.index == i:
+					// The same policy attached at several levels
+				default:
+					findings = append(findings, newFinding("duplicate-statement", Warning, policy, i, fmt.Sprintf("same statement as %s of %s, attached to %s", statementLabel(first.policy.Document.Statement[first.index], first.index), first.policy.Name, first.level)))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// Key identifies the content of a statement, regardless of its Sid.
+func (s Statement) Key() string {
+	s.Sid = ""
+	key, _ := json.Marshal(s)
+	return string(key)
+}
+
+func newFinding(check, severity string, policy Policy, index int, message string) Finding {
+	return Finding{
+		Check:      check,
+		Severity:   severity,
+		PolicyID:   policy.ID,
+		PolicyName: policy.Name,
+		Sid:        statementLabel(policy.Document.Statement[index], index),
+		Message:    message,
+	}
+}
+
+// Identifies a statement by its Sid or, if it has none, by its position.
+func statementLabel(statement Statement, index int) string {
+	if statement.Sid != "" {
+		return statement.Sid
+	}
+	return fmt.Sprintf("statement #%d", index+1)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string // check, severity and statement of the findings, in the order of Checks
+	}{
+		{"full access", fullAccessDocument, []string{"broad-allow/warning/statement #1"}},
+		{"allow with NotAction", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`, []string{"broad-allow/warning/statement #1"}},
+		{"allow of a service", s3OnlyDocument, nil},
+		{"deny of an action", denyLeaveDocument, nil},
+		{"conditional deny of everything", regionsDocument, nil},
+		{"unconditional deny of everything", `{"Version":"2012-10-17","Statement":[{"Sid":"All","Effect":"Deny","Action":"*","Resource":"*"}]}`, []string{"unconditional-deny/warning/All"}},
+		{"unconditional deny with NotAction", `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","NotAction":"iam:*","Resource":"*"}]}`, []string{"unconditional-deny/warning/statement #1"}},
+		{"unconditional deny of a service", `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":["s3:*","ec2:RunInstances"],"Resource":"*"}]}`, []string{"unconditional-deny/warning/statement #1"}},
+		{
+			"large statement",
+			`{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":["` + strings.Repeat(`ec2:RunInstances","`, 60) + `ec2:StartInstances"],"Resource":"*"}]}`,
+			[]string{"statement-size/info/statement #1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testPolicy(t, "policy", tt.document)
+			var got []string
+			for _, check := range Checks {
+				for _, finding := range check.Run(policy) {
+					if finding.Check != check.Name || finding.PolicyID != policy.ID || finding.PolicyName != policy.Name {
+						t.Errorf("finding %+v of %s, want it to name the check and the policy", finding, check.Name)
+					}
+					got = append(got, finding.Check+"/"+finding.Severity+"/"+finding.Sid)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintChain(t *testing.T) {
+	fullAccess := testPolicy(t, "FullAWSAccess", fullAccessDocument)
+	denyLeave := testPolicy(t, "deny-leave", denyLeaveDocument)
+	// The statement of deny-leave under another Sid
+	leaveAgain := testPolicy(t, "leave-again", `{"Version":"2012-10-17","Statement":[{"Sid":"Leave","Effect":"Deny","Action":"organizations:LeaveOrganization","Resource":"*"}]}`)
+
+	tests := []struct {
+		name  string
+		chain []Level
+		want  []string
+	}{
+		{
+			name:  "same policy at several levels",
+			chain: []Level{testLevel("r-root", fullAccess, denyLeave), testLevel("ou-work", fullAccess, denyLeave), testLevel("222222222222", fullAccess)},
+		},
+		{
+			name:  "copy below",
+			chain: []Level{testLevel("r-root", fullAccess), testLevel("ou-work", denyLeave), testLevel("222222222222", leaveAgain)},
+			want:  []string{"leave-again: Leave: same statement as DenyLeave of deny-leave, attached to ou-work"},
+		},
+		{
+			name:  "copy at the same level",
+			chain: []Level{testLevel("r-root", fullAccess, denyLeave, leaveAgain)},
+			want:  []string{"leave-again: Leave: same statement as DenyLeave of deny-leave, attached to r-root"},
+		},
+		{
+			name:  "no policies",
+			chain: []Level{testLevel("r-root"), testLevel("222222222222")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, finding := range LintChain(tt.chain) {
+				got = append(got, finding.PolicyName+": "+finding.Sid+": "+finding.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LintChain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
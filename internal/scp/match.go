@@ -0,0 +1,65 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import "strings"
+
+// MatchAction reports whether an action (e.g. "s3:GetObject") matches a pattern
+// from a policy (e.g. "s3:Get*"). Like IAM, matching is case insensitive and
+// supports the "*" and "?" wildcards.
+func MatchAction(pattern, action string) bool {
+	return wildcardMatch(strings.ToLower(pattern), strings.ToLower(action))
+}
+
+// Reports whether action matches any of the patterns.
+func matchAny(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if MatchAction(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether every action matched by pattern q is also matched by
+// pattern p. Wildcards in q are treated as literals, which is exact for the
+// prefix style patterns ("*", "s3:*", "s3:Get*") used in practice.
+func Covers(p, q string) bool {
+	return MatchAction(p, q)
+}
+
+// Iterative glob matching with backtracking on the last "*".
+func wildcardMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, match := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star != -1:
+			p = star + 1
+			match++
+			i = match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Service returns the service prefix of an action or action pattern ("s3" for "s3:GetObject").
+func Service(action string) string {
+	if i := strings.Index(action, ":"); i >= 0 {
+		return strings.ToLower(action[:i])
+	}
+	return strings.ToLower(action)
+}
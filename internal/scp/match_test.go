@@ -0,0 +1,92 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import "testing"
+
+func TestMatchAction(t *testing.T) {
+	tests := []struct {
+		pattern string
+		action  string
+		want    bool
+	}{
+		{"*", "s3:GetObject", true},
+		{"s3:*", "s3:GetObject", true},
+		{"s3:*", "S3:GetObject", true},
+		{"S3:getobject", "s3:GetObject", true},
+		{"s3:Get*", "s3:GetObjectAcl", true},
+		{"s3:Get*", "s3:PutObject", false},
+		{"s3:Get?bject", "s3:GetObject", true},
+		{"s3:Get?bject", "s3:GetObjects", false},
+		{"ec2:*Instances", "ec2:DescribeInstances", true},
+		{"ec2:*Instances", "ec2:DescribeInstanceStatus", false},
+		{"ec2:*Instance*", "ec2:DescribeInstanceStatus", true},
+		{"iam:*", "s3:GetObject", false},
+		{"s3:GetObject", "s3:GetObjectAcl", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchAction(tt.pattern, tt.action); got != tt.want {
+			t.Errorf("MatchAction(%q, %q) = %v, want %v", tt.pattern, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestStatementMatchesAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement Statement
+		action    string
+		want      bool
+	}{
+		{"action", Statement{Action: StringList{"s3:Get*", "s3:List*"}}, "s3:ListBucket", true},
+		{"other action", Statement{Action: StringList{"s3:Get*", "s3:List*"}}, "s3:PutObject", false},
+		{"not action", Statement{NotAction: StringList{"iam:*", "organizations:*"}}, "s3:PutObject", true},
+		{"excluded by not action", Statement{NotAction: StringList{"iam:*", "organizations:*"}}, "iam:CreateUser", false},
+		{"not action wins over action", Statement{Action: StringList{"*"}, NotAction: StringList{"iam:*"}}, "iam:CreateUser", false},
+		{"no action", Statement{}, "s3:PutObject", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.statement.MatchesAction(tt.action); got != tt.want {
+				t.Errorf("MatchesAction(%q) = %v, want %v", tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		p, q string
+		want bool
+	}{
+		{"*", "s3:*", true},
+		{"s3:*", "s3:Get*", true},
+		{"s3:Get*", "s3:*", false},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:*", "ec2:*", false},
+	}
+
+	for _, tt := range tests {
+		if got := Covers(tt.p, tt.q); got != tt.want {
+			t.Errorf("Covers(%q, %q) = %v, want %v", tt.p, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	tests := map[string]string{
+		"s3:GetObject":  "s3",
+		"EC2:Describe*": "ec2",
+		"*":             "*",
+	}
+
+	for action, want := range tests {
+		if got := Service(action); got != want {
+			t.Errorf("Service(%q) = %q, want %q", action, got, want)
+		}
+	}
+}
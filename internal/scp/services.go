@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package scp
+
+import (
+	"slices"
+	"sort"
+)
+
+// ServiceDenial gathers the deny statements of a chain involving a service.
+type ServiceDenial struct {
+	Service string
+	// Some statement denies every action of the service, on every resource and
+	// unconditionally. Otherwise the service is only partially denied.
+	Full    bool
+	Actions []string // denied action patterns of the service
+	Rules   []Rule
+}
+
+// DeniedServices groups deny statements by the services they deny, sorted by
+// service. Statements denying every service ("*" or NotAction) are returned
+// apart, in broad.
+func DeniedServices(denies []Rule) (services []ServiceDenial, broad []Rule) {
+	byService := map[string]*ServiceDenial{}
+	for _, rule := range denies {
+		statement := rule.Statement
+		if len(statement.NotAction) > 0 || coversAll(statement.Action, "*:*") {
+			broad = append(broad, rule)
+			continue
+		}
+
+		for _, action := range statement.Action {
+			name := Service(action)
+			denial, ok := byService[name]
+			if !ok {
+				denial = &ServiceDenial{Service: name}
+				byService[name] = denial
+			}
+			if !slices.Contains(denial.Actions, action) {
+				denial.Actions = append(denial.Actions, action)
+			}
+			if n := len(denial.Rules); n == 0 || denial.Rules[n-1].Statement.Key() != statement.Key() || denial.Rules[n-1].PolicyID != rule.PolicyID {
+				denial.Rules = append(denial.Rules, rule)
+			}
+			if Covers(action, name+":*") && !statement.Conditional() && statement.OnEveryResource() {
+				denial.Full = true
+			}
+		}
+	}
+
+	for _, denial := range byService {
+		services = append(services, *denial)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Service < services[j].Service })
+	return services, broad
+}
+
+// OnEveryResource reports whether the statement applies to every resource.
+func (s Statement) OnEveryResource() bool {
+	return len(s.NotResource) == 0 && (len(s.Resource) == 0 || coversAll(s.Resource, "*"))
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package tagpolicy reads the effective tag policies computed by AWS Organizations,
+// which are the result of merging every tag policy inherited by an account.
+package tagpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tag is the rule enforced by an effective tag policy on a single tag key.
+type Tag struct {
+	// Key is the tag key with the capitalization required by the policy.
+	Key string
+	// Values allowed for the tag, any value if empty.
+	Values []string
+	// Resource types where noncompliant tagging operations are prevented.
+	EnforcedFor []string
+	// Resource types where the tag is reported as required.
+	RequiredFor []string
+}
+
+// Effective is an effective tag policy.
+type Effective struct {
+	Tags []Tag // sorted by key
+}
+
+// Parse reads the content of an effective tag policy. Effective policies don't
+// contain inheritance operators anymore, but values still wrapped in @@assign
+// or @@append (as in the policies themselves) are accepted too, and any other
+// operator is skipped.
+func Parse(content string) (*Effective, error) {
+	var document struct {
+		Tags map[string]json.RawMessage `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		return nil, fmt.Errorf("invalid tag policy: %v", err)
+	}
+
+	effective := &Effective{}
+	for name, raw := range document.Tags {
+		// e.g. @@operators_allowed_for_child_policies next to the tags
+		if strings.HasPrefix(name, "@@") {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("invalid tag %s: %v", name, err)
+		}
+
+		tag := Tag{Key: name}
+		if raw, ok := fields["tag_key"]; ok {
+			keys, err := values(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag_key of tag %s: %v", name, err)
+			}
+			if len(keys) > 0 {
+				tag.Key = keys[0]
+			}
+		}
+
+		var err error
+		if tag.Values, err = values(fields["tag_value"]); err != nil {
+			return nil, fmt.Errorf("invalid tag_value of tag %s: %v", name, err)
+		}
+		if tag.EnforcedFor, err = values(fields["enforced_for"]); err != nil {
+			return nil, fmt.Errorf("invalid enforced_for of tag %s: %v", name, err)
+		}
+		if tag.RequiredFor, err = values(fields["report_required_tag_for"]); err != nil {
+			return nil, fmt.Errorf("invalid report_required_tag_for of tag %s: %v", name, err)
+		}
+		effective.Tags = append(effective.Tags, tag)
+	}
+
+	sort.Slice(effective.Tags, func(i, j int) bool {
+		return strings.ToLower(effective.Tags[i].Key) < strings.ToLower(effective.Tags[j].Key)
+	})
+	return effective, nil
+}
+
+// Reads a field that can be a string, a list of strings or any of them wrapped
+// in the @@assign and @@append operators.
+func values(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var operators map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &operators); err == nil {
+		assigned, err := values(operators["@@assign"])
+		if err != nil {
+			return nil, err
+		}
+		appended, err := values(operators["@@append"])
+		if err != nil {
+			return nil, err
+		}
+		return append(assigned, appended...), nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+
+	var single string
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return nil, err
+	}
+	return []string{single}, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package tagpolicy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Effective
+	}{
+		{
+			name: "effective policy",
+			content: `{"tags":{
+				"costcenter":{"tag_key":"CostCenter","tag_value":["100","200"],"enforced_for":["ec2:instance"],"report_required_tag_for":["ec2:instance","s3:bucket"]},
+				"owner":{"tag_key":"Owner"}
+			}}`,
+			want: &Effective{Tags: []Tag{
+				{Key: "CostCenter", Values: []string{"100", "200"}, EnforcedFor: []string{"ec2:instance"}, RequiredFor: []string{"ec2:instance", "s3:bucket"}},
+				{Key: "Owner"},
+			}},
+		},
+		{
+			name:    "key defaults to the name of the tag",
+			content: `{"tags":{"team":{"tag_value":"payments"}}}`,
+			want:    &Effective{Tags: []Tag{{Key: "team", Values: []string{"payments"}}}},
+		},
+		{
+			name:    "sorted by key regardless of case",
+			content: `{"tags":{"b":{"tag_key":"beta"},"a":{"tag_key":"Alpha"},"c":{"tag_key":"Charlie"}}}`,
+			want:    &Effective{Tags: []Tag{{Key: "Alpha"}, {Key: "beta"}, {Key: "Charlie"}}},
+		},
+		{
+			name:    "no tags",
+			content: `{}`,
+			want:    &Effective{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInheritanceOperators(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Tag
+	}{
+		{
+			name:    "values wrapped in @@assign",
+			content: `{"tags":{"environment":{"tag_key":{"@@assign":"Environment"},"tag_value":{"@@assign":["prod","dev"]},"enforced_for":{"@@assign":"s3:bucket"}}}}`,
+			want:    []Tag{{Key: "Environment", Values: []string{"prod", "dev"}, EnforcedFor: []string{"s3:bucket"}}},
+		},
+		{
+			name:    "@@append adds to @@assign",
+			content: `{"tags":{"environment":{"tag_value":{"@@assign":["prod"],"@@append":["dev","test"]},"report_required_tag_for":{"@@append":"ec2:volume"}}}}`,
+			want:    []Tag{{Key: "environment", Values: []string{"prod", "dev", "test"}, RequiredFor: []string{"ec2:volume"}}},
+		},
+		{
+			name:    "@@remove is skipped",
+			content: `{"tags":{"environment":{"tag_value":{"@@remove":["test"]},"enforced_for":{"@@assign":["s3:bucket"],"@@remove":["ec2:instance"]}}}}`,
+			want:    []Tag{{Key: "environment", EnforcedFor: []string{"s3:bucket"}}},
+		},
+		{
+			name: "operators allowed for child policies at every level",
+			content: `{"tags":{
+				"@@operators_allowed_for_child_policies":["@@none"],
+				"costcenter":{
+					"@@operators_allowed_for_child_policies":["@@append"],
+					"tag_key":{"@@operators_allowed_for_child_policies":["@@none"],"@@assign":"CostCenter"},
+					"tag_value":{"@@operators_allowed_for_child_policies":["@@append"],"@@assign":["100"]}
+				}
+			}}`,
+			want: []Tag{{Key: "CostCenter", Values: []string{"100"}}},
+		},
+		{
+			name:    "nested @@assign",
+			content: `{"tags":{"owner":{"tag_key":{"@@assign":{"@@assign":"Owner"}}}}}`,
+			want:    []Tag{{Key: "Owner"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Tags, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got.Tags, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"invalid document", `{"tags":`, "invalid tag policy: "},
+		{"tag that is not an object", `{"tags":{"owner":["Owner"]}}`, "invalid tag owner: "},
+		{"invalid tag_key", `{"tags":{"owner":{"tag_key":42}}}`, "invalid tag_key of tag owner: "},
+		{"invalid values", `{"tags":{"owner":{"tag_value":42}}}`, "invalid tag_value of tag owner: "},
+		{"invalid @@append", `{"tags":{"owner":{"enforced_for":{"@@assign":["s3:bucket"],"@@append":[true]}}}}`, "invalid enforced_for of tag owner: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.content)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != nil {
+				t.Errorf("Parse() = %+v, want nil", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,508 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package awsorg traverses an AWS organization and resolves the policies that
+// apply to its accounts, so other Go tools can embed policy-scout instead of
+// running the CLI. The CLI itself is built on it.
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	...
+//	scout := awsorg.New(organizations.NewFromConfig(cfg))
+//	tree, err := scout.BuildTree(ctx, "")
+//	...
+//	scps, err := scout.EffectivePolicies(ctx, "123456789012", types.PolicyTypeServiceControlPolicy)
+package awsorg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ariguillegp/policy-scout/internal/orgtree"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// The tree model is the one rendered by the CLI.
+type (
+	Tree   = orgtree.Tree
+	Node   = orgtree.Node
+	Policy = orgtree.Policy
+)
+
+// Kinds of nodes in the tree.
+const (
+	RootNode    = orgtree.RootNode
+	OUNode      = orgtree.OUNode
+	AccountNode = orgtree.AccountNode
+)
+
+// API is the part of the Organizations API used to read the organization.
+// *organizations.Client implements it, awsorgtest.Org is an in-memory fake.
+type API interface {
+	DescribeAccount(ctx context.Context, params *organizations.DescribeAccountInput, optFns ...func(*organizations.Options)) (*organizations.DescribeAccountOutput, error)
+	DescribeOrganization(ctx context.Context, params *organizations.DescribeOrganizationInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error)
+	DescribeOrganizationalUnit(ctx context.Context, params *organizations.DescribeOrganizationalUnitInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error)
+	ListRoots(ctx context.Context, params *organizations.ListRootsInput, optFns ...func(*organizations.Options)) (*organizations.ListRootsOutput, error)
+	ListAccounts(ctx context.Context, params *organizations.ListAccountsInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error)
+	ListChildren(ctx context.Context, params *organizations.ListChildrenInput, optFns ...func(*organizations.Options)) (*organizations.ListChildrenOutput, error)
+	ListParents(ctx context.Context, params *organizations.ListParentsInput, optFns ...func(*organizations.Options)) (*organizations.ListParentsOutput, error)
+	ListPoliciesForTarget(ctx context.Context, params *organizations.ListPoliciesForTargetInput, optFns ...func(*organizations.Options)) (*organizations.ListPoliciesForTargetOutput, error)
+}
+
+// Cache keeps the results of the API calls made by a Scout, as JSON documents
+// keyed by call and arguments, e.g. "children/ou-ab12-cdef3456/ACCOUNT".
+// Implementations must be safe for concurrent use. The CLI persists its cache,
+// to resume interrupted scans and to answer from a warm cache.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// Scout reads an organization with the Organizations API. Results are kept
+// in its Cache, create a new Scout (or use a new Cache) to read fresh data.
+type Scout struct {
+	client API
+
+	// Cache keeps the results of the API calls, in memory unless replaced
+	// before the first call.
+	Cache Cache
+
+	// Exclude, if set, leaves accounts and OUs out of the results. Excluded
+	// OUs are left out along with everything below them.
+	Exclude func(ctx context.Context, id string) (bool, error)
+
+	// Decorate, if set, is called on every node created, e.g. to add the
+	// documents of its policies or the policies of other types.
+	Decorate func(ctx context.Context, node *Node) error
+
+	// The organization and its root never change, they are not cached
+	mu     sync.Mutex
+	org    *types.Organization
+	rootID string
+}
+
+// New creates a Scout reading the organization with client. The credentials of
+// an *organizations.Client must be the ones of the management account or of a
+// delegated administrator.
+func New(client API) *Scout {
+	return &Scout{client: client, Cache: &memoryCache{entries: map[string][]byte{}}}
+}
+
+// BuildTree builds the tree below startID (the ID of the root or of an OU, the
+// root if empty), every node along with the SCPs applied to it.
+func (s *Scout) BuildTree(ctx context.Context, startID string) (*Tree, error) {
+	org, err := s.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if startID == "" {
+		if startID, err = s.RootID(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := s.buildSubtree(ctx, startID)
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{OrganizationID: *org.Id, Root: root}, nil
+}
+
+// BuildAccountPath builds the tree holding only the path from startID (the
+// root if empty) down to accountID. The tree is nil when the account is not
+// below startID, or is excluded.
+func (s *Scout) BuildAccountPath(ctx context.Context, startID, accountID string) (*Tree, error) {
+	org, err := s.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path, err := s.FindAccountPath(ctx, startID, accountID)
+	if err != nil || path == nil {
+		return nil, err
+	}
+
+	var root, parent *Node
+	for _, id := range path {
+		node, err := s.newNode(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			root = node
+		} else {
+			parent.Children = append(parent.Children, node)
+		}
+		parent = node
+	}
+	return &Tree{OrganizationID: *org.Id, Root: root}, nil
+}
+
+// FindAccountPath returns the IDs from startID (the root if empty) down to
+// accountID, both included. The path is nil when the account is not below
+// startID, or is excluded.
+func (s *Scout) FindAccountPath(ctx context.Context, startID, accountID string) ([]string, error) {
+	if startID == "" {
+		var err error
+		if startID, err = s.RootID(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Breadth first, accounts usually hang from the upper levels
+	queue := [][]string{{startID}}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		parentID := path[len(path)-1]
+
+		accounts, err := s.Children(ctx, parentID, types.ChildTypeAccount)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range accounts {
+			if id != accountID {
+				continue
+			}
+			if excluded, err := s.excluded(ctx, id); err != nil || excluded {
+				return nil, err
+			}
+			return append(append([]string{}, path...), id), nil
+		}
+
+		ous, err := s.Children(ctx, parentID, types.ChildTypeOrganizationalUnit)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ous {
+			excluded, err := s.excluded(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if !excluded {
+				queue = append(queue, append(append([]string{}, path...), id))
+			}
+		}
+	}
+	return nil, nil
+}
+
+// EffectivePolicies returns the policies of policyType applied to targetID,
+// directly or inherited from its OUs and the root. The ones attached closer to
+// the target come first, and every policy is returned once.
+func (s *Scout) EffectivePolicies(ctx context.Context, targetID string, policyType types.PolicyType) ([]Policy, error) {
+	var policies []Policy
+	seen := map[string]bool{}
+	for id := targetID; id != ""; {
+		direct, err := s.DirectPolicies(ctx, id, policyType)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range direct {
+			if !seen[policy.ID] {
+				seen[policy.ID] = true
+				policies = append(policies, policy)
+			}
+		}
+
+		if strings.HasPrefix(id, "r-") {
+			break
+		}
+		if id, err = s.ParentID(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// Organization describes the organization: its ID, management account and
+// feature set.
+func (s *Scout) Organization(ctx context.Context) (*types.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.org != nil {
+		return s.org, nil
+	}
+
+	result, err := s.client.DescribeOrganization(ctx, &organizations.DescribeOrganizationInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error describing organization: %w", err)
+	}
+	s.org = result.Organization
+	return s.org, nil
+}
+
+// RootID returns the ID of the root of the organization.
+func (s *Scout) RootID(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rootID != "" {
+		return s.rootID, nil
+	}
+
+	result, err := s.client.ListRoots(ctx, &organizations.ListRootsInput{})
+	if err != nil {
+		return "", fmt.Errorf("error listing roots: %w", err)
+	}
+	if len(result.Roots) == 0 {
+		return "", fmt.Errorf("the organization has no root")
+	}
+	s.rootID = *result.Roots[0].Id
+	return s.rootID, nil
+}
+
+// Name returns the name of the root ("Root"), of an OU or of an account.
+func (s *Scout) Name(ctx context.Context, id string) (string, error) {
+	switch {
+	case strings.HasPrefix(id, "r-"):
+		return "Root", nil
+	case strings.HasPrefix(id, "ou-"):
+		ou, err := s.OU(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return *ou.Name, nil
+	default:
+		account, err := s.Account(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return *account.Name, nil
+	}
+}
+
+// OU describes an OU.
+func (s *Scout) OU(ctx context.Context, id string) (types.OrganizationalUnit, error) {
+	var ou types.OrganizationalUnit
+	if s.load("ou/"+id, &ou) {
+		return ou, nil
+	}
+
+	result, err := s.client.DescribeOrganizationalUnit(ctx, &organizations.DescribeOrganizationalUnitInput{OrganizationalUnitId: &id})
+	if err != nil {
+		return ou, fmt.Errorf("error getting OU %s: %w", id, err)
+	}
+	s.store("ou/"+id, result.OrganizationalUnit)
+	return *result.OrganizationalUnit, nil
+}
+
+// Account describes an account: its name, email and status.
+func (s *Scout) Account(ctx context.Context, id string) (types.Account, error) {
+	var account types.Account
+	if s.load("account/"+id, &account) {
+		return account, nil
+	}
+
+	result, err := s.client.DescribeAccount(ctx, &organizations.DescribeAccountInput{AccountId: &id})
+	if err != nil {
+		return account, fmt.Errorf("error getting account %s: %w", id, err)
+	}
+	s.store("account/"+id, result.Account)
+	return *result.Account, nil
+}
+
+// Accounts lists every account of the organization. It takes far fewer calls
+// than describing the accounts one by one, and the accounts are cached for
+// Account and Name.
+func (s *Scout) Accounts(ctx context.Context) ([]types.Account, error) {
+	var accounts []types.Account
+	paginator := organizations.NewListAccountsPaginator(s.client, &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing accounts: %w", err)
+		}
+		for _, account := range page.Accounts {
+			s.store("account/"+*account.Id, account)
+		}
+		accounts = append(accounts, page.Accounts...)
+	}
+	return accounts, nil
+}
+
+// Children lists the IDs of the accounts or OUs directly below parentID, in
+// the order of the API. Excluded children are listed as well.
+func (s *Scout) Children(ctx context.Context, parentID string, childType types.ChildType) ([]string, error) {
+	key := "children/" + parentID + "/" + string(childType)
+	var ids []string
+	if s.load(key, &ids) {
+		return ids, nil
+	}
+
+	paginator := organizations.NewListChildrenPaginator(s.client, &organizations.ListChildrenInput{ParentId: &parentID, ChildType: childType})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing children of %s: %w", parentID, err)
+		}
+		for _, child := range page.Children {
+			ids = append(ids, *child.Id)
+		}
+	}
+
+	s.store(key, ids)
+	for _, id := range ids {
+		s.store("parent/"+id, parentID)
+	}
+	return ids, nil
+}
+
+// ParentID returns the ID of the parent of an account or OU, an OU or the
+// root. Accounts and OUs have exactly one parent.
+func (s *Scout) ParentID(ctx context.Context, childID string) (string, error) {
+	var id string
+	if s.load("parent/"+childID, &id) {
+		return id, nil
+	}
+
+	result, err := s.client.ListParents(ctx, &organizations.ListParentsInput{ChildId: &childID})
+	if err != nil {
+		return "", fmt.Errorf("error listing parents of %s: %w", childID, err)
+	}
+	if len(result.Parents) == 0 {
+		return "", fmt.Errorf("%s has no parent", childID)
+	}
+
+	s.store("parent/"+childID, *result.Parents[0].Id)
+	return *result.Parents[0].Id, nil
+}
+
+// DirectPolicies lists the policies of policyType directly attached to
+// targetID, the root, an OU or an account.
+func (s *Scout) DirectPolicies(ctx context.Context, targetID string, policyType types.PolicyType) ([]Policy, error) {
+	key := "policies/" + string(policyType) + "/" + targetID
+	var policies []Policy
+	if s.load(key, &policies) {
+		return policies, nil
+	}
+
+	paginator := organizations.NewListPoliciesForTargetPaginator(s.client, &organizations.ListPoliciesForTargetInput{TargetId: &targetID, Filter: policyType})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s policies of %s: %w", policyType, targetID, err)
+		}
+		for _, policy := range page.Policies {
+			policies = append(policies, Policy{ID: *policy.Id, Name: *policy.Name, ARN: *policy.Arn})
+		}
+	}
+
+	s.store(key, policies)
+	return policies, nil
+}
+
+// Recursively builds the node of parentID and the nodes below it.
+func (s *Scout) buildSubtree(ctx context.Context, parentID string) (*Node, error) {
+	parent, err := s.newNode(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, childType := range []types.ChildType{types.ChildTypeAccount, types.ChildTypeOrganizationalUnit} {
+		ids, err := s.Children(ctx, parentID, childType)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			excluded, err := s.excluded(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if excluded {
+				continue
+			}
+
+			var child *Node
+			if childType == types.ChildTypeAccount {
+				child, err = s.newNode(ctx, id)
+			} else {
+				child, err = s.buildSubtree(ctx, id)
+			}
+			if err != nil {
+				return nil, err
+			}
+			parent.Children = append(parent.Children, child)
+		}
+	}
+	return parent, nil
+}
+
+// Creates the node of a single entity, without its children.
+func (s *Scout) newNode(ctx context.Context, id string) (*Node, error) {
+	name, err := s.Name(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	scps, err := s.EffectivePolicies(ctx, id, types.PolicyTypeServiceControlPolicy)
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{ID: id, Name: name, SCPs: scps}
+
+	switch {
+	case strings.HasPrefix(id, "r-"):
+		node.Type = RootNode
+	case strings.HasPrefix(id, "ou-"):
+		node.Type = OUNode
+	default:
+		node.Type = AccountNode
+		account, err := s.Account(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		org, err := s.Organization(ctx)
+		if err != nil {
+			return nil, err
+		}
+		node.Status = string(account.Status)
+		node.ManagementAccount = id == *org.MasterAccountId
+	}
+
+	if s.Decorate != nil {
+		if err := s.Decorate(ctx, node); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (s *Scout) excluded(ctx context.Context, id string) (bool, error) {
+	if s.Exclude == nil {
+		return false, nil
+	}
+	return s.Exclude(ctx, id)
+}
+
+// Reads a cached result into value, entries that don't decode are misses.
+func (s *Scout) load(key string, value any) bool {
+	data, ok := s.Cache.Get(key)
+	return ok && json.Unmarshal(data, value) == nil
+}
+
+func (s *Scout) store(key string, value any) {
+	if data, err := json.Marshal(value); err == nil {
+		s.Cache.Set(key, data)
+	}
+}
+
+// The cache of a Scout created with New.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+func (c *memoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
@@ -0,0 +1,326 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+package awsorg_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ariguillegp/policy-scout/pkg/awsorg"
+	"github.com/ariguillegp/policy-scout/pkg/awsorg/awsorgtest"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// An organization with two levels of OUs, a suspended account and SCPs at
+// every level, FullAWSAccess being attached twice on the way to payments.
+func newTestOrg() *awsorgtest.Org {
+	return awsorgtest.New("o-example", "r-root", "111111111111").
+		AddAccount("r-root", "111111111111", "management", types.AccountStatusActive).
+		AddOU("r-root", "ou-root-work", "Workloads").
+		AddOU("ou-root-work", "ou-work-prod", "Production").
+		AddAccount("ou-root-work", "333333333333", "legacy", types.AccountStatusSuspended).
+		AddAccount("ou-work-prod", "222222222222", "payments", types.AccountStatusActive).
+		AddAccount("ou-work-prod", "444444444444", "checkout", types.AccountStatusActive).
+		AddOU("r-root", "ou-root-sand", "Sandbox").
+		AddPolicy("p-full", "FullAWSAccess", types.PolicyTypeServiceControlPolicy, "{}").
+		AddPolicy("p-leave", "deny-leave", types.PolicyTypeServiceControlPolicy, "{}").
+		AddPolicy("p-region", "deny-regions", types.PolicyTypeServiceControlPolicy, "{}").
+		AddPolicy("p-tags", "cost-center", types.PolicyTypeTagPolicy, "{}").
+		AttachPolicy("r-root", "p-full").
+		AttachPolicy("ou-root-work", "p-leave").
+		AttachPolicy("ou-root-work", "p-tags").
+		AttachPolicy("ou-work-prod", "p-region").
+		AttachPolicy("ou-root-sand", "p-leave").
+		AttachPolicy("222222222222", "p-full")
+}
+
+// Describes the nodes of a tree, one per line: its depth, type, ID, name,
+// status and SCPs, e.g. "  account 222222222222 payments ACTIVE [deny-regions ...]".
+func describeTree(t *testing.T, tree *awsorg.Tree) []string {
+	t.Helper()
+	if tree == nil {
+		return nil
+	}
+	var lines []string
+	err := tree.Root.Walk(func(node *awsorg.Node, depth int) error {
+		line := fmt.Sprintf("%s%s %s %s", strings.Repeat("  ", depth), node.Type, node.ID, node.Name)
+		if node.Status != "" {
+			line += " " + node.Status
+		}
+		if node.ManagementAccount {
+			line += " (management)"
+		}
+		lines = append(lines, fmt.Sprintf("%s %v", line, policyNames(node.SCPs)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func policyNames(policies []awsorg.Policy) []string {
+	names := []string{}
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+	}
+	return names
+}
+
+// Excludes the accounts and OUs of ids.
+func excluding(ids ...string) func(ctx context.Context, id string) (bool, error) {
+	return func(_ context.Context, id string) (bool, error) {
+		for _, excluded := range ids {
+			if id == excluded {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	tests := []struct {
+		name     string
+		startID  string
+		exclude  []string
+		pageSize int
+		want     []string
+	}{
+		{
+			name: "whole organization",
+			want: []string{
+				"root r-root Root [FullAWSAccess]",
+				"  account 111111111111 management ACTIVE (management) [FullAWSAccess]",
+				"  ou ou-root-work Workloads [deny-leave FullAWSAccess]",
+				"    account 333333333333 legacy SUSPENDED [deny-leave FullAWSAccess]",
+				"    ou ou-work-prod Production [deny-regions deny-leave FullAWSAccess]",
+				"      account 222222222222 payments ACTIVE [FullAWSAccess deny-regions deny-leave]",
+				"      account 444444444444 checkout ACTIVE [deny-regions deny-leave FullAWSAccess]",
+				"  ou ou-root-sand Sandbox [deny-leave FullAWSAccess]",
+			},
+		},
+		{
+			name:    "OU subtree",
+			startID: "ou-work-prod",
+			want: []string{
+				"ou ou-work-prod Production [deny-regions deny-leave FullAWSAccess]",
+				"  account 222222222222 payments ACTIVE [FullAWSAccess deny-regions deny-leave]",
+				"  account 444444444444 checkout ACTIVE [deny-regions deny-leave FullAWSAccess]",
+			},
+		},
+		{
+			name:    "excluded OU and account",
+			exclude: []string{"ou-work-prod", "111111111111"},
+			want: []string{
+				"root r-root Root [FullAWSAccess]",
+				"  ou ou-root-work Workloads [deny-leave FullAWSAccess]",
+				"    account 333333333333 legacy SUSPENDED [deny-leave FullAWSAccess]",
+				"  ou ou-root-sand Sandbox [deny-leave FullAWSAccess]",
+			},
+		},
+		{
+			name:     "one child and one policy per page",
+			pageSize: 1,
+			want: []string{
+				"root r-root Root [FullAWSAccess]",
+				"  account 111111111111 management ACTIVE (management) [FullAWSAccess]",
+				"  ou ou-root-work Workloads [deny-leave FullAWSAccess]",
+				"    account 333333333333 legacy SUSPENDED [deny-leave FullAWSAccess]",
+				"    ou ou-work-prod Production [deny-regions deny-leave FullAWSAccess]",
+				"      account 222222222222 payments ACTIVE [FullAWSAccess deny-regions deny-leave]",
+				"      account 444444444444 checkout ACTIVE [deny-regions deny-leave FullAWSAccess]",
+				"  ou ou-root-sand Sandbox [deny-leave FullAWSAccess]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := newTestOrg()
+			org.PageSize = tt.pageSize
+			scout := awsorg.New(org)
+			scout.Exclude = excluding(tt.exclude...)
+
+			tree, err := scout.BuildTree(context.Background(), tt.startID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tree.OrganizationID != "o-example" {
+				t.Errorf("OrganizationID = %q, want o-example", tree.OrganizationID)
+			}
+			if got := describeTree(t, tree); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildTree(%q) =\n%s\nwant:\n%s", tt.startID, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestBuildAccountPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		startID   string
+		accountID string
+		exclude   []string
+		want      []string
+	}{
+		{
+			name:      "account below the root",
+			accountID: "111111111111",
+			want: []string{
+				"root r-root Root [FullAWSAccess]",
+				"  account 111111111111 management ACTIVE (management) [FullAWSAccess]",
+			},
+		},
+		{
+			name:      "nested account",
+			accountID: "444444444444",
+			want: []string{
+				"root r-root Root [FullAWSAccess]",
+				"  ou ou-root-work Workloads [deny-leave FullAWSAccess]",
+				"    ou ou-work-prod Production [deny-regions deny-leave FullAWSAccess]",
+				"      account 444444444444 checkout ACTIVE [deny-regions deny-leave FullAWSAccess]",
+			},
+		},
+		{
+			name:      "from an OU",
+			startID:   "ou-root-work",
+			accountID: "333333333333",
+			want: []string{
+				"ou ou-root-work Workloads [deny-leave FullAWSAccess]",
+				"  account 333333333333 legacy SUSPENDED [deny-leave FullAWSAccess]",
+			},
+		},
+		{
+			name:      "account outside the OU",
+			startID:   "ou-root-sand",
+			accountID: "222222222222",
+		},
+		{
+			name:      "unknown account",
+			accountID: "999999999999",
+		},
+		{
+			name:      "account below an excluded OU",
+			accountID: "222222222222",
+			exclude:   []string{"ou-work-prod"},
+		},
+		{
+			name:      "excluded account",
+			accountID: "333333333333",
+			exclude:   []string{"333333333333"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scout := awsorg.New(newTestOrg())
+			scout.Exclude = excluding(tt.exclude...)
+
+			tree, err := scout.BuildAccountPath(context.Background(), tt.startID, tt.accountID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeTree(t, tree); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildAccountPath(%q, %q) =\n%s\nwant:\n%s", tt.startID, tt.accountID, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestEffectivePolicies(t *testing.T) {
+	tests := []struct {
+		targetID   string
+		policyType types.PolicyType
+		want       []string
+	}{
+		{"r-root", types.PolicyTypeServiceControlPolicy, []string{"FullAWSAccess"}},
+		{"ou-root-sand", types.PolicyTypeServiceControlPolicy, []string{"deny-leave", "FullAWSAccess"}},
+		// Closest first, FullAWSAccess is attached to the account and to the root
+		{"222222222222", types.PolicyTypeServiceControlPolicy, []string{"FullAWSAccess", "deny-regions", "deny-leave"}},
+		{"444444444444", types.PolicyTypeServiceControlPolicy, []string{"deny-regions", "deny-leave", "FullAWSAccess"}},
+		{"444444444444", types.PolicyTypeTagPolicy, []string{"cost-center"}},
+		{"111111111111", types.PolicyTypeTagPolicy, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.targetID+"/"+string(tt.policyType), func(t *testing.T) {
+			policies, err := awsorg.New(newTestOrg()).EffectivePolicies(context.Background(), tt.targetID, tt.policyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := policyNames(policies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EffectivePolicies(%s, %s) = %v, want %v", tt.targetID, tt.policyType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectivePoliciesOfUnknownTarget(t *testing.T) {
+	_, err := awsorg.New(newTestOrg()).EffectivePolicies(context.Background(), "999999999999", types.PolicyTypeServiceControlPolicy)
+	if err == nil {
+		t.Fatal("EffectivePolicies of an unknown account succeeded")
+	}
+}
+
+// A cache counting the hits, so tests can tell which results were reused.
+type countingCache struct {
+	entries map[string][]byte
+	hits    int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	value, ok := c.entries[key]
+	if ok {
+		c.hits++
+	}
+	return value, ok
+}
+
+func (c *countingCache) Set(key string, value []byte) {
+	c.entries[key] = value
+}
+
+func TestCacheIsShared(t *testing.T) {
+	ctx := context.Background()
+	cache := &countingCache{entries: map[string][]byte{}}
+	first := awsorg.New(newTestOrg())
+	first.Cache = cache
+	want, err := first.BuildTree(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Scout of an organization without any account, answering from the cache
+	second := awsorg.New(awsorgtest.New("o-example", "r-root", "111111111111"))
+	second.Cache = cache
+	cache.hits = 0
+	got, err := second.BuildTree(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(describeTree(t, got), describeTree(t, want)) {
+		t.Errorf("tree built from the cache =\n%s\nwant:\n%s", strings.Join(describeTree(t, got), "\n"), strings.Join(describeTree(t, want), "\n"))
+	}
+	if cache.hits == 0 {
+		t.Error("the second Scout didn't use the cache")
+	}
+}
+
+func TestName(t *testing.T) {
+	scout := awsorg.New(newTestOrg())
+	for id, want := range map[string]string{"r-root": "Root", "ou-work-prod": "Production", "333333333333": "legacy"} {
+		got, err := scout.Name(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Name(%s) = %q, want %q", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+/*
+Copyright © 2024 Aristides Gonzalez <aristides@glezpol.com>
+*/
+
+// Package awsorgtest provides an in-memory organization implementing
+// awsorg.API, along with the other read-only Organizations operations used by
+// policy-scout, so the code reading organizations can be tested without AWS.
+//
+//	org := awsorgtest.New("o-example", "r-root", "111111111111")
+//	org.AddAccount("r-root", "111111111111", "management", types.AccountStatusActive)
+//	org.AddOU("r-root", "ou-root-prod", "Production")
+//	org.AddAccount("ou-root-prod", "222222222222", "payments", types.AccountStatusActive)
+//	org.AddPolicy("p-deny", "deny-leave", types.PolicyTypeServiceControlPolicy, document)
+//	org.AttachPolicy("ou-root-prod", "p-deny")
+//	tree, err := awsorg.New(org).BuildTree(ctx, "")
+package awsorgtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// Org is an organization kept in memory. Children and policies are listed in
+// the order they were added, in a single page unless PageSize is set.
+type Org struct {
+	// Number of children and policies listed per page by ListChildren and
+	// ListPoliciesForTarget, every one of them in a single page if 0
+	PageSize int
+
+	mu                  sync.Mutex
+	id                  string
+	rootID              string
+	managementAccountID string
+	parents             map[string]string // every OU and account, by ID
+	ous                 map[string]types.OrganizationalUnit
+	accounts            map[string]types.Account
+	children            map[string][]types.Child
+	policies            map[string]types.Policy
+	attachments         map[string][]string          // policy IDs, by target ID
+	tags                map[string]map[string]string // tags, by resource ID
+}
+
+// New creates an organization with only a root. The management account must be
+// added to it like any other account.
+func New(id, rootID, managementAccountID string) *Org {
+	return &Org{
+		id:                  id,
+		rootID:              rootID,
+		managementAccountID: managementAccountID,
+		parents:             map[string]string{},
+		ous:                 map[string]types.OrganizationalUnit{},
+		accounts:            map[string]types.Account{},
+		children:            map[string][]types.Child{},
+		policies:            map[string]types.Policy{},
+		attachments:         map[string][]string{},
+		tags:                map[string]map[string]string{},
+	}
+}
+
+// AddOU adds an OU below parentID, the root or another OU.
+func (o *Org) AddOU(parentID, id, name string) *Org {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ous[id] = types.OrganizationalUnit{
+		Id:   aws.String(id),
+		Name: aws.String(name),
+		Arn:  aws.String(fmt.Sprintf("arn:aws:organizations::%s:ou/%s/%s", o.managementAccountID, o.id, id)),
+	}
+	o.addChild(parentID, id, types.ChildTypeOrganizationalUnit)
+	return o
+}
+
+// AddAccount adds an account below parentID, the root or an OU.
+func (o *Org) AddAccount(parentID, id, name string, status types.AccountStatus) *Org {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.accounts[id] = types.Account{
+		Id:     aws.String(id),
+		Name:   aws.String(name),
+		Email:  aws.String(fmt.Sprintf("aws+%s@example.com", id)),
+		Arn:    aws.String(fmt.Sprintf("arn:aws:organizations::%s:account/%s/%s", o.managementAccountID, o.id, id)),
+		Status: status,
+	}
+	o.addChild(parentID, id, types.ChildTypeAccount)
+	return o
+}
+
+// AddPolicy creates a policy with its document, without attaching it.
+func (o *Org) AddPolicy(id, name string, policyType types.PolicyType, content string) *Org {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.policies[id] = types.Policy{
+		Content: aws.String(content),
+		PolicySummary: &types.PolicySummary{
+			Id:   aws.String(id),
+			Name: aws.String(name),
+			Arn:  aws.String(fmt.Sprintf("arn:aws:organizations::%s:policy/%s/%s/%s", o.managementAccountID, o.id, strings.ToLower(string(policyType)), id)),
+			Type: policyType,
+		},
+	}
+	return o
+}
+
+// AttachPolicy attaches a policy created with AddPolicy to targetID, the root,
+// an OU or an account.
+func (o *Org) AttachPolicy(targetID, policyID string) *Org {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.attachments[targetID] = append(o.attachments[targetID], policyID)
+	return o
+}
+
+// SetEmail replaces the email of an account added with AddAccount,
+// aws+<id>@example.com by default.
+func (o *Org) SetEmail(accountID, email string) *Org {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	account := o.accounts[accountID]
+	account.Email = aws.String(email)
+	o.accounts[accountID] = account
+	return o
+}
+
+// TagResource sets a tag on the root, an OU or an account.
+func (o *Org) TagResource(id, key, value string) *Org {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.tags[id] == nil {
+		o.tags[id] = map[string]string{}
+	}
+	o.tags[id][key] = value
+	return o
+}
+
+func (o *Org) addChild(parentID, id string, childType types.ChildType) {
+	o.parents[id] = parentID
+	o.children[parentID] = append(o.children[parentID], types.Child{Id: aws.String(id), Type: childType})
+}
+
+// Whether id is the root or one of the OUs and accounts of the organization.
+func (o *Org) exists(id string) bool {
+	_, ok := o.parents[id]
+	return ok || id == o.rootID
+}
+
+// DescribeOrganization implements awsorg.API.
+func (o *Org) DescribeOrganization(_ context.Context, _ *organizations.DescribeOrganizationInput, _ ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error) {
+	return &organizations.DescribeOrganizationOutput{Organization: &types.Organization{
+		Id:              aws.String(o.id),
+		MasterAccountId: aws.String(o.managementAccountID),
+		FeatureSet:      types.OrganizationFeatureSetAll,
+	}}, nil
+}
+
+// DescribeOrganizationalUnit implements awsorg.API.
+func (o *Org) DescribeOrganizationalUnit(_ context.Context, params *organizations.DescribeOrganizationalUnitInput, _ ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ou, ok := o.ous[aws.ToString(params.OrganizationalUnitId)]
+	if !ok {
+		return nil, &types.OrganizationalUnitNotFoundException{Message: aws.String("OU not found: " + aws.ToString(params.OrganizationalUnitId))}
+	}
+	return &organizations.DescribeOrganizationalUnitOutput{OrganizationalUnit: &ou}, nil
+}
+
+// DescribeAccount implements awsorg.API.
+func (o *Org) DescribeAccount(_ context.Context, params *organizations.DescribeAccountInput, _ ...func(*organizations.Options)) (*organizations.DescribeAccountOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	account, ok := o.accounts[aws.ToString(params.AccountId)]
+	if !ok {
+		return nil, &types.AccountNotFoundException{Message: aws.String("account not found: " + aws.ToString(params.AccountId))}
+	}
+	return &organizations.DescribeAccountOutput{Account: &account}, nil
+}
+
+// ListRoots implements awsorg.API.
+func (o *Org) ListRoots(_ context.Context, _ *organizations.ListRootsInput, _ ...func(*organizations.Options)) (*organizations.ListRootsOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return &organizations.ListRootsOutput{Roots: []types.Root{{
+		Id:          aws.String(o.rootID),
+		Name:        aws.String("Root"),
+		Arn:         aws.String(fmt.Sprintf("arn:aws:organizations::%s:root/%s/%s", o.managementAccountID, o.id, o.rootID)),
+		PolicyTypes: o.enabledPolicyTypes(),
+	}}}, nil
+}
+
+// The policy types of the policies added are the ones enabled in the root.
+func (o *Org) enabledPolicyTypes() []types.PolicyTypeSummary {
+	var enabled []types.PolicyTypeSummary
+	for _, id := range sortedKeys(o.policies) {
+		policyType := o.policies[id].PolicySummary.Type
+		if !slices.ContainsFunc(enabled, func(summary types.PolicyTypeSummary) bool { return summary.Type == policyType }) {
+			enabled = append(enabled, types.PolicyTypeSummary{Type: policyType, Status: types.PolicyTypeStatusEnabled})
+		}
+	}
+	return enabled
+}
+
+// ListAccounts implements awsorg.API.
+func (o *Org) ListAccounts(_ context.Context, _ *organizations.ListAccountsInput, _ ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	output := &organizations.ListAccountsOutput{}
+	o.walk(o.rootID, func(child types.Child) {
+		if child.Type == types.ChildTypeAccount {
+			output.Accounts = append(output.Accounts, o.accounts[*child.Id])
+		}
+	})
+	return output, nil
+}
+
+// Calls fn for every child below parentID, in the order they were added.
+func (o *Org) walk(parentID string, fn func(child types.Child)) {
+	for _, child := range o.children[parentID] {
+		fn(child)
+		o.walk(*child.Id, fn)
+	}
+}
+
+// ListChildren implements awsorg.API.
+func (o *Org) ListChildren(_ context.Context, params *organizations.ListChildrenInput, _ ...func(*organizations.Options)) (*organizations.ListChildrenOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	parentID := aws.ToString(params.ParentId)
+	if !o.exists(parentID) {
+		return nil, &types.ParentNotFoundException{Message: aws.String("parent not found: " + parentID)}
+	}
+
+	var children []types.Child
+	for _, child := range o.children[parentID] {
+		if child.Type == params.ChildType {
+			children = append(children, child)
+		}
+	}
+	output := &organizations.ListChildrenOutput{}
+	output.Children, output.NextToken = page(children, params.NextToken, o.PageSize)
+	return output, nil
+}
+
+// ListParents implements awsorg.API.
+func (o *Org) ListParents(_ context.Context, params *organizations.ListParentsInput, _ ...func(*organizations.Options)) (*organizations.ListParentsOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	parentID, ok := o.parents[aws.ToString(params.ChildId)]
+	if !ok {
+		return nil, &types.ChildNotFoundException{Message: aws.String("child not found: " + aws.ToString(params.ChildId))}
+	}
+
+	parentType := types.ParentTypeOrganizationalUnit
+	if parentID == o.rootID {
+		parentType = types.ParentTypeRoot
+	}
+	return &organizations.ListParentsOutput{Parents: []types.Parent{{Id: aws.String(parentID), Type: parentType}}}, nil
+}
+
+// ListPoliciesForTarget implements awsorg.API.
+func (o *Org) ListPoliciesForTarget(_ context.Context, params *organizations.ListPoliciesForTargetInput, _ ...func(*organizations.Options)) (*organizations.ListPoliciesForTargetOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	targetID := aws.ToString(params.TargetId)
+	if !o.exists(targetID) {
+		return nil, &types.TargetNotFoundException{Message: aws.String("target not found: " + targetID)}
+	}
+
+	var policies []types.PolicySummary
+	for _, id := range o.attachments[targetID] {
+		if policy := o.policies[id]; policy.PolicySummary.Type == params.Filter {
+			policies = append(policies, *policy.PolicySummary)
+		}
+	}
+	output := &organizations.ListPoliciesForTargetOutput{}
+	output.Policies, output.NextToken = page(policies, params.NextToken, o.PageSize)
+	return output, nil
+}
+
+// Returns the page of items starting at token (the offset of its first item),
+// along with the token of the next page, nil on the last one.
+func page[T any](items []T, token *string, size int) ([]T, *string) {
+	start, _ := strconv.Atoi(aws.ToString(token))
+	if size <= 0 || start+size >= len(items) {
+		return items[min(start, len(items)):], nil
+	}
+	return items[start : start+size], aws.String(strconv.Itoa(start + size))
+}
+
+// ListPolicies lists the policies of the type of the request.
+func (o *Org) ListPolicies(_ context.Context, params *organizations.ListPoliciesInput, _ ...func(*organizations.Options)) (*organizations.ListPoliciesOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	output := &organizations.ListPoliciesOutput{}
+	for _, id := range sortedKeys(o.policies) {
+		if policy := o.policies[id]; policy.PolicySummary.Type == params.Filter {
+			output.Policies = append(output.Policies, *policy.PolicySummary)
+		}
+	}
+	return output, nil
+}
+
+// DescribePolicy returns the policy, along with its document.
+func (o *Org) DescribePolicy(_ context.Context, params *organizations.DescribePolicyInput, _ ...func(*organizations.Options)) (*organizations.DescribePolicyOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	policy, ok := o.policies[aws.ToString(params.PolicyId)]
+	if !ok {
+		return nil, &types.PolicyNotFoundException{Message: aws.String("policy not found: " + aws.ToString(params.PolicyId))}
+	}
+	return &organizations.DescribePolicyOutput{Policy: &policy}, nil
+}
+
+// ListTargetsForPolicy lists where a policy is directly attached.
+func (o *Org) ListTargetsForPolicy(_ context.Context, params *organizations.ListTargetsForPolicyInput, _ ...func(*organizations.Options)) (*organizations.ListTargetsForPolicyOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	policyID := aws.ToString(params.PolicyId)
+	if _, ok := o.policies[policyID]; !ok {
+		return nil, &types.PolicyNotFoundException{Message: aws.String("policy not found: " + policyID)}
+	}
+
+	output := &organizations.ListTargetsForPolicyOutput{}
+	for _, targetID := range sortedKeys(o.attachments) {
+		for _, id := range o.attachments[targetID] {
+			if id == policyID {
+				output.Targets = append(output.Targets, o.target(targetID))
+			}
+		}
+	}
+	return output, nil
+}
+
+func (o *Org) target(id string) types.PolicyTargetSummary {
+	target := types.PolicyTargetSummary{TargetId: aws.String(id)}
+	switch {
+	case id == o.rootID:
+		target.Type, target.Name = types.TargetTypeRoot, aws.String("Root")
+	case o.ous[id].Name != nil:
+		target.Type, target.Name = types.TargetTypeOrganizationalUnit, o.ous[id].Name
+	default:
+		target.Type, target.Name = types.TargetTypeAccount, o.accounts[id].Name
+	}
+	return target
+}
+
+// DescribeEffectivePolicy never finds an effective policy, merging policies
+// the way Organizations does is out of the scope of the fake.
+func (o *Org) DescribeEffectivePolicy(_ context.Context, params *organizations.DescribeEffectivePolicyInput, _ ...func(*organizations.Options)) (*organizations.DescribeEffectivePolicyOutput, error) {
+	return nil, &types.EffectivePolicyNotFoundException{Message: aws.String("no effective policy for " + aws.ToString(params.TargetId))}
+}
+
+// ListTagsForResource lists the tags set with TagResource.
+func (o *Org) ListTagsForResource(_ context.Context, params *organizations.ListTagsForResourceInput, _ ...func(*organizations.Options)) (*organizations.ListTagsForResourceOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := aws.ToString(params.ResourceId)
+	if !o.exists(id) {
+		return nil, &types.TargetNotFoundException{Message: aws.String("resource not found: " + id)}
+	}
+
+	output := &organizations.ListTagsForResourceOutput{}
+	for _, key := range sortedKeys(o.tags[id]) {
+		output.Tags = append(output.Tags, types.Tag{Key: aws.String(key), Value: aws.String(o.tags[id][key])})
+	}
+	return output, nil
+}
+
+// ListAWSServiceAccessForOrganization lists no trusted service.
+func (o *Org) ListAWSServiceAccessForOrganization(_ context.Context, _ *organizations.ListAWSServiceAccessForOrganizationInput, _ ...func(*organizations.Options)) (*organizations.ListAWSServiceAccessForOrganizationOutput, error) {
+	return &organizations.ListAWSServiceAccessForOrganizationOutput{}, nil
+}
+
+// ListDelegatedAdministrators lists no delegated administrator.
+func (o *Org) ListDelegatedAdministrators(_ context.Context, _ *organizations.ListDelegatedAdministratorsInput, _ ...func(*organizations.Options)) (*organizations.ListDelegatedAdministratorsOutput, error) {
+	return &organizations.ListDelegatedAdministratorsOutput{}, nil
+}
+
+// ListDelegatedServicesForAccount fails like for an account that isn't a
+// delegated administrator, there are none in the fake.
+func (o *Org) ListDelegatedServicesForAccount(_ context.Context, params *organizations.ListDelegatedServicesForAccountInput, _ ...func(*organizations.Options)) (*organizations.ListDelegatedServicesForAccountOutput, error) {
+	return nil, &types.AccountNotRegisteredException{Message: aws.String(aws.ToString(params.AccountId) + " is not a delegated administrator")}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}